@@ -1,14 +1,24 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 
+	"github.com/andybalholm/cascadia"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	Server struct {
-		Port int `yaml:"port"`
+		Port        int    `yaml:"port"`
+		APIKey      string `yaml:"api_key"`       // Required via X-API-Key on /embed; unset disables it
+		AdminAPIKey string `yaml:"admin_api_key"` // Required via X-API-Key on /ingest and /admin; unset disables them
+
+		ShutdownGracePeriod int `yaml:"shutdown_grace_period"` // Seconds to wait for in-flight requests and ingestion on shutdown (default 30)
 	} `yaml:"server"`
 
 	Qdrant QdrantConfig `yaml:"qdrant"`
@@ -16,28 +26,362 @@ type Config struct {
 	Ollama OllamaConfig `yaml:"ollama"`
 
 	RAG RAGConfig `yaml:"rag"`
+
+	Personas map[string]PersonaConfig `yaml:"personas"` // Keyed by the name chat requests select
+
+	Roles map[string][]string `yaml:"roles"` // Recommendation formulas keyed by ?role=: base stats summed, "Attack|SpAttack" taking the higher (empty = tank and sweeper)
+
+	Ingest IngestConfig `yaml:"ingest"`
+
+	KB KBConfig `yaml:"kb"`
+
+	AnswerCache AnswerCacheConfig `yaml:"answer_cache"`
+
+	Crawler CrawlerConfig `yaml:"crawler"`
 }
 
 type QdrantConfig struct {
 	Host       string `yaml:"host"`
 	Port       int    `yaml:"port"`
 	Collection string `yaml:"collection"`
+
+	ReadConsistency string `yaml:"read_consistency"` // "all" | "majority" | "quorum" | a node count; empty uses the server default
+
+	CollectionPerModel bool `yaml:"collection_per_model"` // Suffix the collection with embedding model and dimension
+
+	RecreateMissingCollection bool `yaml:"recreate_missing_collection"` // Recreate the collection (empty) if it is deleted while running, instead of failing requests
+
+	Alias string `yaml:"alias"` // Search and store through this alias; ingests fill a shadow copy and swap the alias to it on success (empty = use the collection directly)
 }
 
 type OllamaConfig struct {
 	BaseURL        string `yaml:"base_url"`
 	ChatModel      string `yaml:"chat_model"`
 	EmbeddingModel string `yaml:"embedding_model"`
+
+	EmbeddingDimension int `yaml:"embedding_dimension"` // Vector size produced by EmbeddingModel (default 768)
+	EmbeddingRetries   int `yaml:"embedding_retries"`   // Per-input retries when an embedding comes back malformed
+
+	AllowedEmbeddingModels []string `yaml:"allowed_embedding_models"` // Models a chat may pick with "embedding_model"; must match embedding_dimension (empty = no overrides)
+
+	StopSequences []string `yaml:"stop_sequences"` // Generation halts at any of these (e.g. a fabricated "Human:" turn)
+	Seed          *int     `yaml:"seed"`           // Fixed sampling seed for reproducible answers (unset = random)
+
+	EmbedTimeout    int `yaml:"embed_timeout"`    // Seconds per embedding call (default 30)
+	GenerateTimeout int `yaml:"generate_timeout"` // Seconds per generation call (default 120)
+
+	BreakerThreshold int `yaml:"breaker_threshold"` // Consecutive failed calls before Ollama calls fail fast (0 disables the breaker)
+	BreakerCooldown  int `yaml:"breaker_cooldown"`  // Seconds to fail fast before probing Ollama again (default 30)
+
+	RequireOnStartup bool `yaml:"require_on_startup"` // Exit at startup if Ollama or its models are unavailable (default: warn only)
+}
+
+// Dimension returns the configured embedding dimension, defaulting to nomic-embed-text's 768
+func (oc *OllamaConfig) Dimension() int {
+	if oc.EmbeddingDimension <= 0 {
+		return 768
+	}
+	return oc.EmbeddingDimension
 }
 
 type RAGConfig struct {
-	ChunkSize            int `yaml:"chunk_size"`
-	ChunkOverlap         int `yaml:"chunk_overlap"`
-	TopK                 int `yaml:"top_k"`
+	ChunkSize            int `yaml:"chunk_size"`    // Characters per chunk (default 800)
+	ChunkOverlap         int `yaml:"chunk_overlap"` // Characters shared by adjacent chunks, less than chunk_size (default 100)
+	TopK                 int `yaml:"top_k"`         // Chunks retrieved per chat (default 5)
+	MaxTopK              int `yaml:"max_top_k"`     // Upper bound for per-request top_k overrides (default 20)
+	MinResults           int `yaml:"min_results"`   // Relax threshold/filters until at least this many results (0 disables)
 	MaxConversationTurns int `yaml:"max_conversation_turns"`
 	MaxTotalTokens       int `yaml:"max_total_tokens"`
 	MaxHistoryTurns      int `yaml:"max_history_turns"`
-	MaxContextTokens     int `yaml:"max_context_tokens"`
+	MaxContextTokens     int `yaml:"max_context_tokens"`  // Token budget for the whole prompt (default 4000)
+	ReferentTokens       int `yaml:"referent_tokens"`     // Allowance for keeping a trimmed message naming the Pokemon a follow-up's "it" refers to (0 disables)
+	KnowledgeIndexTTL    int `yaml:"knowledge_index_ttl"` // Seconds between knowledge index refreshes (0 = only on ingest)
+
+	DedupHistory bool `yaml:"dedup_history"` // Collapse consecutive identical history messages (double submits) before trimming
+
+	QueryEmbedPrefix    string `yaml:"query_embed_prefix"`    // Prepended to chat queries before embedding (e.g. "query: " for e5)
+	DocumentEmbedPrefix string `yaml:"document_embed_prefix"` // Prepended to ingested chunks before embedding (e.g. "passage: " for e5)
+
+	MinChunkTokens int `yaml:"min_chunk_tokens"` // Dry runs warn about chunks with fewer tokens (default 20)
+	MaxChunkTokens int `yaml:"max_chunk_tokens"` // Dry runs warn about chunks with more tokens (default 512)
+
+	EmbedConcurrency int `yaml:"embed_concurrency"` // Embedding requests in flight per ingested document or re-embed batch (default 1 = one request)
+
+	TokenSafetyMargin float64 `yaml:"token_safety_margin"` // Fraction of max_context_tokens left unused in case counts run low (0 = none, or 0.15 without tiktoken)
+
+	ScoreThreshold    float32 `yaml:"score_threshold"`    // Minimum similarity score for retrieved chunks (0 disables)
+	CitationThreshold float32 `yaml:"citation_threshold"` // Minimum best-chunk score for a Pokemon to be cited in sources (0 cites all)
+	MaxCitedSources   int     `yaml:"max_cited_sources"`  // Cite at most this many Pokemon, by best-chunk score (0 = no limit)
+	InlineCitations   bool    `yaml:"inline_citations"`   // Append a "Sources: [1] ..." footer matching the numbered context entries
+
+	LowConfidenceScore float32 `yaml:"low_confidence_score"` // Hedge answers whose best chunk scored below this and set low_confidence (0 disables)
+
+	MinQueryWords int `yaml:"min_query_words"` // Shorter questions are expanded into a sentence before embedding ("Mew" -> "Tell me about the Pokemon Mew"); 0 disables
+
+	KeywordFallback bool `yaml:"keyword_fallback"` // Answer from a full-text search of chunk content, flagged degraded, when the question can't be embedded
+
+	ComparisonIntent bool `yaml:"comparison_intent"` // For questions comparing two named Pokemon, keep both Base Stats chunks in the context ahead of any truncation
+
+	QueryExpansion bool `yaml:"query_expansion"` // Also search with rewrites of the question and fuse the results (RRF)
+	QueryVariants  int  `yaml:"query_variants"`  // Rewrites searched when QueryExpansion is on (default 2, max 4)
+
+	RecencyBoost       string  `yaml:"recency_boost"`        // "none" | "newer_first" | "older_first": favor results by generation (default none)
+	RecencyBoostWeight float32 `yaml:"recency_boost_weight"` // Score bonus for the most favored generation (default 0.05)
+
+	LogPrompts         bool `yaml:"log_prompts"`           // Log the final prompt sent to the model (may contain user data)
+	LogPromptMaxLength int  `yaml:"log_prompt_max_length"` // Truncate logged prompts to this many characters (0 = no limit)
+
+	ResponseLanguage string `yaml:"response_language"` // Language answers are written in (default English)
+	ReadingLevel     string `yaml:"reading_level"`     // "normal" | "kid_friendly" | "expert" (default normal)
+	ResponseFormat   string `yaml:"response_format"`   // "markdown" | "plain" (default markdown)
+	DefaultPersona   string `yaml:"default_persona"`   // Persona used when a chat request names none (default "default")
+
+	TargetResponseTokens int `yaml:"target_response_tokens"` // Ask for answers of about this many tokens, capping num_predict at 1.5x (0 = no target)
+
+	StructuredFormat string `yaml:"structured_format"` // How format "json" chats constrain Ollama: "schema" (JSON schema, Ollama 0.5+) | "json" (default schema)
+
+	EmptyResponseFallback string `yaml:"empty_response_fallback"` // Answer sent when the model returns no text twice in a row
+
+	Multimodal bool `yaml:"multimodal"` // Attach retrieved Pokemon's artwork to generate requests when the chat model supports vision
+	MaxImages  int  `yaml:"max_images"` // Images attached per chat when multimodal (default 2)
+
+	VerifyStats string `yaml:"verify_stats"` // "off" | "flag" | "caveat": check stat numbers in answers against the retrieved context (default off)
+
+	MaxWordLength int `yaml:"max_word_length"` // Reject chat messages containing a longer unbroken word (default 100)
+}
+
+// applyDefaults fills the chunking, retrieval and prompt budget settings a
+// sparse config leaves at zero, which would otherwise split text into
+// single characters or search for nothing
+func (rc *RAGConfig) applyDefaults() {
+	if rc.ChunkSize <= 0 {
+		rc.ChunkSize = 800
+	}
+	if rc.ChunkOverlap == 0 {
+		rc.ChunkOverlap = min(100, rc.ChunkSize/2) // Small chunk sizes still get a valid overlap
+	}
+	if rc.TopK <= 0 {
+		rc.TopK = 5
+	}
+	if rc.MaxContextTokens <= 0 {
+		rc.MaxContextTokens = 4000
+	}
+	if rc.MaxWordLength <= 0 {
+		rc.MaxWordLength = 100
+	}
+}
+
+// Validate checks that chunks overlap by less than their size, so each chunk
+// moves the splitter forward
+func (rc *RAGConfig) Validate() error {
+	if rc.ChunkOverlap < 0 {
+		return fmt.Errorf("rag.chunk_overlap must not be negative, got %d", rc.ChunkOverlap)
+	}
+	if rc.ChunkOverlap >= rc.ChunkSize {
+		return fmt.Errorf("rag.chunk_overlap (%d) must be less than rag.chunk_size (%d)", rc.ChunkOverlap, rc.ChunkSize)
+	}
+
+	return nil
+}
+
+// PersonaConfig defines a selectable bot persona. Unset fields fall back to
+// the built-in assistant.
+type PersonaConfig struct {
+	SystemPrompt string  `yaml:"system_prompt"`
+	Instruction  string  `yaml:"instruction"` // Extra instruction, e.g. which Pokemon data to emphasize
+	Temperature  float64 `yaml:"temperature"` // Default 0.3
+}
+
+type IngestConfig struct {
+	IdempotencyTTL         int `yaml:"idempotency_ttl"`           // Seconds an Idempotency-Key is remembered after the job finishes (default 3600)
+	RetryDelay             int `yaml:"retry_delay"`               // Seconds between retries of Pokemon that failed in the main pass (default 5)
+	RetryBudget            int `yaml:"retry_budget"`              // Retries per Pokemon across embedding re-requests and the retry pass (0 = no limit)
+	RetryBudgetTime        int `yaml:"retry_budget_time"`         // Seconds from a Pokemon's first attempt after which no retry starts (0 = no limit)
+	RelatedPokemonLimit    int `yaml:"related_pokemon_limit"`     // Max same_type_neighbors stored per Pokemon (0 disables)
+	MaxMetadataValueLength int `yaml:"max_metadata_value_length"` // Longer metadata values are truncated on upsert (default 1024)
+
+	ContentTemplate string `yaml:"content_template"` // Go text/template rendering each crawled Pokemon as the text to embed (empty = built-in layout)
+
+	DedupContent        bool `yaml:"dedup_content"`         // Skip chunks whose normalized content is already stored
+	DedupCrawlList      bool `yaml:"dedup_crawl_list"`      // Drop already stored Pokemon from the listed URLs before crawl_limit applies
+	StripSectionHeaders bool `yaml:"strip_section_headers"` // Drop "=== Section ===" headers from embedded text (stored content keeps them)
+}
+
+// KBConfig scopes the knowledge base to a curated subset of Pokemon
+type KBConfig struct {
+	PokemonAllowlist  []string `yaml:"pokemon_allowlist"`   // Names ("Bulbasaur", "mr-mime") or national numbers ("1", "0004"); empty allows all
+	MaxTotalDocuments int      `yaml:"max_total_documents"` // Ingest refuses to grow the collection past this many documents (0 = no limit)
+	MaxConcurrentJobs int      `yaml:"max_concurrent_jobs"` // Ingest jobs allowed to run at once (default 1)
+
+	Crawler KBCrawlerConfig `yaml:"crawler"`
+}
+
+// KBCrawlerConfig bounds how long filling the knowledge base may take
+type KBCrawlerConfig struct {
+	JobTimeout int `yaml:"job_timeout"` // Seconds before a whole ingest job (crawl, embed and upsert) is stopped (0 = no limit)
+}
+
+// Validate checks each allowlist entry is a plausible Pokemon name or national number
+func (kc *KBConfig) Validate() error {
+	for _, entry := range kc.PokemonAllowlist {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			return errors.New("kb.pokemon_allowlist contains an empty entry")
+		}
+
+		if number, err := strconv.Atoi(entry); err == nil {
+			if number < 1 || number > 1025 {
+				return fmt.Errorf("kb.pokemon_allowlist number %q is out of range (1-1025)", entry)
+			}
+			continue
+		}
+
+		if !pokemonNamePattern.MatchString(entry) {
+			return fmt.Errorf("kb.pokemon_allowlist entry %q is not a valid Pokemon name or number", entry)
+		}
+	}
+
+	return nil
+}
+
+// pokemonNamePattern allows names like "Farfetch'd", "Mr. Mime", "Nidoran♀" and "porygon-z"
+var pokemonNamePattern = regexp.MustCompile(`^[\p{L}][\p{L}0-9 .'’:♀♂-]*$`)
+
+type AnswerCacheConfig struct {
+	Enabled             bool    `yaml:"enabled"`
+	MaxEntries          int     `yaml:"max_entries"`          // Default 500
+	TTL                 int     `yaml:"ttl"`                  // Seconds a cached answer stays valid (default 3600)
+	SemanticMatch       bool    `yaml:"semantic_match"`       // Reuse answers for paraphrased questions
+	SimilarityThreshold float32 `yaml:"similarity_threshold"` // Minimum cosine similarity for a semantic hit (default 0.97)
+	RefreshOnBypass     bool    `yaml:"refresh_on_bypass"`    // Store the fresh answer of a no-cache chat, replacing the cached one
+}
+
+type CrawlerConfig struct {
+	Selectors SelectorConfig `yaml:"selectors"`
+
+	BackoffMinMS int `yaml:"backoff_min_ms"` // First extra delay after a 429 response (default 1000)
+	BackoffMaxMS int `yaml:"backoff_max_ms"` // Upper bound for the extra delay (default 60000)
+
+	ListPages       []string `yaml:"list_pages"`       // Index pages whose Pokemon links are aggregated, in order (default national dex)
+	ListConcurrency int      `yaml:"list_concurrency"` // List pages fetched at once, still subject to the rate limit (default 1)
+	ListCacheTTL    int      `yaml:"list_cache_ttl"`   // Seconds to reuse the crawled URL list (0 = always re-crawl)
+	ListCachePath   string   `yaml:"list_cache_path"`  // File the URL list is persisted to across restarts (empty = memory only)
+
+	DenyPatterns []string `yaml:"deny_patterns"` // Regular expressions; URLs matching any of them are never visited (e.g. "/sprites/")
+}
+
+// Validate checks the selectors and that every deny pattern compiles
+func (cc *CrawlerConfig) Validate() error {
+	if err := cc.Selectors.Validate(); err != nil {
+		return err
+	}
+
+	for _, pattern := range cc.DenyPatterns {
+		if strings.TrimSpace(pattern) == "" {
+			return errors.New("crawler.deny_patterns contains an empty pattern")
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid crawler deny pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// SelectorConfig holds the CSS selectors used to scrape pokemondb.net, so a
+// layout change can be patched in config without recompiling
+type SelectorConfig struct {
+	PokemonList         string `yaml:"pokemon_list"`         // Each Pokemon card on the national dex page
+	PokemonLink         string `yaml:"pokemon_link"`         // Detail page link within a card
+	Name                string `yaml:"name"`                 // Pokemon name heading (only the first match is used)
+	VitalsTable         string `yaml:"vitals_table"`         // Pokedex data table body (number, type, species...)
+	Stats               string `yaml:"stats"`                // Base stats container
+	Description         string `yaml:"description"`          // Pokedex entries table body
+	DescriptionFallback string `yaml:"description_fallback"` // Tried when the description selector yields something that isn't prose
+	TypeDefenses        string `yaml:"type_defenses"`        // Type defenses container
+	Evolutions          string `yaml:"evolutions"`           // Evolution chain container
+	Image               string `yaml:"image"`                // Artwork <img>, for multimodal chats (only the first match is used)
+}
+
+func DefaultSelectorConfig() SelectorConfig {
+	return SelectorConfig{
+		PokemonList:         "div.infocard-list-pkmn-lg > div.infocard",
+		PokemonLink:         "span.infocard-lg-img a",
+		Name:                "main > h1",
+		VitalsTable:         "table.vitals-table tbody",
+		Stats:               "div.resp-scroll",
+		Description:         "div.grid-col:has(h2:contains('Pokédex entries')) table tbody",
+		DescriptionFallback: "h2:contains('Pokédex entries') + div.resp-scroll table tbody",
+		TypeDefenses:        "div.grid-col:has(h2:contains('Type defenses'))",
+		Evolutions:          "div.infocard-list-evo",
+		Image:               "a[rel='lightbox'] img",
+	}
+}
+
+func (cc *CrawlerConfig) applyDefaults() {
+	if cc.BackoffMinMS <= 0 {
+		cc.BackoffMinMS = 1000
+	}
+	if cc.BackoffMaxMS < cc.BackoffMinMS {
+		cc.BackoffMaxMS = max(60000, cc.BackoffMinMS)
+	}
+	if len(cc.ListPages) == 0 {
+		cc.ListPages = []string{"/pokedex/national"}
+	}
+	if cc.ListConcurrency <= 0 {
+		cc.ListConcurrency = 1
+	}
+
+	cc.Selectors.applyDefaults()
+}
+
+// applyDefaults fills unset selectors with the built-in pokemondb values
+func (sc *SelectorConfig) applyDefaults() {
+	defaults := DefaultSelectorConfig()
+	for _, f := range []struct {
+		value    *string
+		fallback string
+	}{
+		{&sc.PokemonList, defaults.PokemonList},
+		{&sc.PokemonLink, defaults.PokemonLink},
+		{&sc.Name, defaults.Name},
+		{&sc.VitalsTable, defaults.VitalsTable},
+		{&sc.Stats, defaults.Stats},
+		{&sc.Description, defaults.Description},
+		{&sc.DescriptionFallback, defaults.DescriptionFallback},
+		{&sc.TypeDefenses, defaults.TypeDefenses},
+		{&sc.Evolutions, defaults.Evolutions},
+		{&sc.Image, defaults.Image},
+	} {
+		if *f.value == "" {
+			*f.value = f.fallback
+		}
+	}
+}
+
+// Validate checks that every selector is set and parses as CSS
+func (sc *SelectorConfig) Validate() error {
+	for name, selector := range map[string]string{
+		"pokemon_list":         sc.PokemonList,
+		"pokemon_link":         sc.PokemonLink,
+		"name":                 sc.Name,
+		"vitals_table":         sc.VitalsTable,
+		"stats":                sc.Stats,
+		"description":          sc.Description,
+		"description_fallback": sc.DescriptionFallback,
+		"type_defenses":        sc.TypeDefenses,
+		"evolutions":           sc.Evolutions,
+		"image":                sc.Image,
+	} {
+		if selector == "" {
+			return fmt.Errorf("crawler selector %s is required", name)
+		}
+		if _, err := cascadia.Compile(selector); err != nil {
+			return fmt.Errorf("invalid crawler selector %s %q: %w", name, selector, err)
+		}
+	}
+
+	return nil
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -51,5 +395,20 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	cfg.Crawler.applyDefaults()
+	if err = cfg.Crawler.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Qdrant.Alias != "" && cfg.KB.MaxConcurrentJobs > 1 {
+		return nil, errors.New("qdrant.alias requires kb.max_concurrent_jobs of 1, as concurrent shadow ingests would overwrite each other")
+	}
+	cfg.RAG.applyDefaults()
+	if err = cfg.RAG.Validate(); err != nil {
+		return nil, err
+	}
+	if err = cfg.KB.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
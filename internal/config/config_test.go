@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestKBConfigValidatesAllowlist(t *testing.T) {
+	tests := []struct {
+		entry string
+		valid bool
+	}{
+		{"Bulbasaur", true},
+		{"mr-mime", true},
+		{"Mr. Mime", true},
+		{"0004", true},
+		{"1025", true},
+		{"", false},
+		{"0", false},
+		{"1026", false},
+		{"pika<script>", false},
+	}
+
+	for _, tt := range tests {
+		kc := KBConfig{PokemonAllowlist: []string{tt.entry}}
+		if err := kc.Validate(); (err == nil) != tt.valid {
+			t.Errorf("entry %q: Validate() = %v, want valid %t", tt.entry, err, tt.valid)
+		}
+	}
+}
+
+func TestCrawlerConfigValidatesDenyPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"/sprites/", true},
+		{`/pokedex/stats(/|$)`, true},
+		{"", false},
+		{"  ", false},
+		{"/sprites/(", false},
+	}
+
+	for _, tt := range tests {
+		cc := CrawlerConfig{Selectors: DefaultSelectorConfig(), DenyPatterns: []string{tt.pattern}}
+		if err := cc.Validate(); (err == nil) != tt.valid {
+			t.Errorf("pattern %q: Validate() = %v, want valid %t", tt.pattern, err, tt.valid)
+		}
+	}
+}
+
+// loadConfigText loads a config file with the given contents
+func loadConfigText(t *testing.T, text string) (*Config, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfig(path)
+}
+
+const minimalConfig = "qdrant:\n  collection: pokemons\nollama:\n  chat_model: test-chat\n  embedding_model: test-embed\n"
+
+func TestLoadConfigDefaultsRAGSizes(t *testing.T) {
+	cfg, err := loadConfigText(t, minimalConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []int{cfg.RAG.ChunkSize, cfg.RAG.ChunkOverlap, cfg.RAG.TopK, cfg.RAG.MaxContextTokens}
+	if want := []int{800, 100, 5, 4000}; !slices.Equal(got, want) {
+		t.Errorf("chunk_size, chunk_overlap, top_k, max_context_tokens = %v, want %v", got, want)
+	}
+
+	// Explicit values are kept, and a small chunk size gets an overlap that fits
+	cfg, err = loadConfigText(t, minimalConfig+"rag:\n  chunk_size: 120\n  top_k: 8\n  max_context_tokens: 2000\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = []int{cfg.RAG.ChunkSize, cfg.RAG.ChunkOverlap, cfg.RAG.TopK, cfg.RAG.MaxContextTokens}
+	if want := []int{120, 60, 8, 2000}; !slices.Equal(got, want) {
+		t.Errorf("chunk_size, chunk_overlap, top_k, max_context_tokens = %v, want %v", got, want)
+	}
+}
+
+func TestLoadConfigRejectsChunkOverlap(t *testing.T) {
+	for _, rag := range []string{
+		"rag:\n  chunk_size: 200\n  chunk_overlap: 200\n",
+		"rag:\n  chunk_size: 200\n  chunk_overlap: 300\n",
+		"rag:\n  chunk_overlap: -1\n",
+	} {
+		if _, err := loadConfigText(t, minimalConfig+rag); err == nil {
+			t.Errorf("config %q was accepted", rag)
+		}
+	}
+}
+
+func TestLoadConfigReadsKBCrawlerJobTimeout(t *testing.T) {
+	cfg, err := loadConfigText(t, minimalConfig+"kb:\n  crawler:\n    job_timeout: 90\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.KB.Crawler.JobTimeout != 90 {
+		t.Errorf("kb.crawler.job_timeout = %d, want 90", cfg.KB.Crawler.JobTimeout)
+	}
+}
@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// successesBeforeRelax is how many consecutive successful responses halve the backoff
+const successesBeforeRelax = 10
+
+// adaptiveBackoff adds an extra delay before each request on top of the
+// collector's LimitRule. It grows when the site answers 429 Too Many Requests
+// and relaxes after sustained success, bounded by [min, max].
+type adaptiveBackoff struct {
+	mu            sync.Mutex
+	current       time.Duration
+	min           time.Duration
+	max           time.Duration
+	successStreak int
+}
+
+func newAdaptiveBackoff(min, max time.Duration) *adaptiveBackoff {
+	return &adaptiveBackoff{min: min, max: max}
+}
+
+// attach registers the backoff callbacks on c. Clones don't inherit
+// callbacks, so this must be called for every collector that makes requests.
+func (b *adaptiveBackoff) attach(c *colly.Collector) {
+	c.OnRequest(func(r *colly.Request) {
+		if delay := b.delay(); delay > 0 {
+			time.Sleep(delay)
+		}
+	})
+
+	c.OnResponse(func(r *colly.Response) {
+		b.onSuccess()
+	})
+
+	c.OnError(func(r *colly.Response, err error) {
+		if r.StatusCode == http.StatusTooManyRequests {
+			b.onTooManyRequests()
+		}
+	})
+}
+
+func (b *adaptiveBackoff) delay() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.current
+}
+
+func (b *adaptiveBackoff) onTooManyRequests() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.successStreak = 0
+	b.current = min(max(b.current*2, b.min), b.max)
+
+	log.Printf("Received 429 Too Many Requests, crawl backoff increased to %s", b.current)
+}
+
+func (b *adaptiveBackoff) onSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.current == 0 {
+		return
+	}
+
+	b.successStreak++
+	if b.successStreak < successesBeforeRelax {
+		return
+	}
+
+	b.successStreak = 0
+	b.current /= 2
+	if b.current < b.min {
+		b.current = 0
+	}
+
+	log.Printf("Crawl backoff relaxed to %s", b.current)
+}
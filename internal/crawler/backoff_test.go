@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestAdaptiveBackoffGrowsAndRelaxes(t *testing.T) {
+	b := newAdaptiveBackoff(time.Second, 5*time.Second)
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		b.onTooManyRequests()
+		if got := b.delay(); got != want {
+			t.Fatalf("delay after 429 = %s, want %s", got, want)
+		}
+	}
+
+	// A success streak halves it; a 429 mid-streak starts the count over
+	for range successesBeforeRelax - 1 {
+		b.onSuccess()
+	}
+	if got := b.delay(); got != 5*time.Second {
+		t.Fatalf("delay relaxed to %s before %d successes", got, successesBeforeRelax)
+	}
+	b.onSuccess()
+	if got := b.delay(); got != 2500*time.Millisecond {
+		t.Fatalf("delay after %d successes = %s, want 2.5s", successesBeforeRelax, got)
+	}
+
+	// Halving below the minimum drops the extra delay entirely
+	for range 2 * successesBeforeRelax {
+		b.onSuccess()
+	}
+	if got := b.delay(); got != 0 {
+		t.Errorf("delay after sustained success = %s, want 0", got)
+	}
+}
+
+func TestCrawlerBacksOffOnTooManyRequests(t *testing.T) {
+	original := http.DefaultTransport
+	http.DefaultTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     make(http.Header),
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	})
+	t.Cleanup(func() { http.DefaultTransport = original })
+
+	pc := NewPokemonDBCrawler(config.CrawlerConfig{
+		Selectors:    config.DefaultSelectorConfig(),
+		BackoffMinMS: 10,
+		BackoffMaxMS: 30,
+	})
+
+	var delays []time.Duration
+	for range 3 {
+		if _, err := pc.CrawlPokemonDetails(context.Background(), "https://pokemondb.net/pokedex/pikachu"); err == nil {
+			t.Fatal("crawl succeeded despite 429")
+		}
+		delays = append(delays, pc.backoff.delay())
+	}
+
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Fatalf("effective delays after consecutive 429s = %v, want %v", delays, want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// DefaultContentTemplate is the built-in layout of the text that gets chunked
+// and embedded for each Pokemon. Section headers ("=== Base Stats ===") are
+// what chunk section tags and ingest.strip_section_headers look for, so
+// custom templates should keep that form.
+const DefaultContentTemplate = `Pokemon: {{.Name}}{{if .Number}} (#{{.Number}}){{end}}
+
+=== Basic Information ===
+{{if .Types}}Type: {{join .Types ", "}}
+{{end}}{{if .Category}}Category: {{.Category}}
+{{end}}{{if .Height}}Height: {{.Height}}
+{{end}}{{if .Weight}}Weight: {{.Weight}}
+{{end}}
+{{if .Description}}=== Description ===
+{{.Description}}
+
+{{end}}{{if or .Abilities .HiddenAbilities}}=== Abilities ===
+{{if .Abilities}}{{join .Abilities ", "}}
+{{end}}{{if .HiddenAbilities}}Hidden Ability: {{join .HiddenAbilities ", "}}
+{{end}}
+{{end}}{{if .Stats}}=== Base Stats ===
+{{with index .Stats "HP"}}HP: {{.}}
+{{end}}{{with index .Stats "Attack"}}Attack: {{.}}
+{{end}}{{with index .Stats "Defense"}}Defense: {{.}}
+{{end}}{{with index .Stats "SpAttack"}}Special Attack: {{.}}
+{{end}}{{with index .Stats "SpDefense"}}Special Defense: {{.}}
+{{end}}{{with index .Stats "Speed"}}Speed: {{.}}
+{{end}}{{with index .Stats "Total"}}Total: {{.}}
+{{end}}
+{{end}}{{if or .WeakAgainst .StrongAgainst}}=== Type Effectiveness ===
+{{if .WeakAgainst}}Weak against: {{join .WeakAgainst ", "}}
+{{end}}{{if .StrongAgainst}}Strong against: {{join .StrongAgainst ", "}}
+{{end}}
+{{end}}{{if .Evolutions}}=== Evolution Chain ===
+Evolves to/from: {{join .Evolutions " → "}}
+
+{{end}}=== Quick Facts ===
+- {{.Name}} is a {{join .Types "/"}} type Pokemon
+{{with highestStat .Stats}}- Highest stat: {{.Name}} ({{.Value}})
+{{end}}{{if and (gt .HeightM 0.0) (gt .WeightKg 0.0)}}- Size: {{measurement .HeightM}} m tall, weighs {{measurement .WeightKg}} kg
+{{end}}{{if .Abilities}}- Primary ability: {{index .Abilities 0}}
+{{end}}{{if .HiddenAbilities}}- Hidden ability: {{join .HiddenAbilities ", "}}
+{{end}}`
+
+// contentTemplateFuncs are available to content templates besides the builtins
+var contentTemplateFuncs = template.FuncMap{
+	// join lists values: {{join .Types ", "}}
+	"join": func(values []string, sep string) string { return strings.Join(values, sep) },
+	// measurement renders a metric value without trailing zeros: {{measurement .HeightM}}
+	"measurement": formatMeasurement,
+	// highestStat returns the highest base stat's Name and Value, or nil without stats
+	"highestStat": highestStat,
+}
+
+// ContentFormatter renders PokemonData with a content template
+type ContentFormatter struct {
+	tmpl *template.Template
+}
+
+// NewContentFormatter parses text as a content template, using
+// DefaultContentTemplate when text is empty. The template is test-rendered
+// against sample data so mistakes such as unknown fields surface at startup
+// rather than on the first ingest.
+func NewContentFormatter(text string) (*ContentFormatter, error) {
+	if strings.TrimSpace(text) == "" {
+		text = DefaultContentTemplate
+	}
+
+	tmpl, err := template.New("content").Funcs(contentTemplateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content template: %w", err)
+	}
+
+	formatter := &ContentFormatter{tmpl: tmpl}
+	if _, err := formatter.Format(&samplePokemon); err != nil {
+		return nil, err
+	}
+
+	return formatter, nil
+}
+
+// Format renders pokemon as the text that gets chunked and embedded
+func (f *ContentFormatter) Format(pokemon *PokemonData) (string, error) {
+	var sb strings.Builder
+	if err := f.tmpl.Execute(&sb, pokemon); err != nil {
+		return "", fmt.Errorf("failed to render content template: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// statOrder is the order base stats are listed in-game, excluding Total
+var statOrder = []string{"HP", "Attack", "Defense", "SpAttack", "SpDefense", "Speed"}
+
+// statValue is a named base stat, as returned by highestStat
+type statValue struct {
+	Name  string
+	Value int
+}
+
+// highestStat walks statOrder so ties always resolve to the same stat and
+// re-ingests produce identical text
+func highestStat(stats map[string]int) *statValue {
+	var best *statValue
+	for _, stat := range statOrder {
+		if value, ok := stats[stat]; ok && value > 0 && (best == nil || value > best.Value) {
+			best = &statValue{Name: stat, Value: value}
+		}
+	}
+	return best
+}
+
+// samplePokemon fills every field so template validation exercises all branches
+var samplePokemon = PokemonData{
+	Name:            "Bulbasaur",
+	Number:          "0001",
+	Types:           []string{"Grass", "Poison"},
+	Stats:           map[string]int{"HP": 45, "Attack": 49, "Defense": 49, "SpAttack": 65, "SpDefense": 65, "Speed": 45, "Total": 318},
+	Abilities:       []string{"Overgrow"},
+	HiddenAbilities: []string{"Chlorophyll"},
+	Description:     "A strange seed was planted on its back at birth.",
+	Height:          "0.7 m (2′04″)",
+	Weight:          "6.9 kg (15.2 lbs)",
+	HeightM:         0.7,
+	WeightKg:        6.9,
+	Category:        "Seed Pokémon",
+	Evolutions:      []string{"Bulbasaur", "Ivysaur", "Venusaur"},
+	WeakAgainst:     []string{"Fire", "Ice", "Flying", "Psychic"},
+	StrongAgainst:   []string{"Water", "Grass", "Electric", "Fighting", "Fairy"},
+	Generation:      1,
+}
@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHighestStatBreaksTiesInStatOrder(t *testing.T) {
+	tests := []struct {
+		stats map[string]int
+		want  string
+	}{
+		{map[string]int{"HP": 50, "Attack": 90, "SpAttack": 90, "Speed": 90, "Total": 320}, "Attack"},
+		{map[string]int{"Speed": 100, "SpDefense": 100, "SpAttack": 100}, "SpAttack"},
+		{map[string]int{"HP": 80, "Defense": 80, "Total": 999}, "HP"}, // Total never counts
+	}
+
+	for _, tt := range tests {
+		// Map iteration order varies between runs, so check repeatedly
+		for range 50 {
+			if got := highestStat(tt.stats); got == nil || got.Name != tt.want {
+				t.Fatalf("highestStat(%v) = %+v, want %s", tt.stats, got, tt.want)
+			}
+		}
+	}
+
+	if got := highestStat(map[string]int{"Total": 300}); got != nil {
+		t.Errorf("highestStat with only a Total = %+v, want nil", got)
+	}
+}
+
+func TestFormatIsStableWithTiedStats(t *testing.T) {
+	formatter, err := NewContentFormatter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pokemon := samplePokemon // SpAttack and SpDefense tie at 65
+	first, err := formatter.Format(&pokemon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(first, "- Highest stat: SpAttack (65)\n") {
+		t.Errorf("formatted text lacks the tie-broken highest stat:\n%s", first)
+	}
+
+	for range 50 {
+		if again, _ := formatter.Format(&pokemon); again != first {
+			t.Fatalf("identical data formatted differently:\n%s\n---\n%s", first, again)
+		}
+	}
+}
+
+func TestCustomContentTemplate(t *testing.T) {
+	formatter, err := NewContentFormatter(`{{.Name}} #{{.Number}}: {{join .Types "/"}}, {{measurement .HeightM}} m{{with highestStat .Stats}}, best {{.Name}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pokemon := samplePokemon
+	got, err := formatter.Format(&pokemon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Bulbasaur #0001: Grass/Poison, 0.7 m, best SpAttack"; got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+}
+
+func TestContentTemplateIsValidatedAtLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"syntax error", "{{.Name"},
+		{"unknown function", "{{shout .Name}}"},
+		{"unknown field", "{{.Nickname}}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewContentFormatter(tt.text); err == nil {
+				t.Errorf("template %q was accepted", tt.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package crawler
+
+import (
+	"errors"
+	"log"
+	"regexp"
+)
+
+// ErrDeniedURL is returned for URLs matching crawler.deny_patterns
+var ErrDeniedURL = errors.New("url matches crawler deny pattern")
+
+// urlDenylist holds the compiled crawler.deny_patterns. Patterns are regular
+// expressions matched anywhere in the full URL, so "/sprites/" denies every
+// sprite page. A nil denylist denies nothing.
+type urlDenylist struct {
+	patterns []*regexp.Regexp
+}
+
+// newURLDenylist compiles patterns, which LoadConfig has already validated;
+// an invalid one is logged and ignored
+func newURLDenylist(patterns []string) *urlDenylist {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	denylist := &urlDenylist{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Printf("Warning: ignoring invalid crawler deny pattern %q: %v", pattern, err)
+			continue
+		}
+		denylist.patterns = append(denylist.patterns, re)
+	}
+
+	return denylist
+}
+
+// match returns the first pattern matching rawURL
+func (denylist *urlDenylist) match(rawURL string) (string, bool) {
+	if denylist == nil {
+		return "", false
+	}
+
+	for _, re := range denylist.patterns {
+		if re.MatchString(rawURL) {
+			return re.String(), true
+		}
+	}
+
+	return "", false
+}
+
+// filter drops and logs the denied URLs
+func (denylist *urlDenylist) filter(urls []string) []string {
+	if denylist == nil {
+		return urls
+	}
+
+	allowed := make([]string, 0, len(urls))
+	for _, u := range urls {
+		if pattern, denied := denylist.match(u); denied {
+			log.Printf("Skipping %s: matches crawler deny pattern %q", u, pattern)
+			continue
+		}
+		allowed = append(allowed, u)
+	}
+
+	return allowed
+}
@@ -0,0 +1,45 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestDeniedDetailPageIsNotVisited(t *testing.T) {
+	fetches := countFetches(t, "/pokedex/pikachu")
+
+	cfg := config.CrawlerConfig{Selectors: config.DefaultSelectorConfig(), DenyPatterns: []string{"/pikachu$"}}
+	_, err := NewPokemonDBCrawler(cfg).CrawlPokemonDetails(context.Background(), "https://pokemondb.net/pokedex/pikachu")
+	if !errors.Is(err, ErrDeniedURL) {
+		t.Errorf("err = %v, want %v", err, ErrDeniedURL)
+	}
+	if got := fetches.Load(); got != 0 {
+		t.Errorf("fetches = %d, want the denied page never requested", got)
+	}
+}
+
+func TestDeniedURLsAreDroppedFromTheList(t *testing.T) {
+	fetches := countFetches(t, "/pokedex/list-gen1", "/pokedex/list-gen2")
+
+	cfg := config.CrawlerConfig{
+		Selectors:    config.DefaultSelectorConfig(),
+		ListPages:    []string{"/pokedex/list-gen1", "/pokedex/list-gen2"},
+		DenyPatterns: []string{"/pikachu$", "list-gen2"},
+	}
+	urls, err := NewPokemonDBCrawler(cfg).CrawlPokemonList(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// list-gen2 is never fetched and Pikachu is left out of list-gen1
+	if want := []string{"https://pokemondb.net/pokedex/bulbasaur"}; !slices.Equal(urls, want) {
+		t.Errorf("urls = %v, want %v", urls, want)
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("list fetches = %d, want only list-gen1", got)
+	}
+}
@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Thresholds for telling a Pokedex entry from a stat fragment such as
+// "45 49 49 65 65 45": real entries are full sentences of mostly letters
+const (
+	minDescriptionWords       = 5
+	minDescriptionLetterRatio = 0.7
+)
+
+// firstDescription returns the first entry of a Pokedex entries table body
+func firstDescription(e *colly.HTMLElement) string {
+	var desc string
+	e.ForEach("tr", func(i int, row *colly.HTMLElement) {
+		if i == 0 {
+			desc = strings.TrimSpace(row.ChildText("td.cell-med-text"))
+		}
+	})
+	return desc
+}
+
+// looksLikeDescription reports whether text reads like prose: enough words,
+// and mostly letters rather than digits or symbols
+func looksLikeDescription(text string) bool {
+	words := strings.Fields(text)
+	if len(words) < minDescriptionWords {
+		return false
+	}
+
+	letters, others := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r):
+			letters++
+		case !unicode.IsSpace(r):
+			others++
+		}
+	}
+
+	return float64(letters)/float64(letters+others) >= minDescriptionLetterRatio
+}
+
+// previewDescription shortens a rejected description for logging
+func previewDescription(text string) string {
+	const maxLen = 60
+	if runes := []rune(text); len(runes) > maxLen {
+		return string(runes[:maxLen]) + "..."
+	}
+	return text
+}
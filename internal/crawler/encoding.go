@@ -0,0 +1,40 @@
+package crawler
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// SanitizeUTF8 replaces invalid UTF-8 sequences in every text field of
+// pokemon with U+FFFD, so the chunks and payloads built from it always
+// marshal to JSON. It reports whether anything had to be replaced.
+func SanitizeUTF8(pokemon *PokemonData) bool {
+	changed := false
+
+	fix := func(s *string) {
+		if !utf8.ValidString(*s) {
+			*s = strings.ToValidUTF8(*s, "\uFFFD")
+			changed = true
+		}
+	}
+	fixAll := func(values []string) {
+		for i := range values {
+			fix(&values[i])
+		}
+	}
+
+	fix(&pokemon.Name)
+	fix(&pokemon.Number)
+	fix(&pokemon.Description)
+	fix(&pokemon.Height)
+	fix(&pokemon.Weight)
+	fix(&pokemon.Category)
+	fixAll(pokemon.Types)
+	fixAll(pokemon.Abilities)
+	fixAll(pokemon.HiddenAbilities)
+	fixAll(pokemon.Evolutions)
+	fixAll(pokemon.WeakAgainst)
+	fixAll(pokemon.StrongAgainst)
+
+	return changed
+}
@@ -0,0 +1,33 @@
+package crawler
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeUTF8(t *testing.T) {
+	pokemon := &PokemonData{
+		Name:        "Flabébé",
+		Description: "A fairy \xe9 carrying a flower\xff.",
+		Types:       []string{"Fairy", "\xc3"},
+		Abilities:   []string{"Flower Veil"},
+	}
+
+	if !SanitizeUTF8(pokemon) {
+		t.Error("SanitizeUTF8 reported nothing replaced")
+	}
+	if want := "A fairy � carrying a flower�."; pokemon.Description != want {
+		t.Errorf("Description = %q, want %q", pokemon.Description, want)
+	}
+	if pokemon.Types[1] != "�" || !utf8.ValidString(pokemon.Types[1]) {
+		t.Errorf("Types = %q, want the invalid type replaced", pokemon.Types)
+	}
+	// Valid multi-byte text is left alone
+	if pokemon.Name != "Flabébé" {
+		t.Errorf("Name = %q, want it unchanged", pokemon.Name)
+	}
+
+	if SanitizeUTF8(pokemon) {
+		t.Error("SanitizeUTF8 reported a change on already valid data")
+	}
+}
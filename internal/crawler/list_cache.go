@@ -0,0 +1,93 @@
+package crawler
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// listCache remembers the aggregated list page URLs so repeated ingests skip
+// re-crawling the (large, rarely changing) national dex. Entries are
+// persisted to path, when set, to survive restarts.
+type listCache struct {
+	ttl  time.Duration // Zero disables caching
+	path string
+
+	mu    sync.Mutex
+	entry *listCacheEntry
+}
+
+type listCacheEntry struct {
+	Pages     []string  `json:"pages"` // Invalidates the entry when crawler.list_pages changes
+	URLs      []string  `json:"urls"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+func newListCache(ttl time.Duration, path string) *listCache {
+	cache := &listCache{ttl: ttl, path: path}
+
+	if ttl > 0 && path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			var entry listCacheEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				log.Printf("Warning: ignoring unreadable list cache %s: %v", path, err)
+			} else {
+				cache.entry = &entry
+			}
+		}
+	}
+
+	return cache
+}
+
+// get returns the cached URLs for pages if they are within the TTL
+func (cache *listCache) get(pages []string) ([]string, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.ttl <= 0 || cache.entry == nil {
+		return nil, false
+	}
+	if !slices.Equal(cache.entry.Pages, pages) || time.Since(cache.entry.FetchedAt) > cache.ttl {
+		return nil, false
+	}
+
+	return cache.entry.URLs, true
+}
+
+func (cache *listCache) put(pages, urls []string) {
+	if cache.ttl <= 0 {
+		return
+	}
+
+	entry := &listCacheEntry{Pages: pages, URLs: urls, FetchedAt: time.Now()}
+
+	cache.mu.Lock()
+	cache.entry = entry
+	cache.mu.Unlock()
+
+	if cache.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(cache.path), 0o755); err == nil {
+			err = os.WriteFile(cache.path, data, 0o644)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: failed to persist list cache to %s: %v", cache.path, err)
+	}
+}
+
+func (cache *listCache) invalidate() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.entry = nil
+}
@@ -0,0 +1,140 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+// countFetches counts requests for the given pokemondb.net paths made
+// through the fixture server
+func countFetches(t *testing.T, paths ...string) *atomic.Int32 {
+	t.Helper()
+	servePokemonDB(t)
+
+	var fetches atomic.Int32
+	served := http.DefaultTransport
+	http.DefaultTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if slices.Contains(paths, req.URL.Path) {
+			fetches.Add(1)
+		}
+		return served.RoundTrip(req)
+	})
+	t.Cleanup(func() { http.DefaultTransport = served })
+
+	return &fetches
+}
+
+func listCacheConfig(ttl int, path string) config.CrawlerConfig {
+	return config.CrawlerConfig{
+		Selectors:     config.DefaultSelectorConfig(),
+		ListPages:     []string{"/pokedex/list-gen1"},
+		ListCacheTTL:  ttl,
+		ListCachePath: path,
+	}
+}
+
+func TestCrawlPokemonListReusesCachedList(t *testing.T) {
+	fetches := countFetches(t, "/pokedex/list-gen1")
+	crawler := NewPokemonDBCrawler(listCacheConfig(3600, ""))
+
+	first, err := crawler.CrawlPokemonList(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := crawler.CrawlPokemonList(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("list fetches = %d, want 1 within the TTL", got)
+	}
+	if !slices.Equal(first, second) {
+		t.Errorf("cached urls = %v, want %v", second, first)
+	}
+
+	crawler.RefreshPokemonList()
+	if _, err := crawler.CrawlPokemonList(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("list fetches after refresh = %d, want 2", got)
+	}
+}
+
+func TestCrawlPokemonListWithoutTTLAlwaysRecrawls(t *testing.T) {
+	fetches := countFetches(t, "/pokedex/list-gen1")
+	crawler := NewPokemonDBCrawler(listCacheConfig(0, ""))
+
+	for range 2 {
+		if _, err := crawler.CrawlPokemonList(context.Background(), 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("list fetches = %d, want 2 with caching disabled", got)
+	}
+}
+
+func TestListCachePersistsAcrossRestarts(t *testing.T) {
+	fetches := countFetches(t, "/pokedex/list-gen1", "/pokedex/list-gen2")
+	path := filepath.Join(t.TempDir(), "cache", "pokemon-list.json")
+
+	first, err := NewPokemonDBCrawler(listCacheConfig(3600, path)).CrawlPokemonList(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh crawler loads the list persisted by the first one
+	restarted, err := NewPokemonDBCrawler(listCacheConfig(3600, path)).CrawlPokemonList(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("list fetches = %d, want 1 after restart", got)
+	}
+	if !slices.Equal(first, restarted) {
+		t.Errorf("restored urls = %v, want %v", restarted, first)
+	}
+
+	// Changing the configured list pages invalidates the persisted entry
+	changed := listCacheConfig(3600, path)
+	changed.ListPages = []string{"/pokedex/list-gen1", "/pokedex/list-gen2"}
+	if _, err := NewPokemonDBCrawler(changed).CrawlPokemonList(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := fetches.Load(); got != 3 {
+		t.Errorf("list fetches after changing list pages = %d, want 3", got)
+	}
+}
+
+func TestEmptyPokemonListIsNotCached(t *testing.T) {
+	fetches := countFetches(t, "/pokedex/pikachu")
+
+	// A detail page has none of the list links, as when the list selector breaks
+	cfg := listCacheConfig(3600, "")
+	cfg.ListPages = []string{"/pokedex/pikachu"}
+	crawler := NewPokemonDBCrawler(cfg)
+
+	for range 2 {
+		urls, err := crawler.CrawlPokemonList(context.Background(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(urls) != 0 {
+			t.Fatalf("urls = %v, want none", urls)
+		}
+	}
+
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("fetches = %d, want the empty list re-crawled", got)
+	}
+}
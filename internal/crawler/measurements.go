@@ -0,0 +1,57 @@
+package crawler
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Units are matched after any spacing, including the non-breaking spaces
+// pokemondb puts between a value and its unit, which \s doesn't cover
+var (
+	metresPattern    = regexp.MustCompile(`(\d+(?:\.\d+)?)[\s\x{00A0}]*m\b`)
+	kilogramsPattern = regexp.MustCompile(`(\d+(?:\.\d+)?)[\s\x{00A0}]*kg\b`)
+	feetPattern      = regexp.MustCompile(`(\d+)[\s\x{00A0}]*[′'][\s\x{00A0}]*(\d+)[\s\x{00A0}]*(?:″|"|'')`)
+	poundsPattern    = regexp.MustCompile(`(\d+(?:\.\d+)?)[\s\x{00A0}]*lbs?\b`)
+)
+
+// ParseHeightMetres extracts the height in metres from pokemondb's
+// "0.7 m (2′04″)" format, falling back to the imperial value. Returns 0 if
+// nothing can be parsed.
+func ParseHeightMetres(height string) float64 {
+	if m := metresPattern.FindStringSubmatch(height); m != nil {
+		value, _ := strconv.ParseFloat(m[1], 64)
+		return value
+	}
+
+	if m := feetPattern.FindStringSubmatch(height); m != nil {
+		feet, _ := strconv.Atoi(m[1])
+		inches, _ := strconv.Atoi(m[2])
+		return float64(feet*12+inches) * 0.0254
+	}
+
+	return 0
+}
+
+// ParseWeightKilograms extracts the weight in kilograms from pokemondb's
+// "6.9 kg (15.2 lbs)" format, falling back to the imperial value. Returns 0
+// if nothing can be parsed.
+func ParseWeightKilograms(weight string) float64 {
+	if m := kilogramsPattern.FindStringSubmatch(weight); m != nil {
+		value, _ := strconv.ParseFloat(m[1], 64)
+		return value
+	}
+
+	if m := poundsPattern.FindStringSubmatch(weight); m != nil {
+		pounds, _ := strconv.ParseFloat(m[1], 64)
+		return pounds * 0.45359237
+	}
+
+	return 0
+}
+
+// formatMeasurement renders a value with up to two decimals, without trailing zeros
+func formatMeasurement(value float64) string {
+	formatted := strconv.FormatFloat(value, 'f', 2, 64)
+	return strings.TrimSuffix(strings.TrimRight(formatted, "0"), ".")
+}
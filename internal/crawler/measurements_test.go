@@ -0,0 +1,70 @@
+package crawler
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestParseMeasurements(t *testing.T) {
+	heights := []struct {
+		input string
+		want  float64
+	}{
+		{"0.7 m (2′04″)", 0.7},
+		{"0.4\u00a0m (1′04″)", 0.4},
+		{"14.5 m (47′07″)", 14.5},
+		{"2′04″", 0.7112}, // Imperial only: 28 inches
+		{"unknown", 0},
+	}
+	for _, tt := range heights {
+		if got := ParseHeightMetres(tt.input); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("ParseHeightMetres(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+
+	weights := []struct {
+		input string
+		want  float64
+	}{
+		{"6.9 kg (15.2 lbs)", 6.9},
+		{"999.9\u00a0kg (2204.4\u00a0lbs)", 999.9},
+		{"15.2 lbs", 15.2 * 0.45359237},
+		{"1 lb", 0.45359237},
+		{"", 0},
+	}
+	for _, tt := range weights {
+		if got := ParseWeightKilograms(tt.input); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("ParseWeightKilograms(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestCrawledMeasurementsAreNumeric(t *testing.T) {
+	servePokemonDB(t)
+
+	cfg := config.CrawlerConfig{Selectors: config.DefaultSelectorConfig()}
+	pokemon, err := NewPokemonDBCrawler(cfg).CrawlPokemonDetails(context.Background(), "https://pokemondb.net/pokedex/pikachu")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pokemon.HeightM != 0.4 || pokemon.WeightKg != 6.0 {
+		t.Errorf("HeightM = %v, WeightKg = %v, want 0.4 and 6", pokemon.HeightM, pokemon.WeightKg)
+	}
+
+	formatter, err := NewContentFormatter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := formatter.Format(pokemon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "- Size: 0.4 m tall, weighs 6 kg\n"; !strings.Contains(content, want) {
+		t.Errorf("formatted content lacks %q:\n%s", want, content)
+	}
+}
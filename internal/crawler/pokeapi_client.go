@@ -0,0 +1,303 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"resty.dev/v3"
+)
+
+const pokeAPIBaseURL = "https://pokeapi.co/api/v2"
+
+// PokeAPIClient fetches Pokemon from the structured PokeAPI JSON instead of
+// scraping HTML. Responses are cached in memory per PokeAPI's fair-use policy,
+// so shared resources (types, evolution chains) are only fetched once.
+type PokeAPIClient struct {
+	restClient *resty.Client
+	baseURL    string
+
+	mu    sync.Mutex
+	cache map[string][]byte
+}
+
+func NewPokeAPIClient(restClient *resty.Client) *PokeAPIClient {
+	return &PokeAPIClient{
+		restClient: restClient,
+		baseURL:    pokeAPIBaseURL,
+		cache:      make(map[string][]byte),
+	}
+}
+
+type namedResource struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type pokeAPIPokemon struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Height int    `json:"height"` // Decimetres
+	Weight int    `json:"weight"` // Hectograms
+	Types  []struct {
+		Slot int           `json:"slot"`
+		Type namedResource `json:"type"`
+	} `json:"types"`
+	Stats []struct {
+		BaseStat int           `json:"base_stat"`
+		Stat     namedResource `json:"stat"`
+	} `json:"stats"`
+	Abilities []struct {
+		Ability  namedResource `json:"ability"`
+		IsHidden bool          `json:"is_hidden"`
+		Slot     int           `json:"slot"`
+	} `json:"abilities"`
+	Species namedResource `json:"species"`
+	Sprites struct {
+		Other struct {
+			OfficialArtwork struct {
+				FrontDefault string `json:"front_default"`
+			} `json:"official-artwork"`
+		} `json:"other"`
+	} `json:"sprites"`
+}
+
+type pokeAPISpecies struct {
+	FlavorTextEntries []struct {
+		FlavorText string        `json:"flavor_text"`
+		Language   namedResource `json:"language"`
+	} `json:"flavor_text_entries"`
+	Genera []struct {
+		Genus    string        `json:"genus"`
+		Language namedResource `json:"language"`
+	} `json:"genera"`
+	Generation     namedResource `json:"generation"`
+	EvolutionChain struct {
+		URL string `json:"url"`
+	} `json:"evolution_chain"`
+}
+
+type pokeAPIChainLink struct {
+	Species   namedResource      `json:"species"`
+	EvolvesTo []pokeAPIChainLink `json:"evolves_to"`
+}
+
+type pokeAPIEvolutionChain struct {
+	Chain pokeAPIChainLink `json:"chain"`
+}
+
+type pokeAPIType struct {
+	DamageRelations struct {
+		DoubleDamageFrom []namedResource `json:"double_damage_from"`
+		HalfDamageFrom   []namedResource `json:"half_damage_from"`
+		NoDamageFrom     []namedResource `json:"no_damage_from"`
+	} `json:"damage_relations"`
+}
+
+// CrawlPokemonList returns the PokeAPI URLs of the first limit national dex entries
+func (pc *PokeAPIClient) CrawlPokemonList(ctx context.Context, limit int) ([]string, error) {
+	urls := make([]string, 0, limit)
+	for id := 1; id <= limit; id++ {
+		urls = append(urls, fmt.Sprintf("%s/pokemon/%d", pc.baseURL, id))
+	}
+	return urls, nil
+}
+
+func (pc *PokeAPIClient) CrawlPokemonDetails(ctx context.Context, url string) (*PokemonData, error) {
+	var pokemon pokeAPIPokemon
+	if err := pc.getJSON(ctx, url, &pokemon); err != nil {
+		return nil, err
+	}
+
+	var species pokeAPISpecies
+	if err := pc.getJSON(ctx, pokemon.Species.URL, &species); err != nil {
+		return nil, err
+	}
+
+	var chain pokeAPIEvolutionChain
+	if species.EvolutionChain.URL != "" {
+		if err := pc.getJSON(ctx, species.EvolutionChain.URL, &chain); err != nil {
+			return nil, err
+		}
+	}
+
+	typeRelations := make(map[string]pokeAPIType)
+	for _, t := range pokemon.Types {
+		var relations pokeAPIType
+		if err := pc.getJSON(ctx, t.Type.URL, &relations); err != nil {
+			return nil, err
+		}
+		typeRelations[t.Type.Name] = relations
+	}
+
+	return mapPokeAPIPokemon(&pokemon, &species, &chain, typeRelations), nil
+}
+
+// getJSON decodes the (cached) response body at url into v
+func (pc *PokeAPIClient) getJSON(ctx context.Context, url string, v any) error {
+	pc.mu.Lock()
+	body, ok := pc.cache[url]
+	pc.mu.Unlock()
+
+	if !ok {
+		resp, err := pc.restClient.R().
+			SetContext(ctx).
+			Get(url)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", url, err)
+		}
+
+		if resp.StatusCode() != 200 {
+			return fmt.Errorf("PokeAPI returned status %d for %s", resp.StatusCode(), url)
+		}
+
+		body = resp.Bytes()
+
+		pc.mu.Lock()
+		pc.cache[url] = body
+		pc.mu.Unlock()
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+
+	return nil
+}
+
+// mapPokeAPIPokemon converts PokeAPI resources into the shape produced by the pokemondb crawler
+func mapPokeAPIPokemon(pokemon *pokeAPIPokemon, species *pokeAPISpecies, chain *pokeAPIEvolutionChain, typeRelations map[string]pokeAPIType) *PokemonData {
+	data := &PokemonData{
+		Name:            displayName(pokemon.Name),
+		Number:          fmt.Sprintf("%04d", pokemon.ID),
+		Stats:           make(map[string]int),
+		Types:           []string{},
+		Abilities:       []string{},
+		HiddenAbilities: []string{},
+		Evolutions:      []string{},
+		WeakAgainst:     []string{},
+		StrongAgainst:   []string{},
+		Height:          fmt.Sprintf("%.1f m", float64(pokemon.Height)/10),
+		Weight:          fmt.Sprintf("%.1f kg", float64(pokemon.Weight)/10),
+		HeightM:         float64(pokemon.Height) / 10,
+		WeightKg:        float64(pokemon.Weight) / 10,
+		Generation:      parseGeneration(species.Generation.Name),
+		ImageURL:        pokemon.Sprites.Other.OfficialArtwork.FrontDefault,
+	}
+
+	sort.Slice(pokemon.Types, func(i, j int) bool { return pokemon.Types[i].Slot < pokemon.Types[j].Slot })
+	for _, t := range pokemon.Types {
+		data.Types = append(data.Types, displayName(t.Type.Name))
+	}
+
+	statNames := map[string]string{
+		"hp":              "HP",
+		"attack":          "Attack",
+		"defense":         "Defense",
+		"special-attack":  "SpAttack",
+		"special-defense": "SpDefense",
+		"speed":           "Speed",
+	}
+	total := 0
+	for _, stat := range pokemon.Stats {
+		if name, ok := statNames[stat.Stat.Name]; ok {
+			data.Stats[name] = stat.BaseStat
+			total += stat.BaseStat
+		}
+	}
+	if len(data.Stats) > 0 {
+		data.Stats["Total"] = total
+	}
+
+	sort.Slice(pokemon.Abilities, func(i, j int) bool { return pokemon.Abilities[i].Slot < pokemon.Abilities[j].Slot })
+	for _, ability := range pokemon.Abilities {
+		if ability.IsHidden {
+			data.HiddenAbilities = append(data.HiddenAbilities, displayName(ability.Ability.Name))
+		} else {
+			data.Abilities = append(data.Abilities, displayName(ability.Ability.Name))
+		}
+	}
+
+	for _, genus := range species.Genera {
+		if genus.Language.Name == "en" {
+			data.Category = genus.Genus
+			break
+		}
+	}
+
+	for _, entry := range species.FlavorTextEntries {
+		if entry.Language.Name == "en" {
+			// Flavor text contains hard line breaks and form feeds from the games
+			data.Description = strings.Join(strings.Fields(entry.FlavorText), " ")
+			break
+		}
+	}
+
+	var walk func(link pokeAPIChainLink)
+	walk = func(link pokeAPIChainLink) {
+		name := displayName(link.Species.Name)
+		if name != "" && name != data.Name {
+			data.Evolutions = append(data.Evolutions, name)
+		}
+		for _, next := range link.EvolvesTo {
+			walk(next)
+		}
+	}
+	walk(chain.Chain)
+
+	// Combine the defending types' multipliers, as pokemondb's type defenses table does
+	multipliers := make(map[string]float64)
+	for _, relations := range typeRelations {
+		for _, t := range relations.DamageRelations.DoubleDamageFrom {
+			multipliers[t.Name] = multiplier(multipliers, t.Name) * 2
+		}
+		for _, t := range relations.DamageRelations.HalfDamageFrom {
+			multipliers[t.Name] = multiplier(multipliers, t.Name) * 0.5
+		}
+		for _, t := range relations.DamageRelations.NoDamageFrom {
+			multipliers[t.Name] = 0
+		}
+	}
+	attackingTypes := make([]string, 0, len(multipliers))
+	for t := range multipliers {
+		attackingTypes = append(attackingTypes, t)
+	}
+	sort.Strings(attackingTypes)
+	for _, t := range attackingTypes {
+		switch m := multipliers[t]; {
+		case m >= 2:
+			data.WeakAgainst = append(data.WeakAgainst, displayName(t))
+		case m < 1:
+			data.StrongAgainst = append(data.StrongAgainst, displayName(t))
+		}
+	}
+
+	return data
+}
+
+func multiplier(multipliers map[string]float64, attackingType string) float64 {
+	if m, ok := multipliers[attackingType]; ok {
+		return m
+	}
+	return 1
+}
+
+// displayName turns PokeAPI slugs ("mr-mime", "special-attack") into title case ("Mr-Mime")
+func displayName(slug string) string {
+	parts := strings.Split(slug, "-")
+	for i, part := range parts {
+		if part != "" {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// parseGeneration converts "generation-iv" into 4
+func parseGeneration(name string) int {
+	numerals := map[string]int{"i": 1, "ii": 2, "iii": 3, "iv": 4, "v": 5, "vi": 6, "vii": 7, "viii": 8, "ix": 9}
+	return numerals[strings.TrimPrefix(name, "generation-")]
+}
@@ -0,0 +1,117 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"resty.dev/v3"
+)
+
+// servePokeAPI serves the JSON fixtures in testdata/pokeapi, with their
+// pokeapi.co links rewritten to the test server, and counts the requests
+func servePokeAPI(t *testing.T) (*PokeAPIClient, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, err := os.ReadFile(filepath.Join("testdata", "pokeapi", strings.Trim(r.URL.Path, "/")+".json"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(strings.ReplaceAll(string(body), pokeAPIBaseURL, server.URL)))
+	}))
+	t.Cleanup(server.Close)
+
+	restClient := resty.New()
+	t.Cleanup(func() { restClient.Close() })
+
+	client := NewPokeAPIClient(restClient)
+	client.baseURL = server.URL
+	return client, &requests
+}
+
+func TestPokeAPIFixtureMapsToFormattedContent(t *testing.T) {
+	client, requests := servePokeAPI(t)
+
+	urls, err := client.CrawlPokemonList(context.Background(), 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pokemon, err := client.CrawlPokemonDetails(context.Background(), urls[24])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	formatter, err := NewContentFormatter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := formatter.Format(pokemon)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `Pokemon: Pikachu (#0025)
+
+=== Basic Information ===
+Type: Electric
+Category: Mouse Pokémon
+Height: 0.4 m
+Weight: 6.0 kg
+
+=== Description ===
+When several of these POKéMON gather, their electricity could build and cause lightning storms.
+
+=== Abilities ===
+Static
+Hidden Ability: Lightning-Rod
+
+=== Base Stats ===
+HP: 35
+Attack: 55
+Defense: 40
+Special Attack: 50
+Special Defense: 50
+Speed: 90
+Total: 320
+
+=== Type Effectiveness ===
+Weak against: Ground
+Strong against: Electric, Flying, Steel
+
+=== Evolution Chain ===
+Evolves to/from: Pichu → Raichu
+
+=== Quick Facts ===
+- Pikachu is a Electric type Pokemon
+- Highest stat: Speed (90)
+- Size: 0.4 m tall, weighs 6 kg
+- Primary ability: Static
+- Hidden ability: Lightning-Rod
+`
+	if content != want {
+		t.Errorf("formatted content:\n%s\nwant:\n%s", content, want)
+	}
+	if pokemon.Generation != 1 || !strings.HasSuffix(pokemon.ImageURL, "/official-artwork/25.png") {
+		t.Errorf("Generation = %d, ImageURL = %q", pokemon.Generation, pokemon.ImageURL)
+	}
+
+	// Responses are cached, so a re-crawl doesn't hit PokeAPI again
+	fetched := requests.Load()
+	if _, err := client.CrawlPokemonDetails(context.Background(), urls[24]); err != nil {
+		t.Fatal(err)
+	}
+	if again := requests.Load(); again != fetched {
+		t.Errorf("re-crawl made %d more requests, want 0", again-fetched)
+	}
+}
@@ -4,28 +4,49 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gocolly/colly/v2"
 	"github.com/gocolly/colly/v2/extensions"
+	"github.com/katatrina/poke-bot/internal/config"
 )
 
+const allowedDomain = "pokemondb.net"
+
 type PokemonDBCrawler struct {
 	collector *colly.Collector
 	baseURL   string
+	selectors config.SelectorConfig
+	backoff   *adaptiveBackoff
+
+	listPages       []string // Paths relative to baseURL
+	listConcurrency int
+	listCache       *listCache
+
+	denylist *urlDenylist // Nil when crawler.deny_patterns is empty
 }
 
-func NewPokemonDBCrawler() *PokemonDBCrawler {
-	c := colly.NewCollector(
-		colly.AllowedDomains("pokemondb.net"),
+func NewPokemonDBCrawler(cfg config.CrawlerConfig) *PokemonDBCrawler {
+	denylist := newURLDenylist(cfg.DenyPatterns)
+
+	options := []colly.CollectorOption{
+		colly.AllowedDomains(allowedDomain),
 		colly.MaxDepth(2),
-		colly.Async(false), // Synchronous for controlled crawling
-	)
+		colly.Async(false),      // Synchronous for controlled crawling
+		colly.AllowURLRevisit(), // Pages that failed (e.g. with 429) are retried, and Pokemon can be re-ingested
+	}
+	if denylist != nil {
+		// Also stops redirects into denied paths; cloned collectors inherit the filters
+		options = append(options, colly.DisallowedURLFilters(denylist.patterns...))
+	}
+	c := colly.NewCollector(options...)
 
 	// Set delays to be respectful
 	c.Limit(&colly.LimitRule{
-		DomainGlob:  "pokemondb.net",
+		DomainGlob:  allowedDomain,
 		Delay:       500 * time.Millisecond,
 		RandomDelay: 200 * time.Millisecond,
 	})
@@ -37,75 +58,210 @@ func NewPokemonDBCrawler() *PokemonDBCrawler {
 		log.Printf("Error crawling %s: %v", r.Request.URL, err)
 	})
 
+	// Back off further when the site starts rate limiting us
+	backoff := newAdaptiveBackoff(
+		time.Duration(cfg.BackoffMinMS)*time.Millisecond,
+		time.Duration(cfg.BackoffMaxMS)*time.Millisecond,
+	)
+	backoff.attach(c)
+
 	return &PokemonDBCrawler{
 		collector: c,
 		baseURL:   "https://pokemondb.net",
+		selectors: cfg.Selectors,
+		backoff:   backoff,
+
+		listPages:       cfg.ListPages,
+		listConcurrency: max(cfg.ListConcurrency, 1),
+		listCache:       newListCache(time.Duration(cfg.ListCacheTTL)*time.Second, cfg.ListCachePath),
+
+		denylist: denylist,
 	}
 }
 
 type PokemonData struct {
-	Name          string
-	Number        string
-	Types         []string
-	Stats         map[string]int
-	Abilities     []string
-	Description   string
-	Height        string
-	Weight        string
-	Category      string
-	Evolutions    []string
-	WeakAgainst   []string
-	StrongAgainst []string
-	Generation    int
+	Name            string
+	Number          string
+	Types           []string
+	Stats           map[string]int
+	Abilities       []string
+	HiddenAbilities []string
+	Description     string
+	Height          string  // Display form, e.g. "0.7 m (2′04″)"
+	Weight          string  // Display form, e.g. "6.9 kg (15.2 lbs)"
+	HeightM         float64 // Metres, 0 when unknown
+	WeightKg        float64 // Kilograms, 0 when unknown
+	Category        string
+	Evolutions      []string
+	WeakAgainst     []string
+	StrongAgainst   []string
+	Generation      int
+	ImageURL        string // Official artwork, empty when the source has none
+}
+
+// PokemonSource lists and fetches Pokemon from one upstream (pokemondb, PokeAPI)
+type PokemonSource interface {
+	CrawlPokemonList(ctx context.Context, limit int) ([]string, error)
+	CrawlPokemonDetails(ctx context.Context, url string) (*PokemonData, error)
 }
 
+// ListRefresher is implemented by sources that cache their Pokemon list
+type ListRefresher interface {
+	RefreshPokemonList()
+}
+
+// CrawlPokemonList collects detail page URLs from each configured list page,
+// fetching up to listConcurrency pages at once. URLs keep list page order and
+// are deduplicated, so pagination stays stable however the fetches interleave.
+// The full list is cached for crawler.list_cache_ttl.
 func (pc *PokemonDBCrawler) CrawlPokemonList(ctx context.Context, limit int) ([]string, error) {
+	pokemonURLs, ok := pc.listCache.get(pc.listPages)
+	if ok {
+		log.Printf("Using cached Pokemon list (%d URLs)", len(pokemonURLs))
+	} else {
+		var err error
+		pokemonURLs, err = pc.crawlListPages(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// An empty list usually means the list selector broke; don't pin that for the TTL
+		if len(pokemonURLs) > 0 {
+			pc.listCache.put(pc.listPages, pokemonURLs)
+		}
+	}
+
+	pokemonURLs = pc.denylist.filter(pokemonURLs)
+
+	if len(pokemonURLs) > limit {
+		pokemonURLs = pokemonURLs[:limit]
+	}
+
+	return pokemonURLs, nil
+}
+
+// RefreshPokemonList drops the cached list so the next CrawlPokemonList re-crawls it
+func (pc *PokemonDBCrawler) RefreshPokemonList() {
+	pc.listCache.invalidate()
+}
+
+// crawlListPages fetches every list page and aggregates their URLs in page order
+func (pc *PokemonDBCrawler) crawlListPages(ctx context.Context) ([]string, error) {
+	pageURLs := make([][]string, len(pc.listPages))
+	errs := make([]error, len(pc.listPages))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, pc.listConcurrency)
+
+	for i, page := range pc.listPages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			pageURLs[i], errs[i] = pc.crawlListPage(ctx, page)
+		}()
+	}
+	wg.Wait()
+
 	var pokemonURLs []string
-	count := 0
+	seen := make(map[string]bool)
 
-	pc.collector.OnHTML("div.infocard-list-pkmn-lg > div.infocard", func(e *colly.HTMLElement) {
-		if count >= limit {
-			return
+	for i, urls := range pageURLs {
+		if errs[i] != nil {
+			return nil, errs[i]
 		}
 
+		for _, u := range urls {
+			if !seen[u] {
+				seen[u] = true
+				pokemonURLs = append(pokemonURLs, u)
+			}
+		}
+	}
+
+	return pokemonURLs, nil
+}
+
+// crawlListPage returns the detail page URLs linked from one list page, in page order
+func (pc *PokemonDBCrawler) crawlListPage(ctx context.Context, page string) ([]string, error) {
+	var pokemonURLs []string
+
+	if pattern, denied := pc.denylist.match(pc.baseURL + page); denied {
+		log.Printf("Skipping list page %s: matches crawler deny pattern %q", page, pattern)
+		return nil, nil
+	}
+
+	listCollector := pc.collector.Clone()
+	listCollector.Context = ctx
+	pc.backoff.attach(listCollector)
+
+	listCollector.OnHTML(pc.selectors.PokemonList, func(e *colly.HTMLElement) {
 		// Get Pokemon URL
-		link := e.ChildAttr("span.infocard-lg-img a", "href")
+		link := e.ChildAttr(pc.selectors.PokemonLink, "href")
 		if link != "" {
 			pokemonURLs = append(pokemonURLs, pc.baseURL+link)
-			count++
 		}
 	})
 
-	// Start from National Pokedex
-	err := pc.collector.Visit(pc.baseURL + "/pokedex/national")
-	if err != nil {
-		return nil, fmt.Errorf("failed to visit pokedex: %w", err)
+	if err := listCollector.Visit(pc.baseURL + page); err != nil {
+		return nil, fmt.Errorf("failed to visit %s: %w", page, err)
 	}
 
-	pc.collector.Wait()
+	listCollector.Wait()
 
 	return pokemonURLs, nil
 }
 
+// ValidatePokemonURL checks that rawURL is an absolute http(s) URL the crawler is allowed to visit
+func ValidatePokemonURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", rawURL, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid url %q: scheme must be http or https", rawURL)
+	}
+
+	if u.Hostname() != allowedDomain {
+		return fmt.Errorf("invalid url %q: domain must be %s", rawURL, allowedDomain)
+	}
+
+	return nil
+}
+
 func (pc *PokemonDBCrawler) CrawlPokemonDetails(ctx context.Context, url string) (*PokemonData, error) {
+	if pattern, denied := pc.denylist.match(url); denied {
+		log.Printf("Skipping %s: matches crawler deny pattern %q", url, pattern)
+		return nil, fmt.Errorf("%w %q: %s", ErrDeniedURL, pattern, url)
+	}
+
 	pokemon := &PokemonData{
-		Stats:         make(map[string]int),
-		Types:         []string{},
-		Abilities:     []string{},
-		Evolutions:    []string{},
-		WeakAgainst:   []string{},
-		StrongAgainst: []string{},
+		Stats:           make(map[string]int),
+		Types:           []string{},
+		Abilities:       []string{},
+		HiddenAbilities: []string{},
+		Evolutions:      []string{},
+		WeakAgainst:     []string{},
+		StrongAgainst:   []string{},
 	}
 
 	detailCollector := pc.collector.Clone()
-
-	// Get Pokemon name and number
-	detailCollector.OnHTML("main h1", func(e *colly.HTMLElement) {
-		pokemon.Name = strings.TrimSpace(e.Text)
+	detailCollector.Context = ctx // Abort the request when the ingest job is cancelled or times out
+	pc.backoff.attach(detailCollector)
+
+	// Get Pokemon name from the page title. Only the first match counts, so
+	// other headings matched by a loose selector can't overwrite it.
+	detailCollector.OnHTML(pc.selectors.Name, func(e *colly.HTMLElement) {
+		if pokemon.Name == "" {
+			pokemon.Name = strings.TrimSpace(e.Text)
+		}
 	})
 
 	// Get Pokemon number from breadcrumb or table
-	detailCollector.OnHTML("table.vitals-table tbody", func(e *colly.HTMLElement) {
+	detailCollector.OnHTML(pc.selectors.VitalsTable, func(e *colly.HTMLElement) {
 		e.ForEach("tr", func(_ int, row *colly.HTMLElement) {
 			header := strings.TrimSpace(row.ChildText("th"))
 			value := strings.TrimSpace(row.ChildText("td"))
@@ -124,12 +280,22 @@ func (pc *PokemonDBCrawler) CrawlPokemonDetails(ctx context.Context, url string)
 				pokemon.Category = value
 			case "Height":
 				pokemon.Height = value
+				pokemon.HeightM = ParseHeightMetres(value)
 			case "Weight":
 				pokemon.Weight = value
+				pokemon.WeightKg = ParseWeightKilograms(value)
 			case "Abilities":
+				// Hidden abilities are wrapped in <small>, e.g.
+				// <small><a>Chlorophyll</a> (hidden ability)</small>; the
+				// marker is outside the link text
 				row.ForEach("td a", func(_ int, ability *colly.HTMLElement) {
 					abilityName := strings.TrimSpace(ability.Text)
-					if abilityName != "" && !strings.Contains(abilityName, "(hidden ability)") {
+					if abilityName == "" {
+						return
+					}
+					if ability.DOM.Closest("small").Length() > 0 {
+						pokemon.HiddenAbilities = append(pokemon.HiddenAbilities, abilityName)
+					} else {
 						pokemon.Abilities = append(pokemon.Abilities, abilityName)
 					}
 				})
@@ -138,7 +304,7 @@ func (pc *PokemonDBCrawler) CrawlPokemonDetails(ctx context.Context, url string)
 	})
 
 	// Get base stats
-	detailCollector.OnHTML("div.resp-scroll", func(e *colly.HTMLElement) {
+	detailCollector.OnHTML(pc.selectors.Stats, func(e *colly.HTMLElement) {
 		e.ForEach("table.vitals-table tbody tr", func(_ int, row *colly.HTMLElement) {
 			statName := strings.TrimSpace(row.ChildText("th"))
 			statValue := strings.TrimSpace(row.ChildText("td.cell-num"))
@@ -168,21 +334,23 @@ func (pc *PokemonDBCrawler) CrawlPokemonDetails(ctx context.Context, url string)
 		})
 	})
 
-	// Get Pokedex description
-	detailCollector.OnHTML("div.grid-col:has(h2:contains('Pokédex entries')) table tbody", func(e *colly.HTMLElement) {
-		// Get first available description
-		e.ForEach("tr", func(i int, row *colly.HTMLElement) {
-			if i == 0 && pokemon.Description == "" {
-				desc := strings.TrimSpace(row.ChildText("td.cell-med-text"))
-				if desc != "" {
-					pokemon.Description = desc
-				}
-			}
-		})
+	// Get Pokedex description. The primary selector can match a neighboring
+	// grid column on some layouts, so its first entry is only kept if it
+	// reads like prose; otherwise the fallback selector's entry is used.
+	var primaryDesc, fallbackDesc string
+	detailCollector.OnHTML(pc.selectors.Description, func(e *colly.HTMLElement) {
+		if primaryDesc == "" {
+			primaryDesc = firstDescription(e)
+		}
+	})
+	detailCollector.OnHTML(pc.selectors.DescriptionFallback, func(e *colly.HTMLElement) {
+		if fallbackDesc == "" {
+			fallbackDesc = firstDescription(e)
+		}
 	})
 
 	// Get type effectiveness
-	detailCollector.OnHTML("div.grid-col:has(h2:contains('Type defenses'))", func(e *colly.HTMLElement) {
+	detailCollector.OnHTML(pc.selectors.TypeDefenses, func(e *colly.HTMLElement) {
 		e.ForEach("table.type-table tbody tr", func(_ int, row *colly.HTMLElement) {
 			header := strings.TrimSpace(row.ChildText("th"))
 
@@ -210,8 +378,15 @@ func (pc *PokemonDBCrawler) CrawlPokemonDetails(ctx context.Context, url string)
 		})
 	})
 
+	// Get the artwork URL, from the first matching image
+	detailCollector.OnHTML(pc.selectors.Image, func(e *colly.HTMLElement) {
+		if pokemon.ImageURL == "" {
+			pokemon.ImageURL = e.Request.AbsoluteURL(e.Attr("src"))
+		}
+	})
+
 	// Get evolution chain
-	detailCollector.OnHTML("div.infocard-list-evo", func(e *colly.HTMLElement) {
+	detailCollector.OnHTML(pc.selectors.Evolutions, func(e *colly.HTMLElement) {
 		e.ForEach("div.infocard", func(_ int, evo *colly.HTMLElement) {
 			evoName := strings.TrimSpace(evo.ChildText("a.ent-name"))
 			if evoName != "" && evoName != pokemon.Name {
@@ -233,114 +408,15 @@ func (pc *PokemonDBCrawler) CrawlPokemonDetails(ctx context.Context, url string)
 		return nil, fmt.Errorf("failed to extract pokemon data from %s", url)
 	}
 
-	return pokemon, nil
-}
-
-func (pc *PokemonDBCrawler) FormatPokemonForRAG(pokemon *PokemonData) string {
-	var sb strings.Builder
-
-	// Header
-	sb.WriteString(fmt.Sprintf("Pokemon: %s", pokemon.Name))
-	if pokemon.Number != "" {
-		sb.WriteString(fmt.Sprintf(" (#%s)", pokemon.Number))
-	}
-	sb.WriteString("\n\n")
-
-	// Basic Info
-	sb.WriteString("=== Basic Information ===\n")
-	if len(pokemon.Types) > 0 {
-		sb.WriteString(fmt.Sprintf("Type: %s\n", strings.Join(pokemon.Types, ", ")))
-	}
-	if pokemon.Category != "" {
-		sb.WriteString(fmt.Sprintf("Category: %s\n", pokemon.Category))
-	}
-	if pokemon.Height != "" {
-		sb.WriteString(fmt.Sprintf("Height: %s\n", pokemon.Height))
-	}
-	if pokemon.Weight != "" {
-		sb.WriteString(fmt.Sprintf("Weight: %s\n", pokemon.Weight))
-	}
-	sb.WriteString("\n")
-
-	// Description
-	if pokemon.Description != "" {
-		sb.WriteString("=== Description ===\n")
-		sb.WriteString(pokemon.Description)
-		sb.WriteString("\n\n")
-	}
-
-	// Abilities
-	if len(pokemon.Abilities) > 0 {
-		sb.WriteString("=== Abilities ===\n")
-		sb.WriteString(fmt.Sprintf("%s\n\n", strings.Join(pokemon.Abilities, ", ")))
-	}
-
-	// Base Stats
-	if len(pokemon.Stats) > 0 {
-		sb.WriteString("=== Base Stats ===\n")
-		if hp, ok := pokemon.Stats["HP"]; ok {
-			sb.WriteString(fmt.Sprintf("HP: %d\n", hp))
-		}
-		if attack, ok := pokemon.Stats["Attack"]; ok {
-			sb.WriteString(fmt.Sprintf("Attack: %d\n", attack))
-		}
-		if defense, ok := pokemon.Stats["Defense"]; ok {
-			sb.WriteString(fmt.Sprintf("Defense: %d\n", defense))
-		}
-		if spAttack, ok := pokemon.Stats["SpAttack"]; ok {
-			sb.WriteString(fmt.Sprintf("Special Attack: %d\n", spAttack))
-		}
-		if spDefense, ok := pokemon.Stats["SpDefense"]; ok {
-			sb.WriteString(fmt.Sprintf("Special Defense: %d\n", spDefense))
-		}
-		if speed, ok := pokemon.Stats["Speed"]; ok {
-			sb.WriteString(fmt.Sprintf("Speed: %d\n", speed))
-		}
-		if total, ok := pokemon.Stats["Total"]; ok {
-			sb.WriteString(fmt.Sprintf("Total: %d\n", total))
-		}
-		sb.WriteString("\n")
-	}
-
-	// Type Effectiveness
-	if len(pokemon.WeakAgainst) > 0 || len(pokemon.StrongAgainst) > 0 {
-		sb.WriteString("=== Type Effectiveness ===\n")
-		if len(pokemon.WeakAgainst) > 0 {
-			sb.WriteString(fmt.Sprintf("Weak against: %s\n", strings.Join(pokemon.WeakAgainst, ", ")))
-		}
-		if len(pokemon.StrongAgainst) > 0 {
-			sb.WriteString(fmt.Sprintf("Strong against: %s\n", strings.Join(pokemon.StrongAgainst, ", ")))
-		}
-		sb.WriteString("\n")
+	switch {
+	case looksLikeDescription(primaryDesc):
+		pokemon.Description = primaryDesc
+	case looksLikeDescription(fallbackDesc):
+		log.Printf("Description selector matched %q for %s, using fallback selector", previewDescription(primaryDesc), pokemon.Name)
+		pokemon.Description = fallbackDesc
+	case primaryDesc != "" || fallbackDesc != "":
+		log.Printf("Warning: no plausible description found for %s (got %q), leaving it empty", pokemon.Name, previewDescription(primaryDesc))
 	}
 
-	// Evolution
-	if len(pokemon.Evolutions) > 0 {
-		sb.WriteString("=== Evolution Chain ===\n")
-		sb.WriteString(fmt.Sprintf("Evolves to/from: %s\n", strings.Join(pokemon.Evolutions, " → ")))
-		sb.WriteString("\n")
-	}
-
-	// Additional context for Q&A
-	sb.WriteString("=== Quick Facts ===\n")
-	sb.WriteString(fmt.Sprintf("- %s is a %s type Pokemon\n", pokemon.Name, strings.Join(pokemon.Types, "/")))
-	if len(pokemon.Stats) > 0 {
-		// Find highest stat
-		maxStat := ""
-		maxValue := 0
-		for stat, value := range pokemon.Stats {
-			if stat != "Total" && value > maxValue {
-				maxValue = value
-				maxStat = stat
-			}
-		}
-		if maxStat != "" {
-			sb.WriteString(fmt.Sprintf("- Highest stat: %s (%d)\n", maxStat, maxValue))
-		}
-	}
-	if len(pokemon.Abilities) > 0 {
-		sb.WriteString(fmt.Sprintf("- Primary ability: %s\n", pokemon.Abilities[0]))
-	}
-
-	return sb.String()
+	return pokemon, nil
 }
@@ -0,0 +1,246 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// servePokemonDB sends pokemondb.net requests to an httptest server serving
+// the fixture pages in testdata, until the test ends
+func servePokemonDB(t *testing.T) {
+	t.Helper()
+
+	fixtures := httptest.NewServer(http.StripPrefix("/pokedex/", http.FileServer(http.Dir("testdata"))))
+	t.Cleanup(fixtures.Close)
+	target, _ := url.Parse(fixtures.URL)
+
+	original := http.DefaultTransport
+	http.DefaultTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Hostname() == allowedDomain {
+			req = req.Clone(req.Context())
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path += ".html"
+		}
+		return original.RoundTrip(req)
+	})
+	t.Cleanup(func() { http.DefaultTransport = original })
+}
+
+func TestCrawlPokemonDetailsWithOverriddenSelectors(t *testing.T) {
+	servePokemonDB(t)
+	const page = "https://pokemondb.net/pokedex/eevee-redesign"
+
+	// The default selectors don't match the redesigned layout
+	defaults := config.CrawlerConfig{Selectors: config.DefaultSelectorConfig()}
+	if _, err := NewPokemonDBCrawler(defaults).CrawlPokemonDetails(context.Background(), page); err == nil {
+		t.Fatal("default selectors unexpectedly matched the redesigned page")
+	}
+
+	selectors := config.DefaultSelectorConfig()
+	selectors.Name = "h1.pokemon-name"
+	selectors.VitalsTable = "table.dex-table tbody"
+	selectors.Stats = "section.base-stats"
+	selectors.Description = "section.dex-entries table tbody"
+	selectors.DescriptionFallback = "section.dex-entries tbody"
+	selectors.TypeDefenses = "section.defenses"
+	selectors.Evolutions = "section.evolution"
+	selectors.Image = "figure.artwork img"
+	cfg := config.CrawlerConfig{Selectors: selectors}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	pokemon, err := NewPokemonDBCrawler(cfg).CrawlPokemonDetails(context.Background(), page)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pokemon.Name != "Eevee" || pokemon.Number != "0133" || pokemon.Category != "Evolution Pokémon" {
+		t.Errorf("got name %q, number %q, category %q", pokemon.Name, pokemon.Number, pokemon.Category)
+	}
+	if !slices.Equal(pokemon.Types, []string{"Normal"}) {
+		t.Errorf("Types = %v", pokemon.Types)
+	}
+	if !slices.Equal(pokemon.Abilities, []string{"Run Away"}) || !slices.Equal(pokemon.HiddenAbilities, []string{"Anticipation"}) {
+		t.Errorf("Abilities = %v, HiddenAbilities = %v", pokemon.Abilities, pokemon.HiddenAbilities)
+	}
+	if pokemon.Stats["HP"] != 55 || pokemon.Stats["Speed"] != 55 {
+		t.Errorf("Stats = %v", pokemon.Stats)
+	}
+	if !slices.Equal(pokemon.WeakAgainst, []string{"Fighting"}) {
+		t.Errorf("WeakAgainst = %v", pokemon.WeakAgainst)
+	}
+	if !strings.HasPrefix(pokemon.Description, "Its genetic code is irregular.") {
+		t.Errorf("Description = %q", pokemon.Description)
+	}
+	if !slices.Equal(pokemon.Evolutions, []string{"Vaporeon"}) {
+		t.Errorf("Evolutions = %v", pokemon.Evolutions)
+	}
+	if !strings.HasSuffix(pokemon.ImageURL, "/artwork/eevee.jpg") {
+		t.Errorf("ImageURL = %q", pokemon.ImageURL)
+	}
+}
+
+func TestSelectorConfigRequiresEverySelector(t *testing.T) {
+	selectors := config.DefaultSelectorConfig()
+	if err := selectors.Validate(); err != nil {
+		t.Fatalf("default selectors rejected: %v", err)
+	}
+
+	selectors.Stats = ""
+	if err := selectors.Validate(); err == nil {
+		t.Error("Validate accepted an empty stats selector")
+	}
+
+	selectors = config.DefaultSelectorConfig()
+	selectors.Name = "main >"
+	if err := selectors.Validate(); err == nil {
+		t.Error("Validate accepted an unparsable name selector")
+	}
+}
+
+func TestCrawlPokemonListAggregatesListPages(t *testing.T) {
+	servePokemonDB(t)
+
+	cfg := config.CrawlerConfig{
+		Selectors:       config.DefaultSelectorConfig(),
+		ListPages:       []string{"/pokedex/list-gen1", "/pokedex/list-gen2"},
+		ListConcurrency: 2,
+	}
+	crawler := NewPokemonDBCrawler(cfg)
+
+	urls, err := crawler.CrawlPokemonList(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Page order is kept and Pikachu, listed on both pages, appears once
+	want := []string{
+		"https://pokemondb.net/pokedex/bulbasaur",
+		"https://pokemondb.net/pokedex/pikachu",
+		"https://pokemondb.net/pokedex/chikorita",
+		"https://pokemondb.net/pokedex/cyndaquil",
+	}
+	if !slices.Equal(urls, want) {
+		t.Errorf("urls = %v, want %v", urls, want)
+	}
+
+	limited, err := crawler.CrawlPokemonList(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(limited, want[:3]) {
+		t.Errorf("limited urls = %v, want %v", limited, want[:3])
+	}
+}
+
+func TestCrawlPokemonDetailsUsesFirstTitleHeading(t *testing.T) {
+	servePokemonDB(t)
+
+	cfg := config.CrawlerConfig{Selectors: config.DefaultSelectorConfig()}
+	pokemon, err := NewPokemonDBCrawler(cfg).CrawlPokemonDetails(context.Background(), "https://pokemondb.net/pokedex/pikachu-multiple-h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A nested banner h1 comes first and a later top-level h1 follows the title
+	if pokemon.Name != "Pikachu" {
+		t.Errorf("Name = %q, want %q", pokemon.Name, "Pikachu")
+	}
+}
+
+func TestCrawlPokemonDetailsReadsArtworkURL(t *testing.T) {
+	servePokemonDB(t)
+
+	cfg := config.CrawlerConfig{Selectors: config.DefaultSelectorConfig()}
+	pokemon, err := NewPokemonDBCrawler(cfg).CrawlPokemonDetails(context.Background(), "https://pokemondb.net/pokedex/pikachu")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "https://img.pokemondb.net/artwork/pikachu.jpg"; pokemon.ImageURL != want {
+		t.Errorf("ImageURL = %q, want %q", pokemon.ImageURL, want)
+	}
+}
+
+func TestCrawlPokemonDetailsSeparatesHiddenAbilities(t *testing.T) {
+	servePokemonDB(t)
+
+	cfg := config.CrawlerConfig{Selectors: config.DefaultSelectorConfig()}
+	pokemon, err := NewPokemonDBCrawler(cfg).CrawlPokemonDetails(context.Background(), "https://pokemondb.net/pokedex/pikachu")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The "(hidden ability)" marker sits outside the link, in the <small> wrapper
+	if !slices.Equal(pokemon.Abilities, []string{"Static"}) {
+		t.Errorf("Abilities = %v, want [Static]", pokemon.Abilities)
+	}
+	if !slices.Equal(pokemon.HiddenAbilities, []string{"Lightning Rod"}) {
+		t.Errorf("HiddenAbilities = %v, want [Lightning Rod]", pokemon.HiddenAbilities)
+	}
+
+	formatter, err := NewContentFormatter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := formatter.Format(pokemon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"=== Abilities ===\nStatic\nHidden Ability: Lightning Rod\n", "- Primary ability: Static\n", "- Hidden ability: Lightning Rod\n"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("content lacks %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestCrawlPokemonDetailsFallsBackFromNonProseDescription(t *testing.T) {
+	servePokemonDB(t)
+
+	// The entries share a grid column with the training table, so the
+	// primary selector's first match is "2 Speed"
+	cfg := config.CrawlerConfig{Selectors: config.DefaultSelectorConfig()}
+	pokemon, err := NewPokemonDBCrawler(cfg).CrawlPokemonDetails(context.Background(), "https://pokemondb.net/pokedex/pikachu-wrong-description")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "When several of these Pokémon gather, their electricity could build and cause lightning storms."
+	if pokemon.Description != want {
+		t.Errorf("Description = %q, want %q", pokemon.Description, want)
+	}
+}
+
+func TestLooksLikeDescription(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"It keeps its tail raised to monitor its surroundings.", true},
+		{"2 Speed", false},
+		{"45 49 49 65 65 45 318", false},
+		{"190 (24.8%) 70 Medium Fast 50% male", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := looksLikeDescription(tt.text); got != tt.want {
+			t.Errorf("looksLikeDescription(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package crawler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// typeChart holds the non-neutral damage multipliers (Gen 6+), keyed by
+// attacking type then defending type
+var typeChart = map[string]map[string]float64{
+	"Normal":   {"Rock": 0.5, "Ghost": 0, "Steel": 0.5},
+	"Fire":     {"Fire": 0.5, "Water": 0.5, "Grass": 2, "Ice": 2, "Bug": 2, "Rock": 0.5, "Dragon": 0.5, "Steel": 2},
+	"Water":    {"Fire": 2, "Water": 0.5, "Grass": 0.5, "Ground": 2, "Rock": 2, "Dragon": 0.5},
+	"Electric": {"Water": 2, "Electric": 0.5, "Grass": 0.5, "Ground": 0, "Flying": 2, "Dragon": 0.5},
+	"Grass":    {"Fire": 0.5, "Water": 2, "Grass": 0.5, "Poison": 0.5, "Ground": 2, "Flying": 0.5, "Bug": 0.5, "Rock": 2, "Dragon": 0.5, "Steel": 0.5},
+	"Ice":      {"Fire": 0.5, "Water": 0.5, "Grass": 2, "Ice": 0.5, "Ground": 2, "Flying": 2, "Dragon": 2, "Steel": 0.5},
+	"Fighting": {"Normal": 2, "Ice": 2, "Poison": 0.5, "Flying": 0.5, "Psychic": 0.5, "Bug": 0.5, "Rock": 2, "Ghost": 0, "Dark": 2, "Steel": 2, "Fairy": 0.5},
+	"Poison":   {"Grass": 2, "Poison": 0.5, "Ground": 0.5, "Rock": 0.5, "Ghost": 0.5, "Steel": 0, "Fairy": 2},
+	"Ground":   {"Fire": 2, "Electric": 2, "Grass": 0.5, "Poison": 2, "Flying": 0, "Bug": 0.5, "Rock": 2, "Steel": 2},
+	"Flying":   {"Electric": 0.5, "Grass": 2, "Fighting": 2, "Bug": 2, "Rock": 0.5, "Steel": 0.5},
+	"Psychic":  {"Fighting": 2, "Poison": 2, "Psychic": 0.5, "Dark": 0, "Steel": 0.5},
+	"Bug":      {"Fire": 0.5, "Grass": 2, "Fighting": 0.5, "Poison": 0.5, "Flying": 0.5, "Psychic": 2, "Ghost": 0.5, "Dark": 2, "Steel": 0.5, "Fairy": 0.5},
+	"Rock":     {"Fire": 2, "Ice": 2, "Fighting": 0.5, "Ground": 0.5, "Flying": 2, "Bug": 2, "Steel": 0.5},
+	"Ghost":    {"Normal": 0, "Psychic": 2, "Ghost": 2, "Dark": 0.5},
+	"Dragon":   {"Dragon": 2, "Steel": 0.5, "Fairy": 0},
+	"Dark":     {"Fighting": 0.5, "Psychic": 2, "Ghost": 2, "Dark": 0.5, "Fairy": 0.5},
+	"Steel":    {"Fire": 0.5, "Water": 0.5, "Electric": 0.5, "Ice": 2, "Rock": 2, "Steel": 0.5, "Fairy": 2},
+	"Fairy":    {"Fire": 0.5, "Fighting": 2, "Poison": 0.5, "Dragon": 2, "Dark": 2, "Steel": 0.5},
+}
+
+// ExpectedTypeEffectiveness derives weaknesses (≥2×) and resistances (<1×,
+// including immunities) for a combination of defending types
+func ExpectedTypeEffectiveness(types []string) (weakAgainst, strongAgainst []string) {
+	for attacking, multipliers := range typeChart {
+		multiplier := 1.0
+		for _, defending := range types {
+			if m, ok := multipliers[NormalizeTypeName(defending)]; ok {
+				multiplier *= m
+			}
+		}
+
+		switch {
+		case multiplier >= 2:
+			weakAgainst = append(weakAgainst, attacking)
+		case multiplier < 1:
+			strongAgainst = append(strongAgainst, attacking)
+		}
+	}
+
+	sort.Strings(weakAgainst)
+	sort.Strings(strongAgainst)
+
+	return weakAgainst, strongAgainst
+}
+
+// ValidateTypeEffectiveness compares crawled matchups with the static type
+// chart and describes each discrepancy. An empty result means they agree.
+func ValidateTypeEffectiveness(pokemon *PokemonData) []string {
+	if len(pokemon.Types) == 0 {
+		return nil
+	}
+
+	expectedWeak, expectedStrong := ExpectedTypeEffectiveness(pokemon.Types)
+
+	var discrepancies []string
+	if missing, extra := diffTypes(expectedWeak, pokemon.WeakAgainst); len(missing) > 0 || len(extra) > 0 {
+		discrepancies = append(discrepancies, fmt.Sprintf("weak against: missing %v, unexpected %v", missing, extra))
+	}
+	if missing, extra := diffTypes(expectedStrong, pokemon.StrongAgainst); len(missing) > 0 || len(extra) > 0 {
+		discrepancies = append(discrepancies, fmt.Sprintf("strong against: missing %v, unexpected %v", missing, extra))
+	}
+
+	return discrepancies
+}
+
+// diffTypes returns the expected types absent from actual, and the actual types not expected
+func diffTypes(expected, actual []string) (missing, extra []string) {
+	actualSet := make(map[string]bool, len(actual))
+	for _, t := range actual {
+		actualSet[NormalizeTypeName(t)] = true
+	}
+
+	expectedSet := make(map[string]bool, len(expected))
+	for _, t := range expected {
+		expectedSet[t] = true
+		if !actualSet[t] {
+			missing = append(missing, t)
+		}
+	}
+
+	for t := range actualSet {
+		if !expectedSet[t] {
+			extra = append(extra, t)
+		}
+	}
+	sort.Strings(extra)
+
+	return missing, extra
+}
+
+// NormalizeTypeName maps "fire" / " FIRE " to the chart's "Fire", the form
+// types are stored in
+func NormalizeTypeName(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	first, size := utf8.DecodeRuneInString(t)
+	if size == 0 {
+		return t
+	}
+	return string(unicode.ToUpper(first)) + t[size:]
+}
@@ -0,0 +1,60 @@
+package crawler
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpectedTypeEffectivenessForDualType(t *testing.T) {
+	weak, strong := ExpectedTypeEffectiveness([]string{"Grass", "Poison"})
+
+	if want := []string{"Fire", "Flying", "Ice", "Psychic"}; !slices.Equal(weak, want) {
+		t.Errorf("weak against %v, want %v", weak, want)
+	}
+	// Grass's Bug and Ground weaknesses are cancelled out by Poison
+	if want := []string{"Electric", "Fairy", "Fighting", "Grass", "Water"}; !slices.Equal(strong, want) {
+		t.Errorf("strong against %v, want %v", strong, want)
+	}
+}
+
+func TestValidateTypeEffectivenessFlagsWrongMatchups(t *testing.T) {
+	bulbasaur := &PokemonData{
+		Name:          "Bulbasaur",
+		Types:         []string{"Grass", "Poison"},
+		WeakAgainst:   []string{"Fire", "Flying", "Ice", "Psychic"},
+		StrongAgainst: []string{"electric", "Fairy", "Fighting", "Grass", "Water"},
+	}
+	if discrepancies := ValidateTypeEffectiveness(bulbasaur); len(discrepancies) != 0 {
+		t.Fatalf("correct matchups flagged: %v", discrepancies)
+	}
+
+	// Parsed as if only the Grass type counted
+	bulbasaur.WeakAgainst = []string{"Bug", "Fire", "Flying", "Ice", "Poison"}
+	discrepancies := ValidateTypeEffectiveness(bulbasaur)
+	if len(discrepancies) != 1 {
+		t.Fatalf("got discrepancies %v, want one for weak against", discrepancies)
+	}
+	if got := discrepancies[0]; !strings.Contains(got, "missing [Psychic]") || !strings.Contains(got, "unexpected [Bug Poison]") {
+		t.Errorf("discrepancy %q doesn't name the missing and unexpected types", got)
+	}
+}
+
+func TestNormalizeTypeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"fire", "Fire"},
+		{" FLYING ", "Flying"},
+		{"Water", "Water"},
+		{"ébène", "Ébène"}, // Multi-byte first letter
+		{"  ", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeTypeName(tt.name); got != tt.want {
+			t.Errorf("NormalizeTypeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,9 +2,13 @@ package handler
 
 import (
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/katatrina/poke-bot/internal/repository"
 	"github.com/katatrina/poke-bot/internal/service"
 )
 
@@ -19,11 +23,24 @@ func NewHTTPHandler(ragService *service.RAGService) *HTTPHandler {
 }
 
 func (hdl *HTTPHandler) HealthCheck(c *gin.Context) {
+	tokenizer := service.GetTokenizerStatus()
+
+	status := "ok"
+	if tokenizer.Degraded {
+		status = "degraded"
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"status": "ok",
+		"status":    status,
+		"tokenizer": tokenizer,
 	})
 }
 
+// Stats returns counters since startup for quick ops checks
+func (hdl *HTTPHandler) Stats(c *gin.Context) {
+	c.JSON(http.StatusOK, hdl.ragService.Stats())
+}
+
 func (hdl *HTTPHandler) IngestDoc(c *gin.Context) {
 	var req service.IngestRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -41,19 +58,146 @@ func (hdl *HTTPHandler) IngestDoc(c *gin.Context) {
 		return
 	}
 
-	if err := hdl.ragService.IngestPokemonData(c.Request.Context(), &req); err != nil {
+	// Dry runs only crawl and chunk, so they answer synchronously outside the job registry
+	if req.DryRun {
+		report, err := hdl.ragService.DryRunIngest(c.Request.Context(), &req)
+		if errors.Is(err, service.ErrNothingToIngest) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "nothing_to_ingest",
+				"details": err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "failed to dry-run ingest",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	job, existing, err := hdl.ragService.RunIngestJob(c.Request.Context(), c.GetHeader("Idempotency-Key"), &req)
+	if errors.Is(err, service.ErrTooManyIngestJobs) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "too_many_ingest_jobs",
+			"message": "Another ingest job is already running. Retry once it has finished.",
+			"job_id":  job.ID,
+			"status":  job.Status,
+		})
+		return
+	}
+	if errors.Is(err, service.ErrNothingToIngest) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "nothing_to_ingest",
+			"details": err.Error(),
+			"job_id":  job.ID,
+		})
+		return
+	}
+	if errors.Is(err, service.ErrDocumentLimitReached) {
+		c.JSON(http.StatusInsufficientStorage, gin.H{
+			"error":   "document_limit_reached",
+			"message": "The knowledge base is at its configured document limit (kb.max_total_documents).",
+			"details": err.Error(),
+			"job_id":  job.ID,
+		})
+		return
+	}
+	if errors.Is(err, repository.ErrCollectionNotFound) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "collection_not_found",
+			"message": collectionNotFoundMessage,
+			"details": err.Error(),
+			"job_id":  job.ID,
+		})
+		return
+	}
+	if errors.Is(err, service.ErrNoPokemonListed) {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":   "no_pokemon_listed",
+			"message": "The source listed no Pokemon. Its page layout may have changed; check the crawler selectors.",
+			"details": err.Error(),
+			"job_id":  job.ID,
+		})
+		return
+	}
+	if errors.Is(err, service.ErrAllPokemonFailed) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "all_pokemon_failed",
+			"message": "Pokemon were listed but none could be ingested. Check the server logs for per-Pokemon errors.",
+			"details": err.Error(),
+			"job_id":  job.ID,
+		})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "failed to ingest document",
 			"details": err.Error(),
+			"job_id":  job.ID,
+		})
+		return
+	}
+
+	// A retry with the same Idempotency-Key gets the original job back
+	if existing {
+		statusCode := http.StatusOK
+		if job.Status == service.IngestJobRunning {
+			statusCode = http.StatusAccepted
+		}
+		c.JSON(statusCode, gin.H{
+			"message":  "ingest job already " + job.Status,
+			"job_id":   job.ID,
+			"status":   job.Status,
+			"progress": job.Progress,
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "document ingested successfully",
+		"message":          "document ingested successfully",
+		"job_id":           job.ID,
+		"status":           job.Status,
+		"skipped_existing": job.Skipped,
 	})
 }
 
+func (hdl *HTTPHandler) Embed(c *gin.Context) {
+	var req service.EmbedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	resp, err := hdl.ragService.Embed(c.Request.Context(), &req)
+	if hdl.respondOllamaUnavailable(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed to generate embeddings",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 func (hdl *HTTPHandler) Chat(c *gin.Context) {
 	var req service.ChatRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -91,9 +235,26 @@ func (hdl *HTTPHandler) Chat(c *gin.Context) {
 		return
 	}
 
+	// Cache-Control: no-cache forces a fresh answer, like "no_cache": true
+	if hasNoCacheDirective(c.GetHeader("Cache-Control")) {
+		req.NoCache = true
+	}
+
 	// Process the chat request
 	resp, err := hdl.ragService.Chat(c.Request.Context(), &req)
 	if err != nil {
+		if errors.Is(err, service.ErrUnknownPersona) || errors.Is(err, service.ErrEmbeddingModelNotAllowed) ||
+			errors.Is(err, service.ErrIncompatibleEmbeddingModel) || errors.Is(err, service.ErrWordTooLong) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if respondCollectionNotFound(c, err) || hdl.respondOllamaUnavailable(c, err) {
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to process chat request",
 			"details": err.Error(),
@@ -103,3 +264,211 @@ func (hdl *HTTPHandler) Chat(c *gin.Context) {
 
 	c.JSON(http.StatusOK, resp)
 }
+
+func (hdl *HTTPHandler) MigrateCollection(c *gin.Context) {
+	result, err := hdl.ragService.MigrateCollection(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":    "Failed to migrate collection",
+			"details":  err.Error(),
+			"scanned":  result.Scanned,
+			"migrated": result.Migrated,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (hdl *HTTPHandler) ReembedCollection(c *gin.Context) {
+	result, err := hdl.ragService.ReembedCollection(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to re-embed collection",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ListPokemon returns the Pokemon matching ?types=Water,Flying, or those
+// numbered within ?from=1&to=10
+func (hdl *HTTPHandler) ListPokemon(c *gin.Context) {
+	if c.Query("from") != "" || c.Query("to") != "" {
+		hdl.listPokemonByNumber(c)
+		return
+	}
+
+	var types []string
+	for _, t := range strings.Split(c.Query("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+
+	if len(types) == 0 || len(types) > 2 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "types must list one or two comma-separated types",
+		})
+		return
+	}
+
+	pokemon, err := hdl.ragService.FindPokemonByTypes(c.Request.Context(), types)
+	if respondCollectionNotFound(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to query Pokemon",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"types":   types,
+		"pokemon": pokemon,
+	})
+}
+
+func (hdl *HTTPHandler) listPokemonByNumber(c *gin.Context) {
+	bounds := make([]int, 2)
+	for i, key := range []string{"from", "to"} {
+		value := c.Query(key)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": key + " must be a positive National number",
+			})
+			return
+		}
+		bounds[i] = n
+	}
+
+	from, to := bounds[0], bounds[1]
+	if to > 0 && from > to {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "from must not be greater than to",
+		})
+		return
+	}
+
+	pokemon, err := hdl.ragService.FindPokemonByNumberRange(c.Request.Context(), from, to)
+	if respondCollectionNotFound(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to query Pokemon",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    from,
+		"to":      to,
+		"pokemon": pokemon,
+	})
+}
+
+// Recommend ranks stored Pokemon for ?role=tank by the role's base stat
+// formula, returning the best ?limit= (default 10, max 50)
+func (hdl *HTTPHandler) Recommend(c *gin.Context) {
+	role := c.Query("role")
+	if role == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "role is required",
+			"roles": hdl.ragService.Roles(),
+		})
+		return
+	}
+
+	limit := 10
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 50 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "limit must be between 1 and 50",
+			})
+			return
+		}
+		limit = n
+	}
+
+	pokemon, err := hdl.ragService.Recommend(c.Request.Context(), role, limit)
+	if errors.Is(err, service.ErrUnknownRole) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"roles": hdl.ragService.Roles(),
+		})
+		return
+	}
+	if respondCollectionNotFound(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to rank Pokemon",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"role":    strings.ToLower(role),
+		"pokemon": pokemon,
+	})
+}
+
+// hasNoCacheDirective reports whether a Cache-Control header value contains
+// the no-cache directive
+func hasNoCacheDirective(cacheControl string) bool {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			return true
+		}
+	}
+	return false
+}
+
+// collectionNotFoundMessage tells operators how to recover from the Qdrant
+// collection being deleted while the server runs
+const collectionNotFoundMessage = "The knowledge base collection no longer exists. Restart the server (or set qdrant.recreate_missing_collection) and re-ingest."
+
+// respondCollectionNotFound writes a 503 and returns true if err means the
+// Qdrant collection is gone, so clients don't see raw gRPC errors
+func respondCollectionNotFound(c *gin.Context, err error) bool {
+	if !errors.Is(err, repository.ErrCollectionNotFound) {
+		return false
+	}
+
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error":   "collection_not_found",
+		"message": collectionNotFoundMessage,
+		"details": err.Error(),
+	})
+	return true
+}
+
+// respondOllamaUnavailable writes a 503 with Retry-After and returns true if
+// err comes from the Ollama circuit breaker failing fast
+func (hdl *HTTPHandler) respondOllamaUnavailable(c *gin.Context, err error) bool {
+	if !errors.Is(err, service.ErrOllamaUnavailable) {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(hdl.ragService.OllamaRetryAfter().Seconds()))
+	c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error":   "ollama_unavailable",
+		"message": "The language model is unavailable after repeated failures. Please try again shortly.",
+		"details": err.Error(),
+	})
+	return true
+}
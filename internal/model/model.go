@@ -8,10 +8,13 @@ type Document struct {
 	ID       uuid.UUID         `json:"id"`
 	Content  string            `json:"content"`
 	Metadata map[string]string `json:"metadata"`
+	Fields   map[string]any    `json:"fields,omitempty"` // Typed metadata stored as-is (e.g. numeric measurements)
 }
 
 type SearchResult struct {
+	ID       string            `json:"id"` // Point ID, as stored by Upsert
 	Content  string            `json:"content"`
 	Score    float32           `json:"score"`
 	Metadata map[string]string `json:"metadata"`
+	Fields   map[string]any    `json:"fields"` // Metadata with payload types preserved (numbers stay numbers)
 }
@@ -0,0 +1,260 @@
+// Package ollamatest runs a fake Ollama HTTP server for tests. Embeddings are
+// deterministic bags of hashed words, so texts sharing words score as similar,
+// and generations echo a canned answer unless a test installs its own.
+package ollamatest
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"unicode"
+)
+
+// DefaultAnswer is what /api/generate returns when no Generate hook is set
+const DefaultAnswer = "Pikachu is an Electric-type Pokemon."
+
+// EmbedRequest is the body of an /api/embed call
+type EmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// GenerateRequest is the body of an /api/generate call
+type GenerateRequest struct {
+	Model   string         `json:"model"`
+	Prompt  string         `json:"prompt"`
+	Options map[string]any `json:"options"`
+	Format  any            `json:"format"`
+	Images  []string       `json:"images"`
+	Stream  *bool          `json:"stream"` // Ollama streams unless this is false
+}
+
+// Server is a fake Ollama. Hooks and recorded requests are guarded by mu.
+type Server struct {
+	*httptest.Server
+
+	dimension int
+
+	mu           sync.Mutex
+	models       []string
+	capabilities []string
+	embed        func(text string) []float32
+	embedLimit   int // Most embeddings returned per /api/embed call (0 = all)
+	generate     func(req GenerateRequest) string
+	statuses     map[string]int // Forced response status by path
+	embeds       []EmbedRequest
+	generates    []GenerateRequest
+}
+
+// NewServer starts a fake Ollama whose embeddings have the given dimension.
+// It is closed when the test ends.
+func NewServer(t testing.TB, dimension int) *Server {
+	t.Helper()
+
+	s := &Server{
+		dimension: dimension,
+		statuses:  make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/embed", s.handleEmbed)
+	mux.HandleFunc("POST /api/generate", s.handleGenerate)
+	mux.HandleFunc("POST /api/show", s.handleShow)
+	mux.HandleFunc("GET /api/tags", s.handleTags)
+
+	s.Server = httptest.NewServer(s.withStatus(mux))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Embedding returns the deterministic vector the server embeds text as: each
+// word hashed into a dimension, plus a constant component so no text maps to
+// the zero vector, normalized to unit length
+func Embedding(text string, dimension int) []float32 {
+	vector := make([]float32, dimension)
+	vector[0] = 0.1
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		vector[1+int(h.Sum32())%(dimension-1)]++
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
+
+// SetModels sets the model names /api/tags lists
+func (s *Server) SetModels(models ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.models = models
+}
+
+// SetCapabilities sets the capabilities /api/show reports for any model
+func (s *Server) SetCapabilities(capabilities ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.capabilities = capabilities
+}
+
+// SetEmbed replaces how each input is embedded. A nil hook restores Embedding.
+func (s *Server) SetEmbed(embed func(text string) []float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.embed = embed
+}
+
+// SetEmbedLimit caps how many embeddings each /api/embed call returns,
+// dropping the rest of the batch like a misbehaving server. Zero clears it.
+func (s *Server) SetEmbedLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.embedLimit = limit
+}
+
+// SetGenerate replaces the /api/generate answer. A nil hook restores DefaultAnswer.
+func (s *Server) SetGenerate(generate func(req GenerateRequest) string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generate = generate
+}
+
+// SetStatus makes every request to path (e.g. "/api/embed") fail with
+// status code. Zero clears it.
+func (s *Server) SetStatus(path string, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if code == 0 {
+		delete(s.statuses, path)
+		return
+	}
+	s.statuses[path] = code
+}
+
+// EmbedRequests returns every /api/embed request received, oldest first
+func (s *Server) EmbedRequests() []EmbedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.embeds)
+}
+
+// GenerateRequests returns every /api/generate request received, oldest first
+func (s *Server) GenerateRequests() []GenerateRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.generates)
+}
+
+// withStatus fails requests to paths with a forced status before they reach next
+func (s *Server) withStatus(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		code := s.statuses[r.URL.Path]
+		s.mu.Unlock()
+
+		if code != 0 {
+			http.Error(w, `{"error":"forced failure"}`, code)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleEmbed(w http.ResponseWriter, r *http.Request) {
+	var req EmbedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.embeds = append(s.embeds, req)
+	embed := s.embed
+	limit := s.embedLimit
+	s.mu.Unlock()
+
+	embeddings := make([][]float32, len(req.Input))
+	for i, text := range req.Input {
+		if embed != nil {
+			embeddings[i] = embed(text)
+		} else {
+			embeddings[i] = Embedding(text, s.dimension)
+		}
+	}
+
+	if limit > 0 && len(embeddings) > limit {
+		embeddings = embeddings[:limit]
+	}
+
+	writeJSON(w, map[string]any{"model": req.Model, "embeddings": embeddings})
+}
+
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	var req GenerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.generates = append(s.generates, req)
+	generate := s.generate
+	s.mu.Unlock()
+
+	answer := DefaultAnswer
+	if generate != nil {
+		answer = generate(req)
+	}
+
+	writeJSON(w, map[string]any{"model": req.Model, "response": answer, "done": true})
+}
+
+func (s *Server) handleShow(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	capabilities := slices.Clone(s.capabilities)
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]any{"capabilities": capabilities})
+}
+
+func (s *Server) handleTags(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	models := make([]map[string]string, 0, len(s.models))
+	for _, name := range s.models {
+		models = append(models, map[string]string{"name": name})
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]any{"models": models})
+}
+
+func writeJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,24 @@
+// Package pokename normalizes Pokemon names so the same Pokemon always maps
+// to the same metadata value, however its name was scraped or typed
+package pokename
+
+import "strings"
+
+// markReplacer drops trademark-style symbols that pokemondb and PokeAPI
+// occasionally attach to names
+var markReplacer = strings.NewReplacer("™", "", "®", "", "©", "")
+
+// Display cleans a name for presentation: trademark symbols are removed and
+// runs of whitespace collapse to a single space. Casing is kept as scraped.
+func Display(name string) string {
+	return strings.Join(strings.Fields(markReplacer.Replace(name)), " ")
+}
+
+// Key returns the canonical form used to compare and filter Pokemon names:
+// lowercase words joined with hyphens, matching pokemondb and PokeAPI URLs
+// ("Mr. Mime" -> "mr-mime", "PIKACHU™" -> "pikachu")
+func Key(name string) string {
+	name = strings.ToLower(Display(name))
+	name = strings.NewReplacer(".", " ", "'", "", "’", "", ":", " ").Replace(name)
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool { return r == ' ' || r == '-' }), "-")
+}
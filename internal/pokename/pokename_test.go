@@ -0,0 +1,45 @@
+package pokename
+
+import "testing"
+
+func TestKeyMapsMessyNamesToOneKey(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Pikachu", "pikachu"},
+		{"PIKACHU™", "pikachu"},
+		{"  Pikachu®\t", "pikachu"},
+		{"Mr. Mime", "mr-mime"},
+		{"mr-mime", "mr-mime"},
+		{"Mr.  Mime™", "mr-mime"},
+		{"Farfetch’d", "farfetchd"},
+		{"Farfetch'd", "farfetchd"},
+		{"Type: Null", "type-null"},
+		{"Ho-Oh", "ho-oh"},
+		{"Tapu  Koko", "tapu-koko"},
+	}
+
+	for _, tt := range tests {
+		if got := Key(tt.name); got != tt.want {
+			t.Errorf("Key(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDisplayKeepsCasing(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Pikachu™", "Pikachu"},
+		{"  Mr.   Mime ", "Mr. Mime"},
+		{"Farfetch’d®", "Farfetch’d"},
+	}
+
+	for _, tt := range tests {
+		if got := Display(tt.name); got != tt.want {
+			t.Errorf("Display(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
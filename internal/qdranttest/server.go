@@ -0,0 +1,878 @@
+// Package qdranttest runs an in-memory Qdrant gRPC server for tests. It
+// implements the subset of the collections and points APIs the repository
+// uses, closely enough that repository code runs against it unchanged.
+package qdranttest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultLimit is what Qdrant returns when a query or scroll sets no limit
+const defaultLimit = 10
+
+// Server is an in-memory Qdrant. Collections and points live in maps guarded
+// by mu; every request is recorded so tests can assert on what was sent.
+type Server struct {
+	client *qdrant.Client
+
+	mu          sync.Mutex
+	collections map[string]*collection
+	aliases     map[string]string // Alias name to collection name
+	calls       map[string]int
+	queries     []*qdrant.QueryPoints
+	scrolls     []*qdrant.ScrollPoints
+	errs        map[string]error
+	score       func(payload map[string]*qdrant.Value, score float32) float32
+}
+
+type collection struct {
+	dimension uint64
+	points    map[string]*point
+	indexes   map[string]qdrant.FieldType
+}
+
+type point struct {
+	id      *qdrant.PointId
+	vector  []float32
+	payload map[string]*qdrant.Value
+}
+
+// NewServer starts a server on a loopback port and returns it with a
+// connected client. Both are shut down when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	s := &Server{
+		collections: make(map[string]*collection),
+		aliases:     make(map[string]string),
+		calls:       make(map[string]int),
+		errs:        make(map[string]error),
+	}
+
+	grpcServer := grpc.NewServer()
+	qdrant.RegisterCollectionsServer(grpcServer, collectionsServer{Server: s})
+	qdrant.RegisterPointsServer(grpcServer, pointsServer{Server: s})
+	go grpcServer.Serve(listener)
+
+	addr := listener.Addr().(*net.TCPAddr)
+	client, err := qdrant.NewClient(&qdrant.Config{
+		Host:                   addr.IP.String(),
+		Port:                   addr.Port,
+		SkipCompatibilityCheck: true,
+		GrpcOptions:            []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+	})
+	if err != nil {
+		grpcServer.Stop()
+		t.Fatalf("failed to create qdrant client: %v", err)
+	}
+	s.client = client
+
+	t.Cleanup(func() {
+		client.Close()
+		grpcServer.Stop()
+	})
+
+	return s
+}
+
+// Client returns a client connected to the server
+func (s *Server) Client() *qdrant.Client {
+	return s.client
+}
+
+// CreateCollection creates an empty collection of the given dimension, as if
+// it had been left behind by an earlier run
+func (s *Server) CreateCollection(name string, dimension uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.collections[name] = newCollection(dimension)
+}
+
+// DeleteCollection drops a collection and the aliases pointing to it, as an
+// operator deleting it out from under the server would
+func (s *Server) DeleteCollection(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteCollection(name)
+}
+
+// Collections returns the names of every collection, sorted
+func (s *Server) Collections() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.collections))
+	for name := range s.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AliasTarget returns the collection alias points to, or "" if it doesn't exist
+func (s *Server) AliasTarget(alias string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.aliases[alias]
+}
+
+// Indexes returns the payload indexes created on a collection, by field name
+func (s *Server) Indexes(name string) map[string]qdrant.FieldType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	col, ok := s.lookup(name)
+	if !ok {
+		return nil
+	}
+	indexes := make(map[string]qdrant.FieldType, len(col.indexes))
+	for field, fieldType := range col.indexes {
+		indexes[field] = fieldType
+	}
+	return indexes
+}
+
+// Points returns every point in a collection (or behind an alias) in ID order,
+// with payloads and vectors
+func (s *Server) Points(name string) []*qdrant.RetrievedPoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	col, ok := s.lookup(name)
+	if !ok {
+		return nil
+	}
+	var points []*qdrant.RetrievedPoint
+	for _, p := range col.sorted() {
+		points = append(points, &qdrant.RetrievedPoint{
+			Id:      p.id,
+			Payload: clonePayload(p.payload),
+			Vectors: vectorsOutput(p.vector),
+		})
+	}
+	return points
+}
+
+// Upsert stores points directly, bypassing the client
+func (s *Server) Upsert(name string, points ...*qdrant.PointStruct) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	col, ok := s.lookup(name)
+	if !ok {
+		panic(fmt.Sprintf("qdranttest: collection %q not found", name))
+	}
+	for _, p := range points {
+		col.points[idKey(p.GetId())] = &point{
+			id:      p.GetId(),
+			vector:  pointVector(p.GetVectors()),
+			payload: clonePayload(p.GetPayload()),
+		}
+	}
+}
+
+// Calls returns how many times the named RPC (e.g. "Query", "Upsert") was called
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[method]
+}
+
+// Queries returns every Query request received, oldest first
+func (s *Server) Queries() []*qdrant.QueryPoints {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.queries)
+}
+
+// Scrolls returns every Scroll request received, oldest first
+func (s *Server) Scrolls() []*qdrant.ScrollPoints {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.scrolls)
+}
+
+// SetError makes every call to the named RPC fail with err until it is
+// cleared with a nil err
+func (s *Server) SetError(method string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		delete(s.errs, method)
+		return
+	}
+	s.errs[method] = err
+}
+
+// SetScore installs a hook that rewrites each query score, for simulating
+// malformed scores. A nil hook restores plain cosine similarity.
+func (s *Server) SetScore(score func(payload map[string]*qdrant.Value, score float32) float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.score = score
+}
+
+// begin counts a call and returns the injected error for it, if any. The
+// caller must hold mu.
+func (s *Server) begin(method string) error {
+	s.calls[method]++
+	return s.errs[method]
+}
+
+// lookup resolves name, which may be an alias. The caller must hold mu.
+func (s *Server) lookup(name string) (*collection, bool) {
+	if target, ok := s.aliases[name]; ok {
+		name = target
+	}
+	col, ok := s.collections[name]
+	return col, ok
+}
+
+// collection is lookup returning the NotFound status Qdrant sends for a
+// missing collection. The caller must hold mu.
+func (s *Server) collection(name string) (*collection, error) {
+	col, ok := s.lookup(name)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Not found: Collection `%s` doesn't exist!", name)
+	}
+	return col, nil
+}
+
+// deleteCollection is DeleteCollection for callers holding mu
+func (s *Server) deleteCollection(name string) bool {
+	if _, ok := s.collections[name]; !ok {
+		return false
+	}
+	delete(s.collections, name)
+	for alias, target := range s.aliases {
+		if target == name {
+			delete(s.aliases, alias)
+		}
+	}
+	return true
+}
+
+func newCollection(dimension uint64) *collection {
+	return &collection{
+		dimension: dimension,
+		points:    make(map[string]*point),
+		indexes:   make(map[string]qdrant.FieldType),
+	}
+}
+
+// sorted returns the collection's points in ID order, which is the order
+// Qdrant scrolls them in
+func (col *collection) sorted() []*point {
+	points := make([]*point, 0, len(col.points))
+	for _, p := range col.points {
+		points = append(points, p)
+	}
+	sort.Slice(points, func(i, j int) bool { return lessID(points[i].id, points[j].id) })
+	return points
+}
+
+// filtered returns the points matching filter in ID order
+func (col *collection) filtered(filter *qdrant.Filter) []*point {
+	var points []*point
+	for _, p := range col.sorted() {
+		if matchFilter(filter, p.payload) {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+type collectionsServer struct {
+	*Server
+	qdrant.UnimplementedCollectionsServer
+}
+
+func (cs collectionsServer) List(context.Context, *qdrant.ListCollectionsRequest) (*qdrant.ListCollectionsResponse, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := cs.begin("ListCollections"); err != nil {
+		return nil, err
+	}
+
+	resp := &qdrant.ListCollectionsResponse{}
+	names := make([]string, 0, len(cs.collections))
+	for name := range cs.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		resp.Collections = append(resp.Collections, &qdrant.CollectionDescription{Name: name})
+	}
+	return resp, nil
+}
+
+func (cs collectionsServer) Create(_ context.Context, req *qdrant.CreateCollection) (*qdrant.CollectionOperationResponse, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := cs.begin("CreateCollection"); err != nil {
+		return nil, err
+	}
+
+	name := req.GetCollectionName()
+	if _, ok := cs.collections[name]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "Wrong input: Collection `%s` already exists!", name)
+	}
+	cs.collections[name] = newCollection(req.GetVectorsConfig().GetParams().GetSize())
+	return &qdrant.CollectionOperationResponse{Result: true}, nil
+}
+
+func (cs collectionsServer) Delete(_ context.Context, req *qdrant.DeleteCollection) (*qdrant.CollectionOperationResponse, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := cs.begin("DeleteCollection"); err != nil {
+		return nil, err
+	}
+
+	// Like Qdrant, deleting a missing collection succeeds with a false result
+	return &qdrant.CollectionOperationResponse{Result: cs.deleteCollection(req.GetCollectionName())}, nil
+}
+
+func (cs collectionsServer) UpdateAliases(_ context.Context, req *qdrant.ChangeAliases) (*qdrant.CollectionOperationResponse, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := cs.begin("UpdateAliases"); err != nil {
+		return nil, err
+	}
+
+	// Apply to a copy so a failing action leaves the aliases untouched
+	aliases := make(map[string]string, len(cs.aliases))
+	for alias, target := range cs.aliases {
+		aliases[alias] = target
+	}
+
+	for _, action := range req.GetActions() {
+		switch op := action.GetAction().(type) {
+		case *qdrant.AliasOperations_CreateAlias:
+			if _, ok := cs.collections[op.CreateAlias.GetCollectionName()]; !ok {
+				return nil, status.Errorf(codes.NotFound, "Not found: Collection `%s` doesn't exist!", op.CreateAlias.GetCollectionName())
+			}
+			aliases[op.CreateAlias.GetAliasName()] = op.CreateAlias.GetCollectionName()
+		case *qdrant.AliasOperations_DeleteAlias:
+			if _, ok := aliases[op.DeleteAlias.GetAliasName()]; !ok {
+				return nil, status.Errorf(codes.NotFound, "Not found: Alias `%s` doesn't exist!", op.DeleteAlias.GetAliasName())
+			}
+			delete(aliases, op.DeleteAlias.GetAliasName())
+		case *qdrant.AliasOperations_RenameAlias:
+			target, ok := aliases[op.RenameAlias.GetOldAliasName()]
+			if !ok {
+				return nil, status.Errorf(codes.NotFound, "Not found: Alias `%s` doesn't exist!", op.RenameAlias.GetOldAliasName())
+			}
+			delete(aliases, op.RenameAlias.GetOldAliasName())
+			aliases[op.RenameAlias.GetNewAliasName()] = target
+		}
+	}
+
+	cs.aliases = aliases
+	return &qdrant.CollectionOperationResponse{Result: true}, nil
+}
+
+func (cs collectionsServer) ListAliases(context.Context, *qdrant.ListAliasesRequest) (*qdrant.ListAliasesResponse, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := cs.begin("ListAliases"); err != nil {
+		return nil, err
+	}
+
+	resp := &qdrant.ListAliasesResponse{}
+	for alias, target := range cs.aliases {
+		resp.Aliases = append(resp.Aliases, &qdrant.AliasDescription{AliasName: alias, CollectionName: target})
+	}
+	sort.Slice(resp.Aliases, func(i, j int) bool { return resp.Aliases[i].AliasName < resp.Aliases[j].AliasName })
+	return resp, nil
+}
+
+type pointsServer struct {
+	*Server
+	qdrant.UnimplementedPointsServer
+}
+
+func (ps pointsServer) Upsert(_ context.Context, req *qdrant.UpsertPoints) (*qdrant.PointsOperationResponse, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if err := ps.begin("Upsert"); err != nil {
+		return nil, err
+	}
+
+	col, err := ps.collection(req.GetCollectionName())
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the whole batch first, as Qdrant rejects it as a unit
+	for _, p := range req.GetPoints() {
+		if vector := pointVector(p.GetVectors()); uint64(len(vector)) != col.dimension {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"Wrong input: Vector dimension error: expected dim: %d, got %d", col.dimension, len(vector))
+		}
+	}
+	for _, p := range req.GetPoints() {
+		col.points[idKey(p.GetId())] = &point{
+			id:      p.GetId(),
+			vector:  pointVector(p.GetVectors()),
+			payload: clonePayload(p.GetPayload()),
+		}
+	}
+
+	return &qdrant.PointsOperationResponse{Result: &qdrant.UpdateResult{Status: qdrant.UpdateStatus_Completed}}, nil
+}
+
+func (ps pointsServer) SetPayload(_ context.Context, req *qdrant.SetPayloadPoints) (*qdrant.PointsOperationResponse, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if err := ps.begin("SetPayload"); err != nil {
+		return nil, err
+	}
+
+	col, err := ps.collection(req.GetCollectionName())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range selectPoints(col, req.GetPointsSelector()) {
+		for k, v := range req.GetPayload() {
+			p.payload[k] = proto.Clone(v).(*qdrant.Value)
+		}
+	}
+
+	return &qdrant.PointsOperationResponse{Result: &qdrant.UpdateResult{Status: qdrant.UpdateStatus_Completed}}, nil
+}
+
+func (ps pointsServer) Delete(_ context.Context, req *qdrant.DeletePoints) (*qdrant.PointsOperationResponse, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if err := ps.begin("Delete"); err != nil {
+		return nil, err
+	}
+
+	col, err := ps.collection(req.GetCollectionName())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range selectPoints(col, req.GetPoints()) {
+		delete(col.points, idKey(p.id))
+	}
+
+	return &qdrant.PointsOperationResponse{Result: &qdrant.UpdateResult{Status: qdrant.UpdateStatus_Completed}}, nil
+}
+
+func (ps pointsServer) CreateFieldIndex(_ context.Context, req *qdrant.CreateFieldIndexCollection) (*qdrant.PointsOperationResponse, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if err := ps.begin("CreateFieldIndex"); err != nil {
+		return nil, err
+	}
+
+	col, err := ps.collection(req.GetCollectionName())
+	if err != nil {
+		return nil, err
+	}
+	col.indexes[req.GetFieldName()] = req.GetFieldType()
+
+	return &qdrant.PointsOperationResponse{Result: &qdrant.UpdateResult{Status: qdrant.UpdateStatus_Completed}}, nil
+}
+
+func (ps pointsServer) Count(_ context.Context, req *qdrant.CountPoints) (*qdrant.CountResponse, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if err := ps.begin("Count"); err != nil {
+		return nil, err
+	}
+
+	col, err := ps.collection(req.GetCollectionName())
+	if err != nil {
+		return nil, err
+	}
+
+	return &qdrant.CountResponse{Result: &qdrant.CountResult{Count: uint64(len(col.filtered(req.GetFilter())))}}, nil
+}
+
+func (ps pointsServer) Scroll(_ context.Context, req *qdrant.ScrollPoints) (*qdrant.ScrollResponse, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.scrolls = append(ps.scrolls, proto.Clone(req).(*qdrant.ScrollPoints))
+	if err := ps.begin("Scroll"); err != nil {
+		return nil, err
+	}
+
+	col, err := ps.collection(req.GetCollectionName())
+	if err != nil {
+		return nil, err
+	}
+
+	limit := int(req.GetLimit())
+	if req.Limit == nil {
+		limit = defaultLimit
+	}
+
+	points := col.filtered(req.GetFilter())
+	resp := &qdrant.ScrollResponse{}
+
+	if orderBy := req.GetOrderBy(); orderBy != nil {
+		// Ordered scrolls skip points without the key and return no next offset
+		points = slices.DeleteFunc(points, func(p *point) bool {
+			_, ok := numericValue(p.payload[orderBy.GetKey()])
+			return !ok
+		})
+		sort.SliceStable(points, func(i, j int) bool {
+			a, _ := numericValue(points[i].payload[orderBy.GetKey()])
+			b, _ := numericValue(points[j].payload[orderBy.GetKey()])
+			if orderBy.GetDirection() == qdrant.Direction_Desc {
+				return a > b
+			}
+			return a < b
+		})
+		if len(points) > limit {
+			points = points[:limit]
+		}
+	} else {
+		if offset := req.GetOffset(); offset != nil {
+			start := sort.Search(len(points), func(i int) bool { return !lessID(points[i].id, offset) })
+			points = points[start:]
+		}
+		if len(points) > limit {
+			resp.NextPageOffset = points[limit].id
+			points = points[:limit]
+		}
+	}
+
+	for _, p := range points {
+		retrieved := &qdrant.RetrievedPoint{
+			Id:      p.id,
+			Payload: selectPayload(p.payload, req.GetWithPayload()),
+		}
+		if req.GetWithVectors().GetEnable() {
+			retrieved.Vectors = vectorsOutput(p.vector)
+		}
+		resp.Result = append(resp.Result, retrieved)
+	}
+
+	return resp, nil
+}
+
+func (ps pointsServer) Query(_ context.Context, req *qdrant.QueryPoints) (*qdrant.QueryResponse, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.queries = append(ps.queries, proto.Clone(req).(*qdrant.QueryPoints))
+	if err := ps.begin("Query"); err != nil {
+		return nil, err
+	}
+
+	col, err := ps.collection(req.GetCollectionName())
+	if err != nil {
+		return nil, err
+	}
+
+	vector := req.GetQuery().GetNearest().GetDense().GetData()
+	if uint64(len(vector)) != col.dimension {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"Wrong input: Vector dimension error: expected dim: %d, got %d", col.dimension, len(vector))
+	}
+
+	limit := int(req.GetLimit())
+	if req.Limit == nil {
+		limit = defaultLimit
+	}
+
+	var scored []*qdrant.ScoredPoint
+	for _, p := range col.filtered(req.GetFilter()) {
+		score := cosine(vector, p.vector)
+		if ps.score != nil {
+			score = ps.score(p.payload, score)
+		}
+		if req.ScoreThreshold != nil && !(score >= req.GetScoreThreshold()) {
+			continue
+		}
+		scored = append(scored, &qdrant.ScoredPoint{
+			Id:      p.id,
+			Payload: selectPayload(p.payload, req.GetWithPayload()),
+			Score:   score,
+		})
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].Score > scored[j].Score })
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+
+	return &qdrant.QueryResponse{Result: scored}, nil
+}
+
+// selectPoints returns the points a selector picks, by ID list or filter
+func selectPoints(col *collection, selector *qdrant.PointsSelector) []*point {
+	if ids := selector.GetPoints(); ids != nil {
+		var points []*point
+		for _, id := range ids.GetIds() {
+			if p, ok := col.points[idKey(id)]; ok {
+				points = append(points, p)
+			}
+		}
+		return points
+	}
+	return col.filtered(selector.GetFilter())
+}
+
+// matchFilter reports whether payload satisfies filter. A nil filter matches
+// everything.
+func matchFilter(filter *qdrant.Filter, payload map[string]*qdrant.Value) bool {
+	if filter == nil {
+		return true
+	}
+	for _, cond := range filter.GetMust() {
+		if !matchCondition(cond, payload) {
+			return false
+		}
+	}
+	for _, cond := range filter.GetMustNot() {
+		if matchCondition(cond, payload) {
+			return false
+		}
+	}
+	if should := filter.GetShould(); len(should) > 0 {
+		for _, cond := range should {
+			if matchCondition(cond, payload) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchCondition(cond *qdrant.Condition, payload map[string]*qdrant.Value) bool {
+	switch c := cond.GetConditionOneOf().(type) {
+	case *qdrant.Condition_Filter:
+		return matchFilter(c.Filter, payload)
+	case *qdrant.Condition_IsEmpty:
+		values := fieldValues(payload[c.IsEmpty.GetKey()])
+		return len(values) == 0
+	case *qdrant.Condition_Field:
+		return matchField(c.Field, payload)
+	default:
+		panic(fmt.Sprintf("qdranttest: unsupported condition %T", c))
+	}
+}
+
+func matchField(field *qdrant.FieldCondition, payload map[string]*qdrant.Value) bool {
+	values := fieldValues(payload[field.GetKey()])
+
+	if r := field.GetRange(); r != nil {
+		for _, v := range values {
+			n, ok := numericValue(v)
+			if ok && (r.Gte == nil || n >= r.GetGte()) && (r.Gt == nil || n > r.GetGt()) &&
+				(r.Lte == nil || n <= r.GetLte()) && (r.Lt == nil || n < r.GetLt()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	match := field.GetMatch()
+	if match == nil {
+		panic(fmt.Sprintf("qdranttest: unsupported field condition on %q", field.GetKey()))
+	}
+	for _, v := range values {
+		switch m := match.GetMatchValue().(type) {
+		case *qdrant.Match_Keyword:
+			if v.GetStringValue() == m.Keyword {
+				return true
+			}
+		case *qdrant.Match_Keywords:
+			if _, ok := v.GetKind().(*qdrant.Value_StringValue); ok && slices.Contains(m.Keywords.GetStrings(), v.GetStringValue()) {
+				return true
+			}
+		case *qdrant.Match_Text:
+			if matchText(v.GetStringValue(), m.Text) {
+				return true
+			}
+		case *qdrant.Match_Integer:
+			if n, ok := v.GetKind().(*qdrant.Value_IntegerValue); ok && n.IntegerValue == m.Integer {
+				return true
+			}
+		case *qdrant.Match_Boolean:
+			if b, ok := v.GetKind().(*qdrant.Value_BoolValue); ok && b.BoolValue == m.Boolean {
+				return true
+			}
+		default:
+			panic(fmt.Sprintf("qdranttest: unsupported match %T", m))
+		}
+	}
+	return false
+}
+
+// matchText approximates Qdrant's word tokenizer: every word of query must
+// appear as a word of text, ignoring case
+func matchText(text, query string) bool {
+	words := make(map[string]bool)
+	for _, word := range tokenize(text) {
+		words[word] = true
+	}
+	queryWords := tokenize(query)
+	for _, word := range queryWords {
+		if !words[word] {
+			return false
+		}
+	}
+	return len(queryWords) > 0
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 0x7f)
+	})
+}
+
+// fieldValues flattens a payload value so list elements match individually
+func fieldValues(v *qdrant.Value) []*qdrant.Value {
+	if v == nil {
+		return nil
+	}
+	if list, ok := v.GetKind().(*qdrant.Value_ListValue); ok {
+		return list.ListValue.GetValues()
+	}
+	if _, ok := v.GetKind().(*qdrant.Value_NullValue); ok {
+		return nil
+	}
+	return []*qdrant.Value{v}
+}
+
+func numericValue(v *qdrant.Value) (float64, bool) {
+	switch kind := v.GetKind().(type) {
+	case *qdrant.Value_IntegerValue:
+		return float64(kind.IntegerValue), true
+	case *qdrant.Value_DoubleValue:
+		return kind.DoubleValue, true
+	}
+	return 0, false
+}
+
+// selectPayload applies a with_payload selector. A nil selector returns no
+// payload, as Qdrant does.
+func selectPayload(payload map[string]*qdrant.Value, selector *qdrant.WithPayloadSelector) map[string]*qdrant.Value {
+	switch s := selector.GetSelectorOptions().(type) {
+	case *qdrant.WithPayloadSelector_Enable:
+		if s.Enable {
+			return clonePayload(payload)
+		}
+	case *qdrant.WithPayloadSelector_Include:
+		selected := make(map[string]*qdrant.Value)
+		for _, field := range s.Include.GetFields() {
+			if v, ok := payload[field]; ok {
+				selected[field] = proto.Clone(v).(*qdrant.Value)
+			}
+		}
+		return selected
+	case *qdrant.WithPayloadSelector_Exclude:
+		selected := clonePayload(payload)
+		for _, field := range s.Exclude.GetFields() {
+			delete(selected, field)
+		}
+		return selected
+	}
+	return nil
+}
+
+func clonePayload(payload map[string]*qdrant.Value) map[string]*qdrant.Value {
+	cloned := make(map[string]*qdrant.Value, len(payload))
+	for k, v := range payload {
+		cloned[k] = proto.Clone(v).(*qdrant.Value)
+	}
+	return cloned
+}
+
+// pointVector returns the dense vector of an upserted point
+func pointVector(vectors *qdrant.Vectors) []float32 {
+	vector := vectors.GetVector()
+	if dense := vector.GetDense().GetData(); len(dense) > 0 {
+		return slices.Clone(dense)
+	}
+	return slices.Clone(vector.GetData())
+}
+
+func vectorsOutput(vector []float32) *qdrant.VectorsOutput {
+	return &qdrant.VectorsOutput{
+		VectorsOptions: &qdrant.VectorsOutput_Vector{
+			Vector: &qdrant.VectorOutput{
+				Vector: &qdrant.VectorOutput_Dense{Dense: &qdrant.DenseVector{Data: slices.Clone(vector)}},
+			},
+		},
+	}
+}
+
+// cosine returns the cosine similarity of a and b, NaN if either is zero
+func cosine(a, b []float32) float32 {
+	var dot, normA, normB float64
+	for i := range min(len(a), len(b)) {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
+
+// idKey returns a map key for a point ID
+func idKey(id *qdrant.PointId) string {
+	if uuid := id.GetUuid(); uuid != "" {
+		return uuid
+	}
+	return strconv.FormatUint(id.GetNum(), 10)
+}
+
+// lessID orders numeric IDs before UUIDs, each in natural order
+func lessID(a, b *qdrant.PointId) bool {
+	aUUID, bUUID := a.GetUuid(), b.GetUuid()
+	switch {
+	case aUUID == "" && bUUID == "":
+		return a.GetNum() < b.GetNum()
+	case aUUID == "" || bUUID == "":
+		return aUUID == ""
+	default:
+		return aUUID < bUUID
+	}
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+type shadowKey struct{}
+
+// WithShadow directs the repository calls made with ctx to the shadow
+// collection instead of the alias, so an ingest can fill it while chats keep
+// searching through the alias
+func WithShadow(ctx context.Context, shadow string) context.Context {
+	return context.WithValue(ctx, shadowKey{}, shadow)
+}
+
+// target returns the collection calls made with ctx operate on
+func (repo *VectorRepository) target(ctx context.Context) string {
+	if shadow, ok := ctx.Value(shadowKey{}).(string); ok && shadow != "" {
+		return shadow
+	}
+	return repo.collection
+}
+
+// UsesAlias reports whether cfg.Qdrant.Alias is set, so ingests should go
+// through a shadow collection
+func (repo *VectorRepository) UsesAlias() bool {
+	return repo.alias != ""
+}
+
+// ensureAlias makes the alias point at a collection, creating the collection
+// named after the configured one when the alias doesn't exist yet
+func (repo *VectorRepository) ensureAlias(ctx context.Context) error {
+	current, err := repo.aliasTarget(ctx)
+	if err != nil {
+		return err
+	}
+	if current != "" {
+		repo.ensureIndexes(ctx, current)
+		log.Printf("Qdrant alias %q points to collection %q", repo.alias, current)
+		return nil
+	}
+
+	collections, err := repo.qdrantClient.ListCollections(ctx)
+	if err != nil {
+		return err
+	}
+	exists := false
+	for _, col := range collections {
+		if col == repo.alias {
+			return fmt.Errorf("qdrant.alias %q is already the name of a collection", repo.alias)
+		}
+		if col == repo.baseCollection {
+			exists = true
+		}
+	}
+	if exists {
+		repo.ensureIndexes(ctx, repo.baseCollection)
+	} else if err := repo.createCollection(ctx, repo.baseCollection); err != nil {
+		return err
+	}
+
+	if err := repo.qdrantClient.CreateAlias(ctx, repo.alias, repo.baseCollection); err != nil {
+		return fmt.Errorf("failed to create alias %q: %w", repo.alias, err)
+	}
+	log.Printf("Created Qdrant alias %q for collection %q", repo.alias, repo.baseCollection)
+
+	return nil
+}
+
+// aliasTarget returns the collection the alias points to, or "" if the alias
+// doesn't exist
+func (repo *VectorRepository) aliasTarget(ctx context.Context) (string, error) {
+	aliases, err := repo.qdrantClient.ListAliases(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, alias := range aliases {
+		if alias.GetAliasName() == repo.alias {
+			return alias.GetCollectionName(), nil
+		}
+	}
+	return "", nil
+}
+
+// CreateShadow creates a new collection holding a copy of every point behind
+// the alias, for an ingest to add to without chats seeing it half done
+func (repo *VectorRepository) CreateShadow(ctx context.Context) (string, error) {
+	return repo.createShadow(ctx, true)
+}
+
+// createShadow creates a collection named after the configured one with a
+// timestamp suffix, copying the alias's points into it when copyPoints is set
+func (repo *VectorRepository) createShadow(ctx context.Context, copyPoints bool) (string, error) {
+	shadow := fmt.Sprintf("%s_%d", repo.baseCollection, time.Now().UnixNano())
+	if err := repo.createCollection(ctx, shadow); err != nil {
+		return "", fmt.Errorf("failed to create shadow collection: %w", err)
+	}
+
+	if copyPoints {
+		copied, err := repo.copyPoints(ctx, shadow)
+		if err != nil {
+			repo.DropCollection(ctx, shadow)
+			return "", fmt.Errorf("failed to copy points into shadow collection: %w", err)
+		}
+		log.Printf("Created shadow collection %q with %d copied points", shadow, copied)
+	}
+
+	return shadow, nil
+}
+
+// copyPoints copies every point behind the alias, vectors included, into dest
+func (repo *VectorRepository) copyPoints(ctx context.Context, dest string) (int, error) {
+	var (
+		copied int
+		offset *qdrant.PointId
+	)
+
+	for {
+		points, nextOffset, err := repo.qdrantClient.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: repo.collection,
+			Offset:         offset,
+			Limit:          qdrant.PtrOf(uint32(256)),
+			WithPayload:    qdrant.NewWithPayload(true),
+			WithVectors:    qdrant.NewWithVectors(true),
+		})
+		if err != nil {
+			return copied, err
+		}
+
+		if len(points) > 0 {
+			batch := make([]*qdrant.PointStruct, 0, len(points))
+			for _, point := range points {
+				batch = append(batch, &qdrant.PointStruct{
+					Id:      point.GetId(),
+					Vectors: qdrant.NewVectors(denseVector(point.GetVectors())...),
+					Payload: point.GetPayload(),
+				})
+			}
+			if _, err := repo.qdrantClient.Upsert(ctx, &qdrant.UpsertPoints{
+				CollectionName: dest,
+				Wait:           qdrant.PtrOf(true),
+				Points:         batch,
+			}); err != nil {
+				return copied, err
+			}
+			copied += len(batch)
+		}
+
+		if nextOffset == nil {
+			break
+		}
+		offset = nextOffset
+	}
+
+	return copied, nil
+}
+
+// denseVector returns the single dense vector of a retrieved point, which
+// older Qdrant servers report in the deprecated data field
+func denseVector(vectors *qdrant.VectorsOutput) []float32 {
+	vector := vectors.GetVector()
+	if dense := vector.GetDense().GetData(); len(dense) > 0 {
+		return dense
+	}
+	return vector.GetData()
+}
+
+// SwapAlias atomically points the alias at shadow, then deletes the
+// collection it pointed to before
+func (repo *VectorRepository) SwapAlias(ctx context.Context, shadow string) error {
+	previous, err := repo.aliasTarget(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to look up alias %q: %w", repo.alias, err)
+	}
+
+	actions := []*qdrant.AliasOperations{qdrant.NewAliasCreate(repo.alias, shadow)}
+	if previous != "" {
+		actions = append([]*qdrant.AliasOperations{qdrant.NewAliasDelete(repo.alias)}, actions...)
+	}
+	if err := repo.qdrantClient.UpdateAliases(ctx, actions); err != nil {
+		return fmt.Errorf("failed to swap alias %q to %q: %w", repo.alias, shadow, err)
+	}
+	log.Printf("Swapped Qdrant alias %q from %q to %q", repo.alias, previous, shadow)
+
+	if previous != "" && previous != shadow {
+		repo.DropCollection(ctx, previous)
+	}
+	return nil
+}
+
+// DropCollection deletes a shadow or replaced collection, logging failures since
+// there is nothing more the caller can do about them
+func (repo *VectorRepository) DropCollection(ctx context.Context, collection string) {
+	if err := repo.qdrantClient.DeleteCollection(ctx, collection); err != nil {
+		log.Printf("Warning: failed to delete collection %q: %v", collection, err)
+	}
+}
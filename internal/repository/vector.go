@@ -2,22 +2,77 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/katatrina/poke-bot/internal/config"
 	"github.com/katatrina/poke-bot/internal/model"
+	"github.com/katatrina/poke-bot/internal/pokename"
 	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// maxOrderedScroll caps ordered scrolls, which Qdrant can't page by offset.
+// It comfortably covers every chunk of the full National Dex.
+const maxOrderedScroll = 100000
+
+// SchemaVersion is written to every upserted point. Bump it when the payload
+// shape changes and teach migratePayload how to upgrade older points.
+const SchemaVersion = 5
+
+// ErrCollectionNotFound is returned when the collection was deleted while the
+// server was running and cfg.Qdrant.RecreateMissingCollection is off
+var ErrCollectionNotFound = errors.New("qdrant collection not found")
+
 type VectorRepository struct {
-	qdrantClient *qdrant.Client
-	collection   string
+	qdrantClient    *qdrant.Client
+	collection      string
+	dimension       uint64
+	readConsistency *qdrant.ReadConsistency
+	dedupContent    bool
+	maxMetadataLen  int  // Max runes per metadata value; longer values are truncated
+	recreateMissing bool // Recreate the collection if it disappears at runtime
+	textIndex       bool // Index content for KeywordSearch
+
+	// With cfg.Qdrant.Alias set, collection is the alias and ingests build a
+	// shadow collection named after baseCollection before swapping the alias
+	alias          string
+	baseCollection string
 }
 
 func NewVectorRepository(cfg *config.Config, qdrantClient *qdrant.Client) (*VectorRepository, error) {
+	readConsistency, err := parseReadConsistency(cfg.Qdrant.ReadConsistency)
+	if err != nil {
+		return nil, err
+	}
+
 	repo := &VectorRepository{
-		qdrantClient: qdrantClient,
-		collection:   cfg.Qdrant.Collection,
+		qdrantClient:    qdrantClient,
+		collection:      ResolveCollectionName(cfg),
+		dimension:       uint64(cfg.Ollama.Dimension()),
+		readConsistency: readConsistency,
+		dedupContent:    cfg.Ingest.DedupContent,
+		maxMetadataLen:  cfg.Ingest.MaxMetadataValueLength,
+		recreateMissing: cfg.Qdrant.RecreateMissingCollection,
+		textIndex:       cfg.RAG.KeywordFallback,
+	}
+	if cfg.Qdrant.Alias != "" {
+		repo.alias = cfg.Qdrant.Alias
+		repo.baseCollection = repo.collection
+		repo.collection = cfg.Qdrant.Alias
+	}
+
+	if repo.maxMetadataLen <= 0 {
+		repo.maxMetadataLen = 1024 // Default fallback
 	}
 
 	// Ensure collection exists
@@ -25,10 +80,54 @@ func NewVectorRepository(cfg *config.Config, qdrantClient *qdrant.Client) (*Vect
 		return nil, fmt.Errorf("failed to ensure collection: %w", err)
 	}
 
+	log.Printf("Using Qdrant collection %q", repo.collection)
+
 	return repo, nil
 }
 
+// ResolveCollectionName returns the collection to use. With
+// cfg.Qdrant.CollectionPerModel, the embedding model and dimension are appended
+// (e.g. "pokemons_nomic_embed_text_768") so switching models never mixes
+// incompatible vectors in one collection.
+func ResolveCollectionName(cfg *config.Config) string {
+	if !cfg.Qdrant.CollectionPerModel {
+		return cfg.Qdrant.Collection
+	}
+
+	modelSlug := strings.Trim(nonAlphanumericPattern.ReplaceAllString(strings.ToLower(cfg.Ollama.EmbeddingModel), "_"), "_")
+
+	return fmt.Sprintf("%s_%s_%d", cfg.Qdrant.Collection, modelSlug, cfg.Ollama.Dimension())
+}
+
+var nonAlphanumericPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// parseReadConsistency maps the config value to a Qdrant read consistency.
+// Empty returns nil so Qdrant applies its default.
+func parseReadConsistency(value string) (*qdrant.ReadConsistency, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return nil, nil
+	case "all":
+		return qdrant.NewReadConsistencyType(qdrant.ReadConsistencyType_All), nil
+	case "majority":
+		return qdrant.NewReadConsistencyType(qdrant.ReadConsistencyType_Majority), nil
+	case "quorum":
+		return qdrant.NewReadConsistencyType(qdrant.ReadConsistencyType_Quorum), nil
+	}
+
+	factor, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || factor == 0 {
+		return nil, fmt.Errorf("invalid read consistency %q (must be all, majority, quorum or a positive number)", value)
+	}
+
+	return qdrant.NewReadConsistencyFactor(factor), nil
+}
+
 func (repo *VectorRepository) ensureCollection(ctx context.Context) error {
+	if repo.alias != "" {
+		return repo.ensureAlias(ctx)
+	}
+
 	collections, err := repo.qdrantClient.ListCollections(ctx)
 	if err != nil {
 		return err
@@ -37,15 +136,20 @@ func (repo *VectorRepository) ensureCollection(ctx context.Context) error {
 	// Check if collection exists
 	for _, col := range collections {
 		if col == repo.collection {
+			repo.ensureIndexes(ctx, repo.collection)
 			return nil // Collection exists
 		}
 	}
 
-	// Create collection
-	err = repo.qdrantClient.CreateCollection(ctx, &qdrant.CreateCollection{
-		CollectionName: repo.collection,
+	return repo.createCollection(ctx, repo.collection)
+}
+
+// createCollection creates an empty collection with the configured dimension
+func (repo *VectorRepository) createCollection(ctx context.Context, name string) error {
+	err := repo.qdrantClient.CreateCollection(ctx, &qdrant.CreateCollection{
+		CollectionName: name,
 		VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
-			Size:     768,                    // nomic-embed-text dimension
+			Size:     repo.dimension,
 			Distance: qdrant.Distance_Cosine, // optimal for semantic search
 		}),
 	})
@@ -53,20 +157,103 @@ func (repo *VectorRepository) ensureCollection(ctx context.Context) error {
 		return err
 	}
 
+	repo.ensureIndexes(ctx, name)
 	return nil
 }
 
+// withCollection runs op, handling the collection being deleted out from
+// under the server. Qdrant reports that as a gRPC NotFound status: with
+// recreateMissing the collection is recreated empty and op retried once,
+// otherwise the status is replaced by ErrCollectionNotFound.
+func (repo *VectorRepository) withCollection(ctx context.Context, op func() error) error {
+	err := op()
+	if !isNotFound(err) {
+		return err
+	}
+
+	// A vanished shadow collection can't be rebuilt mid-ingest
+	if target := repo.target(ctx); target != repo.collection {
+		return fmt.Errorf("%w: %s", ErrCollectionNotFound, target)
+	}
+	if !repo.recreateMissing {
+		return fmt.Errorf("%w: %s", ErrCollectionNotFound, repo.collection)
+	}
+
+	log.Printf("Warning: Qdrant collection %q is missing, recreating it", repo.collection)
+	if err := repo.ensureCollection(ctx); err != nil {
+		return fmt.Errorf("%w: %s (recreate failed: %v)", ErrCollectionNotFound, repo.collection, err)
+	}
+
+	return op()
+}
+
+// isNotFound reports whether err carries a gRPC NotFound status, which Qdrant
+// returns for operations on a collection that doesn't exist
+func isNotFound(err error) bool {
+	return err != nil && status.Code(err) == codes.NotFound
+}
+
+// ensureIndexes creates the integer index on number_int that range filters
+// and ordered scrolls rely on, and with keyword search on, the full-text index
+// on content. Qdrant treats re-creating an existing index as a no-op, so this
+// is safe to call on every start.
+func (repo *VectorRepository) ensureIndexes(ctx context.Context, collection string) {
+	indexes := map[string]qdrant.FieldType{"number_int": qdrant.FieldType_FieldTypeInteger}
+	if repo.textIndex {
+		indexes["content"] = qdrant.FieldType_FieldTypeText
+	}
+
+	for field, fieldType := range indexes {
+		_, err := repo.qdrantClient.CreateFieldIndex(ctx, &qdrant.CreateFieldIndexCollection{
+			CollectionName: collection,
+			Wait:           qdrant.PtrOf(true),
+			FieldName:      field,
+			FieldType:      fieldType.Enum(),
+		})
+		if err != nil {
+			log.Printf("Warning: failed to create %s index on %s: %v", field, collection, err)
+		}
+	}
+}
+
 func (repo *VectorRepository) Upsert(ctx context.Context, documents []model.Document, embeddings [][]float32) error {
 	if len(documents) != len(embeddings) {
 		return fmt.Errorf("documents and embeddings count mismatch: %d vs %d", len(documents), len(embeddings))
 	}
 
+	hashes := make([]string, len(documents))
+	for i, doc := range documents {
+		hashes[i] = contentHash(doc.Content)
+	}
+
+	var existing map[string]bool
+	if repo.dedupContent {
+		var err error
+		existing, err = repo.existingContentHashes(ctx, hashes)
+		if err != nil {
+			return fmt.Errorf("failed to check for duplicate content: %w", err)
+		}
+	}
+
 	var points []*qdrant.PointStruct
 	for i, doc := range documents {
+		if repo.dedupContent {
+			if existing[hashes[i]] {
+				log.Printf("Skipping duplicate chunk for %s (content_hash=%s)", doc.Metadata["pokemon"], hashes[i][:12])
+				continue
+			}
+			existing[hashes[i]] = true // Also dedup within this batch
+		}
+
 		// Convert metadata to Qdrant payload
 		payload := make(map[string]any)
 		payload["content"] = doc.Content
+		payload["content_hash"] = hashes[i]
+		payload["schema_version"] = SchemaVersion
 		for k, v := range doc.Metadata {
+			payload[k] = repo.capMetadataValue(doc.Metadata["pokemon"], k, v)
+		}
+		for k, v := range doc.Fields {
 			payload[k] = v
 		}
 
@@ -79,21 +266,154 @@ func (repo *VectorRepository) Upsert(ctx context.Context, documents []model.Docu
 		points = append(points, &point)
 	}
 
-	_, err := repo.qdrantClient.Upsert(ctx, &qdrant.UpsertPoints{
-		CollectionName: repo.collection,
-		Points:         points,
+	if len(points) == 0 {
+		return nil
+	}
+
+	return repo.withCollection(ctx, func() error {
+		_, err := repo.qdrantClient.Upsert(ctx, &qdrant.UpsertPoints{
+			CollectionName: repo.target(ctx),
+			Points:         points,
+		})
+		return err
+	})
+}
+
+// metadataTruncationMarker is appended to metadata values cut at maxMetadataLen
+const metadataTruncationMarker = "...[truncated]"
+
+// capMetadataValue bounds a metadata value's length so a bad crawl can't bloat
+// the payload. Content is chunked instead and never passes through here.
+func (repo *VectorRepository) capMetadataValue(pokemon, key, value string) string {
+	runes := []rune(value)
+	if len(runes) <= repo.maxMetadataLen {
+		return value
+	}
+
+	log.Printf("Truncating metadata %q for %s from %d to %d characters", key, pokemon, len(runes), repo.maxMetadataLen)
+	return string(runes[:repo.maxMetadataLen]) + metadataTruncationMarker
+}
+
+// existingContentHashes returns which of hashes are already stored in the collection
+func (repo *VectorRepository) existingContentHashes(ctx context.Context, hashes []string) (map[string]bool, error) {
+	var points []*qdrant.RetrievedPoint
+	err := repo.withCollection(ctx, func() error {
+		var err error
+		points, err = repo.qdrantClient.Scroll(ctx, &qdrant.ScrollPoints{
+			CollectionName: repo.target(ctx),
+			Filter: &qdrant.Filter{
+				Must: []*qdrant.Condition{
+					qdrant.NewMatchKeywords("content_hash", hashes...),
+				},
+			},
+			Limit:       qdrant.PtrOf(uint32(len(hashes))),
+			WithPayload: qdrant.NewWithPayloadInclude("content_hash"),
+			WithVectors: qdrant.NewWithVectors(false),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool, len(points))
+	for _, point := range points {
+		existing[point.Payload["content_hash"].GetStringValue()] = true
+	}
+
+	return existing, nil
+}
+
+// contentHash hashes content after normalizing case and whitespace, so
+// trivially different copies of the same text collide
+func contentHash(content string) string {
+	normalized := strings.Join(strings.Fields(strings.ToLower(content)), " ")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// CountPoints returns the number of points in the collection
+func (repo *VectorRepository) CountPoints(ctx context.Context) (uint64, error) {
+	return repo.countPoints(ctx, false) // Approximate is enough to tell empty from non-empty
+}
+
+// CountPointsExact returns the exact number of points, for enforcing limits
+func (repo *VectorRepository) CountPointsExact(ctx context.Context) (uint64, error) {
+	return repo.countPoints(ctx, true)
+}
+
+func (repo *VectorRepository) countPoints(ctx context.Context, exact bool) (uint64, error) {
+	var count uint64
+	err := repo.withCollection(ctx, func() error {
+		var err error
+		count, err = repo.qdrantClient.Count(ctx, &qdrant.CountPoints{
+			CollectionName: repo.target(ctx),
+			Exact:          qdrant.PtrOf(exact),
+		})
+		return err
 	})
+	return count, err
+}
+
+// SearchOptions narrows a vector search
+type SearchOptions struct {
+	ScoreThreshold float32           // Minimum similarity score (0 disables)
+	Match          map[string]string // Payload fields that must equal the given values
+	Numbers        *NumberRange      // National number range (nil disables)
+}
 
-	return err
+// NumberRange bounds the National number stored under number_int. A zero
+// bound is open, so {Min: 1, Max: 10} and {Max: 10} select the same points.
+type NumberRange struct {
+	Min int
+	Max int
+}
+
+func (r NumberRange) condition() *qdrant.Condition {
+	bounds := &qdrant.Range{}
+	if r.Min > 0 {
+		bounds.Gte = qdrant.PtrOf(float64(r.Min))
+	}
+	if r.Max > 0 {
+		bounds.Lte = qdrant.PtrOf(float64(r.Max))
+	}
+	return qdrant.NewRange("number_int", bounds)
 }
 
 func (repo *VectorRepository) Search(ctx context.Context, embedding []float32, limit int) ([]model.SearchResult, error) {
-	searchResult, err := repo.qdrantClient.Query(ctx, &qdrant.QueryPoints{
-		CollectionName: repo.collection,
-		Query:          qdrant.NewQuery(embedding...),
-		Limit:          qdrant.PtrOf(uint64(limit)),
-		WithPayload:    qdrant.NewWithPayload(true),
-		WithVectors:    qdrant.NewWithVectors(false),
+	return repo.SearchWithOptions(ctx, embedding, limit, SearchOptions{})
+}
+
+func (repo *VectorRepository) SearchWithOptions(ctx context.Context, embedding []float32, limit int, opts SearchOptions) ([]model.SearchResult, error) {
+	query := &qdrant.QueryPoints{
+		CollectionName:  repo.target(ctx),
+		Query:           qdrant.NewQuery(embedding...),
+		Limit:           qdrant.PtrOf(uint64(limit)),
+		WithPayload:     qdrant.NewWithPayload(true),
+		WithVectors:     qdrant.NewWithVectors(false),
+		ReadConsistency: repo.readConsistency,
+	}
+
+	if opts.ScoreThreshold > 0 {
+		query.ScoreThreshold = qdrant.PtrOf(opts.ScoreThreshold)
+	}
+
+	if len(opts.Match) > 0 || opts.Numbers != nil {
+		filter := &qdrant.Filter{}
+		for field, value := range opts.Match {
+			filter.Must = append(filter.Must, qdrant.NewMatch(field, value))
+		}
+		if opts.Numbers != nil {
+			filter.Must = append(filter.Must, opts.Numbers.condition())
+		}
+		query.Filter = filter
+	}
+
+	var searchResult []*qdrant.ScoredPoint
+	err := repo.withCollection(ctx, func() error {
+		var err error
+		searchResult, err = repo.qdrantClient.Query(ctx, query)
+		return err
 	})
 	if err != nil {
 		return nil, err
@@ -101,25 +421,528 @@ func (repo *VectorRepository) Search(ctx context.Context, embedding []float32, l
 
 	var results []model.SearchResult
 	for _, point := range searchResult {
-		result := model.SearchResult{
-			Score:    point.Score,
-			Metadata: make(map[string]string),
+		// Drop malformed points so sorting and threshold comparisons stay well-defined
+		if !isFiniteScore(point.Score) {
+			log.Printf("Warning: dropping search result %s with non-finite score %v", point.GetId().String(), point.Score)
+			continue
 		}
 
-		// Extract content
-		if contentValue, ok := point.Payload["content"]; ok {
-			result.Content = contentValue.GetStringValue()
+		results = append(results, toSearchResult(point.GetId(), point.Score, point.Payload))
+	}
+
+	return results, nil
+}
+
+// toSearchResult converts a point's payload into a SearchResult
+func toSearchResult(id *qdrant.PointId, score float32, payload map[string]*qdrant.Value) model.SearchResult {
+	result := model.SearchResult{
+		ID:       id.GetUuid(),
+		Score:    score,
+		Metadata: make(map[string]string),
+		Fields:   make(map[string]any),
+	}
+
+	// Extract content
+	if contentValue, ok := payload["content"]; ok {
+		result.Content = contentValue.GetStringValue()
+	}
+
+	// Extract other metadata, keeping typed values alongside the string form
+	for k, v := range payload {
+		if k != "content" {
+			typed := payloadValue(v)
+			result.Fields[k] = typed
+			result.Metadata[k] = payloadString(typed)
 		}
+	}
+
+	return result
+}
+
+// KeywordSearch returns up to limit points whose content contains any of
+// keywords, scored by the share of keywords found. It is the degraded search
+// used when query embeddings can't be computed, and relies on the full-text
+// index on content that cfg.RAG.KeywordFallback creates.
+func (repo *VectorRepository) KeywordSearch(ctx context.Context, keywords []string, limit int, opts SearchOptions) ([]model.SearchResult, error) {
+	if len(keywords) == 0 {
+		return nil, nil
+	}
+
+	filter := &qdrant.Filter{}
+	for _, keyword := range keywords {
+		filter.Should = append(filter.Should, qdrant.NewMatchText("content", keyword))
+	}
+	for field, value := range opts.Match {
+		filter.Must = append(filter.Must, qdrant.NewMatch(field, value))
+	}
+	if opts.Numbers != nil {
+		filter.Must = append(filter.Must, opts.Numbers.condition())
+	}
+
+	var points []*qdrant.RetrievedPoint
+	err := repo.withCollection(ctx, func() error {
+		var err error
+		points, err = repo.qdrantClient.Scroll(ctx, &qdrant.ScrollPoints{
+			CollectionName:  repo.target(ctx),
+			Filter:          filter,
+			Limit:           qdrant.PtrOf(uint32(max(limit*10, 100))), // Candidates to rank, as scroll order isn't by relevance
+			WithPayload:     qdrant.NewWithPayload(true),
+			WithVectors:     qdrant.NewWithVectors(false),
+			ReadConsistency: repo.readConsistency,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		// Extract other metadata
-		for k, v := range point.Payload {
-			if k != "content" {
-				result.Metadata[k] = v.GetStringValue()
+	results := make([]model.SearchResult, 0, len(points))
+	for _, point := range points {
+		content := strings.ToLower(point.Payload["content"].GetStringValue())
+		found := 0
+		for _, keyword := range keywords {
+			if strings.Contains(content, strings.ToLower(keyword)) {
+				found++
 			}
 		}
+		results = append(results, toSearchResult(point.GetId(), float32(found)/float32(len(keywords)), point.Payload))
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
 
-		results = append(results, result)
+// PokemonChunks returns every chunk stored for the named Pokemon, matched by
+// pokename.Key, with a zero score since nothing was ranked
+func (repo *VectorRepository) PokemonChunks(ctx context.Context, pokemon string) ([]model.SearchResult, error) {
+	var points []*qdrant.RetrievedPoint
+	err := repo.withCollection(ctx, func() error {
+		var err error
+		points, err = repo.qdrantClient.Scroll(ctx, &qdrant.ScrollPoints{
+			CollectionName: repo.target(ctx),
+			Filter: &qdrant.Filter{
+				Must: []*qdrant.Condition{qdrant.NewMatch("pokemon_key", pokename.Key(pokemon))},
+			},
+			Limit:           qdrant.PtrOf(uint32(256)),
+			WithPayload:     qdrant.NewWithPayload(true),
+			WithVectors:     qdrant.NewWithVectors(false),
+			ReadConsistency: repo.readConsistency,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	results := make([]model.SearchResult, 0, len(points))
+	for _, point := range points {
+		results = append(results, toSearchResult(point.GetId(), 0, point.Payload))
+	}
 	return results, nil
 }
+
+// isFiniteScore reports whether score is neither NaN nor ±Inf
+func isFiniteScore(score float32) bool {
+	f := float64(score)
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// ScrollMetadata returns the requested payload fields of every point in the collection
+func (repo *VectorRepository) ScrollMetadata(ctx context.Context, fields ...string) ([]map[string]string, error) {
+	return repo.scrollMetadata(ctx, nil, nil, fields...)
+}
+
+// ScrollMetadataByTypes returns the requested payload fields of every point
+// whose types list contains all of types. Matching is exact per list element,
+// so "Water" doesn't match a "Water,Ground" string.
+func (repo *VectorRepository) ScrollMetadataByTypes(ctx context.Context, types []string, fields ...string) ([]map[string]string, error) {
+	filter := &qdrant.Filter{}
+	for _, t := range types {
+		filter.Must = append(filter.Must, qdrant.NewMatch("types", t))
+	}
+
+	return repo.scrollMetadata(ctx, filter, nil, fields...)
+}
+
+// ScrollMetadataBySource returns the requested payload fields of every point
+// ingested from source, letting Qdrant filter instead of the caller
+func (repo *VectorRepository) ScrollMetadataBySource(ctx context.Context, source string, fields ...string) ([]map[string]string, error) {
+	filter := &qdrant.Filter{
+		Must: []*qdrant.Condition{qdrant.NewMatch("source", source)},
+	}
+
+	return repo.scrollMetadata(ctx, filter, nil, fields...)
+}
+
+// ScrollMetadataByNumberRange returns the requested payload fields of every
+// point whose National number falls within r, ordered by number ascending
+func (repo *VectorRepository) ScrollMetadataByNumberRange(ctx context.Context, r NumberRange, fields ...string) ([]map[string]string, error) {
+	filter := &qdrant.Filter{
+		Must: []*qdrant.Condition{r.condition()},
+	}
+	orderBy := &qdrant.OrderBy{
+		Key:       "number_int",
+		Direction: qdrant.Direction_Asc.Enum(),
+	}
+
+	return repo.scrollMetadata(ctx, filter, orderBy, fields...)
+}
+
+// scrollMetadata pages through the points matching filter. Qdrant doesn't
+// return a next offset for ordered scrolls, so when orderBy is set the whole
+// result is fetched in a single request.
+func (repo *VectorRepository) scrollMetadata(ctx context.Context, filter *qdrant.Filter, orderBy *qdrant.OrderBy, fields ...string) ([]map[string]string, error) {
+	var (
+		results []map[string]string
+		offset  *qdrant.PointId
+		limit   = uint32(256)
+	)
+	if orderBy != nil {
+		limit = maxOrderedScroll
+	}
+
+	for {
+		var (
+			points     []*qdrant.RetrievedPoint
+			nextOffset *qdrant.PointId
+		)
+		err := repo.withCollection(ctx, func() error {
+			var err error
+			points, nextOffset, err = repo.qdrantClient.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+				CollectionName: repo.target(ctx),
+				Filter:         filter,
+				Offset:         offset,
+				Limit:          qdrant.PtrOf(limit),
+				OrderBy:        orderBy,
+				WithPayload:    qdrant.NewWithPayloadInclude(fields...),
+				WithVectors:    qdrant.NewWithVectors(false),
+			})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, point := range points {
+			metadata := make(map[string]string, len(point.Payload))
+			for k, v := range point.Payload {
+				metadata[k] = payloadString(payloadValue(v))
+			}
+			results = append(results, metadata)
+		}
+
+		if nextOffset == nil || orderBy != nil {
+			break
+		}
+		offset = nextOffset
+	}
+
+	return results, nil
+}
+
+// SetPokemonPayload merges payload into every point belonging to the named
+// Pokemon, matched by pokename.Key so spelling variants hit the same points
+func (repo *VectorRepository) SetPokemonPayload(ctx context.Context, pokemon string, payload map[string]any) error {
+	return repo.withCollection(ctx, func() error {
+		_, err := repo.qdrantClient.SetPayload(ctx, &qdrant.SetPayloadPoints{
+			CollectionName: repo.target(ctx),
+			Payload:        qdrant.NewValueMap(payload),
+			PointsSelector: qdrant.NewPointsSelectorFilter(&qdrant.Filter{
+				Must: []*qdrant.Condition{
+					qdrant.NewMatch("pokemon_key", pokename.Key(pokemon)),
+				},
+			}),
+		})
+		return err
+	})
+}
+
+// MigrationResult summarizes a schema migration
+type MigrationResult struct {
+	Scanned       int `json:"scanned"`
+	Migrated      int `json:"migrated"`
+	SchemaVersion int `json:"schema_version"`
+}
+
+// MigrateSchema scrolls the whole collection and upgrades points written by an
+// older schema version, backfilling missing fields in place
+func (repo *VectorRepository) MigrateSchema(ctx context.Context) (MigrationResult, error) {
+	result := MigrationResult{SchemaVersion: SchemaVersion}
+	var offset *qdrant.PointId
+
+	for {
+		var (
+			points     []*qdrant.RetrievedPoint
+			nextOffset *qdrant.PointId
+		)
+		err := repo.withCollection(ctx, func() error {
+			var err error
+			points, nextOffset, err = repo.qdrantClient.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+				CollectionName: repo.target(ctx),
+				Offset:         offset,
+				Limit:          qdrant.PtrOf(uint32(256)),
+				WithPayload:    qdrant.NewWithPayloadInclude("content", "content_hash", "number", "pokemon", "schema_version", "types"),
+				WithVectors:    qdrant.NewWithVectors(false),
+			})
+			return err
+		})
+		if err != nil {
+			return result, err
+		}
+
+		for _, point := range points {
+			result.Scanned++
+
+			updates := migratePayload(point.Payload)
+			if len(updates) == 0 {
+				continue
+			}
+
+			err := repo.withCollection(ctx, func() error {
+				_, err := repo.qdrantClient.SetPayload(ctx, &qdrant.SetPayloadPoints{
+					CollectionName: repo.target(ctx),
+					Payload:        qdrant.NewValueMap(updates),
+					PointsSelector: qdrant.NewPointsSelector(point.GetId()),
+				})
+				return err
+			})
+			if err != nil {
+				return result, fmt.Errorf("failed to migrate point %s: %w", point.GetId().String(), err)
+			}
+			result.Migrated++
+		}
+
+		if nextOffset == nil {
+			break
+		}
+		offset = nextOffset
+	}
+
+	return result, nil
+}
+
+// migratePayload returns the fields to set to bring a point up to
+// SchemaVersion, or nil if it is already current. Points without a
+// schema_version predate versioning and count as version 1.
+func migratePayload(payload map[string]*qdrant.Value) map[string]any {
+	version := int64(1)
+	if v, ok := payload["schema_version"]; ok {
+		version = v.GetIntegerValue()
+	}
+	if version >= SchemaVersion {
+		return nil
+	}
+
+	updates := map[string]any{"schema_version": SchemaVersion}
+
+	// Version 2: content_hash is used for dedup
+	if payload["content_hash"].GetStringValue() == "" {
+		updates["content_hash"] = contentHash(payload["content"].GetStringValue())
+	}
+
+	// Version 3: types is a list so type filters match whole elements
+	if types, ok := payload["types"].GetKind().(*qdrant.Value_StringValue); ok {
+		updates["types"] = TypesPayload(strings.Split(types.StringValue, ","))
+	}
+
+	// Version 4: number_int backs numeric range filters and sorting
+	if n, ok := ParseNationalNumber(payload["number"].GetStringValue()); ok {
+		updates["number_int"] = n
+	}
+
+	// Version 5: names are normalized, with pokemon_key for filtering
+	if name := payload["pokemon"].GetStringValue(); name != "" {
+		updates["pokemon"] = pokename.Display(name)
+		updates["pokemon_key"] = pokename.Key(name)
+	}
+
+	return updates
+}
+
+// StoredPoint is a point read back from the collection, kept opaque so it can
+// be rewritten with a new vector without touching its payload
+type StoredPoint struct {
+	Content string
+
+	id      *qdrant.PointId
+	payload map[string]*qdrant.Value
+}
+
+// ScrollPoints returns every point in the collection with its full payload
+func (repo *VectorRepository) ScrollPoints(ctx context.Context) ([]StoredPoint, error) {
+	var (
+		results []StoredPoint
+		offset  *qdrant.PointId
+	)
+
+	for {
+		var (
+			points     []*qdrant.RetrievedPoint
+			nextOffset *qdrant.PointId
+		)
+		err := repo.withCollection(ctx, func() error {
+			var err error
+			points, nextOffset, err = repo.qdrantClient.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+				CollectionName: repo.target(ctx),
+				Offset:         offset,
+				Limit:          qdrant.PtrOf(uint32(256)),
+				WithPayload:    qdrant.NewWithPayload(true),
+				WithVectors:    qdrant.NewWithVectors(false),
+			})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, point := range points {
+			results = append(results, StoredPoint{
+				Content: point.Payload["content"].GetStringValue(),
+				id:      point.GetId(),
+				payload: point.Payload,
+			})
+		}
+
+		if nextOffset == nil {
+			break
+		}
+		offset = nextOffset
+	}
+
+	return results, nil
+}
+
+// ReplaceVectors recreates the collection with the configured dimension and
+// stores points again with the given vectors, keeping their IDs and payloads.
+// Everything not in points is lost, so callers pass the full ScrollPoints result.
+// Behind an alias the points go to a new collection the alias is then swapped
+// to, so chats keep searching the old vectors until it's complete.
+func (repo *VectorRepository) ReplaceVectors(ctx context.Context, points []StoredPoint, embeddings [][]float32) error {
+	if len(points) != len(embeddings) {
+		return fmt.Errorf("points and embeddings count mismatch: %d vs %d", len(points), len(embeddings))
+	}
+
+	if repo.alias != "" {
+		shadow, err := repo.createShadow(ctx, false)
+		if err != nil {
+			return err
+		}
+		if err := repo.upsertStored(WithShadow(ctx, shadow), points, embeddings); err != nil {
+			repo.DropCollection(ctx, shadow)
+			return err
+		}
+		return repo.SwapAlias(ctx, shadow)
+	}
+
+	if err := repo.qdrantClient.DeleteCollection(ctx, repo.collection); err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+	if err := repo.ensureCollection(ctx); err != nil {
+		return fmt.Errorf("failed to recreate collection: %w", err)
+	}
+
+	return repo.upsertStored(ctx, points, embeddings)
+}
+
+// upsertStored writes points with the given vectors in batches
+func (repo *VectorRepository) upsertStored(ctx context.Context, points []StoredPoint, embeddings [][]float32) error {
+	const batchSize = 256
+	for start := 0; start < len(points); start += batchSize {
+		end := min(start+batchSize, len(points))
+
+		batch := make([]*qdrant.PointStruct, 0, end-start)
+		for i := start; i < end; i++ {
+			batch = append(batch, &qdrant.PointStruct{
+				Id:      points[i].id,
+				Vectors: qdrant.NewVectors(embeddings[i]...),
+				Payload: points[i].payload,
+			})
+		}
+
+		err := repo.withCollection(ctx, func() error {
+			_, err := repo.qdrantClient.Upsert(ctx, &qdrant.UpsertPoints{
+				CollectionName: repo.target(ctx),
+				Points:         batch,
+			})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store points %d-%d: %w", start, end, err)
+		}
+	}
+
+	return nil
+}
+
+// TypesPayload converts Pokemon types into the list stored under "types"
+func TypesPayload(types []string) []any {
+	values := make([]any, 0, len(types))
+	for _, t := range types {
+		if t = strings.TrimSpace(t); t != "" {
+			values = append(values, t)
+		}
+	}
+	return values
+}
+
+// ParseNationalNumber parses a zero-padded National number such as "0006"
+// into the integer stored under "number_int"
+func ParseNationalNumber(number string) (int64, bool) {
+	n, err := strconv.ParseInt(strings.TrimLeft(strings.TrimSpace(number), "#"), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// payloadValue converts a Qdrant payload value into its Go equivalent:
+// string, int64, float64, bool, []any, map[string]any or nil
+func payloadValue(v *qdrant.Value) any {
+	switch kind := v.GetKind().(type) {
+	case *qdrant.Value_StringValue:
+		return kind.StringValue
+	case *qdrant.Value_IntegerValue:
+		return kind.IntegerValue
+	case *qdrant.Value_DoubleValue:
+		return kind.DoubleValue
+	case *qdrant.Value_BoolValue:
+		return kind.BoolValue
+	case *qdrant.Value_ListValue:
+		values := make([]any, 0, len(kind.ListValue.GetValues()))
+		for _, item := range kind.ListValue.GetValues() {
+			values = append(values, payloadValue(item))
+		}
+		return values
+	case *qdrant.Value_StructValue:
+		fields := make(map[string]any, len(kind.StructValue.GetFields()))
+		for k, item := range kind.StructValue.GetFields() {
+			fields[k] = payloadValue(item)
+		}
+		return fields
+	default:
+		return nil
+	}
+}
+
+// payloadString renders a payload value for the string-typed Metadata map.
+// Lists are comma-joined to match how list-like metadata (types) is stored.
+func payloadString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = payloadString(item)
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,583 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/katatrina/poke-bot/internal/config"
+	"github.com/katatrina/poke-bot/internal/model"
+	"github.com/katatrina/poke-bot/internal/ollamatest"
+	"github.com/katatrina/poke-bot/internal/qdranttest"
+	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const testDimension = 16
+
+// newTestRepo returns a repository on a fresh fake Qdrant. configure, if
+// non-nil, adjusts the config before the repository is created.
+func newTestRepo(t *testing.T, configure func(cfg *config.Config)) (*VectorRepository, *qdranttest.Server) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := []byte("qdrant:\n  collection: pokemons\nollama:\n  embedding_model: test-embed\n  embedding_dimension: 16\n")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	server := qdranttest.NewServer(t)
+	repo, err := NewVectorRepository(cfg, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo, server
+}
+
+// testDocument returns a chunk of the named Pokemon embedded like the fake Ollama would
+func testDocument(pokemon, content string) (model.Document, []float32) {
+	doc := model.Document{
+		ID:      uuid.Must(uuid.NewV7()),
+		Content: content,
+		Metadata: map[string]string{
+			"pokemon":     pokemon,
+			"pokemon_key": pokemon,
+		},
+	}
+	return doc, ollamatest.Embedding(content, testDimension)
+}
+
+// upsertTestDocuments stores one chunk per content, all for pokemon
+func upsertTestDocuments(t *testing.T, repo *VectorRepository, pokemon string, contents ...string) {
+	t.Helper()
+
+	var (
+		docs       []model.Document
+		embeddings [][]float32
+	)
+	for _, content := range contents {
+		doc, embedding := testDocument(pokemon, content)
+		docs = append(docs, doc)
+		embeddings = append(embeddings, embedding)
+	}
+	if err := repo.Upsert(context.Background(), docs, embeddings); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchDropsNonFiniteScores(t *testing.T) {
+	repo, server := newTestRepo(t, nil)
+	upsertTestDocuments(t, repo, "pikachu",
+		"Pikachu is an Electric type",
+		"Pikachu evolves into Raichu",
+		"Pikachu has a base Speed of 90",
+	)
+
+	server.SetScore(func(payload map[string]*qdrant.Value, score float32) float32 {
+		switch payload["content"].GetStringValue() {
+		case "Pikachu evolves into Raichu":
+			return float32(math.NaN())
+		case "Pikachu has a base Speed of 90":
+			return float32(math.Inf(1))
+		}
+		return score
+	})
+
+	results, err := repo.Search(context.Background(), ollamatest.Embedding("Pikachu type", testDimension), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want only the finite one: %+v", len(results), results)
+	}
+	if results[0].Content != "Pikachu is an Electric type" {
+		t.Errorf("kept %q, want the finite-scored chunk", results[0].Content)
+	}
+	if !isFiniteScore(results[0].Score) {
+		t.Errorf("score %v is not finite", results[0].Score)
+	}
+}
+
+func TestSearchSetsReadConsistency(t *testing.T) {
+	tests := []struct {
+		configured string
+		want       *qdrant.ReadConsistency
+	}{
+		{"", nil},
+		{"majority", qdrant.NewReadConsistencyType(qdrant.ReadConsistencyType_Majority)},
+		{"All", qdrant.NewReadConsistencyType(qdrant.ReadConsistencyType_All)},
+		{"2", qdrant.NewReadConsistencyFactor(2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.configured, func(t *testing.T) {
+			repo, server := newTestRepo(t, func(cfg *config.Config) {
+				cfg.Qdrant.ReadConsistency = tt.configured
+			})
+			upsertTestDocuments(t, repo, "pikachu", "Pikachu is an Electric type")
+
+			if _, err := repo.Search(context.Background(), ollamatest.Embedding("Pikachu", testDimension), 5); err != nil {
+				t.Fatal(err)
+			}
+
+			queries := server.Queries()
+			if len(queries) != 1 {
+				t.Fatalf("got %d queries, want 1", len(queries))
+			}
+			if got := queries[0].GetReadConsistency(); !proto.Equal(got, tt.want) {
+				t.Errorf("read consistency = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidReadConsistencyIsRejected(t *testing.T) {
+	for _, value := range []string{"eventual", "0", "-1"} {
+		if _, err := parseReadConsistency(value); err == nil {
+			t.Errorf("read consistency %q was accepted", value)
+		}
+	}
+}
+
+func TestUpsertSkipsDuplicateContent(t *testing.T) {
+	repo, server := newTestRepo(t, func(cfg *config.Config) {
+		cfg.Ingest.DedupContent = true
+	})
+
+	upsertTestDocuments(t, repo, "pikachu", "Pikachu is an Electric type")
+	// Same text after normalizing case and whitespace, plus a duplicate within the batch
+	upsertTestDocuments(t, repo, "pikachu", "pikachu  is an\nELECTRIC type", "Pikachu evolves into Raichu", "Pikachu evolves into Raichu")
+
+	points := server.Points("pokemons")
+	if len(points) != 2 {
+		t.Fatalf("stored %d points, want 2", len(points))
+	}
+	if got := points[0].Payload["content"].GetStringValue(); got != "Pikachu is an Electric type" {
+		t.Errorf("first stored content = %q, want the original copy", got)
+	}
+}
+
+func TestUpsertKeepsDuplicatesWhenDedupDisabled(t *testing.T) {
+	repo, server := newTestRepo(t, func(cfg *config.Config) {
+		cfg.Ingest.DedupContent = false
+	})
+
+	upsertTestDocuments(t, repo, "pikachu", "Pikachu is an Electric type")
+	upsertTestDocuments(t, repo, "pikachu", "Pikachu is an Electric type")
+
+	if got := len(server.Points("pokemons")); got != 2 {
+		t.Errorf("stored %d points, want 2", got)
+	}
+}
+
+func TestResolveCollectionNameFollowsEmbeddingModel(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Qdrant.Collection = "pokemons"
+	cfg.Ollama.EmbeddingModel = "nomic-embed-text"
+	cfg.Ollama.EmbeddingDimension = 768
+
+	if got := ResolveCollectionName(cfg); got != "pokemons" {
+		t.Errorf("without collection_per_model: %q, want pokemons", got)
+	}
+
+	cfg.Qdrant.CollectionPerModel = true
+	if got := ResolveCollectionName(cfg); got != "pokemons_nomic_embed_text_768" {
+		t.Errorf("nomic-embed-text: %q, want pokemons_nomic_embed_text_768", got)
+	}
+
+	cfg.Ollama.EmbeddingModel = "mxbai-embed-large:latest"
+	cfg.Ollama.EmbeddingDimension = 1024
+	if got := ResolveCollectionName(cfg); got != "pokemons_mxbai_embed_large_latest_1024" {
+		t.Errorf("mxbai-embed-large: %q, want pokemons_mxbai_embed_large_latest_1024", got)
+	}
+}
+
+func TestCollectionPerModelStoresIntoResolvedCollection(t *testing.T) {
+	repo, server := newTestRepo(t, func(cfg *config.Config) {
+		cfg.Qdrant.CollectionPerModel = true
+	})
+	upsertTestDocuments(t, repo, "pikachu", "Pikachu is an Electric type")
+
+	if got := server.Collections(); len(got) != 1 || got[0] != "pokemons_test_embed_16" {
+		t.Fatalf("collections = %v, want only pokemons_test_embed_16", got)
+	}
+	if got := len(server.Points("pokemons_test_embed_16")); got != 1 {
+		t.Errorf("stored %d points in the resolved collection, want 1", got)
+	}
+}
+
+func TestSearchPreservesPayloadTypes(t *testing.T) {
+	repo, server := newTestRepo(t, nil)
+
+	embedding := ollamatest.Embedding("Pikachu stats", testDimension)
+	server.Upsert("pokemons", &qdrant.PointStruct{
+		Id:      qdrant.NewID(uuid.NewString()),
+		Vectors: qdrant.NewVectors(embedding...),
+		Payload: qdrant.NewValueMap(map[string]any{
+			"content":    "Pikachu stats",
+			"pokemon":    "Pikachu",
+			"number_int": 25,
+			"height_m":   0.4,
+			"legendary":  false,
+			"types":      []any{"Electric"},
+			"stats":      map[string]any{"Speed": 90},
+		}),
+	})
+
+	results, err := repo.Search(context.Background(), embedding, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	result := results[0]
+
+	wantFields := map[string]any{
+		"pokemon":    "Pikachu",
+		"number_int": int64(25),
+		"height_m":   0.4,
+		"legendary":  false,
+		"types":      []any{"Electric"},
+		"stats":      map[string]any{"Speed": int64(90)},
+	}
+	if !reflect.DeepEqual(result.Fields, wantFields) {
+		t.Errorf("Fields = %#v, want %#v", result.Fields, wantFields)
+	}
+
+	wantMetadata := map[string]string{
+		"pokemon":    "Pikachu",
+		"number_int": "25",
+		"height_m":   "0.4",
+		"legendary":  "false",
+		"types":      "Electric",
+		"stats":      "map[Speed:90]",
+	}
+	if !reflect.DeepEqual(result.Metadata, wantMetadata) {
+		t.Errorf("Metadata = %v, want %v", result.Metadata, wantMetadata)
+	}
+	if result.Content != "Pikachu stats" {
+		t.Errorf("Content = %q", result.Content)
+	}
+}
+
+func TestMigrateSchemaUpgradesOlderPoints(t *testing.T) {
+	repo, server := newTestRepo(t, nil)
+
+	// A current point, written through Upsert
+	upsertTestDocuments(t, repo, "Pikachu", "Pikachu is an Electric type Pokemon.")
+
+	// A point from before versioning, and one stopped at version 3
+	legacyID := uuid.NewString()
+	partialID := uuid.NewString()
+	server.Upsert("pokemons",
+		&qdrant.PointStruct{
+			Id:      qdrant.NewID(legacyID),
+			Vectors: qdrant.NewVectors(ollamatest.Embedding("Bulbasaur", testDimension)...),
+			Payload: qdrant.NewValueMap(map[string]any{
+				"content": "Bulbasaur is a Grass type Pokemon.",
+				"pokemon": "Bulbasaur™",
+				"number":  "#0001",
+				"types":   "Grass,Poison",
+			}),
+		},
+		&qdrant.PointStruct{
+			Id:      qdrant.NewID(partialID),
+			Vectors: qdrant.NewVectors(ollamatest.Embedding("Squirtle", testDimension)...),
+			Payload: qdrant.NewValueMap(map[string]any{
+				"content":        "Squirtle is a Water type Pokemon.",
+				"content_hash":   "kept",
+				"pokemon":        "Squirtle",
+				"number":         "0007",
+				"types":          []any{"Water"},
+				"schema_version": 3,
+			}),
+		},
+	)
+
+	result, err := repo.MigrateSchema(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MigrationResult{Scanned: 3, Migrated: 2, SchemaVersion: SchemaVersion}); result != want {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+
+	payloads := make(map[string]map[string]*qdrant.Value)
+	for _, p := range server.Points("pokemons") {
+		payloads[p.GetId().GetUuid()] = p.GetPayload()
+		if got := p.GetPayload()["schema_version"].GetIntegerValue(); got != SchemaVersion {
+			t.Errorf("point %s has schema_version %d, want %d", p.GetId().GetUuid(), got, SchemaVersion)
+		}
+	}
+
+	legacy := payloads[legacyID]
+	if got := legacy["content_hash"].GetStringValue(); got != contentHash("Bulbasaur is a Grass type Pokemon.") {
+		t.Errorf("legacy content_hash = %q, want it backfilled", got)
+	}
+	if got := payloadValue(legacy["types"]); !reflect.DeepEqual(got, []any{"Grass", "Poison"}) {
+		t.Errorf("legacy types = %v, want a list", got)
+	}
+	if got := legacy["number_int"].GetIntegerValue(); got != 1 {
+		t.Errorf("legacy number_int = %d, want 1", got)
+	}
+	if got, key := legacy["pokemon"].GetStringValue(), legacy["pokemon_key"].GetStringValue(); got != "Bulbasaur" || key != "bulbasaur" {
+		t.Errorf("legacy pokemon = %q, pokemon_key = %q, want normalized names", got, key)
+	}
+
+	partial := payloads[partialID]
+	if got := partial["content_hash"].GetStringValue(); got != "kept" {
+		t.Errorf("partial content_hash = %q, want the existing hash kept", got)
+	}
+	if got := partial["number_int"].GetIntegerValue(); got != 7 {
+		t.Errorf("partial number_int = %d, want 7", got)
+	}
+
+	// A second run finds nothing left to migrate
+	again, err := repo.MigrateSchema(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Migrated != 0 || again.Scanned != 3 {
+		t.Errorf("second run = %+v, want 3 scanned and none migrated", again)
+	}
+}
+
+func TestUpsertTruncatesOversizeMetadata(t *testing.T) {
+	repo, server := newTestRepo(t, func(cfg *config.Config) {
+		cfg.Ingest.MaxMetadataValueLength = 20
+	})
+
+	content := strings.Repeat("Pikachu stores electricity in its cheeks. ", 10)
+	doc, embedding := testDocument("pikachu", content)
+	doc.Metadata["types"] = "Electric" + strings.Repeat("é", 40) // Multi-byte runes must not be split
+	doc.Metadata["category"] = "Mouse Pokemon"
+	if err := repo.Upsert(context.Background(), []model.Document{doc}, [][]float32{embedding}); err != nil {
+		t.Fatal(err)
+	}
+
+	points := server.Points("pokemons")
+	if len(points) != 1 {
+		t.Fatalf("stored %d points, want 1", len(points))
+	}
+	payload := points[0].GetPayload()
+
+	want := "Electric" + strings.Repeat("é", 12) + metadataTruncationMarker
+	if got := payload["types"].GetStringValue(); got != want {
+		t.Errorf("types = %q, want %q", got, want)
+	}
+	if got := payload["category"].GetStringValue(); got != "Mouse Pokemon" {
+		t.Errorf("category = %q, want it untouched", got)
+	}
+	if got := payload["content"].GetStringValue(); got != content {
+		t.Errorf("content was changed (%d bytes, want %d), but it is exempt", len(got), len(content))
+	}
+}
+
+func TestParseNationalNumber(t *testing.T) {
+	tests := []struct {
+		number string
+		want   int64
+		wantOK bool
+	}{
+		{"0006", 6, true},
+		{"#0025", 25, true},
+		{" 1025 ", 1025, true},
+		{"0000", 0, false},
+		{"", 0, false},
+		{"n/a", 0, false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := ParseNationalNumber(tt.number); got != tt.want || ok != tt.wantOK {
+			t.Errorf("ParseNationalNumber(%q) = %d, %v, want %d, %v", tt.number, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestScrollMetadataByNumberRange(t *testing.T) {
+	repo, server := newTestRepo(t, nil)
+	if err := repo.ensureCollection(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.Indexes("pokemons")["number_int"]; got != qdrant.FieldType_FieldTypeInteger {
+		t.Errorf("number_int index type = %v, want integer", got)
+	}
+
+	var (
+		docs       []model.Document
+		embeddings [][]float32
+	)
+	for _, number := range []string{"0025", "0001", "0150", "0007"} {
+		doc, embedding := testDocument("pokemon-"+number, "Pokemon number "+number)
+		n, _ := ParseNationalNumber(number)
+		doc.Metadata["number"] = number
+		doc.Fields = map[string]any{"number_int": n}
+		docs = append(docs, doc)
+		embeddings = append(embeddings, embedding)
+	}
+	if err := repo.Upsert(context.Background(), docs, embeddings); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := repo.ScrollMetadataByNumberRange(context.Background(), NumberRange{Min: 1, Max: 25}, "number")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numbers []string
+	for _, md := range metadata {
+		numbers = append(numbers, md["number"])
+	}
+	if want := []string{"0001", "0007", "0025"}; !slices.Equal(numbers, want) {
+		t.Errorf("numbers = %v, want %v in ascending order", numbers, want)
+	}
+
+	// The same range filter applies to vector search
+	results, err := repo.SearchWithOptions(context.Background(), embeddings[2], 10, SearchOptions{Numbers: &NumberRange{Min: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Metadata["number"] != "0150" {
+		t.Errorf("search results = %+v, want only number 150", results)
+	}
+}
+
+// collectionOps exercises every repository operation that reads or writes the collection
+func collectionOps(repo *VectorRepository) map[string]func(ctx context.Context) error {
+	doc, embedding := testDocument("pikachu", "Pikachu is an Electric type")
+	stored := []StoredPoint{{id: qdrant.NewIDUUID(doc.ID.String()), payload: qdrant.NewValueMap(map[string]any{"content": doc.Content})}}
+
+	return map[string]func(ctx context.Context) error{
+		"Upsert": func(ctx context.Context) error {
+			return repo.Upsert(ctx, []model.Document{doc}, [][]float32{embedding})
+		},
+		"existingContentHashes": func(ctx context.Context) error {
+			_, err := repo.existingContentHashes(ctx, []string{contentHash(doc.Content)})
+			return err
+		},
+		"CountPoints": func(ctx context.Context) error {
+			_, err := repo.CountPoints(ctx)
+			return err
+		},
+		"Search": func(ctx context.Context) error {
+			_, err := repo.Search(ctx, embedding, 3)
+			return err
+		},
+		"ScrollMetadata": func(ctx context.Context) error {
+			_, err := repo.ScrollMetadata(ctx, "pokemon")
+			return err
+		},
+		"SetPokemonPayload": func(ctx context.Context) error {
+			return repo.SetPokemonPayload(ctx, "pikachu", map[string]any{"source": "pokemondb"})
+		},
+		"MigrateSchema": func(ctx context.Context) error {
+			_, err := repo.MigrateSchema(ctx)
+			return err
+		},
+		"ScrollPoints": func(ctx context.Context) error {
+			_, err := repo.ScrollPoints(ctx)
+			return err
+		},
+		"upsertStored": func(ctx context.Context) error {
+			return repo.upsertStored(ctx, stored, [][]float32{embedding})
+		},
+	}
+}
+
+func TestKeywordSearchRanksByKeywordsFound(t *testing.T) {
+	repo, server := newTestRepo(t, func(cfg *config.Config) {
+		cfg.RAG.KeywordFallback = true
+	})
+	if got := server.Indexes("pokemons")["content"]; got != qdrant.FieldType_FieldTypeText {
+		t.Errorf("content index = %v, want a full-text index", got)
+	}
+
+	upsertTestDocuments(t, repo, "Raichu", "Raichu evolves from Pikachu with a Thunder Stone")
+	upsertTestDocuments(t, repo, "Pikachu", "Pikachu is an Electric type Pokemon")
+	upsertTestDocuments(t, repo, "Bulbasaur", "Bulbasaur is a Grass type Pokemon")
+
+	search := func(limit int, opts SearchOptions) []string {
+		t.Helper()
+		results, err := repo.KeywordSearch(context.Background(), []string{"pikachu", "electric"}, limit, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, result := range results {
+			got = append(got, fmt.Sprintf("%s %.1f", result.Metadata["pokemon"], result.Score))
+		}
+		return got
+	}
+
+	if got, want := search(5, SearchOptions{}), []string{"Pikachu 1.0", "Raichu 0.5"}; !slices.Equal(got, want) {
+		t.Errorf("results = %v, want %v", got, want)
+	}
+	if got, want := search(1, SearchOptions{}), []string{"Pikachu 1.0"}; !slices.Equal(got, want) {
+		t.Errorf("limited results = %v, want %v", got, want)
+	}
+	if got, want := search(5, SearchOptions{Match: map[string]string{"pokemon": "Raichu"}}), []string{"Raichu 0.5"}; !slices.Equal(got, want) {
+		t.Errorf("filtered results = %v, want %v", got, want)
+	}
+
+	if results, err := repo.KeywordSearch(context.Background(), nil, 5, SearchOptions{}); err != nil || len(results) != 0 {
+		t.Errorf("no keywords gave %v, %v; want nothing", results, err)
+	}
+}
+
+func TestMissingCollectionReturnsErrCollectionNotFound(t *testing.T) {
+	repo, server := newTestRepo(t, func(cfg *config.Config) {
+		cfg.Ingest.DedupContent = true
+	})
+
+	for name, op := range collectionOps(repo) {
+		t.Run(name, func(t *testing.T) {
+			server.DeleteCollection("pokemons")
+
+			err := op(context.Background())
+			if !errors.Is(err, ErrCollectionNotFound) {
+				t.Fatalf("err = %v, want ErrCollectionNotFound", err)
+			}
+			if status.Code(err) == codes.NotFound {
+				t.Errorf("err = %v leaks the gRPC NotFound status", err)
+			}
+		})
+	}
+}
+
+func TestMissingCollectionIsRecreated(t *testing.T) {
+	repo, server := newTestRepo(t, func(cfg *config.Config) {
+		cfg.Ingest.DedupContent = true
+		cfg.Qdrant.RecreateMissingCollection = true
+	})
+
+	for name, op := range collectionOps(repo) {
+		t.Run(name, func(t *testing.T) {
+			server.DeleteCollection("pokemons")
+
+			if err := op(context.Background()); err != nil {
+				t.Fatalf("err = %v, want the collection recreated", err)
+			}
+			if !slices.Contains(server.Collections(), "pokemons") {
+				t.Errorf("collections = %v, want pokemons recreated", server.Collections())
+			}
+		})
+	}
+}
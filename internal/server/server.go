@@ -1,26 +1,40 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/katatrina/poke-bot/internal/config"
 	"github.com/katatrina/poke-bot/internal/handler"
+	"github.com/katatrina/poke-bot/internal/service"
 )
 
 type Server struct {
-	config *config.Config
-	router *gin.Engine
-	hdl    *handler.HTTPHandler
+	config     *config.Config
+	router     *gin.Engine
+	hdl        *handler.HTTPHandler
+	httpServer *http.Server
 }
 
 func NewServer(cfg *config.Config, hdl *handler.HTTPHandler) *Server {
-	router := gin.Default()
+	router := gin.New()
+	router.Use(gin.Recovery(), requestID(), accessLog())
 
 	srv := &Server{
 		config: cfg,
 		router: router,
 		hdl:    hdl,
+		httpServer: &http.Server{
+			Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
+			Handler: router,
+		},
 	}
 
 	return srv
@@ -30,12 +44,109 @@ func (s *Server) SetupRoutes() {
 	v1 := s.router.Group("/api/v1")
 
 	v1.GET("/health", s.hdl.HealthCheck)
-	v1.POST("/ingest", s.hdl.IngestDoc)
+	v1.GET("/stats", s.hdl.Stats)
+	v1.POST("/ingest", s.requireAdminAPIKey(), s.hdl.IngestDoc)
 	v1.POST("/chat", s.hdl.Chat)
+	v1.GET("/pokemon", s.hdl.ListPokemon)
+	v1.GET("/recommend", s.hdl.Recommend)
+	v1.POST("/embed", s.requireAPIKey(), s.hdl.Embed)
+
+	admin := v1.Group("/admin", s.requireAdminAPIKey())
+	admin.POST("/migrate", s.hdl.MigrateCollection)
+	admin.POST("/reembed", s.hdl.ReembedCollection)
 
 	s.router.StaticFile("/", "./web/index.html")
 }
 
+// requestID propagates the caller's X-Request-ID (or generates one) into the
+// request context and echoes it in the response
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if id == "" {
+			id = uuid.NewString()
+		}
+
+		c.Request = c.Request.WithContext(service.WithRequestID(c.Request.Context(), id))
+		c.Header("X-Request-ID", id)
+
+		c.Next()
+	}
+}
+
+// accessLog logs one structured line per request. It must run after
+// requestID so the ID is in the request context.
+func accessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		slog.Info("http request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"latency_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+			"request_id", service.RequestIDFromContext(c.Request.Context()),
+			"response_size", max(c.Writer.Size(), 0), // -1 until the body is written
+		)
+	}
+}
+
+// requireAPIKey rejects requests without a matching X-API-Key header.
+// Protected endpoints are closed entirely when no key is configured.
+func (s *Server) requireAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := s.config.Server.APIKey
+		provided := c.GetHeader("X-API-Key")
+
+		if apiKey == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requireAdminAPIKey guards ingestion and admin endpoints with
+// cfg.Server.AdminAPIKey: 401 without an X-API-Key header, 403 with a wrong
+// key. The endpoints are disabled (403) when no admin key is configured.
+func (s *Server) requireAdminAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminKey := s.config.Server.AdminAPIKey
+		provided := c.GetHeader("X-API-Key")
+
+		if provided == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized",
+			})
+			return
+		}
+
+		if adminKey == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(adminKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "forbidden",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Start blocks serving HTTP until Shutdown is called
 func (s *Server) Start() error {
-	return s.router.Run(fmt.Sprintf(":%d", s.config.Server.Port))
+	if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests until ctx expires
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
 }
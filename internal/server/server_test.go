@@ -0,0 +1,604 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/katatrina/poke-bot/internal/config"
+	"github.com/katatrina/poke-bot/internal/handler"
+	"github.com/katatrina/poke-bot/internal/ollamatest"
+	"github.com/katatrina/poke-bot/internal/qdranttest"
+	"github.com/katatrina/poke-bot/internal/repository"
+	"github.com/katatrina/poke-bot/internal/service"
+	"github.com/qdrant/go-client/qdrant"
+	"resty.dev/v3"
+)
+
+const testDimension = 16
+
+// newTestServer returns a server with routes set up, backed by fake Qdrant and
+// Ollama servers. configure, if non-nil, adjusts the config first.
+func newTestServer(t *testing.T, configure func(cfg *config.Config)) *Server {
+	t.Helper()
+
+	srv, _ := newTestServerWithQdrant(t, configure)
+	return srv
+}
+
+// newTestServerWithQdrant is newTestServer that also returns the fake Qdrant,
+// for tests that need documents in the collection
+func newTestServerWithQdrant(t *testing.T, configure func(cfg *config.Config)) (*Server, *qdranttest.Server) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := []byte("qdrant:\n  collection: pokemons\nollama:\n  chat_model: test-chat\n  embedding_model: test-embed\n  embedding_dimension: 16\n")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ollama := ollamatest.NewServer(t, testDimension)
+	cfg.Ollama.BaseURL = ollama.URL
+	if configure != nil {
+		configure(cfg)
+	}
+
+	qdrantServer := qdranttest.NewServer(t)
+	repo, err := repository.NewVectorRepository(cfg, qdrantServer.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	restClient := resty.New()
+	t.Cleanup(func() { restClient.Close() })
+
+	ragService, err := service.NewRAGService(cfg, repo, restClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewServer(cfg, handler.NewHTTPHandler(ragService))
+	srv.SetupRoutes()
+	return srv, qdrantServer
+}
+
+// serve sends a JSON request through the router and returns the recorded response
+func serve(t *testing.T, srv *Server, method, path string, body any, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestEmbedReturnsVectorsOfConfiguredDimension(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Config) {
+		cfg.Server.APIKey = "secret"
+	})
+
+	rec := serve(t, srv, http.MethodPost, "/api/v1/embed",
+		map[string]any{"texts": []string{"Pikachu", "Bulbasaur is a Grass type"}},
+		http.Header{"X-Api-Key": {"secret"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	var resp service.EmbedResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Dimension != testDimension {
+		t.Errorf("dimension = %d, want %d", resp.Dimension, testDimension)
+	}
+	if len(resp.Embeddings) != 2 {
+		t.Fatalf("got %d embeddings, want 2", len(resp.Embeddings))
+	}
+	for i, embedding := range resp.Embeddings {
+		if len(embedding) != testDimension {
+			t.Errorf("embedding %d has %d values, want %d", i, len(embedding), testDimension)
+		}
+	}
+}
+
+func TestEmbedRequiresAPIKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		provided string
+	}{
+		{"missing key", "secret", ""},
+		{"wrong key", "secret", "guess"},
+		{"no key configured", "", "anything"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, func(cfg *config.Config) {
+				cfg.Server.APIKey = tt.key
+			})
+
+			header := http.Header{}
+			if tt.provided != "" {
+				header.Set("X-API-Key", tt.provided)
+			}
+			rec := serve(t, srv, http.MethodPost, "/api/v1/embed", map[string]any{"texts": []string{"Pikachu"}}, header)
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestEmbedRejectsOversizedRequests(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Config) {
+		cfg.Server.APIKey = "secret"
+	})
+
+	texts := make([]string, 1000)
+	for i := range texts {
+		texts[i] = "Pikachu"
+	}
+	rec := serve(t, srv, http.MethodPost, "/api/v1/embed", map[string]any{"texts": texts}, http.Header{"X-Api-Key": {"secret"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestEmbedRejectsUnknownPurpose(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Config) {
+		cfg.Server.APIKey = "secret"
+	})
+
+	rec := serve(t, srv, http.MethodPost, "/api/v1/embed",
+		map[string]any{"texts": []string{"Pikachu"}, "purpose": "passage"},
+		http.Header{"X-Api-Key": {"secret"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHealthReportsTokenizerStatus(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	rec := serve(t, srv, http.MethodGet, "/api/v1/health", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+
+	var resp struct {
+		Status    string                  `json:"status"`
+		Tokenizer service.TokenizerStatus `json:"tokenizer"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	want := service.GetTokenizerStatus()
+	if resp.Tokenizer != want {
+		t.Errorf("tokenizer = %+v, want %+v", resp.Tokenizer, want)
+	}
+	wantStatus := "ok"
+	if want.Degraded {
+		wantStatus = "degraded"
+	}
+	if resp.Status != wantStatus {
+		t.Errorf("status = %q, want %q for tokenizer %+v", resp.Status, wantStatus, want)
+	}
+}
+
+func TestChatRejectsUnknownPersona(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Config) {
+		cfg.Personas = map[string]config.PersonaConfig{"competitive": {SystemPrompt: "You are a battle analyst."}}
+	})
+
+	rec := serve(t, srv, http.MethodPost, "/api/v1/chat", map[string]any{"message": "Tell me about Pikachu", "persona": "pirate"}, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "unknown persona") {
+		t.Errorf("body = %s, want it to name the unknown persona", rec.Body)
+	}
+}
+
+func TestChatRejectsDisallowedEmbeddingModel(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	rec := serve(t, srv, http.MethodPost, "/api/v1/chat", map[string]any{"message": "Tell me about Pikachu", "embedding_model": "other-embed"}, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "other-embed") {
+		t.Errorf("body = %s, want it to name the rejected model", rec.Body)
+	}
+}
+
+func TestChatReportsMissingCollection(t *testing.T) {
+	srv, qdrantServer := newTestServerWithQdrant(t, nil)
+	qdrantServer.DeleteCollection("pokemons")
+
+	rec := serve(t, srv, http.MethodPost, "/api/v1/chat", map[string]any{"message": "Tell me about Pikachu"}, nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusServiceUnavailable, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "collection_not_found") || strings.Contains(rec.Body.String(), "rpc error") {
+		t.Errorf("body = %s, want collection_not_found without the raw gRPC error", rec.Body)
+	}
+}
+
+func TestChatReportsOpenOllamaBreaker(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(down.Close)
+
+	srv, qdrantServer := newTestServerWithQdrant(t, func(cfg *config.Config) {
+		cfg.Ollama.BaseURL = down.URL
+		cfg.Ollama.BreakerThreshold = 1
+		cfg.Ollama.BreakerCooldown = 60
+	})
+	qdrantServer.Upsert("pokemons", &qdrant.PointStruct{
+		Id:      qdrant.NewID(uuid.NewString()),
+		Vectors: qdrant.NewVectors(ollamatest.Embedding("Pikachu is an Electric type Pokemon.", testDimension)...),
+		Payload: qdrant.NewValueMap(map[string]any{
+			"content": "Pikachu is an Electric type Pokemon.",
+			"pokemon": "Pikachu",
+		}),
+	})
+
+	body := map[string]any{"message": "Tell me about Pikachu"}
+	if rec := serve(t, srv, http.MethodPost, "/api/v1/chat", body, nil); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("first failure status = %d, want %d: %s", rec.Code, http.StatusInternalServerError, rec.Body)
+	}
+
+	rec := serve(t, srv, http.MethodPost, "/api/v1/chat", body, nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusServiceUnavailable, rec.Body)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	if !strings.Contains(rec.Body.String(), "ollama_unavailable") {
+		t.Errorf("body = %s, want ollama_unavailable", rec.Body)
+	}
+}
+
+func TestRecommendValidatesRoleAndLimit(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	for _, query := range []string{"", "?role=support", "?role=tank&limit=0", "?role=tank&limit=51", "?role=tank&limit=x"} {
+		if rec := serve(t, srv, http.MethodGet, "/api/v1/recommend"+query, nil, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	rec := serve(t, srv, http.MethodGet, "/api/v1/recommend?role=Tank&limit=5", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Role    string `json:"role"`
+		Pokemon []any  `json:"pokemon"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Role != "tank" || len(resp.Pokemon) != 0 {
+		t.Errorf("response = %+v, want no tanks from an empty collection", resp)
+	}
+}
+
+// Chat answers arrive as one JSON body, so there is no SSE stream to keep alive
+func TestChatRespondsWithSingleJSONBody(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	rec := serve(t, srv, http.MethodPost, "/api/v1/chat", map[string]any{"message": "Tell me about Pikachu"}, http.Header{"Accept": {"text/event-stream"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		t.Errorf("content type = %q, want a JSON body even when SSE is accepted", contentType)
+	}
+	var resp map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Errorf("body isn't a single JSON object: %v", err)
+	}
+}
+
+func TestMigrateReportsCountsToAdmins(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Config) {
+		cfg.Server.AdminAPIKey = "admin-secret"
+	})
+
+	if rec := serve(t, srv, http.MethodPost, "/api/v1/admin/migrate", nil, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status without key = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec := serve(t, srv, http.MethodPost, "/api/v1/admin/migrate", nil, http.Header{"X-Api-Key": {"admin-secret"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var result repository.MigrationResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if want := (repository.MigrationResult{SchemaVersion: repository.SchemaVersion}); result != want {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+}
+
+func TestChatRejectsPastedBlob(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	blob := strings.Repeat("0123456789abcdefghijklmnopqrstuvwxyz", 25)[:900]
+	rec := serve(t, srv, http.MethodPost, "/api/v1/chat", map[string]any{"message": blob}, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), service.ErrWordTooLong.Error()) {
+		t.Errorf("body = %s, want the word length error", rec.Body)
+	}
+}
+
+func TestAccessLogHasStructuredFields(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	var buf bytes.Buffer
+	original := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(original) })
+
+	rec := serve(t, srv, http.MethodGet, "/api/v1/health", nil, http.Header{"X-Request-Id": {"req-123"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+
+	var entry struct {
+		Msg          string `json:"msg"`
+		Method       string `json:"method"`
+		Path         string `json:"path"`
+		Status       int    `json:"status"`
+		LatencyMS    *int64 `json:"latency_ms"`
+		ClientIP     string `json:"client_ip"`
+		RequestID    string `json:"request_id"`
+		ResponseSize int    `json:"response_size"`
+	}
+	var found bool
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		if err := json.Unmarshal(line, &entry); err == nil && entry.Msg == "http request" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatalf("no access log entry in:\n%s", buf.String())
+	}
+
+	if entry.Method != http.MethodGet || entry.Path != "/api/v1/health" || entry.Status != http.StatusOK {
+		t.Errorf("method %q, path %q, status %d", entry.Method, entry.Path, entry.Status)
+	}
+	if entry.LatencyMS == nil || *entry.LatencyMS < 0 {
+		t.Errorf("latency_ms = %v, want a non-negative duration", entry.LatencyMS)
+	}
+	if entry.ClientIP != "192.0.2.1" { // httptest.NewRequest's RemoteAddr
+		t.Errorf("client_ip = %q", entry.ClientIP)
+	}
+	if entry.RequestID != "req-123" {
+		t.Errorf("request_id = %q, want the caller's X-Request-ID", entry.RequestID)
+	}
+	if entry.ResponseSize != rec.Body.Len() {
+		t.Errorf("response_size = %d, want %d", entry.ResponseSize, rec.Body.Len())
+	}
+}
+
+func TestAdminEndpointsRequireAdminAPIKey(t *testing.T) {
+	endpoints := []struct {
+		path string
+		body any
+	}{
+		// An unknown source fails validation, so an authorized request never crawls
+		{"/api/v1/ingest", map[string]any{"source": "bulbapedia"}},
+		{"/api/v1/admin/migrate", nil},
+		{"/api/v1/admin/reembed", nil},
+	}
+	tests := []struct {
+		name       string
+		adminKey   string
+		provided   string
+		wantStatus int
+	}{
+		{"missing key", "admin-secret", "", http.StatusUnauthorized},
+		{"wrong key", "admin-secret", "guess", http.StatusForbidden},
+		{"chat key is not an admin key", "admin-secret", "chat-secret", http.StatusForbidden},
+		{"no admin key configured", "", "anything", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, func(cfg *config.Config) {
+				cfg.Server.APIKey = "chat-secret"
+				cfg.Server.AdminAPIKey = tt.adminKey
+			})
+
+			header := http.Header{}
+			if tt.provided != "" {
+				header.Set("X-API-Key", tt.provided)
+			}
+			for _, endpoint := range endpoints {
+				if rec := serve(t, srv, http.MethodPost, endpoint.path, endpoint.body, header); rec.Code != tt.wantStatus {
+					t.Errorf("%s: status = %d, want %d", endpoint.path, rec.Code, tt.wantStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizedAdminRequestsReachHandlers(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Config) {
+		cfg.Server.AdminAPIKey = "admin-secret"
+	})
+	header := http.Header{"X-Api-Key": {"admin-secret"}}
+
+	rec := serve(t, srv, http.MethodPost, "/api/v1/ingest", map[string]any{"source": "bulbapedia"}, header)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unsupported source") {
+		t.Errorf("ingest: status = %d, body = %s, want the handler's validation error", rec.Code, rec.Body)
+	}
+
+	if rec := serve(t, srv, http.MethodPost, "/api/v1/admin/reembed", nil, header); rec.Code != http.StatusOK {
+		t.Errorf("reembed: status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestChatStaysOpenWithAdminKey(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Config) {
+		cfg.Server.AdminAPIKey = "admin-secret"
+	})
+
+	rec := serve(t, srv, http.MethodPost, "/api/v1/chat", map[string]any{"message": "What type is Pikachu?"}, nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
+
+func TestListPokemonByTypesValidatesTypes(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	for _, query := range []string{"", "?types=", "?types=Water,Flying,Fire"} {
+		if rec := serve(t, srv, http.MethodGet, "/api/v1/pokemon"+query, nil, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	rec := serve(t, srv, http.MethodGet, "/api/v1/pokemon?types=Water,Flying", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Types   []string          `json:"types"`
+		Pokemon []json.RawMessage `json:"pokemon"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Types) != 2 || len(resp.Pokemon) != 0 {
+		t.Errorf("got %+v, want both types and no Pokemon in an empty collection", resp)
+	}
+}
+
+func TestListPokemonByNumberValidatesRange(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	for _, query := range []string{"?from=0", "?to=-3", "?from=abc", "?from=10&to=1"} {
+		if rec := serve(t, srv, http.MethodGet, "/api/v1/pokemon"+query, nil, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	rec := serve(t, srv, http.MethodGet, "/api/v1/pokemon?from=1&to=10", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		From    int               `json:"from"`
+		To      int               `json:"to"`
+		Pokemon []json.RawMessage `json:"pokemon"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.From != 1 || resp.To != 10 || len(resp.Pokemon) != 0 {
+		t.Errorf("got %+v, want the range echoed and no Pokemon in an empty collection", resp)
+	}
+}
+
+func TestStatsReflectsChats(t *testing.T) {
+	srv := newTestServer(t, nil)
+
+	for range 2 {
+		if rec := serve(t, srv, http.MethodPost, "/api/v1/chat", map[string]any{"message": "What type is Pikachu?"}, nil); rec.Code != http.StatusOK {
+			t.Fatalf("chat: status = %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	rec := serve(t, srv, http.MethodGet, "/api/v1/stats", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var snap service.StatsSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+		t.Fatal(err)
+	}
+	if snap.Chats != 2 || snap.StartedAt.IsZero() {
+		t.Errorf("snapshot = %+v, want 2 chats since a set start time", snap)
+	}
+}
+
+func TestNoCacheBypassesWarmAnswerCache(t *testing.T) {
+	srv, qdrantServer := newTestServerWithQdrant(t, func(cfg *config.Config) {
+		cfg.AnswerCache.Enabled = true
+	})
+	qdrantServer.Upsert("pokemons", &qdrant.PointStruct{
+		Id:      qdrant.NewID(uuid.NewString()),
+		Vectors: qdrant.NewVectors(ollamatest.Embedding("Pikachu is an Electric type Pokemon.", testDimension)...),
+		Payload: qdrant.NewValueMap(map[string]any{
+			"content": "Pikachu is an Electric type Pokemon.",
+			"pokemon": "Pikachu",
+		}),
+	})
+
+	chat := map[string]any{"message": "What type is Pikachu?"}
+	cacheHits := func() int {
+		var resp service.StatsSnapshot
+		rec := serve(t, srv, http.MethodGet, "/api/v1/stats", nil, nil)
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return int(resp.CacheHits)
+	}
+
+	// The first chat warms the cache and the second is served from it
+	for range 2 {
+		if rec := serve(t, srv, http.MethodPost, "/api/v1/chat", chat, nil); rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+	}
+	if hits := cacheHits(); hits != 1 {
+		t.Fatalf("cache hits = %d, want 1 once warm", hits)
+	}
+
+	bypass := http.Header{"Cache-Control": []string{"max-age=0, No-Cache"}}
+	if rec := serve(t, srv, http.MethodPost, "/api/v1/chat", chat, bypass); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(t, srv, http.MethodPost, "/api/v1/chat", map[string]any{"message": "What type is Pikachu?", "no_cache": true}, nil); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if hits := cacheHits(); hits != 1 {
+		t.Errorf("cache hits = %d, want the no-cache header and field to skip the warm entry", hits)
+	}
+}
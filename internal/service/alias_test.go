@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+const testAlias = "pokemons_live"
+
+func withAlias(cfg *config.Config) {
+	cfg.Qdrant.Alias = testAlias
+	cfg.AnswerCache.Enabled = true
+}
+
+// aliasedPokemon returns the distinct Pokemon names stored behind the alias, sorted
+func (env *testEnv) aliasedPokemon() []string {
+	var names []string
+	for _, point := range env.qdrant.Points(testAlias) {
+		if name := point.GetPayload()["pokemon"].GetStringValue(); !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestAliasSwapsOnlyAfterSuccessfulIngest(t *testing.T) {
+	env := newTestEnv(t, withAlias)
+	env.source.add(bulbasaur, charmander)
+
+	if target := env.qdrant.AliasTarget(testAlias); target != "pokemons" {
+		t.Fatalf("alias points to %q at startup, want the configured collection", target)
+	}
+
+	// Midway through, Bulbasaur is only in the shadow collection
+	var midway []string
+	env.source.detail = func(_ context.Context, url string) error {
+		if url != pokemonURL("Charmander") {
+			return nil
+		}
+		if target := env.qdrant.AliasTarget(testAlias); target != "pokemons" {
+			midway = append(midway, "alias moved to "+target)
+		}
+		if names := env.aliasedPokemon(); len(names) > 0 {
+			midway = append(midway, "chats see "+names[0])
+		}
+		if _, ok := env.service.knowledgeIndex.Lookup("Bulbasaur"); ok {
+			midway = append(midway, "knowledge index has Bulbasaur")
+		}
+		if empty, err := env.service.collection.isEmpty(context.Background()); err != nil || !empty {
+			midway = append(midway, "collection marked non-empty")
+		}
+		return nil
+	}
+	env.ingest(t, "Bulbasaur", "Charmander")
+
+	for _, problem := range midway {
+		t.Errorf("during the ingest: %s", problem)
+	}
+	if target := env.qdrant.AliasTarget(testAlias); target == "pokemons" || target == "" {
+		t.Errorf("alias points to %q after the ingest, want the shadow collection", target)
+	}
+	if want := []string{"Bulbasaur", "Charmander"}; !slices.Equal(env.aliasedPokemon(), want) {
+		t.Errorf("stored = %v, want %v", env.aliasedPokemon(), want)
+	}
+	if _, ok := env.service.knowledgeIndex.Lookup("Charmander"); !ok {
+		t.Error("knowledge index missing Charmander after the swap")
+	}
+	if collections := env.qdrant.Collections(); len(collections) != 1 {
+		t.Errorf("collections = %v, want only the swapped-in shadow", collections)
+	}
+}
+
+func TestFailedIngestKeepsAlias(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		withAlias(cfg)
+		cfg.Ingest.RetryDelay = 1
+	})
+	env.source.add(pikachu, charmander)
+	env.ingest(t, "Pikachu")
+	target := env.qdrant.AliasTarget(testAlias)
+
+	env.source.detail = func(context.Context, string) error { return errors.New("connection reset") }
+	_, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   env.source.urls("Charmander"),
+	})
+	if !errors.Is(err, ErrAllPokemonFailed) {
+		t.Fatalf("err = %v, want ErrAllPokemonFailed", err)
+	}
+
+	if got := env.qdrant.AliasTarget(testAlias); got != target {
+		t.Errorf("alias moved to %q, want it kept on %q", got, target)
+	}
+	if collections := env.qdrant.Collections(); !slices.Equal(collections, []string{target}) {
+		t.Errorf("collections = %v, want the shadow dropped", collections)
+	}
+}
+
+func TestStoppedIngestSwapsAliasIfAnythingWasStored(t *testing.T) {
+	tests := []struct {
+		name     string
+		stopAt   string
+		wantSwap bool
+		want     []string
+	}{
+		{"after storing Bulbasaur", "Charmander", true, []string{"Bulbasaur", "Pikachu"}},
+		{"before storing anything", "Bulbasaur", false, []string{"Pikachu"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, withAlias)
+			env.source.add(pikachu, bulbasaur, charmander, squirtle)
+			env.ingest(t, "Pikachu")
+			env.chat(t, "What type is Pikachu?")
+			target := env.qdrant.AliasTarget(testAlias)
+
+			// Cancelling stands in for the job timeout or a shutdown
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			env.source.detail = func(ctx context.Context, url string) error {
+				if url == pokemonURL(tt.stopAt) {
+					cancel()
+					return ctx.Err()
+				}
+				return nil
+			}
+			_, err := env.service.IngestPokemonData(ctx, &IngestRequest{
+				Source: pokemonDBSource,
+				URLs:   env.source.urls("Bulbasaur", "Charmander", "Squirtle"),
+			})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("err = %v, want the ingest stopped", err)
+			}
+
+			if swapped := env.qdrant.AliasTarget(testAlias) != target; swapped != tt.wantSwap {
+				t.Errorf("alias swapped = %t, want %t", swapped, tt.wantSwap)
+			}
+			if !slices.Equal(env.aliasedPokemon(), tt.want) {
+				t.Errorf("stored = %v, want %v", env.aliasedPokemon(), tt.want)
+			}
+			if len(env.qdrant.Collections()) != 1 {
+				t.Errorf("collections = %v, want the unused one dropped", env.qdrant.Collections())
+			}
+			if _, ok := env.service.knowledgeIndex.Lookup("Bulbasaur"); ok != tt.wantSwap {
+				t.Errorf("knowledge index has Bulbasaur = %t, want %t", ok, tt.wantSwap)
+			}
+
+			// The swap changed what chats search, so cached answers must go
+			env.chat(t, "What type is Pikachu?")
+			wantAnswers := 1
+			if tt.wantSwap {
+				wantAnswers = 2
+			}
+			if got := len(env.ollama.GenerateRequests()); got != wantAnswers {
+				t.Errorf("generated %d answers, want %d", got, wantAnswers)
+			}
+		})
+	}
+}
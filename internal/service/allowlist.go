@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/katatrina/poke-bot/internal/crawler"
+	"github.com/katatrina/poke-bot/internal/pokename"
+)
+
+// errNotAllowlisted is returned by ingestPokemon for Pokemon outside cfg.KB.PokemonAllowlist
+var errNotAllowlisted = errors.New("not in pokemon allowlist")
+
+// pokemonAllowlist matches Pokemon against cfg.KB.PokemonAllowlist by name
+// slug or national number. A nil allowlist allows everything.
+type pokemonAllowlist struct {
+	names   map[string]bool // Slugs, e.g. "mr-mime"
+	numbers map[int]bool
+}
+
+func newPokemonAllowlist(entries []string) *pokemonAllowlist {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	allowlist := &pokemonAllowlist{
+		names:   make(map[string]bool),
+		numbers: make(map[int]bool),
+	}
+	for _, entry := range entries {
+		if number, err := strconv.Atoi(strings.TrimSpace(entry)); err == nil {
+			allowlist.numbers[number] = true
+		} else {
+			allowlist.names[pokename.Key(entry)] = true
+		}
+	}
+
+	return allowlist
+}
+
+// filterURLs drops detail URLs that can already be ruled out from their last
+// path segment: pokemondb links end in a name slug, PokeAPI links in a number.
+// URLs that can't be decided yet are kept and checked by allows after crawling.
+func (allowlist *pokemonAllowlist) filterURLs(pokemonURLs []string) []string {
+	if allowlist == nil {
+		return pokemonURLs
+	}
+
+	var filtered []string
+	for _, pokemonURL := range pokemonURLs {
+		if allowlist.mayAllowURL(pokemonURL) {
+			filtered = append(filtered, pokemonURL)
+		}
+	}
+
+	return filtered
+}
+
+func (allowlist *pokemonAllowlist) mayAllowURL(pokemonURL string) bool {
+	u, err := url.Parse(pokemonURL)
+	if err != nil {
+		return true
+	}
+	segment := path.Base(u.Path)
+
+	if number, err := strconv.Atoi(segment); err == nil {
+		return allowlist.numbers[number] || len(allowlist.names) > 0
+	}
+
+	return allowlist.names[pokename.Key(segment)] || len(allowlist.numbers) > 0
+}
+
+// allows reports whether a crawled Pokemon is on the allowlist
+func (allowlist *pokemonAllowlist) allows(pokemon *crawler.PokemonData) bool {
+	if allowlist == nil {
+		return true
+	}
+
+	if allowlist.names[pokename.Key(pokemon.Name)] {
+		return true
+	}
+
+	number, err := strconv.Atoi(pokemon.Number)
+	return err == nil && allowlist.numbers[number]
+}
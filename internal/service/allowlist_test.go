@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+// storedPokemon returns the distinct Pokemon names stored in the collection, sorted
+func (env *testEnv) storedPokemon() []string {
+	var names []string
+	for _, point := range env.qdrant.Points("pokemons") {
+		if name := point.GetPayload()["pokemon"].GetStringValue(); !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestOnlyAllowlistedPokemonAreCrawled(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.KB.PokemonAllowlist = []string{"Bulbasaur", "squirtle"}
+	})
+	env.source.add(bulbasaur, charmander, squirtle, pikachu)
+
+	if _, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{Source: pokemonDBSource, CrawlLimit: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := env.source.crawledURLs(), env.source.urls("Bulbasaur", "Squirtle"); !slices.Equal(got, want) {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+	if got := env.storedPokemon(); !slices.Equal(got, []string{"Bulbasaur", "Squirtle"}) {
+		t.Errorf("stored %v, want Bulbasaur and Squirtle", got)
+	}
+}
+
+func TestAllowlistedNumbersAreCheckedAfterCrawl(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.KB.PokemonAllowlist = []string{"4", "0025"}
+	})
+	env.source.add(bulbasaur, charmander, squirtle, pikachu)
+
+	// pokemondb URLs carry names, so numbers can only be matched once crawled
+	if _, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{Source: pokemonDBSource, CrawlLimit: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := env.storedPokemon(); !slices.Equal(got, []string{"Charmander", "Pikachu"}) {
+		t.Errorf("stored %v, want Charmander and Pikachu", got)
+	}
+}
+
+func TestIngestOutsideAllowlistFails(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.KB.PokemonAllowlist = []string{"mew"}
+	})
+	env.source.add(bulbasaur, charmander)
+
+	_, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{Source: pokemonDBSource, CrawlLimit: 10})
+	if !errors.Is(err, ErrNothingToIngest) {
+		t.Fatalf("error = %v, want ErrNothingToIngest", err)
+	}
+	if crawled := env.source.crawledURLs(); len(crawled) != 0 {
+		t.Errorf("crawled %v, want nothing", crawled)
+	}
+}
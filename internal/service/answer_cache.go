@@ -0,0 +1,157 @@
+package service
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+// answerCache remembers answers to standalone questions. Lookups match the
+// normalized query exactly, then fall back to the most similar cached query
+// embedding when it is within the configured cosine similarity threshold.
+type answerCache struct {
+	mu                  sync.Mutex
+	entries             []*answerCacheEntry // Oldest first
+	maxEntries          int
+	ttl                 time.Duration
+	similarityThreshold float32 // Zero disables semantic matching
+}
+
+type answerCacheEntry struct {
+	query     string
+	embedding []float32
+	response  ChatResponse
+	createdAt time.Time
+}
+
+func newAnswerCache(maxEntries int, ttl time.Duration, similarityThreshold float32) *answerCache {
+	return &answerCache{
+		maxEntries:          maxEntries,
+		ttl:                 ttl,
+		similarityThreshold: similarityThreshold,
+	}
+}
+
+func newAnswerCacheFromConfig(cfg config.AnswerCacheConfig) *answerCache {
+	maxEntries := cfg.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 500
+	}
+
+	ttl := time.Duration(cfg.TTL) * time.Second
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+
+	var similarityThreshold float32
+	if cfg.SemanticMatch {
+		similarityThreshold = cfg.SimilarityThreshold
+		if similarityThreshold <= 0 {
+			similarityThreshold = 0.97 // High default to avoid answering a different question
+		}
+	}
+
+	return newAnswerCache(maxEntries, ttl, similarityThreshold)
+}
+
+// get returns a cached answer for query, or ok=false on a miss
+func (cache *answerCache) get(query string, embedding []float32) (response ChatResponse, ok bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.purgeExpired()
+
+	key := normalizeCacheQuery(query)
+	for _, entry := range cache.entries {
+		if entry.query == key {
+			return entry.response, true
+		}
+	}
+
+	if cache.similarityThreshold <= 0 {
+		return ChatResponse{}, false
+	}
+
+	var best *answerCacheEntry
+	var bestSimilarity float32
+	for _, entry := range cache.entries {
+		similarity := cosineSimilarity(entry.embedding, embedding)
+		if similarity >= cache.similarityThreshold && similarity > bestSimilarity {
+			best, bestSimilarity = entry, similarity
+		}
+	}
+
+	if best == nil {
+		return ChatResponse{}, false
+	}
+
+	return best.response, true
+}
+
+func (cache *answerCache) put(query string, embedding []float32, response ChatResponse) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	// Replace rather than shadow an earlier answer, which get would still find first
+	key := normalizeCacheQuery(query)
+	cache.entries = slices.DeleteFunc(cache.entries, func(entry *answerCacheEntry) bool {
+		return entry.query == key
+	})
+
+	cache.entries = append(cache.entries, &answerCacheEntry{
+		query:     key,
+		embedding: embedding,
+		response:  response,
+		createdAt: time.Now(),
+	})
+
+	if len(cache.entries) > cache.maxEntries {
+		cache.entries = cache.entries[len(cache.entries)-cache.maxEntries:]
+	}
+}
+
+// invalidate drops every cached answer, e.g. once the collection has changed
+func (cache *answerCache) invalidate() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.entries = nil
+}
+
+// purgeExpired drops entries older than the TTL. Caller must hold mu.
+func (cache *answerCache) purgeExpired() {
+	i := 0
+	for i < len(cache.entries) && time.Since(cache.entries[i].createdAt) > cache.ttl {
+		i++
+	}
+	cache.entries = cache.entries[i:]
+}
+
+func normalizeCacheQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b, or 0 if
+// they differ in length or either is zero
+func cosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/katatrina/poke-bot/internal/config"
+	"github.com/katatrina/poke-bot/internal/ollamatest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAnswerCacheSemanticMatchFollowsThreshold(t *testing.T) {
+	const (
+		cached     = "What is the strongest Pokemon?"
+		paraphrase = "Which Pokemon is the strongest one?"
+		unrelated  = "How tall is Onix?"
+	)
+	cachedEmbedding := ollamatest.Embedding(cached, testDimension)
+	paraphraseEmbedding := ollamatest.Embedding(paraphrase, testDimension)
+	similarity := cosineSimilarity(cachedEmbedding, paraphraseEmbedding)
+
+	tests := []struct {
+		name      string
+		threshold float32
+		query     string
+		wantHit   bool
+	}{
+		{"paraphrase within threshold", similarity - 0.01, paraphrase, true},
+		{"paraphrase below threshold", min(similarity+0.01, 1), paraphrase, false},
+		{"unrelated question", similarity - 0.01, unrelated, false},
+		{"semantic match disabled", 0, paraphrase, false},
+		{"exact match ignores threshold", 0, "  what is the STRONGEST pokemon? ", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newAnswerCache(10, time.Hour, tt.threshold)
+			cache.put(cached, cachedEmbedding, ChatResponse{Response: "Arceus"})
+
+			response, ok := cache.get(tt.query, ollamatest.Embedding(tt.query, testDimension))
+			if ok != tt.wantHit {
+				t.Fatalf("hit = %v, want %v (similarity %.3f, threshold %.3f)", ok, tt.wantHit, similarity, tt.threshold)
+			}
+			if ok && response.Response != "Arceus" {
+				t.Errorf("cached response = %q, want Arceus", response.Response)
+			}
+		})
+	}
+}
+
+func TestAnswerCacheDefaultsToHighThreshold(t *testing.T) {
+	cache := newAnswerCacheFromConfig(config.AnswerCacheConfig{Enabled: true, SemanticMatch: true})
+	if cache.similarityThreshold != 0.97 {
+		t.Errorf("default similarity threshold = %v, want 0.97", cache.similarityThreshold)
+	}
+}
+
+func TestIngestInvalidatesAnswerCache(t *testing.T) {
+	for _, alias := range []string{"", "pokemons_live"} {
+		t.Run("alias="+alias, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.AnswerCache.Enabled = true
+				cfg.Qdrant.Alias = alias
+			})
+			env.source.add(pikachu, charmander)
+			env.ingest(t, "Pikachu")
+
+			env.chat(t, "What type is Pikachu?")
+			env.chat(t, "What type is Pikachu?")
+			if got := len(env.ollama.GenerateRequests()); got != 1 {
+				t.Fatalf("generated %d answers, want the repeat served from the cache", got)
+			}
+
+			env.ingest(t, "Charmander")
+			env.chat(t, "What type is Pikachu?")
+			if got := len(env.ollama.GenerateRequests()); got != 2 {
+				t.Errorf("generated %d answers, want a fresh one after the ingest", got)
+			}
+		})
+	}
+}
+
+func TestFailedAliasSwapKeepsAnswerCache(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.AnswerCache.Enabled = true
+		cfg.Qdrant.Alias = "pokemons_live"
+	})
+	env.source.add(pikachu, charmander)
+	env.ingest(t, "Pikachu")
+	env.chat(t, "What type is Pikachu?")
+
+	env.qdrant.SetError("UpdateAliases", status.Error(codes.Unavailable, "qdrant is restarting"))
+	if _, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   env.source.urls("Charmander"),
+	}); err == nil {
+		t.Fatal("ingest succeeded despite the failed alias swap")
+	}
+	env.qdrant.SetError("UpdateAliases", nil)
+
+	env.chat(t, "What type is Pikachu?")
+	if got := len(env.ollama.GenerateRequests()); got != 1 {
+		t.Errorf("generated %d answers, want the cached one kept while the alias still serves the old collection", got)
+	}
+}
+
+func TestChatWithSeedBypassesAnswerCache(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.AnswerCache.Enabled = true
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+	env.ollama.SetGenerate(func(req ollamatest.GenerateRequest) string {
+		return fmt.Sprintf("seed %v", req.Options["seed"])
+	})
+
+	env.chat(t, "What type is Pikachu?")
+
+	seed := 42
+	resp, err := env.service.Chat(context.Background(), &ChatRequest{Message: "What type is Pikachu?", Seed: &seed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Response != "seed 42" {
+		t.Errorf("response = %q, want a fresh answer generated with seed 42", resp.Response)
+	}
+
+	// Nor is the seeded answer served to unseeded questions
+	if resp := env.chat(t, "What type is Pikachu?"); resp.Response != "seed <nil>" {
+		t.Errorf("unseeded response = %q, want the first cached answer", resp.Response)
+	}
+}
+
+func TestNoCacheChatRefreshesOnlyWhenConfigured(t *testing.T) {
+	for _, refresh := range []bool{false, true} {
+		t.Run(fmt.Sprintf("refresh_on_bypass=%v", refresh), func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.AnswerCache.Enabled = true
+				cfg.AnswerCache.RefreshOnBypass = refresh
+			})
+			env.source.add(pikachu)
+			env.ingest(t, "Pikachu")
+
+			answer := "Pikachu is Electric."
+			env.ollama.SetGenerate(func(ollamatest.GenerateRequest) string { return answer })
+			env.chat(t, "What type is Pikachu?")
+
+			answer = "Pikachu is an Electric type."
+			fresh, err := env.service.Chat(context.Background(), &ChatRequest{Message: "What type is Pikachu?", NoCache: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fresh.Response != answer {
+				t.Errorf("no-cache response = %q, want the fresh answer %q", fresh.Response, answer)
+			}
+
+			want := "Pikachu is Electric."
+			if refresh {
+				want = answer
+			}
+			if cached := env.chat(t, "What type is Pikachu?"); cached.Response != want {
+				t.Errorf("cached response = %q, want %q", cached.Response, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import "fmt"
+
+const (
+	readingLevelNormal      = "normal"
+	readingLevelKidFriendly = "kid_friendly"
+	readingLevelExpert      = "expert"
+
+	audienceChild  = "child"
+	audienceAdult  = "adult"
+	audienceExpert = "expert"
+)
+
+// audienceReadingLevels maps ChatRequest.Audience to the cfg.RAG.ReadingLevel it selects
+var audienceReadingLevels = map[string]string{
+	audienceChild:  readingLevelKidFriendly,
+	audienceAdult:  readingLevelNormal,
+	audienceExpert: readingLevelExpert,
+}
+
+// answerStyle carries the per-request choices that change the prompt's instructions
+type answerStyle struct {
+	structured   bool   // Ask for a StructuredAnswer instead of prose
+	readingLevel string // One of the readingLevel* constants
+}
+
+// resolveReadingLevel returns the reading level for a request's audience,
+// falling back to cfg.RAG.ReadingLevel when none is given
+func (s *RAGService) resolveReadingLevel(audience string) string {
+	if level, ok := audienceReadingLevels[audience]; ok {
+		return level
+	}
+	if level := s.config.RAG.ReadingLevel; level != "" {
+		return level
+	}
+	return readingLevelNormal // Default fallback
+}
+
+// lengthInstruction asks for about cfg.RAG.TargetResponseTokens tokens, given
+// in words too since models judge those better (about 0.75 words per token).
+// It returns "" when no target is set.
+func (s *RAGService) lengthInstruction() string {
+	target := s.config.RAG.TargetResponseTokens
+	if target <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("- Aim for an answer of about %d tokens (~%d words)\n", target, max(target*3/4, 1))
+}
+
+// numPredict returns the num_predict option for cfg.RAG.TargetResponseTokens,
+// or 0 when no target is set. It allows half as much again as the target, so
+// the target stays advisory and only runaway answers are cut off.
+func (s *RAGService) numPredict() int {
+	target := s.config.RAG.TargetResponseTokens
+	if target <= 0 {
+		return 0
+	}
+	return target + target/2
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+// lastPrompt returns the prompt of the most recent generate call
+func (env *testEnv) lastPrompt(t *testing.T) string {
+	t.Helper()
+
+	requests := env.ollama.GenerateRequests()
+	if len(requests) == 0 {
+		t.Fatal("no generate request was sent")
+	}
+	return requests[len(requests)-1].Prompt
+}
+
+func TestInstructionsReflectConfiguredLanguageAndReadingLevel(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.ResponseLanguage = "Vietnamese"
+		cfg.RAG.ReadingLevel = readingLevelKidFriendly
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	env.chat(t, "What type is Pikachu?")
+	prompt := env.lastPrompt(t)
+
+	for _, want := range []string{
+		"Always answer in Vietnamese",
+		"a young child can understand",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt is missing %q:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestInstructionsDefaultToEnglishAtNormalLevel(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	env.chat(t, "What type is Pikachu?")
+	prompt := env.lastPrompt(t)
+
+	for _, unwanted := range []string{"Always answer in", "young child", "experienced player"} {
+		if strings.Contains(prompt, unwanted) {
+			t.Errorf("default prompt contains %q:\n%s", unwanted, prompt)
+		}
+	}
+}
+
+func TestAudienceOverridesConfiguredReadingLevel(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.ReadingLevel = readingLevelKidFriendly
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	if _, err := env.service.Chat(context.Background(), &ChatRequest{Message: "What type is Pikachu?", Audience: audienceExpert}); err != nil {
+		t.Fatal(err)
+	}
+	prompt := env.lastPrompt(t)
+
+	if !strings.Contains(prompt, "experienced player") || strings.Contains(prompt, "young child") {
+		t.Errorf("prompt doesn't use the expert reading level:\n%s", prompt)
+	}
+}
+
+func TestInstructionsChangePerAudience(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	tests := []struct {
+		audience string
+		want     []string
+		unwanted []string
+	}{
+		{audienceChild, []string{"a young child can understand", "everyday comparisons"}, []string{"experienced player"}},
+		{audienceAdult, nil, []string{"young child", "experienced player"}},
+		{audienceExpert, []string{"experienced player", "exact numbers"}, []string{"young child"}},
+	}
+
+	for _, tt := range tests {
+		req := &ChatRequest{Message: "How fast is Pikachu?", Audience: tt.audience}
+		if err := req.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := env.service.Chat(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		prompt := env.lastPrompt(t)
+
+		for _, want := range tt.want {
+			if !strings.Contains(prompt, want) {
+				t.Errorf("audience %q: prompt is missing %q", tt.audience, want)
+			}
+		}
+		for _, unwanted := range tt.unwanted {
+			if strings.Contains(prompt, unwanted) {
+				t.Errorf("audience %q: prompt contains %q", tt.audience, unwanted)
+			}
+		}
+	}
+}
+
+func TestChatRequestRejectsUnknownAudience(t *testing.T) {
+	req := &ChatRequest{Message: "How fast is Pikachu?", Audience: "toddler"}
+	if err := req.Validate(); err == nil {
+		t.Error("expected an unknown audience to be rejected")
+	}
+}
+
+func TestHistoryIsTrimmedServerSide(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.MaxHistoryTurns = 2
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	// Ten short messages fit the token budget, so only the turn window trims them
+	var history []ConversationMessage
+	for i := range 10 {
+		msgType := "user"
+		if i%2 == 1 {
+			msgType = "assistant"
+		}
+		history = append(history, ConversationMessage{Type: msgType, Content: fmt.Sprintf("history marker %02d", i)})
+	}
+
+	req := &ChatRequest{Message: "What type is Pikachu?", ConversationHistory: history}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.service.Chat(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	prompt := env.lastPrompt(t)
+
+	for i := range 10 {
+		marker := fmt.Sprintf("history marker %02d", i)
+		if kept := i >= 6; strings.Contains(prompt, marker) != kept {
+			t.Errorf("%q in prompt = %t, want %t", marker, !kept, kept)
+		}
+	}
+}
+
+func TestDuplicatedHistoryTurnsAreCollapsed(t *testing.T) {
+	// The second question was submitted twice
+	history := []ConversationMessage{
+		{Type: "user", Content: "Tell me about Pikachu"},
+		{Type: "assistant", Content: "Pikachu is an Electric type Pokemon."},
+		{Type: "user", Content: "What does it evolve into?"},
+		{Type: "user", Content: "What does it evolve into?"},
+		{Type: "assistant", Content: "It evolves into Raichu."},
+	}
+
+	for _, dedup := range []bool{true, false} {
+		t.Run(fmt.Sprintf("dedup_history=%t", dedup), func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.RAG.DedupHistory = dedup
+				cfg.RAG.MaxHistoryTurns = 2
+			})
+			env.source.add(pikachu)
+			env.ingest(t, "Pikachu")
+
+			req := &ChatRequest{Message: "How fast is Raichu?", ConversationHistory: history}
+			if err := req.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := env.service.Chat(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			prompt := env.lastPrompt(t)
+
+			wantRepeats := 1
+			if !dedup {
+				wantRepeats = 2
+			}
+			if got := strings.Count(prompt, "Human: What does it evolve into?"); got != wantRepeats {
+				t.Errorf("repeated question appears %d times, want %d", got, wantRepeats)
+			}
+			// The duplicate no longer takes a slot in the two-turn window
+			if kept := strings.Contains(prompt, "Human: Tell me about Pikachu"); kept != dedup {
+				t.Errorf("first turn kept = %t, want %t", kept, dedup)
+			}
+		})
+	}
+}
+
+func TestDedupHistoryKeepsAnythingButExactRepeats(t *testing.T) {
+	history := []ConversationMessage{
+		{Type: "user", Content: "Hi"},
+		{Type: "assistant", Content: "Hi"},
+		{Type: "user", Content: "hi"},
+		{Type: "user", Content: "Hi"},
+		{Type: "user", Content: "Hi"},
+		{Type: "assistant", Content: "Hello!"},
+		{Type: "user", Content: "Hi"},
+	}
+
+	got := dedupHistory(history)
+	want := slices.Delete(slices.Clone(history), 4, 5)
+	if !slices.Equal(got, want) {
+		t.Errorf("deduped = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestTargetResponseTokensSetsLengthAndNumPredict(t *testing.T) {
+	tests := []struct {
+		target          int
+		wantInstruction string
+		wantNumPredict  float64 // JSON numbers decode as float64
+	}{
+		{200, "Aim for an answer of about 200 tokens (~150 words)", 300},
+		{0, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("target=%d", tt.target), func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.RAG.TargetResponseTokens = tt.target
+			})
+			env.source.add(pikachu)
+			env.ingest(t, "Pikachu")
+
+			env.chat(t, "What type is Pikachu?")
+			request := env.ollama.GenerateRequests()[0]
+
+			if tt.wantInstruction == "" {
+				if strings.Contains(request.Prompt, "Aim for an answer of about") {
+					t.Errorf("prompt has a length instruction without a target:\n%s", request.Prompt)
+				}
+			} else if !strings.Contains(request.Prompt, tt.wantInstruction) {
+				t.Errorf("prompt is missing %q:\n%s", tt.wantInstruction, request.Prompt)
+			}
+
+			numPredict, ok := request.Options["num_predict"]
+			if tt.wantNumPredict == 0 {
+				if ok {
+					t.Errorf("num_predict = %v, want it unset", numPredict)
+				}
+			} else if numPredict != tt.wantNumPredict {
+				t.Errorf("num_predict = %v, want %v", numPredict, tt.wantNumPredict)
+			}
+		})
+	}
+}
+
+func TestTargetResponseTokensLeavesStructuredOutputUncut(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.TargetResponseTokens = 200
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	if _, err := env.service.Chat(context.Background(), &ChatRequest{Message: "What type is Pikachu?", Format: chatFormatJSON}); err != nil {
+		t.Fatal(err)
+	}
+	if numPredict, ok := env.ollama.GenerateRequests()[0].Options["num_predict"]; ok {
+		t.Errorf("num_predict = %v, want it unset so the JSON isn't cut short", numPredict)
+	}
+}
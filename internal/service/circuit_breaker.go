@@ -0,0 +1,118 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrOllamaUnavailable is returned without calling Ollama while the circuit
+// breaker is open after repeated failures
+var ErrOllamaUnavailable = errors.New("ollama unavailable, circuit breaker open")
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// circuitBreaker fast-fails Ollama calls after threshold consecutive failures,
+// so an outage doesn't make every request wait out its timeout. Once cooldown
+// has passed, a single probe call is let through (half-open): success closes
+// the breaker, failure opens it for another cooldown. A probe that never
+// reports back is replaced after a cooldown. A nil breaker allows everything.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int       // Consecutive failures while closed
+	openedAt time.Time // When the breaker last opened or let a probe through
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second // Default fallback
+	}
+
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     breakerClosed,
+	}
+}
+
+// allow returns ErrOllamaUnavailable if the call must not be made. When the
+// cooldown has passed it lets exactly one caller through as the probe.
+func (cb *circuitBreaker) allow() error {
+	if cb == nil {
+		return nil
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == breakerClosed {
+		return nil
+	}
+	if wait := cb.cooldown - cb.now().Sub(cb.openedAt); wait > 0 {
+		return fmt.Errorf("%w (retry in %s)", ErrOllamaUnavailable, wait.Round(time.Second))
+	}
+
+	cb.state = breakerHalfOpen
+	cb.openedAt = cb.now()
+	log.Printf("Ollama circuit breaker half-open, probing")
+	return nil
+}
+
+// record reports the outcome of a call that allow let through
+func (cb *circuitBreaker) record(failed bool) {
+	if cb == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if !failed {
+		if cb.state != breakerClosed {
+			log.Printf("Ollama circuit breaker closed, Ollama is responding again")
+		}
+		cb.state = breakerClosed
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if cb.state == breakerHalfOpen || cb.failures >= cb.threshold {
+		if cb.state != breakerOpen {
+			log.Printf("Warning: Ollama circuit breaker open after %d consecutive failures, failing fast for %s", cb.failures, cb.cooldown)
+		}
+		cb.state = breakerOpen
+		cb.openedAt = cb.now()
+	}
+}
+
+// retryAfter returns how long until the breaker lets a probe through, or 0
+// if calls are allowed now
+func (cb *circuitBreaker) retryAfter() time.Duration {
+	if cb == nil {
+		return 0
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == breakerClosed {
+		return 0
+	}
+	return max(cb.cooldown-cb.now().Sub(cb.openedAt), 0)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	cb := newCircuitBreaker(3, 30*time.Second)
+	cb.now = clock.Now
+
+	// Closed: failures below the threshold still let calls through
+	for range 2 {
+		if err := cb.allow(); err != nil {
+			t.Fatalf("closed breaker refused a call: %v", err)
+		}
+		cb.record(true)
+	}
+	if err := cb.allow(); err != nil {
+		t.Fatalf("closed breaker refused a call: %v", err)
+	}
+	cb.record(true)
+
+	// Open: the third consecutive failure fails calls fast until the cooldown ends
+	if err := cb.allow(); !errors.Is(err, ErrOllamaUnavailable) {
+		t.Fatalf("err = %v, want ErrOllamaUnavailable once open", err)
+	}
+	if got := cb.retryAfter(); got != 30*time.Second {
+		t.Errorf("retryAfter = %s, want 30s", got)
+	}
+	clock.advance(29 * time.Second)
+	if err := cb.allow(); !errors.Is(err, ErrOllamaUnavailable) {
+		t.Fatalf("err = %v, want ErrOllamaUnavailable before the cooldown ends", err)
+	}
+
+	// Half-open: one probe is let through, and its failure reopens the breaker
+	clock.advance(time.Second)
+	if err := cb.allow(); err != nil {
+		t.Fatalf("probe refused after the cooldown: %v", err)
+	}
+	if err := cb.allow(); !errors.Is(err, ErrOllamaUnavailable) {
+		t.Fatalf("err = %v, want only one probe while half-open", err)
+	}
+	cb.record(true)
+	if err := cb.allow(); !errors.Is(err, ErrOllamaUnavailable) {
+		t.Fatalf("err = %v, want a failed probe to reopen the breaker", err)
+	}
+
+	// A successful probe closes it again and resets the failure count
+	clock.advance(30 * time.Second)
+	if err := cb.allow(); err != nil {
+		t.Fatalf("probe refused after the cooldown: %v", err)
+	}
+	cb.record(false)
+	if got := cb.retryAfter(); got != 0 {
+		t.Errorf("retryAfter = %s once closed, want 0", got)
+	}
+	cb.record(true)
+	if err := cb.allow(); err != nil {
+		t.Errorf("one failure after closing opened the breaker: %v", err)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	cb := newCircuitBreaker(0, time.Minute)
+	if cb != nil {
+		t.Fatal("a zero threshold should disable the breaker")
+	}
+
+	// A nil breaker allows everything
+	for range 10 {
+		cb.record(true)
+	}
+	if err := cb.allow(); err != nil {
+		t.Errorf("disabled breaker refused a call: %v", err)
+	}
+}
+
+func TestChatFailsFastWhileOllamaIsDown(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Ollama.BreakerThreshold = 2
+		cfg.Ollama.BreakerCooldown = 30
+	})
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	env.service.ollamaBreaker.now = clock.Now
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	env.ollama.SetStatus("/api/embed", http.StatusInternalServerError)
+	for range 2 {
+		_, err := env.service.Chat(context.Background(), &ChatRequest{Message: "What type is Pikachu?"})
+		if err == nil || errors.Is(err, ErrOllamaUnavailable) {
+			t.Fatalf("err = %v, want the Ollama failure itself", err)
+		}
+	}
+
+	_, err := env.service.Chat(context.Background(), &ChatRequest{Message: "What type is Pikachu?"})
+	if !errors.Is(err, ErrOllamaUnavailable) {
+		t.Fatalf("err = %v, want ErrOllamaUnavailable after 2 failures", err)
+	}
+	if got := env.service.OllamaRetryAfter(); got != 30*time.Second {
+		t.Errorf("OllamaRetryAfter = %s, want 30s", got)
+	}
+
+	// Once Ollama recovers, the probe after the cooldown closes the breaker
+	env.ollama.SetStatus("/api/embed", 0)
+	clock.advance(30 * time.Second)
+	env.chat(t, "What type is Pikachu?")
+	if got := env.service.OllamaRetryAfter(); got != 0 {
+		t.Errorf("OllamaRetryAfter = %s after recovering, want 0", got)
+	}
+}
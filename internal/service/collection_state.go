@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/katatrina/poke-bot/internal/repository"
+)
+
+// emptyKnowledgeBaseResponse is returned by Chat instead of letting the model
+// answer from its own knowledge when nothing has been ingested yet
+const emptyKnowledgeBaseResponse = "The knowledge base is empty; please ingest data first."
+
+// collectionState caches whether the collection has any points. Nothing
+// deletes points, so once non-empty the answer is kept for good; an empty
+// answer is re-checked at most every recheckInterval.
+type collectionState struct {
+	vectorRepo      *repository.VectorRepository
+	recheckInterval time.Duration
+
+	mu        sync.Mutex
+	nonEmpty  bool
+	checkedAt time.Time
+}
+
+func newCollectionState(vectorRepo *repository.VectorRepository) *collectionState {
+	return &collectionState{
+		vectorRepo:      vectorRepo,
+		recheckInterval: 10 * time.Second,
+	}
+}
+
+// isEmpty reports whether the collection has no points
+func (state *collectionState) isEmpty(ctx context.Context) (bool, error) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.nonEmpty || time.Since(state.checkedAt) < state.recheckInterval {
+		return !state.nonEmpty, nil
+	}
+
+	count, err := state.vectorRepo.CountPoints(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	state.nonEmpty = count > 0
+	state.checkedAt = time.Now()
+
+	return !state.nonEmpty, nil
+}
+
+// markNonEmpty records that points were upserted
+func (state *collectionState) markNonEmpty() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.nonEmpty = true
+}
@@ -0,0 +1,40 @@
+package service
+
+import "testing"
+
+func TestChatOnEmptyCollectionAsksForIngest(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	for range 3 {
+		resp := env.chat(t, "What type is Pikachu?")
+		if resp.Response != emptyKnowledgeBaseResponse {
+			t.Errorf("response = %q, want %q", resp.Response, emptyKnowledgeBaseResponse)
+		}
+	}
+
+	if got := len(env.ollama.GenerateRequests()); got != 0 {
+		t.Errorf("sent %d generate requests, want 0", got)
+	}
+	if got := env.qdrant.Calls("Query"); got != 0 {
+		t.Errorf("searched %d times, want 0", got)
+	}
+	// The emptiness check is cached between requests
+	if got := env.qdrant.Calls("Count"); got != 1 {
+		t.Errorf("counted points %d times, want 1", got)
+	}
+}
+
+func TestChatAnswersOnceDataIsIngested(t *testing.T) {
+	env := newTestEnv(t, nil)
+	if resp := env.chat(t, "What type is Pikachu?"); resp.Response != emptyKnowledgeBaseResponse {
+		t.Fatalf("response = %q, want the empty knowledge base message", resp.Response)
+	}
+
+	// Ingesting marks the collection non-empty without waiting for a recheck
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	if resp := env.chat(t, "What type is Pikachu?"); resp.Response == emptyKnowledgeBaseResponse {
+		t.Error("chat still reports an empty knowledge base after ingest")
+	}
+}
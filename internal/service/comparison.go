@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/katatrina/poke-bot/internal/model"
+	"github.com/katatrina/poke-bot/internal/pokename"
+)
+
+// statsSection is the content template section holding a Pokemon's base stats
+const statsSection = "Base Stats"
+
+// comparisonPattern matches wording that weighs Pokemon against each other
+// ("Pikachu vs Raichu", "which is faster, Jolteon or Crobat?")
+var comparisonPattern = regexp.MustCompile(`(?i)\b(compare|compared|comparison|vs|versus|difference between|better|worse|stronger|weaker|faster|slower|bulkier|tankier|higher|lower)\b`)
+
+// comparedPokemon returns the two Pokemon a stat comparison question names,
+// or nil when cfg.RAG.ComparisonIntent is off or the question isn't one
+func (s *RAGService) comparedPokemon(question string) []string {
+	if !s.config.RAG.ComparisonIntent || !comparisonPattern.MatchString(question) {
+		return nil
+	}
+
+	names := s.pokemonNames(question)
+	if len(names) < 2 {
+		return nil
+	}
+	return names[:2]
+}
+
+// pinStatChunks moves each compared Pokemon's Base Stats chunk to the front of
+// results, fetching it when the search didn't return it, and reports how many
+// were pinned. Pinned chunks are budgeted ahead of history and the rest of the
+// context, so truncation can't leave the answer with one side's stats only.
+func (s *RAGService) pinStatChunks(ctx context.Context, results []model.SearchResult, compared []string) ([]model.SearchResult, int) {
+	var pinned []model.SearchResult
+	for _, name := range compared {
+		i := slices.IndexFunc(results, func(result model.SearchResult) bool {
+			return isStatChunk(result, name)
+		})
+		if i >= 0 {
+			pinned = append(pinned, results[i])
+			results = slices.Delete(results, i, i+1)
+			continue
+		}
+
+		chunks, err := s.vectorRepo.PokemonChunks(ctx, name)
+		if err != nil {
+			log.Printf("Warning: failed to fetch %s's stats for a comparison: %v", name, err)
+			continue
+		}
+		if j := slices.IndexFunc(chunks, func(result model.SearchResult) bool {
+			return isStatChunk(result, name)
+		}); j >= 0 {
+			pinned = append(pinned, chunks[j])
+		} else {
+			log.Printf("No %s chunk stored for %s, comparing without it", statsSection, name)
+		}
+	}
+
+	if len(pinned) > 0 {
+		log.Printf("Comparison of %s: pinned %d stat chunks ahead of truncation", strings.Join(compared, " and "), len(pinned))
+	}
+	return append(pinned, results...), len(pinned)
+}
+
+// isStatChunk reports whether result is the named Pokemon's chunk covering
+// its base stats
+func isStatChunk(result model.SearchResult, name string) bool {
+	return pokename.Key(result.Metadata["pokemon"]) == pokename.Key(name) &&
+		slices.Contains(strings.Split(result.Metadata["sections"], ","), statsSection)
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+	"github.com/katatrina/poke-bot/internal/crawler"
+)
+
+// longStatPokemon is statPokemon with enough description to need several chunks
+func longStatPokemon(name, number string, stats ...int) *crawler.PokemonData {
+	p := statPokemon(name, number, stats...)
+	p.Description = strings.Repeat(name+" darts across the field in a blur. ", 12)
+	return p
+}
+
+func TestComparisonKeepsBothStatChunksUnderTightBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		intent   bool
+		question string
+		wantBoth bool
+	}{
+		{"comparison", true, "Is Jolteon faster than Alakazam?", true},
+		{"intent disabled", false, "Is Jolteon faster than Alakazam?", false},
+		{"not a comparison", true, "Tell me about Jolteon and Alakazam", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.RAG.ComparisonIntent = tt.intent
+				cfg.RAG.ChunkSize = 300
+				cfg.RAG.ChunkOverlap = 0
+				cfg.RAG.TopK = 3
+				cfg.RAG.MaxContextTokens = 400 // Room for about one chunk of context
+			})
+			env.source.add(
+				longStatPokemon("Jolteon", "0135", 65, 65, 60, 110, 95, 130),
+				longStatPokemon("Alakazam", "0065", 55, 50, 45, 135, 95, 120),
+			)
+			env.ingest(t, "Jolteon", "Alakazam")
+
+			resp := env.chat(t, tt.question)
+			prompt := env.lastPrompt(t)
+
+			both := strings.Contains(prompt, "Speed: 130") && strings.Contains(prompt, "Speed: 120")
+			if both != tt.wantBoth {
+				t.Errorf("both Pokemon's speed in prompt = %t, want %t:\n%s", both, tt.wantBoth, prompt)
+			}
+			if !tt.wantBoth {
+				return
+			}
+			// The stat chunks weren't in the top 3, so they were fetched and lead the context
+			chunks := resp.ContextChunks
+			if len(chunks) < 2 || chunks[0].Pokemon != "Jolteon" || chunks[1].Pokemon != "Alakazam" {
+				t.Errorf("context chunks = %+v, want Jolteon's then Alakazam's stats first", chunks)
+			}
+		})
+	}
+}
+
+func TestComparedPokemon(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.ComparisonIntent = true
+	})
+	env.source.add(pikachu, bulbasaur, charmander)
+	env.ingest(t, "Pikachu", "Bulbasaur", "Charmander")
+
+	tests := []struct {
+		question string
+		want     []string
+	}{
+		{"Pikachu vs Bulbasaur", []string{"Pikachu", "Bulbasaur"}},
+		{"Which is faster, charmander or Pikachu?", []string{"Charmander", "Pikachu"}},
+		{"Is Bulbasaur stronger than Charmander or Pikachu?", []string{"Bulbasaur", "Charmander"}},
+		{"Is Pikachu faster than Mew?", nil}, // Mew isn't ingested
+		{"Tell me about Pikachu and Bulbasaur", nil},
+	}
+	for _, tt := range tests {
+		if got := env.service.comparedPokemon(tt.question); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("comparedPokemon(%q) = %v, want %v", tt.question, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ErrDocumentLimitReached is returned when an ingest would grow the
+// collection past cfg.KB.MaxTotalDocuments
+var ErrDocumentLimitReached = errors.New("collection document limit reached")
+
+// documentLimitWarnRatio is the fill level from which each ingest logs a warning
+const documentLimitWarnRatio = 0.9
+
+// checkDocumentLimit rejects adding documents that would take the collection
+// past cfg.KB.MaxTotalDocuments (0 disables the cap). The count is exact, so
+// chunks later skipped as duplicates still count against the limit here.
+func (s *RAGService) checkDocumentLimit(ctx context.Context, adding int) error {
+	limit := s.config.KB.MaxTotalDocuments
+	if limit <= 0 {
+		return nil
+	}
+
+	count, err := s.vectorRepo.CountPointsExact(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	if int(count)+adding > limit {
+		return fmt.Errorf("%w: %d stored + %d new would exceed kb.max_total_documents=%d", ErrDocumentLimitReached, count, adding, limit)
+	}
+
+	return nil
+}
+
+// logDocumentLimit reports how full the collection is relative to
+// cfg.KB.MaxTotalDocuments, warning once it is nearly full
+func (s *RAGService) logDocumentLimit(ctx context.Context) {
+	limit := s.config.KB.MaxTotalDocuments
+	if limit <= 0 {
+		return
+	}
+
+	count, err := s.vectorRepo.CountPointsExact(ctx)
+	if err != nil {
+		log.Printf("Warning: failed to count documents: %v", err)
+		return
+	}
+
+	ratio := float64(count) / float64(limit)
+	if ratio >= documentLimitWarnRatio {
+		log.Printf("Warning: collection holds %d of %d allowed documents (%.0f%%)", count, limit, ratio*100)
+		return
+	}
+	log.Printf("Collection holds %d of %d allowed documents (%.0f%%)", count, limit, ratio*100)
+}
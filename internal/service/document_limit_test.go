@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestIngestStopsAtDocumentLimit(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.KB.MaxTotalDocuments = 2 // Each test Pokemon is a single chunk
+	})
+	env.source.add(bulbasaur, charmander, squirtle)
+	env.ingest(t, "Bulbasaur")
+	embedsBefore := len(env.ollama.EmbedRequests())
+
+	_, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   env.source.urls("Charmander", "Squirtle"),
+	})
+	if !errors.Is(err, ErrDocumentLimitReached) {
+		t.Fatalf("ingest error = %v, want %v", err, ErrDocumentLimitReached)
+	}
+
+	// Charmander fills the collection; Squirtle is refused before being embedded
+	if stored, want := env.storedPokemon(), []string{"Bulbasaur", "Charmander"}; !slices.Equal(stored, want) {
+		t.Errorf("stored = %v, want %v", stored, want)
+	}
+	for _, req := range env.ollama.EmbedRequests()[embedsBefore:] {
+		for _, input := range req.Input {
+			if strings.Contains(input, "Squirtle") {
+				t.Error("Squirtle was embedded despite the limit")
+			}
+		}
+	}
+}
+
+func TestDocumentLimitDisabledByDefault(t *testing.T) {
+	env := newTestEnv(t, nil)
+	if err := env.service.checkDocumentLimit(context.Background(), 1_000_000); err != nil {
+		t.Errorf("checkDocumentLimit = %v, want no cap without kb.max_total_documents", err)
+	}
+}
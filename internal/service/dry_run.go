@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/katatrina/poke-bot/internal/crawler"
+)
+
+// DryRunReport shows how the requested Pokemon would be chunked, without
+// embedding or storing anything
+type DryRunReport struct {
+	Pokemon     []DryRunPokemon `json:"pokemon"`
+	ChunkTokens ChunkTokenStats `json:"chunk_tokens"`
+	Warnings    []string        `json:"warnings,omitempty"` // Chunks outside [rag.min_chunk_tokens, rag.max_chunk_tokens]
+}
+
+type DryRunPokemon struct {
+	URL    string        `json:"url"`
+	Name   string        `json:"name,omitempty"`
+	Chunks []DryRunChunk `json:"chunks,omitempty"`
+	Error  string        `json:"error,omitempty"` // Set when the Pokemon couldn't be crawled or chunked
+}
+
+type DryRunChunk struct {
+	Text   string `json:"text"`
+	Tokens int    `json:"tokens"` // countTokens of the text as it would be embedded
+}
+
+// ChunkTokenStats summarizes the token counts of every chunk in a dry run
+type ChunkTokenStats struct {
+	Count int     `json:"count"`
+	Min   int     `json:"min"`
+	Max   int     `json:"max"`
+	Avg   float64 `json:"avg"`
+}
+
+// DryRunIngest crawls and chunks the Pokemon req selects like an ingest
+// would, reporting each chunk with its token count. Failures are reported per
+// Pokemon and don't stop the run.
+func (s *RAGService) DryRunIngest(ctx context.Context, req *IngestRequest) (*DryRunReport, error) {
+	pokemonURLs, _, err := s.resolvePokemonURLs(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	source := s.sources[req.Source]
+	minTokens, maxTokens := s.chunkTokenBounds()
+
+	report := &DryRunReport{Pokemon: make([]DryRunPokemon, 0, len(pokemonURLs))}
+	var counts []int
+	for _, url := range pokemonURLs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		entry := DryRunPokemon{URL: url}
+		pokemonData, chunks, err := s.preparePokemon(ctx, source, url)
+		if err != nil {
+			if errors.Is(err, errNotAllowlisted) || errors.Is(err, crawler.ErrDeniedURL) {
+				continue
+			}
+			entry.Error = err.Error()
+			report.Pokemon = append(report.Pokemon, entry)
+			continue
+		}
+
+		entry.Name = pokemonData.Name
+		for i, text := range s.prepareForEmbedding(chunks) {
+			tokens := countTokens(text)
+			counts = append(counts, tokens)
+			entry.Chunks = append(entry.Chunks, DryRunChunk{Text: text, Tokens: tokens})
+
+			if tokens < minTokens || tokens > maxTokens {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s chunk %d/%d has %d tokens (want %d-%d)",
+					pokemonData.Name, i+1, len(chunks), tokens, minTokens, maxTokens))
+			}
+		}
+		report.Pokemon = append(report.Pokemon, entry)
+	}
+
+	report.ChunkTokens = chunkTokenStats(counts)
+	log.Printf("Dry run chunked %d Pokemon into %d chunks (%d tokens avg), %d warnings",
+		len(report.Pokemon), report.ChunkTokens.Count, int(report.ChunkTokens.Avg), len(report.Warnings))
+
+	return report, nil
+}
+
+// chunkTokenBounds returns cfg.RAG.MinChunkTokens and cfg.RAG.MaxChunkTokens
+// with their defaults applied
+func (s *RAGService) chunkTokenBounds() (minTokens, maxTokens int) {
+	minTokens = s.config.RAG.MinChunkTokens
+	if minTokens <= 0 {
+		minTokens = 20 // Default fallback
+	}
+	maxTokens = s.config.RAG.MaxChunkTokens
+	if maxTokens <= 0 {
+		maxTokens = 512 // Default fallback
+	}
+	return minTokens, maxTokens
+}
+
+// chunkTokenStats computes the min, max and average of counts
+func chunkTokenStats(counts []int) ChunkTokenStats {
+	if len(counts) == 0 {
+		return ChunkTokenStats{}
+	}
+
+	stats := ChunkTokenStats{Count: len(counts), Min: counts[0], Max: counts[0]}
+	total := 0
+	for _, count := range counts {
+		stats.Min = min(stats.Min, count)
+		stats.Max = max(stats.Max, count)
+		total += count
+	}
+	stats.Avg = float64(total) / float64(len(counts))
+
+	return stats
+}
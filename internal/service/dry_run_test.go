@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestChunkTokenStats(t *testing.T) {
+	got := chunkTokenStats([]int{12, 142, 131})
+	want := ChunkTokenStats{Count: 3, Min: 12, Max: 142, Avg: 95}
+	if got != want {
+		t.Errorf("chunkTokenStats = %+v, want %+v", got, want)
+	}
+
+	if got := chunkTokenStats(nil); got != (ChunkTokenStats{}) {
+		t.Errorf("chunkTokenStats(nil) = %+v, want zero", got)
+	}
+}
+
+func TestDryRunReportsChunkTokens(t *testing.T) {
+	tests := []struct {
+		name         string
+		minTokens    int
+		wantWarnings int
+	}{
+		{"default bounds", 0, 2}, // One-sentence chunks are under the default 20 tokens
+		{"relaxed bounds", 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.Ingest.ContentTemplate = "{{.Description}}"
+				cfg.RAG.MinChunkTokens = tt.minTokens
+			})
+			env.source.add(bulbasaur, charmander)
+
+			report, err := env.service.DryRunIngest(context.Background(), &IngestRequest{
+				Source: pokemonDBSource,
+				URLs:   env.source.urls("Bulbasaur", "Charmander"),
+				DryRun: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Pokemon) != 2 {
+				t.Fatalf("reported %d Pokemon, want 2", len(report.Pokemon))
+			}
+			var counts []int
+			for _, pokemon := range report.Pokemon {
+				if len(pokemon.Chunks) != 1 {
+					t.Fatalf("%s has %d chunks, want 1", pokemon.Name, len(pokemon.Chunks))
+				}
+				chunk := pokemon.Chunks[0]
+				if chunk.Tokens != countTokens(chunk.Text) || chunk.Tokens == 0 {
+					t.Errorf("%s chunk has %d tokens, countTokens says %d", pokemon.Name, chunk.Tokens, countTokens(chunk.Text))
+				}
+				counts = append(counts, chunk.Tokens)
+			}
+
+			if want := chunkTokenStats(counts); report.ChunkTokens != want {
+				t.Errorf("chunk tokens = %+v, want %+v", report.ChunkTokens, want)
+			}
+			if len(report.Warnings) != tt.wantWarnings {
+				t.Errorf("warnings = %v, want %d", report.Warnings, tt.wantWarnings)
+			}
+
+			// Nothing is embedded or stored
+			if n := len(env.ollama.EmbedRequests()); n != 0 {
+				t.Errorf("sent %d embed requests", n)
+			}
+			if n := len(env.qdrant.Points("pokemons")); n != 0 {
+				t.Errorf("stored %d points", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// maxEmbedBatch caps the chunks sent in one embedding request by embedDocuments
+const maxEmbedBatch = 32
+
+// embedDocuments embeds document chunks, splitting them into contiguous
+// batches embedded by up to cfg.RAG.EmbedConcurrency concurrent requests.
+// Each batch writes only its own slots, so the result is in input order
+// however the requests finish. The first failure cancels the other batches.
+func (s *RAGService) embedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	concurrency := s.config.RAG.EmbedConcurrency
+	if concurrency <= 1 || len(texts) <= 1 {
+		return s.generateEmbeddings(ctx, texts, embedDocument)
+	}
+
+	// Spread the chunks evenly across workers, within the request size cap
+	batchSize := min((len(texts)+concurrency-1)/concurrency, maxEmbedBatch)
+	batchCount := (len(texts) + batchSize - 1) / batchSize
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	embeddings := make([][]float32, len(texts))
+
+	var (
+		wg       sync.WaitGroup
+		failOnce sync.Once
+		firstErr error
+	)
+	semaphore := make(chan struct{}, concurrency)
+
+	for b := 0; b < batchCount; b++ {
+		start := b * batchSize
+		end := min(start+batchSize, len(texts))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			if ctx.Err() != nil {
+				return // Another batch failed
+			}
+
+			batch, err := s.generateEmbeddings(ctx, texts[start:end], embedDocument)
+			if err != nil {
+				// Keep the failure that caused the cancellation, not the cancellations it caused
+				failOnce.Do(func() {
+					firstErr = fmt.Errorf("chunks %d-%d: %w", start, end-1, err)
+					cancel()
+				})
+				return
+			}
+			copy(embeddings[start:end], batch)
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return embeddings, nil
+}
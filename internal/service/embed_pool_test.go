@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/katatrina/poke-bot/internal/config"
+	"github.com/katatrina/poke-bot/internal/ollamatest"
+)
+
+// chunkTexts returns n distinct chunk texts
+func chunkTexts(n int) []string {
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("chunk %d about Pokemon number %d", i, i*7)
+	}
+	return texts
+}
+
+func TestEmbedDocumentsPreservesChunkOrder(t *testing.T) {
+	texts := chunkTexts(40)
+
+	serial := newTestEnv(t, nil)
+	want, err := serial.service.embedDocuments(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.EmbedConcurrency = 4
+	})
+	// Random delays make the batches finish out of order
+	env.ollama.SetEmbed(func(text string) []float32 {
+		time.Sleep(time.Duration(rand.IntN(3)) * time.Millisecond)
+		return ollamatest.Embedding(text, testDimension)
+	})
+
+	got, err := env.service.embedDocuments(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d embeddings, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !slices.Equal(got[i], want[i]) {
+			t.Errorf("embedding %d is out of place", i)
+		}
+	}
+
+	if requests := len(env.ollama.EmbedRequests()); requests != 4 {
+		t.Errorf("embed requests = %d, want one batch per worker", requests)
+	}
+}
+
+func TestEmbedDocumentsFailureReturnsNoPartialResult(t *testing.T) {
+	texts := chunkTexts(12)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.EmbedConcurrency = 3
+		cfg.Ollama.EmbeddingRetries = 0
+	})
+	env.ollama.SetEmbed(func(text string) []float32 {
+		embedding := ollamatest.Embedding(text, testDimension)
+		if strings.HasSuffix(text, texts[5]) {
+			return embedding[:testDimension/2]
+		}
+		return embedding
+	})
+
+	embeddings, err := env.service.embedDocuments(context.Background(), texts)
+	if err == nil {
+		t.Fatal("expected the malformed chunk to fail the batch")
+	}
+	if embeddings != nil {
+		t.Errorf("got %d embeddings alongside the error, want none", len(embeddings))
+	}
+	// Chunk 5 is in the second batch of four
+	if !strings.Contains(err.Error(), "chunks 4-7") {
+		t.Errorf("error = %v, want it to name the failing batch", err)
+	}
+}
+
+func BenchmarkEmbedDocuments(b *testing.B) {
+	texts := chunkTexts(64)
+
+	for _, concurrency := range []int{1, 4} {
+		b.Run(fmt.Sprintf("embed_concurrency=%d", concurrency), func(b *testing.B) {
+			env := newTestEnv(b, func(cfg *config.Config) {
+				cfg.RAG.EmbedConcurrency = concurrency
+			})
+			// Model latency dominates real embedding requests
+			env.ollama.SetEmbed(func(text string) []float32 {
+				time.Sleep(100 * time.Microsecond)
+				return ollamatest.Embedding(text, testDimension)
+			})
+
+			for b.Loop() {
+				if _, err := env.service.embedDocuments(context.Background(), texts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrEmbeddingModelNotAllowed is returned for a chat embedding_model that
+	// isn't listed in cfg.Ollama.AllowedEmbeddingModels
+	ErrEmbeddingModelNotAllowed = errors.New("embedding model override not allowed")
+
+	// ErrIncompatibleEmbeddingModel is returned when an embedding_model
+	// override produces vectors of a different size than the collection's
+	ErrIncompatibleEmbeddingModel = errors.New("embedding model incompatible with collection")
+)
+
+// validateEmbeddingModel checks a chat's embedding_model override against
+// cfg.Ollama.AllowedEmbeddingModels. The configured model is always allowed.
+func (s *RAGService) validateEmbeddingModel(model string) error {
+	if model == "" || model == s.config.Ollama.EmbeddingModel {
+		return nil
+	}
+	if !slices.Contains(s.config.Ollama.AllowedEmbeddingModels, model) {
+		return fmt.Errorf("%w: %s (allowed: %s)", ErrEmbeddingModelNotAllowed, model, strings.Join(s.config.Ollama.AllowedEmbeddingModels, ", "))
+	}
+	return nil
+}
+
+// embedQueries embeds chat queries with model, or with the configured model
+// when model is empty. An override is used as-is, without the retries of
+// generateEmbeddings: a vector of the wrong size means the model can't search
+// this collection, which retrying won't fix.
+func (s *RAGService) embedQueries(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	if model == "" || model == s.config.Ollama.EmbeddingModel {
+		return s.generateEmbeddings(ctx, texts, embedQuery)
+	}
+
+	embeddings, err := s.requestEmbeddings(ctx, model, s.applyEmbedPrefix(texts, embedQuery))
+	if err != nil {
+		return nil, fmt.Errorf("embedding with %s: %w", model, err)
+	}
+	if len(embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedding API returned %d embeddings for %d inputs with %s", len(embeddings), len(texts), model)
+	}
+
+	dimension := s.config.Ollama.Dimension()
+	for _, embedding := range embeddings {
+		if len(embedding) != dimension {
+			return nil, fmt.Errorf("%w: %s produces %d-dimensional vectors, the collection uses %d",
+				ErrIncompatibleEmbeddingModel, model, len(embedding), dimension)
+		}
+	}
+
+	return embeddings, nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestChatUsesAllowedEmbeddingModel(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Ollama.AllowedEmbeddingModels = []string{"alt-embed"}
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	resp, err := env.service.Chat(context.Background(), &ChatRequest{Message: "What type is Pikachu?", EmbeddingModel: "alt-embed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Sources) == 0 {
+		t.Error("expected the override to find Pikachu")
+	}
+
+	requests := env.ollama.EmbedRequests()
+	if last := requests[len(requests)-1]; last.Model != "alt-embed" {
+		t.Errorf("query embedded with %q, want alt-embed", last.Model)
+	}
+}
+
+func TestChatRejectsEmbeddingModelOverride(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Ollama.AllowedEmbeddingModels = []string{"alt-embed"}
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	t.Run("not allowed", func(t *testing.T) {
+		_, err := env.service.Chat(context.Background(), &ChatRequest{Message: "What type is Pikachu?", EmbeddingModel: "other-embed"})
+		if !errors.Is(err, ErrEmbeddingModelNotAllowed) {
+			t.Errorf("err = %v, want ErrEmbeddingModelNotAllowed", err)
+		}
+	})
+
+	t.Run("wrong dimension", func(t *testing.T) {
+		// The allowed model produces vectors the collection can't search
+		env.ollama.SetEmbed(func(string) []float32 { return make([]float32, testDimension/2) })
+
+		_, err := env.service.Chat(context.Background(), &ChatRequest{Message: "What type is Pikachu?", EmbeddingModel: "alt-embed"})
+		if !errors.Is(err, ErrIncompatibleEmbeddingModel) {
+			t.Errorf("err = %v, want ErrIncompatibleEmbeddingModel", err)
+		}
+	})
+}
+
+func TestConfiguredEmbeddingModelIsAlwaysAllowed(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	if err := env.service.validateEmbeddingModel("test-embed"); err != nil {
+		t.Errorf("configured model rejected: %v", err)
+	}
+	if err := env.service.validateEmbeddingModel("alt-embed"); !errors.Is(err, ErrEmbeddingModelNotAllowed) {
+		t.Errorf("err = %v, want ErrEmbeddingModelNotAllowed", err)
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/katatrina/poke-bot/internal/pokename"
+)
+
+// existingPokemon records which Pokemon of one source are already stored,
+// by name slug and national number
+type existingPokemon struct {
+	names   map[string]bool
+	numbers map[int]bool
+}
+
+// loadExistingPokemon reads the Pokemon already ingested from sourceName
+// straight from the collection, so a stale knowledge index can't cause a
+// Pokemon to be skipped or re-ingested by mistake. Only that source's points
+// and two payload fields are fetched, keeping the lookup cheap.
+func (s *RAGService) loadExistingPokemon(ctx context.Context, sourceName string) (*existingPokemon, error) {
+	metadata, err := s.vectorRepo.ScrollMetadataBySource(ctx, sourceName, "pokemon", "number")
+	if err != nil {
+		return nil, err
+	}
+
+	existing := &existingPokemon{
+		names:   make(map[string]bool),
+		numbers: make(map[int]bool),
+	}
+	for _, md := range metadata {
+		if name := strings.TrimSpace(md["pokemon"]); name != "" {
+			existing.names[pokename.Key(name)] = true
+		}
+		if number, err := strconv.Atoi(md["number"]); err == nil {
+			existing.numbers[number] = true
+		}
+	}
+
+	return existing, nil
+}
+
+// filterURLs drops detail URLs whose last path segment names a stored
+// Pokemon: a name slug for pokemondb, a number for PokeAPI
+func (existing *existingPokemon) filterURLs(pokemonURLs []string) (remaining []string, skipped int) {
+	for _, pokemonURL := range pokemonURLs {
+		if existing.hasURL(pokemonURL) {
+			skipped++
+			continue
+		}
+		remaining = append(remaining, pokemonURL)
+	}
+
+	return remaining, skipped
+}
+
+func (existing *existingPokemon) hasURL(pokemonURL string) bool {
+	u, err := url.Parse(pokemonURL)
+	if err != nil {
+		return false
+	}
+	segment := path.Base(u.Path)
+
+	if number, err := strconv.Atoi(segment); err == nil {
+		return existing.numbers[number]
+	}
+
+	return existing.names[pokename.Key(segment)]
+}
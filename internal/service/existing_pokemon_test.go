@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestSkipExistingLeavesStoredPokemonOut(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(bulbasaur, charmander, squirtle)
+	env.ingest(t, "Bulbasaur")
+	before := len(env.source.crawledURLs())
+
+	skipped, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source:       pokemonDBSource,
+		CrawlLimit:   10,
+		SkipExisting: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if skipped != 1 {
+		t.Errorf("skipped = %d, want Bulbasaur only", skipped)
+	}
+	if got, want := env.source.crawledURLs()[before:], env.source.urls("Charmander", "Squirtle"); !slices.Equal(got, want) {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+}
+
+func TestSkipExistingOnlyCountsTheSameSource(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(bulbasaur)
+	env.ingest(t, "Bulbasaur")
+
+	existing, err := env.service.loadExistingPokemon(context.Background(), pokeAPISource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existing.hasURL(pokemonURL("Bulbasaur")) {
+		t.Error("a Pokemon stored from pokemondb counts as existing for PokeAPI")
+	}
+
+	existing, err = env.service.loadExistingPokemon(context.Background(), pokemonDBSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// PokeAPI-style URLs end in the national number rather than a name
+	for _, u := range []string{pokemonURL("Bulbasaur"), "https://pokeapi.co/api/v2/pokemon/1/"} {
+		if !existing.hasURL(u) {
+			t.Errorf("%s is not recognized as stored", u)
+		}
+	}
+	if existing.hasURL(pokemonURL("Charmander")) {
+		t.Error("Charmander counts as stored")
+	}
+}
+
+func TestDedupCrawlListDropsStoredPokemonBeforeLimit(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Ingest.DedupCrawlList = true
+	})
+	env.source.add(bulbasaur, charmander, squirtle)
+	env.ingest(t, "Bulbasaur")
+	before := len(env.source.crawledURLs())
+
+	// crawl_limit counts only Pokemon that aren't stored yet
+	skipped, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source:     pokemonDBSource,
+		CrawlLimit: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if skipped != 1 {
+		t.Errorf("skipped = %d, want Bulbasaur only", skipped)
+	}
+	if got, want := env.source.crawledURLs()[before:], env.source.urls("Charmander"); !slices.Equal(got, want) {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+}
+
+func TestDedupCrawlListCrawlsNothingWhenAllStored(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Ingest.DedupCrawlList = true
+	})
+	env.source.add(bulbasaur, charmander)
+	env.ingest(t, "Bulbasaur", "Charmander")
+	before := len(env.source.crawledURLs())
+
+	skipped, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source:     pokemonDBSource,
+		CrawlLimit: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if skipped != 2 {
+		t.Errorf("skipped = %d, want 2", skipped)
+	}
+	if crawled := env.source.crawledURLs()[before:]; len(crawled) != 0 {
+		t.Errorf("crawled %v, want no detail pages visited", crawled)
+	}
+}
+
+func TestExistingPokemonLookupFiltersBySource(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(bulbasaur)
+	env.ingest(t, "Bulbasaur")
+
+	if _, err := env.service.loadExistingPokemon(context.Background(), pokemonDBSource); err != nil {
+		t.Fatal(err)
+	}
+
+	scrolls := env.qdrant.Scrolls()
+	filter := scrolls[len(scrolls)-1].GetFilter()
+	if got := filter.GetMust()[0].GetField(); got.GetKey() != "source" || got.GetMatch().GetKeyword() != pokemonDBSource {
+		t.Errorf("scroll filter = %v, want a match on source", filter)
+	}
+}
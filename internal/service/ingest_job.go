@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	IngestJobRunning   = "running"
+	IngestJobCompleted = "completed"
+	IngestJobFailed    = "failed"
+)
+
+type IngestJob struct {
+	ID         string         `json:"job_id"`
+	Status     string         `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	Skipped    int            `json:"skipped_existing,omitempty"` // Pokemon left out by skip_existing
+	Progress   *ProgressEvent `json:"progress,omitempty"`         // Latest per-Pokemon event, seen by retries while running
+}
+
+// ErrTooManyIngestJobs is returned when the concurrent ingest job limit is reached
+var ErrTooManyIngestJobs = errors.New("too many ingest jobs running")
+
+// ingestJobStore tracks running ingest jobs, enforcing the concurrency limit,
+// and dedups requests by Idempotency-Key. Running and completed keyed jobs are
+// remembered; failed ones are forgotten so the client can retry.
+type ingestJobStore struct {
+	mu         sync.Mutex
+	jobs       map[string]*IngestJob // Keyed by Idempotency-Key
+	running    map[string]*IngestJob // Keyed by job ID
+	ttl        time.Duration
+	maxRunning int
+}
+
+func newIngestJobStore(ttl time.Duration, maxRunning int) *ingestJobStore {
+	if ttl <= 0 {
+		ttl = time.Hour // Default fallback
+	}
+	if maxRunning <= 0 {
+		maxRunning = 1 // Default fallback
+	}
+
+	return &ingestJobStore{
+		jobs:       make(map[string]*IngestJob),
+		running:    make(map[string]*IngestJob),
+		ttl:        ttl,
+		maxRunning: maxRunning,
+	}
+}
+
+// begin registers a new running job. If key matches a remembered job, a copy
+// of it is returned with existing=true. If the concurrency limit is reached,
+// a copy of one of the running jobs is returned with ErrTooManyIngestJobs.
+func (store *ingestJobStore) begin(key string) (job IngestJob, existing bool, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.purgeExpired()
+
+	if job, ok := store.jobs[key]; ok && key != "" {
+		return *job, true, nil
+	}
+
+	if len(store.running) >= store.maxRunning {
+		for _, runningJob := range store.running {
+			return *runningJob, false, ErrTooManyIngestJobs
+		}
+	}
+
+	jobID, _ := uuid.NewV7()
+	newJob := &IngestJob{
+		ID:        jobID.String(),
+		Status:    IngestJobRunning,
+		StartedAt: time.Now(),
+	}
+	store.running[newJob.ID] = newJob
+	if key != "" {
+		store.jobs[key] = newJob
+	}
+
+	return *newJob, false, nil
+}
+
+// progress records the latest event of a running job
+func (store *ingestJobStore) progress(jobID string, event ProgressEvent) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if job, ok := store.running[jobID]; ok {
+		job.Progress = &event
+	}
+}
+
+func (store *ingestJobStore) finish(key, jobID string, skipped int, err error) IngestJob {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	job := store.running[jobID]
+	delete(store.running, jobID)
+
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Skipped = skipped
+
+	if err != nil {
+		job.Status = IngestJobFailed
+		job.Error = err.Error()
+		delete(store.jobs, key)
+	} else {
+		job.Status = IngestJobCompleted
+	}
+
+	return *job
+}
+
+// purgeExpired drops finished jobs older than the TTL. Caller must hold mu.
+func (store *ingestJobStore) purgeExpired() {
+	for key, job := range store.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > store.ttl {
+			delete(store.jobs, key)
+		}
+	}
+}
+
+// RunIngestJob runs an ingest as a job. When idempotencyKey matches an
+// in-flight or recently completed job, that job is returned with existing=true
+// instead of starting another crawl. The job isn't cancelled with ctx. When
+// cfg.KB.MaxConcurrentJobs are already running, a running job is returned
+// with ErrTooManyIngestJobs.
+func (s *RAGService) RunIngestJob(ctx context.Context, idempotencyKey string, req *IngestRequest) (job IngestJob, existing bool, err error) {
+	job, existing, err = s.ingestJobs.begin(idempotencyKey)
+	if existing || err != nil {
+		return job, existing, err
+	}
+
+	// Keep the job's progress current, still passing events on to the caller's callback
+	callerProgress := req.Progress
+	req.Progress = func(event ProgressEvent) {
+		s.ingestJobs.progress(job.ID, event)
+		if callerProgress != nil {
+			callerProgress(event)
+		}
+	}
+
+	// A client that times out and retries with the same key must find the job
+	// still running, so it outlives the request; shutdown and the job timeout
+	// still stop it
+	skipped, err := s.IngestPokemonData(context.WithoutCancel(ctx), req)
+	job = s.ingestJobs.finish(idempotencyKey, job.ID, skipped, err)
+	s.stats.recordIngest(err)
+
+	return job, false, err
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestIdempotencyKeyReturnsExistingJob(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+
+	// Hold the first job mid-crawl so the retry arrives while it is in flight
+	release := make(chan struct{})
+	crawling := make(chan struct{}, 1)
+	env.source.detail = func(ctx context.Context, _ string) error {
+		select {
+		case crawling <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	}
+
+	type result struct {
+		job IngestJob
+		err error
+	}
+	first := make(chan result, 1)
+	go func() {
+		job, _, err := env.service.RunIngestJob(context.Background(), "retry-1", &IngestRequest{
+			Source: pokemonDBSource,
+			URLs:   env.source.urls("Pikachu"),
+		})
+		first <- result{job, err}
+	}()
+	<-crawling
+
+	inFlight, existing, err := env.service.RunIngestJob(context.Background(), "retry-1", &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   env.source.urls("Pikachu"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !existing || inFlight.Status != IngestJobRunning {
+		t.Errorf("in-flight retry: existing = %v, status = %q", existing, inFlight.Status)
+	}
+
+	close(release)
+	done := <-first
+	if done.err != nil {
+		t.Fatal(done.err)
+	}
+	if inFlight.ID != done.job.ID {
+		t.Errorf("in-flight retry got job %s, want %s", inFlight.ID, done.job.ID)
+	}
+
+	completed, existing, err := env.service.RunIngestJob(context.Background(), "retry-1", &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   env.source.urls("Pikachu"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !existing || completed.ID != done.job.ID || completed.Status != IngestJobCompleted {
+		t.Errorf("completed retry: existing = %v, job %s (%s), want job %s completed", existing, completed.ID, completed.Status, done.job.ID)
+	}
+	if crawls := len(env.source.crawledURLs()); crawls != 1 {
+		t.Errorf("Pikachu was crawled %d times, want 1", crawls)
+	}
+}
+
+func TestKeyedJobSurvivesDisconnectedCaller(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu, charmander)
+
+	// The first caller disconnects while Pikachu is being crawled
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	env.source.detail = func(_ context.Context, url string) error {
+		if url == pokemonURL("Pikachu") {
+			cancel()
+			<-release
+		}
+		return nil
+	}
+
+	first := make(chan error, 1)
+	go func() {
+		_, _, err := env.service.RunIngestJob(ctx, "retry-1", &IngestRequest{
+			Source: pokemonDBSource,
+			URLs:   env.source.urls("Pikachu", "Charmander"),
+		})
+		first <- err
+	}()
+	<-ctx.Done()
+
+	retry, existing, err := env.service.RunIngestJob(context.Background(), "retry-1", &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   env.source.urls("Pikachu", "Charmander"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !existing || retry.Status != IngestJobRunning {
+		t.Errorf("retry: existing = %v, status = %q, want the first caller's job still running", existing, retry.Status)
+	}
+
+	close(release)
+	if err := <-first; err != nil {
+		t.Fatalf("job stopped with its caller: %v", err)
+	}
+	again, existing, err := env.service.RunIngestJob(context.Background(), "retry-1", &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   env.source.urls("Pikachu", "Charmander"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !existing || again.ID != retry.ID || again.Status != IngestJobCompleted {
+		t.Errorf("later retry: existing = %v, job %s (%s), want job %s completed", existing, again.ID, again.Status, retry.ID)
+	}
+	if got := env.source.crawledURLs(); len(got) != 2 {
+		t.Errorf("crawled %v, want both Pokemon crawled once", got)
+	}
+}
+
+func TestIngestWithoutIdempotencyKeyStartsNewJob(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+
+	req := func() *IngestRequest {
+		return &IngestRequest{Source: pokemonDBSource, URLs: env.source.urls("Pikachu")}
+	}
+	first, _, err := env.service.RunIngestJob(context.Background(), "", req())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, existing, err := env.service.RunIngestJob(context.Background(), "", req())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existing || first.ID == second.ID {
+		t.Errorf("unkeyed requests shared job %s (existing = %v)", first.ID, existing)
+	}
+}
+
+func TestIngestJobsBeyondLimitAreRejected(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.KB.MaxConcurrentJobs = 2
+	})
+	env.source.add(bulbasaur, charmander, squirtle)
+
+	// Hold every crawl until the test has tried to start the excess job
+	release := make(chan struct{})
+	crawling := make(chan struct{}, 3)
+	env.source.detail = func(context.Context, string) error {
+		crawling <- struct{}{}
+		<-release
+		return nil
+	}
+
+	running := make(chan IngestJob, 2)
+	for _, name := range []string{"Bulbasaur", "Charmander"} {
+		go func() {
+			job, _, err := env.service.RunIngestJob(context.Background(), "", &IngestRequest{
+				Source: pokemonDBSource,
+				URLs:   env.source.urls(name),
+			})
+			if err != nil {
+				t.Errorf("ingest of %s: %v", name, err)
+			}
+			running <- job
+		}()
+	}
+	<-crawling
+	<-crawling
+
+	rejected, _, err := env.service.RunIngestJob(context.Background(), "", &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   env.source.urls("Squirtle"),
+	})
+	if !errors.Is(err, ErrTooManyIngestJobs) {
+		t.Fatalf("third job error = %v, want ErrTooManyIngestJobs", err)
+	}
+	if rejected.Status != IngestJobRunning || rejected.ID == "" {
+		t.Errorf("rejected job points at %+v, want a running job", rejected)
+	}
+
+	close(release)
+	ids := []string{(<-running).ID, (<-running).ID}
+	if !slices.Contains(ids, rejected.ID) {
+		t.Errorf("rejection named job %s, want one of the running jobs %v", rejected.ID, ids)
+	}
+	if slices.Contains(env.source.crawledURLs(), pokemonURL("Squirtle")) {
+		t.Error("the rejected job crawled anyway")
+	}
+
+	// Once they finish, a new job is accepted
+	if _, _, err := env.service.RunIngestJob(context.Background(), "", &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   env.source.urls("Squirtle"),
+	}); err != nil {
+		t.Errorf("job after the others finished: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestChatFallsBackToKeywordSearch(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.KeywordFallback = true
+	})
+	env.source.add(pikachu, bulbasaur)
+	env.ingest(t, "Pikachu", "Bulbasaur")
+
+	env.ollama.SetStatus("/api/embed", http.StatusInternalServerError)
+	resp := env.chat(t, "What type is Pikachu?")
+
+	if !resp.Degraded {
+		t.Error("degraded = false, want the keyword fallback flagged")
+	}
+	// Bulbasaur's chunk only mentions "type", so it ranks below Pikachu's
+	chunks := resp.ContextChunks
+	if len(chunks) != 2 || chunks[0].Pokemon != "Pikachu" || chunks[0].Score != 1 || chunks[1].Score != 0.5 {
+		t.Errorf("context chunks = %+v, want Pikachu's chunk ranked first by keyword", chunks)
+	}
+	if len(env.ollama.GenerateRequests()) != 1 {
+		t.Error("no answer was generated from the keyword context")
+	}
+}
+
+func TestChatFailsWithoutKeywordFallback(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	env.ollama.SetStatus("/api/embed", http.StatusInternalServerError)
+	if _, err := env.service.Chat(context.Background(), &ChatRequest{Message: "What type is Pikachu?"}); err == nil {
+		t.Fatal("chat succeeded without an embedding or a keyword fallback")
+	}
+	if len(env.ollama.GenerateRequests()) != 0 {
+		t.Error("an answer was generated without any context")
+	}
+}
+
+func TestQueryKeywordsDropStopwords(t *testing.T) {
+	got := queryKeywords("What type is Pikachu?")
+	if len(got) != 2 || got[0] != "type" || got[1] != "pikachu" {
+		t.Errorf("keywords = %q, want [type pikachu]", got)
+	}
+}
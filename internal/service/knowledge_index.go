@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/katatrina/poke-bot/internal/pokename"
+	"github.com/katatrina/poke-bot/internal/repository"
+)
+
+// PokemonEntry is what the knowledge index holds for one Pokemon
+type PokemonEntry struct {
+	Name   string   `json:"name"`
+	Number string   `json:"number"`
+	Types  []string `json:"types"`
+}
+
+// KnowledgeIndex is an in-memory cache of the Pokemon names, numbers and types
+// stored in the collection, so resolving the Pokemon a question names
+// (pokemonNames) and same-type neighbors don't need to query Qdrant
+type KnowledgeIndex struct {
+	vectorRepo *repository.VectorRepository
+	ttl        time.Duration // Zero disables automatic refresh
+
+	mu          sync.RWMutex
+	pokemon     map[string]PokemonEntry // Keyed by pokename.Key
+	refreshedAt time.Time
+
+	refreshing atomic.Bool
+}
+
+func NewKnowledgeIndex(vectorRepo *repository.VectorRepository, ttl time.Duration) *KnowledgeIndex {
+	return &KnowledgeIndex{
+		vectorRepo: vectorRepo,
+		ttl:        ttl,
+		pokemon:    make(map[string]PokemonEntry),
+	}
+}
+
+// Refresh rebuilds the index from the collection and swaps it in atomically
+func (idx *KnowledgeIndex) Refresh(ctx context.Context) error {
+	metadata, err := idx.vectorRepo.ScrollMetadata(ctx, "pokemon", "number", "types")
+	if err != nil {
+		return err
+	}
+
+	pokemon := make(map[string]PokemonEntry)
+	for _, md := range metadata {
+		addEntry(pokemon, md)
+	}
+
+	idx.mu.Lock()
+	idx.pokemon = pokemon
+	idx.refreshedAt = time.Now()
+	idx.mu.Unlock()
+
+	log.Printf("Knowledge index refreshed: %d Pokemon", len(pokemon))
+	return nil
+}
+
+// Add records a single document's metadata, used to keep the index current on upsert
+func (idx *KnowledgeIndex) Add(metadata map[string]string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	addEntry(idx.pokemon, metadata)
+}
+
+// Lookup returns the entry for a Pokemon name, compared by pokename.Key
+func (idx *KnowledgeIndex) Lookup(name string) (PokemonEntry, bool) {
+	idx.maybeRefresh()
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	entry, ok := idx.pokemon[pokename.Key(name)]
+	return entry, ok
+}
+
+// SameTypeNeighbors returns up to limit other Pokemon sharing name's primary type, sorted by name
+func (idx *KnowledgeIndex) SameTypeNeighbors(name string, limit int) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	entry, ok := idx.pokemon[pokename.Key(name)]
+	if !ok || len(entry.Types) == 0 || limit <= 0 {
+		return nil
+	}
+	primaryType := entry.Types[0]
+
+	var neighbors []string
+	for key, other := range idx.pokemon {
+		if key == pokename.Key(entry.Name) || len(other.Types) == 0 {
+			continue
+		}
+		if strings.EqualFold(other.Types[0], primaryType) {
+			neighbors = append(neighbors, other.Name)
+		}
+	}
+	sort.Strings(neighbors)
+
+	if len(neighbors) > limit {
+		neighbors = neighbors[:limit]
+	}
+
+	return neighbors
+}
+
+// maybeRefresh triggers a background refresh once the TTL has elapsed.
+// Readers never block on Qdrant; they keep seeing the previous snapshot.
+func (idx *KnowledgeIndex) maybeRefresh() {
+	if idx.ttl <= 0 {
+		return
+	}
+
+	idx.mu.RLock()
+	stale := time.Since(idx.refreshedAt) > idx.ttl
+	idx.mu.RUnlock()
+
+	if !stale || !idx.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer idx.refreshing.Store(false)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := idx.Refresh(ctx); err != nil {
+			log.Printf("Warning: failed to refresh knowledge index: %v", err)
+		}
+	}()
+}
+
+func addEntry(pokemon map[string]PokemonEntry, metadata map[string]string) {
+	name := pokename.Display(metadata["pokemon"])
+	if name == "" {
+		return
+	}
+
+	var pokemonTypes []string
+	for _, t := range strings.Split(metadata["types"], ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		pokemonTypes = append(pokemonTypes, t)
+	}
+
+	pokemon[pokename.Key(name)] = PokemonEntry{
+		Name:   name,
+		Number: metadata["number"],
+		Types:  pokemonTypes,
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestKnowledgeIndexConcurrentReadsDuringRefresh(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(bulbasaur, charmander, squirtle)
+	env.ingest(t, "Bulbasaur", "Charmander")
+
+	idx := env.service.knowledgeIndex
+	if _, ok := idx.Lookup("Squirtle"); ok {
+		t.Fatal("Squirtle indexed before it was ingested")
+	}
+
+	// Store Squirtle behind the index's back so refreshes alternate snapshots
+	env.ingest(t, "Squirtle")
+	idx.Refresh(context.Background())
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	errs := make(chan string, 100)
+
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				// Name resolution reads the index the way chats do
+				names := env.service.pokemonNames("Is Squirtle faster than bulbasaur or Charmander?")
+				if !slices.Equal(names, []string{"Squirtle", "Bulbasaur", "Charmander"}) {
+					errs <- "inconsistent names snapshot"
+					return
+				}
+				if entry, ok := idx.Lookup("squirtle"); !ok || entry.Types[0] != "Water" {
+					errs <- "Squirtle missing mid-refresh"
+					return
+				}
+				runtime.Gosched() // Let the refresh's gRPC calls run on small machines
+			}
+		}()
+	}
+
+	for range 20 {
+		if err := idx.Refresh(context.Background()); err != nil {
+			t.Errorf("refresh failed: %v", err)
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+
+	for msg := range errs {
+		t.Error(msg)
+	}
+}
+
+func TestKnowledgeIndexUpdatedOnIngest(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	entry, ok := env.service.knowledgeIndex.Lookup("PIKACHU")
+	if !ok {
+		t.Fatal("Pikachu not indexed after ingest")
+	}
+	if entry.Number != "0025" || len(entry.Types) != 1 || entry.Types[0] != "Electric" {
+		t.Errorf("entry = %+v, want number 0025 and type Electric", entry)
+	}
+}
+
+func TestIngestNormalizesPokemonNames(t *testing.T) {
+	env := newTestEnv(t, nil)
+	// Registered under the clean URL, but the page carries a mark and odd spacing
+	messy := testPokemon("Mr. Mime", "0122", "Psychic", "Fairy")
+	env.source.add(messy)
+	messy.Name = "Mr.  Mime™"
+	env.ingest(t, "Mr. Mime")
+
+	points := env.qdrant.Points("pokemons")
+	if len(points) == 0 {
+		t.Fatal("nothing was stored")
+	}
+	for _, p := range points {
+		payload := p.GetPayload()
+		if got := payload["pokemon"].GetStringValue(); got != "Mr. Mime" {
+			t.Errorf("pokemon = %q, want the display name %q", got, "Mr. Mime")
+		}
+		if got := payload["pokemon_key"].GetStringValue(); got != "mr-mime" {
+			t.Errorf("pokemon_key = %q, want %q", got, "mr-mime")
+		}
+	}
+
+	// Any spelling of the name finds the same entry
+	for _, name := range []string{"mr-mime", "MR. MIME", "Mr. Mime®"} {
+		entry, ok := env.service.knowledgeIndex.Lookup(name)
+		if !ok || entry.Name != "Mr. Mime" {
+			t.Errorf("Lookup(%q) = %+v, %v, want Mr. Mime", name, entry, ok)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/katatrina/poke-bot/internal/model"
+)
+
+// maxImageBytes bounds a single downloaded artwork, so a bad URL can't bloat
+// the generate request
+const maxImageBytes = 5 << 20
+
+// visionSupport caches whether the chat model accepts images. Failed lookups
+// aren't cached, so a transient Ollama error doesn't disable images for good.
+type visionSupport struct {
+	mu        sync.Mutex
+	checked   bool
+	supported bool
+}
+
+type ollamaShowResponse struct {
+	Capabilities []string `json:"capabilities"`
+}
+
+// chatModelSupportsImages asks Ollama's /api/show whether the chat model lists
+// the "vision" capability
+func (s *RAGService) chatModelSupportsImages(ctx context.Context) bool {
+	s.vision.mu.Lock()
+	defer s.vision.mu.Unlock()
+
+	if s.vision.checked {
+		return s.vision.supported
+	}
+
+	var show ollamaShowResponse
+	resp, err := s.restClient.R().
+		SetContext(ctx).
+		SetBody(map[string]string{"model": s.config.Ollama.ChatModel}).
+		SetResult(&show).
+		Post(s.config.Ollama.BaseURL + "/api/show")
+	if err != nil || resp.StatusCode() != 200 {
+		log.Printf("Warning: failed to check %s for vision support, sending text only: %v", s.config.Ollama.ChatModel, err)
+		return false
+	}
+
+	s.vision.checked = true
+	s.vision.supported = slices.Contains(show.Capabilities, "vision")
+	if !s.vision.supported {
+		log.Printf("rag.multimodal is on but %s doesn't support images, sending text only", s.config.Ollama.ChatModel)
+	}
+	return s.vision.supported
+}
+
+// contextImages returns the base64-encoded artwork of the distinct Pokemon in
+// results, best ranked first, for Ollama's images field. It returns nil unless
+// cfg.RAG.Multimodal is on and the chat model supports images. Artwork that
+// fails to download is skipped.
+func (s *RAGService) contextImages(ctx context.Context, results []model.SearchResult) []string {
+	if !s.config.RAG.Multimodal || !s.chatModelSupportsImages(ctx) {
+		return nil
+	}
+
+	maxImages := s.config.RAG.MaxImages
+	if maxImages <= 0 {
+		maxImages = 2 // Default fallback
+	}
+
+	var images []string
+	seen := make(map[string]bool)
+	for _, result := range results {
+		url := result.Metadata["image_url"]
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+
+		image, err := s.fetchImage(ctx, url)
+		if err != nil {
+			log.Printf("Warning: skipping artwork for %s: %v", result.Metadata["pokemon"], err)
+			continue
+		}
+		images = append(images, image)
+		if len(images) == maxImages {
+			break
+		}
+	}
+
+	return images
+}
+
+// fetchImage downloads url and returns it base64-encoded
+func (s *RAGService) fetchImage(ctx context.Context, url string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	resp, err := s.restClient.R().
+		SetContext(ctx).
+		Get(url)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode() != 200 {
+		return "", fmt.Errorf("image returned status %d", resp.StatusCode())
+	}
+	if contentType := resp.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "image/") {
+		return "", fmt.Errorf("unexpected content type %q", contentType)
+	}
+
+	body := resp.Bytes()
+	if len(body) > maxImageBytes {
+		return "", fmt.Errorf("image is %d bytes, over the %d byte limit", len(body), maxImageBytes)
+	}
+
+	return base64.StdEncoding.EncodeToString(body), nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+// serveArtwork serves fake PNG artwork, counting downloads
+func serveArtwork(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		if r.URL.Path == "/missing.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png:" + r.URL.Path))
+	}))
+	t.Cleanup(server.Close)
+	return server, &downloads
+}
+
+func TestChatAttachesArtworkForVisionModels(t *testing.T) {
+	artwork, _ := serveArtwork(t)
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.Multimodal = true
+		cfg.RAG.MaxImages = 1
+	})
+	env.ollama.SetCapabilities("completion", "vision")
+
+	withArt := *pikachu
+	withArt.ImageURL = artwork.URL + "/pikachu.png"
+	env.source.add(&withArt)
+	env.ingest(t, "Pikachu")
+
+	env.chat(t, "What type is Pikachu?")
+
+	requests := env.ollama.GenerateRequests()
+	want := []string{base64.StdEncoding.EncodeToString([]byte("png:/pikachu.png"))}
+	if got := requests[len(requests)-1].Images; !slices.Equal(got, want) {
+		t.Errorf("images = %v, want %v", got, want)
+	}
+}
+
+func TestChatSendsTextOnlyWithoutMultimodal(t *testing.T) {
+	tests := []struct {
+		name         string
+		multimodal   bool
+		capabilities []string
+		imagePath    string
+	}{
+		{"disabled", false, []string{"completion", "vision"}, "/pikachu.png"},
+		{"text model", true, []string{"completion"}, "/pikachu.png"},
+		{"artwork fails to download", true, []string{"completion", "vision"}, "/missing.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			artwork, downloads := serveArtwork(t)
+
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.RAG.Multimodal = tt.multimodal
+			})
+			env.ollama.SetCapabilities(tt.capabilities...)
+
+			withArt := *pikachu
+			withArt.ImageURL = artwork.URL + tt.imagePath
+			env.source.add(&withArt)
+			env.ingest(t, "Pikachu")
+
+			env.chat(t, "What type is Pikachu?")
+
+			requests := env.ollama.GenerateRequests()
+			if got := requests[len(requests)-1].Images; len(got) != 0 {
+				t.Errorf("images = %v, want none", got)
+			}
+			if wantDownloads := tt.imagePath == "/missing.png"; (downloads.Load() > 0) != wantDownloads {
+				t.Errorf("artwork downloaded %d times", downloads.Load())
+			}
+		})
+	}
+}
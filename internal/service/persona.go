@@ -0,0 +1,68 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+const defaultPersonaName = "default"
+
+// ErrUnknownPersona is returned when a chat request names a persona that isn't configured
+var ErrUnknownPersona = errors.New("unknown persona")
+
+// persona controls the system prompt, an extra instruction and the sampling
+// temperature used to answer a chat request
+type persona struct {
+	name         string
+	systemPrompt string
+	instruction  string
+	temperature  float64
+}
+
+// builtinPersona is used when no personas are configured
+var builtinPersona = persona{
+	name:         defaultPersonaName,
+	systemPrompt: "You are a helpful Pokemon expert assistant. Answer questions based on the provided context about Pokemon.",
+	temperature:  0.3, // Lower temperature for factual responses
+}
+
+// resolvePersona returns the persona named by the request, or the configured
+// default (cfg.RAG.DefaultPersona) when name is empty
+func (s *RAGService) resolvePersona(name string) (persona, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = s.config.RAG.DefaultPersona
+	}
+	if name == "" || (name == defaultPersonaName && len(s.config.Personas) == 0) {
+		return builtinPersona, nil
+	}
+
+	personaCfg, ok := s.config.Personas[name]
+	if !ok {
+		return persona{}, fmt.Errorf("%w: %s", ErrUnknownPersona, name)
+	}
+
+	return newPersona(name, personaCfg), nil
+}
+
+// newPersona fills unset persona fields from the built-in persona
+func newPersona(name string, cfg config.PersonaConfig) persona {
+	p := persona{
+		name:         name,
+		systemPrompt: strings.TrimSpace(cfg.SystemPrompt),
+		instruction:  strings.TrimSpace(cfg.Instruction),
+		temperature:  cfg.Temperature,
+	}
+
+	if p.systemPrompt == "" {
+		p.systemPrompt = builtinPersona.systemPrompt
+	}
+	if p.temperature <= 0 {
+		p.temperature = builtinPersona.temperature // Default fallback
+	}
+
+	return p
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func newPersonaTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Personas = map[string]config.PersonaConfig{
+			"casual": {
+				SystemPrompt: "You are a friendly Pokemon fan chatting with another fan.",
+				Instruction:  "Mention fun facts from the Pokedex description",
+				Temperature:  0.8,
+			},
+			"competitive": {
+				SystemPrompt: "You are a competitive Pokemon battle analyst.",
+				Instruction:  "Focus on base stats, abilities and type matchups",
+			},
+		}
+		cfg.RAG.DefaultPersona = "casual"
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+	return env
+}
+
+// chatAs sends question as the named persona and returns the generate request
+func (env *testEnv) chatAs(t *testing.T, personaName, question string) (prompt string, temperature any) {
+	t.Helper()
+
+	if _, err := env.service.Chat(context.Background(), &ChatRequest{Message: question, Persona: personaName}); err != nil {
+		t.Fatalf("chat as %q failed: %v", personaName, err)
+	}
+	requests := env.ollama.GenerateRequests()
+	last := requests[len(requests)-1]
+	return last.Prompt, last.Options["temperature"]
+}
+
+func TestPersonasProduceDifferentPrompts(t *testing.T) {
+	env := newPersonaTestEnv(t)
+
+	casualPrompt, casualTemperature := env.chatAs(t, "casual", "Tell me about Pikachu")
+	competitivePrompt, competitiveTemperature := env.chatAs(t, "competitive", "Tell me about Pikachu")
+
+	if !strings.HasPrefix(casualPrompt, "You are a friendly Pokemon fan") ||
+		!strings.Contains(casualPrompt, "- Mention fun facts from the Pokedex description\n") {
+		t.Errorf("casual prompt lacks its persona:\n%s", casualPrompt)
+	}
+	if !strings.HasPrefix(competitivePrompt, "You are a competitive Pokemon battle analyst.") ||
+		!strings.Contains(competitivePrompt, "- Focus on base stats, abilities and type matchups\n") {
+		t.Errorf("competitive prompt lacks its persona:\n%s", competitivePrompt)
+	}
+	if strings.Contains(competitivePrompt, "fun facts") {
+		t.Error("competitive prompt carries the casual instruction")
+	}
+
+	if casualTemperature != 0.8 {
+		t.Errorf("casual temperature = %v, want 0.8", casualTemperature)
+	}
+	if competitiveTemperature != builtinPersona.temperature {
+		t.Errorf("competitive temperature = %v, want the default %v", competitiveTemperature, builtinPersona.temperature)
+	}
+}
+
+func TestChatFallsBackToDefaultPersona(t *testing.T) {
+	env := newPersonaTestEnv(t)
+
+	prompt, _ := env.chatAs(t, "", "Tell me about Pikachu")
+	if !strings.HasPrefix(prompt, "You are a friendly Pokemon fan") {
+		t.Errorf("prompt without a persona should use cfg.RAG.DefaultPersona:\n%s", prompt)
+	}
+
+	// With no personas configured the built-in assistant answers
+	builtin := newTestEnv(t, nil)
+	builtin.source.add(pikachu)
+	builtin.ingest(t, "Pikachu")
+	builtin.chat(t, "Tell me about Pikachu")
+	if !strings.HasPrefix(builtin.lastPrompt(t), builtinPersona.systemPrompt) {
+		t.Errorf("prompt should use the built-in persona:\n%s", builtin.lastPrompt(t))
+	}
+}
+
+func TestUnknownPersonaIsRejected(t *testing.T) {
+	env := newPersonaTestEnv(t)
+
+	_, err := env.service.Chat(context.Background(), &ChatRequest{Message: "Tell me about Pikachu", Persona: "pirate"})
+	if !errors.Is(err, ErrUnknownPersona) {
+		t.Fatalf("error = %v, want ErrUnknownPersona", err)
+	}
+	if got := len(env.ollama.GenerateRequests()); got != 0 {
+		t.Errorf("sent %d generate requests for an unknown persona, want 0", got)
+	}
+}
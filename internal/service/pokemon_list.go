@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/katatrina/poke-bot/internal/crawler"
+	"github.com/katatrina/poke-bot/internal/pokename"
+	"github.com/katatrina/poke-bot/internal/repository"
+)
+
+// FindPokemonByTypes returns the Pokemon having every one of types (e.g.
+// Water and Flying), sorted by national number. It queries the collection
+// directly so the result is exact even when the index is stale.
+func (s *RAGService) FindPokemonByTypes(ctx context.Context, types []string) ([]PokemonEntry, error) {
+	normalized := make([]string, 0, len(types))
+	for _, t := range types {
+		if t = crawler.NormalizeTypeName(t); t != "" {
+			normalized = append(normalized, t)
+		}
+	}
+
+	metadata, err := s.vectorRepo.ScrollMetadataByTypes(ctx, normalized, "pokemon", "number", "types")
+	if err != nil {
+		return nil, err
+	}
+
+	pokemon := make(map[string]PokemonEntry)
+	for _, md := range metadata {
+		addEntry(pokemon, md)
+	}
+
+	entries := make([]PokemonEntry, 0, len(pokemon))
+	for _, entry := range pokemon {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Number != entries[j].Number {
+			return entries[i].Number < entries[j].Number
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries, nil
+}
+
+// FindPokemonByNumberRange returns the Pokemon whose National number lies
+// between from and to inclusive, in National Dex order. A zero bound is open.
+func (s *RAGService) FindPokemonByNumberRange(ctx context.Context, from, to int) ([]PokemonEntry, error) {
+	metadata, err := s.vectorRepo.ScrollMetadataByNumberRange(ctx, repository.NumberRange{Min: from, Max: to}, "pokemon", "number", "types")
+	if err != nil {
+		return nil, err
+	}
+
+	// Chunks arrive ordered by number, so the first chunk of each Pokemon fixes its position
+	pokemon := make(map[string]PokemonEntry)
+	var entries []PokemonEntry
+	for _, md := range metadata {
+		key := pokename.Key(md["pokemon"])
+		if _, seen := pokemon[key]; seen {
+			continue
+		}
+		addEntry(pokemon, md)
+		if entry, ok := pokemon[key]; ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
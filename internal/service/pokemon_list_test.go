@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/repository"
+)
+
+func TestFindPokemonByTypes(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(
+		testPokemon("Gyarados", "0130", "Water", "Flying"),
+		testPokemon("Wingull", "0278", "Water", "Flying"),
+		testPokemon("Quagsire", "0195", "Water", "Ground"),
+		testPokemon("Squirtle", "0007", "Water"),
+		testPokemon("Pidgey", "0016", "Normal", "Flying"),
+	)
+	env.ingest(t, "Gyarados", "Wingull", "Quagsire", "Squirtle", "Pidgey")
+
+	names := func(entries []PokemonEntry) []string {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		types []string
+		want  []string
+	}{
+		{[]string{"Water"}, []string{"Squirtle", "Gyarados", "Quagsire", "Wingull"}},
+		{[]string{"water", " FLYING "}, []string{"Gyarados", "Wingull"}},
+		{[]string{"Flying", "Water"}, []string{"Gyarados", "Wingull"}},
+		{[]string{"Water", "Ground"}, []string{"Quagsire"}},
+		{[]string{"Fire"}, nil},
+	}
+
+	for _, tt := range tests {
+		entries, err := env.service.FindPokemonByTypes(context.Background(), tt.types)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(entries); !slices.Equal(got, tt.want) {
+			t.Errorf("types %v: got %v, want %v", tt.types, got, tt.want)
+		}
+		// Each Pokemon appears once, though all of its chunks match
+		for _, entry := range entries {
+			if len(entry.Types) == 0 {
+				t.Errorf("types %v: %s has no types", tt.types, entry.Name)
+			}
+		}
+	}
+}
+
+func TestFindPokemonByNumberRange(t *testing.T) {
+	env := newTestEnv(t, nil)
+	// Ingested out of order, so results must be sorted by number rather than arrival
+	env.source.add(pikachu, squirtle, bulbasaur, charmander)
+	env.ingest(t, "Pikachu", "Squirtle", "Bulbasaur", "Charmander")
+
+	for _, p := range env.qdrant.Points("pokemons") {
+		payload := p.GetPayload()
+		if n, ok := repository.ParseNationalNumber(payload["number"].GetStringValue()); !ok || payload["number_int"].GetIntegerValue() != n {
+			t.Errorf("%s: number_int = %v, want %q parsed", payload["pokemon"].GetStringValue(), payload["number_int"], payload["number"].GetStringValue())
+		}
+	}
+
+	tests := []struct {
+		from, to int
+		want     []string
+	}{
+		{1, 10, []string{"Bulbasaur", "Charmander", "Squirtle"}},
+		{4, 7, []string{"Charmander", "Squirtle"}},
+		{5, 0, []string{"Squirtle", "Pikachu"}},
+		{0, 4, []string{"Bulbasaur", "Charmander"}},
+		{26, 151, nil},
+	}
+
+	for _, tt := range tests {
+		entries, err := env.service.FindPokemonByNumberRange(context.Background(), tt.from, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("from %d to %d: got %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package service
+
+const (
+	ProgressIngested  = "ingested"  // Stored successfully
+	ProgressFailed    = "failed"    // Failed; in the main pass it is queued for a retry
+	ProgressSkipped   = "skipped"   // Excluded by the allowlist or deny patterns
+	ProgressStopped   = "stopped"   // The ingest stopped here (document limit, missing collection)
+	ProgressAbandoned = "abandoned" // Failed after using up ingest.retry_budget or retry_budget_time; not retried again
+)
+
+// ProgressEvent reports the outcome of one Pokemon during an ingest
+type ProgressEvent struct {
+	URL     string `json:"url"`
+	Pokemon string `json:"pokemon,omitempty"` // Name, once crawled successfully
+	Index   int    `json:"index"`             // 1-based position within the pass
+	Total   int    `json:"total"`             // Pokemon in the pass
+	Retry   bool   `json:"retry,omitempty"`   // Event from the retry pass over failed Pokemon
+	Status  string `json:"status"`            // One of the Progress* constants
+	Error   string `json:"error,omitempty"`
+}
+
+// ProgressFunc receives ingest progress, in order, from the goroutine running
+// the ingest. It must not block for long, as the ingest waits on it.
+type ProgressFunc func(ProgressEvent)
+
+// reportProgress calls req.Progress, if set
+func (req *IngestRequest) reportProgress(event ProgressEvent, err error) {
+	if req.Progress == nil {
+		return
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	req.Progress(event)
+}
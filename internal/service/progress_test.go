@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestIngestProgressFiresInOrder(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Ingest.RetryDelay = 1
+	})
+	env.source.add(bulbasaur, charmander, squirtle)
+
+	// Charmander fails once, then succeeds in the retry pass
+	var (
+		mu     sync.Mutex
+		failed bool
+	)
+	env.source.detail = func(_ context.Context, url string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if url == pokemonURL("Charmander") && !failed {
+			failed = true
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+
+	var events []ProgressEvent
+	if _, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source:   pokemonDBSource,
+		URLs:     env.source.urls("Bulbasaur", "Charmander", "Squirtle"),
+		Progress: func(event ProgressEvent) { events = append(events, event) },
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range events {
+		if (events[i].Status == ProgressFailed) != (events[i].Error != "") {
+			t.Errorf("event %d = %+v, want an error exactly on failure", i, events[i])
+		}
+		events[i].Error = ""
+	}
+	want := []ProgressEvent{
+		{URL: pokemonURL("Bulbasaur"), Pokemon: "Bulbasaur", Index: 1, Total: 3, Status: ProgressIngested},
+		{URL: pokemonURL("Charmander"), Index: 2, Total: 3, Status: ProgressFailed},
+		{URL: pokemonURL("Squirtle"), Pokemon: "Squirtle", Index: 3, Total: 3, Status: ProgressIngested},
+		{URL: pokemonURL("Charmander"), Pokemon: "Charmander", Index: 1, Total: 1, Retry: true, Status: ProgressIngested},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v\nwant %+v", events, want)
+	}
+}
+
+func TestIngestProgressReportsErrors(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.KB.MaxTotalDocuments = 1 // Each test Pokemon is a single chunk
+	})
+	env.source.add(bulbasaur, charmander)
+
+	var events []ProgressEvent
+	_, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source:   pokemonDBSource,
+		URLs:     env.source.urls("Bulbasaur", "Charmander"),
+		Progress: func(event ProgressEvent) { events = append(events, event) },
+	})
+	if !errors.Is(err, ErrDocumentLimitReached) {
+		t.Fatalf("err = %v, want ErrDocumentLimitReached", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	if last := events[1]; last.Status != ProgressStopped || last.Error == "" || last.Index != 2 || last.Total != 2 {
+		t.Errorf("last event = %+v, want a stopped event with the error", last)
+	}
+}
+
+func TestIngestJobTracksProgress(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(bulbasaur, charmander)
+
+	var calls int
+	job, _, err := env.service.RunIngestJob(context.Background(), "", &IngestRequest{
+		Source:   pokemonDBSource,
+		URLs:     env.source.urls("Bulbasaur", "Charmander"),
+		Progress: func(ProgressEvent) { calls++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 2 {
+		t.Errorf("caller's callback fired %d times, want 2", calls)
+	}
+	want := &ProgressEvent{URL: pokemonURL("Charmander"), Pokemon: "Charmander", Index: 2, Total: 2, Status: ProgressIngested}
+	if !reflect.DeepEqual(job.Progress, want) {
+		t.Errorf("job progress = %+v, want %+v", job.Progress, want)
+	}
+}
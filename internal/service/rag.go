@@ -5,14 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/katatrina/poke-bot/internal/config"
 	"github.com/katatrina/poke-bot/internal/crawler"
 	"github.com/katatrina/poke-bot/internal/model"
+	"github.com/katatrina/poke-bot/internal/pokename"
 	"github.com/katatrina/poke-bot/internal/repository"
+	"github.com/katatrina/poke-bot/internal/types"
 	"github.com/pkoukk/tiktoken-go"
 	"github.com/tmc/langchaingo/textsplitter"
 	"resty.dev/v3"
@@ -20,6 +28,7 @@ import (
 
 const (
 	pokemonDBSource = "pokemondb"
+	pokeAPISource   = "pokeapi"
 )
 
 var (
@@ -32,7 +41,23 @@ func init() {
 	tokenizer, err = tiktoken.GetEncoding("cl100k_base")
 	if err != nil {
 		log.Printf("Warning: failed to initialize tokenizer: %v. Token counting will use character approximation.", err)
+		return
 	}
+	log.Printf("Tokenizer initialized: cl100k_base")
+}
+
+// TokenizerStatus reports how tokens are being counted, so operators can
+// alert when the token budget logic runs on the chars/4 approximation
+type TokenizerStatus struct {
+	Mode     string `json:"mode"` // "tiktoken" | "char_approximation"
+	Degraded bool   `json:"degraded"`
+}
+
+func GetTokenizerStatus() TokenizerStatus {
+	if tokenizer == nil {
+		return TokenizerStatus{Mode: "char_approximation", Degraded: true}
+	}
+	return TokenizerStatus{Mode: "tiktoken", Degraded: false}
 }
 
 // countTokens counts the number of tokens in the given text
@@ -45,135 +70,716 @@ func countTokens(text string) int {
 }
 
 type RAGService struct {
-	config     *config.Config
-	vectorRepo *repository.VectorRepository
-	restClient *resty.Client
-	crawler    *crawler.PokemonDBCrawler
+	config         *config.Config
+	vectorRepo     *repository.VectorRepository
+	restClient     *resty.Client
+	sources        map[string]crawler.PokemonSource // Keyed by IngestRequest.Source
+	content        *crawler.ContentFormatter        // Renders crawled Pokemon as the text to embed
+	roles          map[string]roleFormula           // Keyed by lowercase role name, for Recommend
+	knowledgeIndex *KnowledgeIndex
+	ingestJobs     *ingestJobStore
+	answerCache    *answerCache    // Nil when disabled
+	ollamaBreaker  *circuitBreaker // Nil when cfg.Ollama.BreakerThreshold is 0
+	vision         visionSupport   // Whether the chat model takes images, for cfg.RAG.Multimodal
+	collection     *collectionState
+	allowlist      *pokemonAllowlist // Nil when cfg.KB.PokemonAllowlist is empty
+	stats          *serviceStats
+	now            func() time.Time // Clock for stage timings, swappable in tests
+
+	// Cancelled on shutdown so running ingests stop at the next Pokemon boundary
+	shutdownCtx    context.Context
+	shutdownCancel context.CancelFunc
+	ingestWG       sync.WaitGroup
 }
 
 func NewRAGService(
 	cfg *config.Config,
 	vectorRepo *repository.VectorRepository,
 	restClient *resty.Client,
-) *RAGService {
+) (*RAGService, error) {
+	content, err := crawler.NewContentFormatter(cfg.Ingest.ContentTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("ingest.content_template: %w", err)
+	}
+
+	roles, err := parseRoles(cfg.Roles)
+	if err != nil {
+		return nil, fmt.Errorf("roles: %w", err)
+	}
+
+	knowledgeIndex := NewKnowledgeIndex(vectorRepo, time.Duration(cfg.RAG.KnowledgeIndexTTL)*time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := knowledgeIndex.Refresh(ctx); err != nil {
+		log.Printf("Warning: failed to load knowledge index: %v", err)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithCancel(context.Background())
+
+	var cache *answerCache
+	if cfg.AnswerCache.Enabled {
+		cache = newAnswerCacheFromConfig(cfg.AnswerCache)
+	}
+
 	return &RAGService{
 		config:     cfg,
 		vectorRepo: vectorRepo,
 		restClient: restClient,
-		crawler:    crawler.NewPokemonDBCrawler(),
+		sources: map[string]crawler.PokemonSource{
+			pokemonDBSource: crawler.NewPokemonDBCrawler(cfg.Crawler),
+			pokeAPISource:   crawler.NewPokeAPIClient(restClient),
+		},
+		content:        content,
+		roles:          roles,
+		knowledgeIndex: knowledgeIndex,
+		ingestJobs:     newIngestJobStore(time.Duration(cfg.Ingest.IdempotencyTTL)*time.Second, cfg.KB.MaxConcurrentJobs),
+		answerCache:    cache,
+		ollamaBreaker:  newCircuitBreaker(cfg.Ollama.BreakerThreshold, time.Duration(cfg.Ollama.BreakerCooldown)*time.Second),
+		collection:     newCollectionState(vectorRepo),
+		allowlist:      newPokemonAllowlist(cfg.KB.PokemonAllowlist),
+		stats:          newServiceStats(time.Now()),
+		now:            time.Now,
+		shutdownCtx:    shutdownCtx,
+		shutdownCancel: shutdownCancel,
+	}, nil
+}
+
+// Shutdown signals running ingests to stop after the Pokemon they are on and
+// waits for them to return, or for ctx to expire
+func (s *RAGService) Shutdown(ctx context.Context) error {
+	s.shutdownCancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.ingestWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for ingestion to stop: %w", ctx.Err())
+	}
+}
+
+// trackIngest registers an in-flight ingest and returns a context that is also
+// cancelled on shutdown. The returned func must be called when the ingest ends.
+func (s *RAGService) trackIngest(ctx context.Context) (context.Context, func()) {
+	s.ingestWG.Add(1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(s.shutdownCtx, cancel)
+
+	return ctx, func() {
+		stop()
+		cancel()
+		s.ingestWG.Done()
 	}
 }
 
+// MigrateCollection upgrades points written by older ingestion schemas to
+// repository.SchemaVersion
+func (s *RAGService) MigrateCollection(ctx context.Context) (repository.MigrationResult, error) {
+	result, err := s.vectorRepo.MigrateSchema(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	log.Printf("Migrated %d of %d points to schema version %d", result.Migrated, result.Scanned, result.SchemaVersion)
+
+	return result, nil
+}
+
+type ReembedResult struct {
+	Documents int    `json:"documents"`
+	Model     string `json:"model"`
+	Dimension int    `json:"dimension"`
+}
+
+// ReembedCollection recomputes every document's vector from its stored
+// content with the current embedding model, so switching models doesn't
+// require a re-crawl. All embeddings are generated before the collection is
+// recreated, so a failure part way leaves the old vectors intact.
+func (s *RAGService) ReembedCollection(ctx context.Context) (ReembedResult, error) {
+	ctx, done := s.trackIngest(ctx)
+	defer done()
+
+	result := ReembedResult{
+		Model:     s.config.Ollama.EmbeddingModel,
+		Dimension: s.config.Ollama.Dimension(),
+	}
+
+	points, err := s.vectorRepo.ScrollPoints(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to read documents: %w", err)
+	}
+	if len(points) == 0 {
+		return result, nil
+	}
+
+	const batchSize = 32
+	embeddings := make([][]float32, 0, len(points))
+	for start := 0; start < len(points); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		end := min(start+batchSize, len(points))
+
+		chunks := make([]string, 0, end-start)
+		for _, point := range points[start:end] {
+			chunks = append(chunks, point.Content)
+		}
+
+		batch, err := s.embedDocuments(ctx, s.prepareForEmbedding(chunks))
+		if err != nil {
+			return result, fmt.Errorf("failed to embed documents %d-%d: %w", start, end, err)
+		}
+		embeddings = append(embeddings, batch...)
+
+		log.Printf("Re-embedded %d/%d documents", end, len(points))
+	}
+
+	if err := s.vectorRepo.ReplaceVectors(ctx, points, embeddings); err != nil {
+		return result, err
+	}
+
+	result.Documents = len(points)
+	log.Printf("Re-embedded %d documents with %s (%d dimensions)", result.Documents, result.Model, result.Dimension)
+
+	return result, nil
+}
+
+var (
+	// ErrNothingToIngest is returned when pagination leaves no Pokemon to crawl
+	ErrNothingToIngest = errors.New("nothing to ingest")
+
+	// ErrNoPokemonListed is returned when the source lists no Pokemon at all,
+	// which for pokemondb usually means crawler.selectors.pokemon_list broke
+	ErrNoPokemonListed = errors.New("source listed no Pokemon URLs")
+
+	// ErrAllPokemonFailed is returned when Pokemon were listed but none of
+	// them could be crawled, embedded and stored
+	ErrAllPokemonFailed = errors.New("every listed Pokemon failed to ingest")
+)
+
 type IngestRequest struct {
-	Source     string `json:"source,omitempty"` // "pokemondb" or "text"
-	CrawlLimit int    `json:"crawl_limit"`      // Number of Pokemon to crawl (default 10)
-	StartFrom  int    `json:"start_from"`       // Start from Pokemon number (for pagination)
+	Source      string   `json:"source,omitempty"`       // "pokemondb" or "pokeapi"
+	CrawlLimit  int      `json:"crawl_limit"`            // Number of Pokemon to crawl (default 10)
+	StartFrom   int      `json:"start_from"`             // Start from Pokemon number (for pagination)
+	URLs        []string `json:"urls,omitempty"`         // Explicit detail page URLs, skips the national dex crawl
+	RefreshList bool     `json:"refresh_list,omitempty"` // Re-crawl the Pokemon list instead of using the cached one
+
+	SkipExisting bool `json:"skip_existing,omitempty"` // Don't re-crawl Pokemon this source already stored
+	DryRun       bool `json:"dry_run,omitempty"`       // Crawl and chunk only, returning a DryRunReport instead of storing
+
+	Progress ProgressFunc `json:"-"` // Called as each Pokemon finishes (nil = no callbacks)
 }
 
 func (req *IngestRequest) Validate() error {
-	if req.Source != pokemonDBSource {
-		return fmt.Errorf("unsupported source: %s (must be 'pokemondb')", req.Source)
+	if req.Source != pokemonDBSource && req.Source != pokeAPISource {
+		return fmt.Errorf("unsupported source: %s (must be 'pokemondb' or 'pokeapi')", req.Source)
 	}
 
 	if req.CrawlLimit <= 0 {
 		req.CrawlLimit = 10 // Default to 10 Pokemon
 	}
 
+	if req.StartFrom < 0 {
+		return errors.New("start_from cannot be negative")
+	}
+
 	if req.CrawlLimit > 151 {
 		req.CrawlLimit = 151 // Max Gen 1 Pokemon
 	}
 
+	if len(req.URLs) > 0 && req.Source != pokemonDBSource {
+		return errors.New("urls are only supported for the 'pokemondb' source")
+	}
+	if len(req.URLs) > 151 {
+		return errors.New("too many urls (max 151)")
+	}
+	for _, pokemonURL := range req.URLs {
+		if err := crawler.ValidatePokemonURL(pokemonURL); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (s *RAGService) IngestPokemonData(ctx context.Context, req *IngestRequest) error {
-	log.Printf("Starting Pokemon crawl with limit=%d", req.CrawlLimit)
+// IngestPokemonData crawls and stores the requested Pokemon. It returns how
+// many were skipped because req.SkipExisting or cfg.Ingest.DedupCrawlList
+// found them already stored.
+func (s *RAGService) IngestPokemonData(ctx context.Context, req *IngestRequest) (skipped int, err error) {
+	ctx, done := s.trackIngest(ctx)
+	defer done()
+
+	// Cached answers may be stale once the collection changes. Deferred
+	// before the shadow swap so it runs after it, seeing its error.
+	defer func() {
+		if err == nil && s.answerCache != nil {
+			s.answerCache.invalidate()
+		}
+	}()
 
-	// Step 1: Get list of Pokemon URLs
-	pokemonURLs, err := s.crawler.CrawlPokemonList(ctx, req.CrawlLimit)
-	if err != nil {
-		return fmt.Errorf("failed to crawl pokemon list: %w", err)
+	if jobTimeout := s.config.KB.Crawler.JobTimeout; jobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(jobTimeout)*time.Second)
+		defer cancel()
 	}
 
-	log.Printf("Found %d Pokemon URLs to crawl", len(pokemonURLs))
+	source := s.sources[req.Source]
 
-	// Process start_from if specified
-	if req.StartFrom > 0 && req.StartFrom < len(pokemonURLs) {
-		pokemonURLs = pokemonURLs[req.StartFrom:]
+	pokemonURLs, skipped, err := s.resolvePokemonURLs(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+
+	if req.SkipExisting && len(pokemonURLs) > 0 {
+		existing, err := s.loadExistingPokemon(ctx, req.Source)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check for existing Pokemon: %w", err)
+		}
+		var skippedNow int
+		pokemonURLs, skippedNow = existing.filterURLs(pokemonURLs)
+		skipped += skippedNow
+		log.Printf("Skipping %d already ingested Pokemon, %d left to crawl", skippedNow, len(pokemonURLs))
+	}
+	if len(pokemonURLs) == 0 {
+		return skipped, nil // Everything requested is already stored
 	}
 
 	successCount := 0
+
+	// Behind an alias, ingest into a copy so chats keep searching the complete
+	// old collection; the alias only moves to the copy if the ingest succeeds,
+	// or stops on a timeout or shutdown after storing something
+	index := s.knowledgeIndex
+	if s.vectorRepo.UsesAlias() {
+		shadow, shadowErr := s.vectorRepo.CreateShadow(ctx)
+		if shadowErr != nil {
+			return skipped, shadowErr
+		}
+		ctx = repository.WithShadow(ctx, shadow)
+
+		// Chats keep using the live index until the swap publishes the copy
+		index = NewKnowledgeIndex(s.vectorRepo, 0)
+		if err := index.Refresh(ctx); err != nil {
+			log.Printf("Warning: failed to index shadow collection %q: %v", shadow, err)
+		}
+
+		defer func() {
+			cleanupCtx := context.WithoutCancel(ctx) // Still clean up after a timeout
+			stopped := errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+			if err != nil && !(stopped && successCount > 0) {
+				log.Printf("Discarding shadow collection %q after the failed ingest", shadow)
+				s.vectorRepo.DropCollection(cleanupCtx, shadow)
+				return
+			}
+			if swapErr := s.vectorRepo.SwapAlias(cleanupCtx, shadow); swapErr != nil {
+				s.vectorRepo.DropCollection(cleanupCtx, shadow)
+				if err == nil {
+					err = swapErr
+				}
+				return
+			}
+
+			if refreshErr := s.knowledgeIndex.Refresh(cleanupCtx); refreshErr != nil {
+				log.Printf("Warning: failed to refresh knowledge index: %v", refreshErr)
+			}
+			if successCount > 0 {
+				s.collection.markNonEmpty()
+			}
+			// A stopped ingest keeps its error, so the deferred invalidation
+			// above won't run for it
+			if err != nil && s.answerCache != nil {
+				s.answerCache.invalidate()
+			}
+		}()
+	}
+
+	s.logDocumentLimit(ctx)
+
 	failCount := 0
+	abandonedCount := 0
+	var ingestedNames []string
+	var retryQueue []string
+	budgets := make(map[string]*retryBudget) // Per Pokemon, shared by its first attempt and retry
 
 	// Step 2: Crawl each Pokemon and ingest
 	for i, url := range pokemonURLs {
+		// Stop between Pokemon so the collection never holds a partial entry
+		if err := ctx.Err(); err != nil {
+			return skipped, s.ingestStopped(err, i, len(pokemonURLs), successCount, failCount+len(retryQueue))
+		}
+
 		log.Printf("Crawling Pokemon %d/%d: %s", i+1, len(pokemonURLs), url)
 
-		// Crawl Pokemon details
-		pokemonData, err := s.crawler.CrawlPokemonDetails(ctx, url)
-		if err != nil {
-			log.Printf("Failed to crawl %s: %v", url, err)
+		budgets[url] = s.newRetryBudget()
+		name, chunkCount, err := s.ingestPokemon(withRetryBudget(ctx, budgets[url]), index, source, req.Source, url)
+		event := ProgressEvent{URL: url, Pokemon: name, Index: i + 1, Total: len(pokemonURLs)}
+		if errors.Is(err, errNotAllowlisted) || errors.Is(err, crawler.ErrDeniedURL) {
+			log.Printf("Skipping %s: %v", url, err)
+			event.Status = ProgressSkipped
+			req.reportProgress(event, err)
+			continue
+		}
+		// Every later Pokemon would fail the same way
+		if errors.Is(err, ErrDocumentLimitReached) || errors.Is(err, repository.ErrCollectionNotFound) {
+			log.Printf("Stopping ingest at %s: %v", url, err)
+			event.Status = ProgressStopped
+			req.reportProgress(event, err)
+			return skipped, fmt.Errorf("ingest stopped after %d of %d Pokemon (%d success): %w", i, len(pokemonURLs), successCount, err)
+		}
+		if errors.Is(err, ErrRetryBudgetExhausted) {
+			log.Printf("Abandoning %s: %v", url, err)
+			event.Status = ProgressAbandoned
+			req.reportProgress(event, err)
 			failCount++
+			abandonedCount++
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to ingest %s: %v", url, err)
+			event.Status = ProgressFailed
+			req.reportProgress(event, err)
+			retryQueue = append(retryQueue, url)
 			continue
 		}
 
-		// Format Pokemon data for RAG
-		content := s.crawler.FormatPokemonForRAG(pokemonData)
+		event.Status = ProgressIngested
+		req.reportProgress(event, nil)
+		successCount++
+		ingestedNames = append(ingestedNames, name)
+		log.Printf("Successfully ingested %s (%d chunks)", name, chunkCount)
+	}
 
-		// Split into chunks if needed
-		chunks, err := s.splitText(content)
-		if err != nil {
-			log.Printf("Failed to split text for %s: %v", pokemonData.Name, err)
+	// Step 3: Retry failures once, spaced out, so transient errors heal within the run
+	var recoveredNames []string
+	for i, url := range retryQueue {
+		if err := sleepContext(ctx, s.retryDelay()); err != nil {
+			return skipped, s.ingestStopped(err, len(pokemonURLs), len(pokemonURLs), successCount, failCount+len(retryQueue)-i)
+		}
+
+		event := ProgressEvent{URL: url, Index: i + 1, Total: len(retryQueue), Retry: true}
+		if err := budgets[url].spend("ingest"); err != nil {
+			log.Printf("Abandoning %s: %v", url, err)
+			event.Status = ProgressAbandoned
+			req.reportProgress(event, err)
 			failCount++
+			abandonedCount++
 			continue
 		}
 
-		// Generate embeddings
-		embeddings, err := s.generateEmbeddings(chunks)
+		log.Printf("Retrying Pokemon %d/%d: %s", i+1, len(retryQueue), url)
+
+		name, chunkCount, err := s.ingestPokemon(withRetryBudget(ctx, budgets[url]), index, source, req.Source, url)
+		event.Pokemon = name
+		if errors.Is(err, ErrDocumentLimitReached) || errors.Is(err, repository.ErrCollectionNotFound) {
+			log.Printf("Stopping retries at %s: %v", url, err)
+			event.Status = ProgressStopped
+			req.reportProgress(event, err)
+			return skipped, fmt.Errorf("ingest stopped during retries (%d success): %w", successCount, err)
+		}
 		if err != nil {
-			log.Printf("Failed to generate embeddings for %s: %v", pokemonData.Name, err)
+			log.Printf("Failed to ingest %s on retry: %v", url, err)
+			event.Status = ProgressFailed
+			if errors.Is(err, ErrRetryBudgetExhausted) {
+				event.Status = ProgressAbandoned
+				abandonedCount++
+			}
+			req.reportProgress(event, err)
 			failCount++
 			continue
 		}
 
-		// Create documents
-		var documents []model.Document
-		for j, chunk := range chunks {
-			documentID, _ := uuid.NewV7()
-			doc := model.Document{
-				ID:      documentID,
-				Content: chunk,
-				Metadata: map[string]string{
-					"source":  pokemonDBSource,
-					"pokemon": pokemonData.Name,
-					"number":  pokemonData.Number,
-					"types":   strings.Join(pokemonData.Types, ","),
-					"chunk":   fmt.Sprintf("%d/%d", j+1, len(chunks)),
-				},
-			}
-			documents = append(documents, doc)
+		event.Status = ProgressIngested
+		req.reportProgress(event, nil)
+		successCount++
+		ingestedNames = append(ingestedNames, name)
+		recoveredNames = append(recoveredNames, name)
+		log.Printf("Successfully ingested %s on retry (%d chunks)", name, chunkCount)
+	}
+
+	if len(recoveredNames) > 0 {
+		log.Printf("Recovered on retry: %s", strings.Join(recoveredNames, ", "))
+	}
+	log.Printf("Pokemon crawl completed: %d success (%d on retry), %d failed (%d over the retry budget)", successCount, len(recoveredNames), failCount, abandonedCount)
+
+	// Resync with the collection in case other writers touched it
+	if err := index.Refresh(ctx); err != nil {
+		log.Printf("Warning: failed to refresh knowledge index: %v", err)
+	}
+
+	// Second pass: neighbors are only known once the whole batch is in the index
+	s.storeRelatedPokemon(ctx, index, ingestedNames)
+
+	if successCount == 0 && failCount == 0 {
+		return skipped, fmt.Errorf("%w: every crawled Pokemon was excluded by the allowlist or deny patterns", ErrNothingToIngest)
+	}
+	if successCount == 0 {
+		return skipped, fmt.Errorf("%w: %d of %d failed, check the detail page selectors and Ollama/Qdrant logs", ErrAllPokemonFailed, failCount, len(pokemonURLs))
+	}
+
+	return skipped, nil
+}
+
+// ingestPokemon crawls, chunks, embeds and stores a single Pokemon, adding it
+// to index and returning its name and chunk count
+func (s *RAGService) ingestPokemon(ctx context.Context, index *KnowledgeIndex, source crawler.PokemonSource, sourceName, url string) (string, int, error) {
+	pokemonData, chunks, err := s.preparePokemon(ctx, source, url)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Refuse before spending time on embeddings
+	if err := s.checkDocumentLimit(ctx, len(chunks)); err != nil {
+		return "", 0, err
+	}
+
+	// Generate embeddings
+	embeddings, err := s.embedDocuments(ctx, s.prepareForEmbedding(chunks))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to generate embeddings for %s: %w", pokemonData.Name, err)
+	}
+
+	// Create documents
+	sections := chunkSections(chunks)
+	var documents []model.Document
+	for j, chunk := range chunks {
+		documentID, _ := uuid.NewV7()
+		doc := model.Document{
+			ID:      documentID,
+			Content: chunk,
+			Metadata: map[string]string{
+				"source":      sourceName,
+				"pokemon":     pokemonData.Name,
+				"pokemon_key": pokename.Key(pokemonData.Name),
+				"number":      pokemonData.Number,
+				"types":       strings.Join(pokemonData.Types, ","),
+				"chunk":       fmt.Sprintf("%d/%d", j+1, len(chunks)),
+				"sections":    strings.Join(sections[j], ","),
+				"image_url":   pokemonData.ImageURL,
+			},
+			Fields: typedFields(pokemonData),
 		}
+		documents = append(documents, doc)
+	}
 
-		// Store in vector database
-		if err = s.vectorRepo.Upsert(ctx, documents, embeddings); err != nil {
-			log.Printf("Failed to store %s: %v", pokemonData.Name, err)
-			failCount++
+	// Store in vector database
+	if err = s.vectorRepo.Upsert(ctx, documents, embeddings); err != nil {
+		return "", 0, fmt.Errorf("failed to store %s: %w", pokemonData.Name, err)
+	}
+
+	for _, doc := range documents {
+		index.Add(doc.Metadata)
+	}
+	// A staging index means the points went to a shadow collection, which
+	// chats can't search until the alias swap
+	if index == s.knowledgeIndex {
+		s.collection.markNonEmpty()
+	}
+
+	return pokemonData.Name, len(chunks), nil
+}
+
+// preparePokemon crawls a single Pokemon and renders and chunks its content,
+// stopping short of embedding
+func (s *RAGService) preparePokemon(ctx context.Context, source crawler.PokemonSource, url string) (*crawler.PokemonData, []string, error) {
+	// Crawl Pokemon details
+	pokemonData, err := source.CrawlPokemonDetails(ctx, url)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to crawl: %w", err)
+	}
+
+	// Encoding quirks on the upstream page would otherwise break JSON marshaling downstream
+	if crawler.SanitizeUTF8(pokemonData) {
+		log.Printf("Warning: replaced invalid UTF-8 in crawled data for %s", pokemonData.Name)
+	}
+	pokemonData.Name = pokename.Display(pokemonData.Name)
+
+	if !s.allowlist.allows(pokemonData) {
+		return nil, nil, fmt.Errorf("%s: %w", pokemonData.Name, errNotAllowlisted)
+	}
+
+	// Catch crawler regressions in matchup parsing without failing the ingest
+	for _, discrepancy := range crawler.ValidateTypeEffectiveness(pokemonData) {
+		log.Printf("Warning: %s type effectiveness differs from type chart: %s", pokemonData.Name, discrepancy)
+	}
+
+	// Format Pokemon data for RAG
+	content, err := s.content.Format(pokemonData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to format %s: %w", pokemonData.Name, err)
+	}
+
+	// Split into chunks if needed
+	chunks, err := s.splitText(content)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to split text for %s: %w", pokemonData.Name, err)
+	}
+
+	return pokemonData, chunks, nil
+}
+
+// typedFields returns payload fields stored with their own types: types as a
+// list for exact type filters, and numeric height/weight and base stats so
+// comparisons ("which is heavier?") and role rankings don't depend on parsing
+// display strings
+func typedFields(pokemon *crawler.PokemonData) map[string]any {
+	fields := map[string]any{
+		"types": repository.TypesPayload(pokemon.Types),
+	}
+	number, ok := repository.ParseNationalNumber(pokemon.Number)
+	if ok {
+		fields["number_int"] = number
+	}
+	// pokemondb pages don't state the generation, so derive it from the number
+	generation := pokemon.Generation
+	if generation <= 0 {
+		generation = generationForNumber(number)
+	}
+	if generation > 0 {
+		fields["generation"] = generation
+	}
+	if pokemon.HeightM > 0 {
+		fields["height_m"] = pokemon.HeightM
+	}
+	if pokemon.WeightKg > 0 {
+		fields["weight_kg"] = pokemon.WeightKg
+	}
+	for stat, field := range statFields {
+		if value, ok := pokemon.Stats[stat]; ok && value > 0 {
+			fields[field] = value
+		}
+	}
+	return fields
+}
+
+// ingestStopped logs and builds the error for an ingest cut short by
+// cancellation or the job timeout after processed of total Pokemon
+func (s *RAGService) ingestStopped(err error, processed, total, successCount, failCount int) error {
+	reason := "cancelled"
+	if errors.Is(err, context.DeadlineExceeded) {
+		reason = fmt.Sprintf("job timeout of %ds exceeded", s.config.KB.Crawler.JobTimeout)
+	}
+
+	log.Printf("Pokemon crawl stopped after %d/%d (%s): %d success, %d failed", processed, total, reason, successCount, failCount)
+	return fmt.Errorf("ingest stopped after %d of %d Pokemon (%d success, %d failed): %s: %w", processed, total, successCount, failCount, reason, err)
+}
+
+// retryDelay is the pause before each retry of a failed Pokemon
+func (s *RAGService) retryDelay() time.Duration {
+	if s.config.Ingest.RetryDelay <= 0 {
+		return 5 * time.Second // Default fallback
+	}
+	return time.Duration(s.config.Ingest.RetryDelay) * time.Second
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// storeRelatedPokemon stores a same_type_neighbors field, taken from index, on
+// each ingested Pokemon's documents so the UI can show recommendations without
+// extra queries
+func (s *RAGService) storeRelatedPokemon(ctx context.Context, index *KnowledgeIndex, names []string) {
+	limit := s.config.Ingest.RelatedPokemonLimit
+	if limit <= 0 {
+		return
+	}
+
+	for _, name := range names {
+		neighbors := index.SameTypeNeighbors(name, limit)
+		if len(neighbors) == 0 {
 			continue
 		}
 
-		successCount++
-		log.Printf("Successfully ingested %s (%d chunks)", pokemonData.Name, len(chunks))
+		payload := map[string]any{
+			"same_type_neighbors": strings.Join(neighbors, ","),
+		}
+		if err := s.vectorRepo.SetPokemonPayload(ctx, name, payload); err != nil {
+			log.Printf("Failed to store related Pokemon for %s: %v", name, err)
+		}
 	}
+}
 
-	log.Printf("Pokemon crawl completed: %d success, %d failed", successCount, failCount)
+// resolvePokemonURLs returns the detail pages to ingest: the caller's explicit
+// list when given, otherwise the national dex crawl
+func (s *RAGService) resolvePokemonURLs(ctx context.Context, req *IngestRequest) (pokemonURLs []string, skipped int, err error) {
+	if len(req.URLs) > 0 {
+		log.Printf("Starting Pokemon crawl of %d provided URLs", len(req.URLs))
+		return req.URLs, 0, nil
+	}
 
-	if successCount == 0 {
-		return fmt.Errorf("failed to ingest any Pokemon data")
+	log.Printf("Starting Pokemon crawl with limit=%d", req.CrawlLimit)
+
+	// Step 1: Get list of Pokemon URLs. Deduping needs the whole list, since
+	// crawl_limit then counts only Pokemon that aren't stored yet.
+	source := s.sources[req.Source]
+	if refresher, ok := source.(crawler.ListRefresher); ok && req.RefreshList {
+		refresher.RefreshPokemonList()
 	}
 
-	return nil
+	dedup := s.config.Ingest.DedupCrawlList
+	listLimit := req.CrawlLimit
+	if dedup {
+		listLimit = max(listLimit, nationalDexSize)
+	}
+
+	pokemonURLs, err = source.CrawlPokemonList(ctx, listLimit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to crawl pokemon list: %w", err)
+	}
+
+	log.Printf("Found %d Pokemon URLs to crawl", len(pokemonURLs))
+	if len(pokemonURLs) == 0 {
+		return nil, 0, fmt.Errorf("%w from %s; the list page layout or selector may have changed", ErrNoPokemonListed, req.Source)
+	}
+
+	// Process start_from if specified
+	if req.StartFrom >= len(pokemonURLs) {
+		return nil, 0, fmt.Errorf("%w: start_from %d is past the %d Pokemon listed", ErrNothingToIngest, req.StartFrom, len(pokemonURLs))
+	}
+	pokemonURLs = pokemonURLs[req.StartFrom:]
+
+	if s.allowlist != nil {
+		pokemonURLs = s.allowlist.filterURLs(pokemonURLs)
+		log.Printf("%d Pokemon URLs left after applying the allowlist", len(pokemonURLs))
+		if len(pokemonURLs) == 0 {
+			return nil, 0, fmt.Errorf("%w: no listed Pokemon are in the allowlist", ErrNothingToIngest)
+		}
+	}
+
+	if dedup {
+		existing, err := s.loadExistingPokemon(ctx, req.Source)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to check for existing Pokemon: %w", err)
+		}
+		pokemonURLs, skipped = existing.filterURLs(pokemonURLs)
+		pokemonURLs = pokemonURLs[:min(len(pokemonURLs), req.CrawlLimit)]
+		log.Printf("Dropped %d already ingested Pokemon from the list, %d left to crawl", skipped, len(pokemonURLs))
+	}
+
+	return pokemonURLs, skipped, nil
 }
 
+// nationalDexSize is the number of Pokemon in the National Dex, the list
+// length fetched when cfg.Ingest.DedupCrawlList needs the whole list
+const nationalDexSize = 1025
+
 func (s *RAGService) splitText(text string) ([]string, error) {
 	// For smaller Pokemon entries, don't split unnecessarily
 	if len(text) < s.config.RAG.ChunkSize {
@@ -191,30 +797,238 @@ func (s *RAGService) splitText(text string) ([]string, error) {
 		return nil, err
 	}
 
-	return chunks, nil
-}
+	return chunks, nil
+}
+
+// sectionHeaderPattern matches the content template's "=== Base Stats ===" lines
+var sectionHeaderPattern = regexp.MustCompile(`(?m)^=== .+ ===[ \t]*\n?`)
+
+// chunkSections returns the "=== Section ===" names each chunk covers. A
+// chunk starting mid-section (no header before its first line) also covers
+// the section the previous chunk ended in.
+func chunkSections(chunks []string) [][]string {
+	sections := make([][]string, len(chunks))
+	current := ""
+
+	for i, chunk := range chunks {
+		headers := sectionHeaderPattern.FindAllStringIndex(chunk, -1)
+
+		if current != "" && (len(headers) == 0 || strings.TrimSpace(chunk[:headers[0][0]]) != "") {
+			sections[i] = append(sections[i], current)
+		}
+
+		for _, loc := range headers {
+			current = strings.Trim(strings.TrimSpace(chunk[loc[0]:loc[1]]), "= ")
+			if !slices.Contains(sections[i], current) {
+				sections[i] = append(sections[i], current)
+			}
+		}
+	}
+
+	return sections
+}
+
+// prepareForEmbedding returns the text to embed for each chunk. With
+// cfg.Ingest.StripSectionHeaders, the boilerplate section headers repeated in
+// every chunk are removed so they don't dominate similarity; the stored
+// content keeps them for LLM readability.
+func (s *RAGService) prepareForEmbedding(chunks []string) []string {
+	if !s.config.Ingest.StripSectionHeaders {
+		return chunks
+	}
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = strings.TrimSpace(sectionHeaderPattern.ReplaceAllString(chunk, ""))
+	}
+
+	return texts
+}
+
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// CheckOllamaOnStartup runs CheckOllama before the server starts serving. A
+// failure only logs a warning, so local dev can start Ollama later, unless
+// cfg.Ollama.RequireOnStartup is set, in which case it is returned.
+func (s *RAGService) CheckOllamaOnStartup(ctx context.Context) error {
+	err := s.CheckOllama(ctx)
+	if err == nil {
+		return nil
+	}
+
+	if s.config.Ollama.RequireOnStartup {
+		return fmt.Errorf("ollama is unavailable: %w", err)
+	}
+	log.Printf("Warning: Ollama is unavailable, chat and ingestion will fail until it is reachable: %v", err)
+	return nil
+}
+
+// CheckOllama verifies Ollama is reachable and has the configured chat and
+// embedding models pulled
+func (s *RAGService) CheckOllama(ctx context.Context) error {
+	var tags ollamaTagsResponse
+	resp, err := s.restClient.R().
+		SetContext(ctx).
+		SetResult(&tags).
+		Get(s.config.Ollama.BaseURL + "/api/tags")
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", s.config.Ollama.BaseURL, err)
+	}
+
+	if resp.StatusCode() != 200 {
+		return fmt.Errorf("tags API returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	available := make(map[string]bool, len(tags.Models))
+	for _, m := range tags.Models {
+		available[m.Name] = true
+		available[strings.TrimSuffix(m.Name, ":latest")] = true
+	}
+
+	var missing []string
+	for _, name := range []string{s.config.Ollama.ChatModel, s.config.Ollama.EmbeddingModel} {
+		if !available[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("models not pulled: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+type OllamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type OllamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// embedPurpose selects which configured task prefix, if any, is prepended
+// before embedding. Instruction-tuned models (e5, mxbai) expect different
+// prefixes for queries and documents.
+type embedPurpose int
+
+const (
+	embedRaw      embedPurpose = iota // Texts are embedded as given
+	embedQuery                        // cfg.RAG.QueryEmbedPrefix
+	embedDocument                     // cfg.RAG.DocumentEmbedPrefix
+)
+
+// generateEmbeddings embeds texts in one batch, then re-requests individually
+// any vector that came back missing or with the wrong dimension
+func (s *RAGService) generateEmbeddings(ctx context.Context, texts []string, purpose embedPurpose) ([][]float32, error) {
+	texts = s.applyEmbedPrefix(texts, purpose)
+
+	model := s.config.Ollama.EmbeddingModel
+	embeddings, err := s.requestEmbeddings(ctx, model, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	// With a short or long batch there's no telling which vector belongs to
+	// which input, so pair them up one request at a time instead
+	if len(embeddings) != len(texts) {
+		log.Printf("Embedding API returned %d embeddings for %d inputs, re-requesting individually", len(embeddings), len(texts))
+		if err := retryBudgetFrom(ctx).spend("embedding"); err != nil {
+			return nil, err
+		}
+
+		embeddings = make([][]float32, len(texts))
+		for i, text := range texts {
+			if embeddings[i], err = s.requestSingleEmbedding(ctx, model, i, text); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	dimension := s.config.Ollama.Dimension()
+
+	for i, text := range texts {
+		for attempt := 0; len(embeddings[i]) != dimension; attempt++ {
+			if attempt >= s.config.Ollama.EmbeddingRetries {
+				return nil, fmt.Errorf("invalid embedding for chunk %d (%q): got %d dimensions, want %d",
+					i, previewText(text, 60), len(embeddings[i]), dimension)
+			}
+
+			log.Printf("Embedding for chunk %d has %d dimensions (want %d), retrying", i, len(embeddings[i]), dimension)
+			if err := retryBudgetFrom(ctx).spend("embedding"); err != nil {
+				return nil, err
+			}
+
+			embeddings[i], err = s.requestSingleEmbedding(ctx, model, i, text)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return embeddings, nil
+}
+
+// requestSingleEmbedding embeds the text of chunk i on its own
+func (s *RAGService) requestSingleEmbedding(ctx context.Context, model string, i int, text string) ([]float32, error) {
+	embeddings, err := s.requestEmbeddings(ctx, model, []string{text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed chunk %d: %w", i, err)
+	}
+
+	if len(embeddings) != 1 {
+		return nil, fmt.Errorf("embedding API returned %d embeddings for chunk %d (%q), want 1", len(embeddings), i, previewText(text, 60))
+	}
+
+	return embeddings[0], nil
+}
+
+// applyEmbedPrefix returns texts with the prefix configured for purpose prepended
+func (s *RAGService) applyEmbedPrefix(texts []string, purpose embedPurpose) []string {
+	var prefix string
+	switch purpose {
+	case embedQuery:
+		prefix = s.config.RAG.QueryEmbedPrefix
+	case embedDocument:
+		prefix = s.config.RAG.DocumentEmbedPrefix
+	}
+
+	if prefix == "" {
+		return texts
+	}
 
-type OllamaEmbedRequest struct {
-	Model string   `json:"model"`
-	Input []string `json:"input"`
+	prefixed := make([]string, len(texts))
+	for i, text := range texts {
+		prefixed[i] = prefix + text
+	}
+	return prefixed
 }
 
-type OllamaEmbedResponse struct {
-	Embeddings [][]float32 `json:"embeddings"`
-}
+// requestEmbeddings makes one /api/embed call, bounded by cfg.Ollama.EmbedTimeout
+func (s *RAGService) requestEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	ctx, cancel := context.WithTimeout(ctx, ollamaTimeout(s.config.Ollama.EmbedTimeout, 30*time.Second))
+	defer cancel()
 
-func (s *RAGService) generateEmbeddings(texts []string) ([][]float32, error) {
 	reqBody := OllamaEmbedRequest{
-		Model: s.config.Ollama.EmbeddingModel,
+		Model: model,
 		Input: texts,
 	}
 
 	var result OllamaEmbedResponse
 
+	if err := s.ollamaBreaker.allow(); err != nil {
+		return nil, err
+	}
 	resp, err := s.restClient.R().
+		SetContext(ctx).
 		SetBody(reqBody).
 		SetResult(&result).
 		Post(s.config.Ollama.BaseURL + "/api/embed")
+	s.recordOllamaCall(resp, err)
 
 	if err != nil {
 		return nil, err
@@ -231,6 +1045,82 @@ func (s *RAGService) generateEmbeddings(texts []string) ([][]float32, error) {
 	return result.Embeddings, nil
 }
 
+// previewText shortens text for log and error messages
+func previewText(text string, maxRunes int) string {
+	runes := []rune(text)
+	if len(runes) <= maxRunes {
+		return text
+	}
+	return string(runes[:maxRunes]) + "..."
+}
+
+const (
+	maxEmbedTexts      = 32
+	maxEmbedTextLength = 2000
+
+	embedPurposeQuery    = "query"
+	embedPurposeDocument = "document"
+)
+
+type EmbedRequest struct {
+	Texts   []string `json:"texts"`
+	Purpose string   `json:"purpose,omitempty"` // "query" | "document" (default); picks the configured embed prefix
+}
+
+func (req *EmbedRequest) Validate() error {
+	if len(req.Texts) == 0 {
+		return errors.New("texts cannot be empty")
+	}
+	if len(req.Texts) > maxEmbedTexts {
+		return fmt.Errorf("too many texts (max %d)", maxEmbedTexts)
+	}
+
+	for i, text := range req.Texts {
+		if strings.TrimSpace(text) == "" {
+			return fmt.Errorf("text %d is empty", i)
+		}
+		if len(text) > maxEmbedTextLength {
+			return fmt.Errorf("text %d too long (max %d characters)", i, maxEmbedTextLength)
+		}
+	}
+	if req.Purpose != "" && req.Purpose != embedPurposeQuery && req.Purpose != embedPurposeDocument {
+		return fmt.Errorf("invalid purpose %q (must be %q or %q)", req.Purpose, embedPurposeQuery, embedPurposeDocument)
+	}
+
+	return nil
+}
+
+type EmbedResponse struct {
+	Model      string      `json:"model"`
+	Dimension  int         `json:"dimension"`
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// Embed exposes the ingestion/chat embedding pipeline so clients get vectors
+// compatible with the collection. Texts get the same prefix as ingested chunks
+// unless the request marks them as queries.
+func (s *RAGService) Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse, error) {
+	purpose := embedDocument
+	if req.Purpose == embedPurposeQuery {
+		purpose = embedQuery
+	}
+
+	embeddings, err := s.generateEmbeddings(ctx, req.Texts, purpose)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+
+	if len(embeddings) != len(req.Texts) {
+		return nil, fmt.Errorf("embeddings count mismatch: got %d, want %d", len(embeddings), len(req.Texts))
+	}
+
+	return &EmbedResponse{
+		Model:      s.config.Ollama.EmbeddingModel,
+		Dimension:  len(embeddings[0]),
+		Embeddings: embeddings,
+	}, nil
+}
+
 type ConversationMessage struct {
 	Type    string `json:"type"` // "user" | "assistant"
 	Content string `json:"content"`
@@ -239,6 +1129,29 @@ type ConversationMessage struct {
 type ChatRequest struct {
 	Message             string                `json:"message"`
 	ConversationHistory []ConversationMessage `json:"conversation_history"`
+	TopK                int                   `json:"top_k,omitempty"`           // Overrides cfg.RAG.TopK, clamped to cfg.RAG.MaxTopK
+	Persona             string                `json:"persona,omitempty"`         // One of cfg.Personas; empty uses cfg.RAG.DefaultPersona
+	Source              string                `json:"source,omitempty"`          // Only answer from documents ingested from this source; empty searches all
+	Seed                *int                  `json:"seed,omitempty"`            // Sampling seed for reproducible answers; overrides cfg.Ollama.Seed
+	NoCache             bool                  `json:"no_cache,omitempty"`        // Skip the answer cache lookup (also set by Cache-Control: no-cache)
+	Format              string                `json:"format,omitempty"`          // "json" for a StructuredAnswer in ChatResponse.Structured; empty for prose
+	Audience            string                `json:"audience,omitempty"`        // "child" | "adult" | "expert"; overrides cfg.RAG.ReadingLevel
+	EmbeddingModel      string                `json:"embedding_model,omitempty"` // One of cfg.Ollama.AllowedEmbeddingModels, for experiments
+}
+
+// validateWordLength rejects a message or history entry containing a word
+// longer than cfg.RAG.MaxWordLength
+func (s *RAGService) validateWordLength(req *ChatRequest) error {
+	maxLength := s.config.RAG.MaxWordLength
+	if err := ValidateWordLength(req.Message, maxLength); err != nil {
+		return err
+	}
+	for _, msg := range req.ConversationHistory {
+		if err := ValidateWordLength(msg.Content, maxLength); err != nil {
+			return fmt.Errorf("conversation history: %w", err)
+		}
+	}
+	return nil
 }
 
 // ErrConversationTooLong is returned when conversation history exceeds the maximum allowed length
@@ -261,6 +1174,22 @@ func (req *ChatRequest) Validate() error {
 		return ErrPromptInjection
 	}
 
+	if req.TopK < 0 {
+		return errors.New("top_k must be positive")
+	}
+
+	if req.Source != "" && req.Source != pokemonDBSource && req.Source != pokeAPISource {
+		return fmt.Errorf("invalid source %q (must be %q or %q)", req.Source, pokemonDBSource, pokeAPISource)
+	}
+
+	if req.Format != "" && req.Format != chatFormatJSON {
+		return fmt.Errorf("invalid format %q (must be %q or empty)", req.Format, chatFormatJSON)
+	}
+
+	if _, ok := audienceReadingLevels[req.Audience]; req.Audience != "" && !ok {
+		return fmt.Errorf("invalid audience %q (must be %q, %q or %q)", req.Audience, audienceChild, audienceAdult, audienceExpert)
+	}
+
 	// 4. Validate conversation history length
 	// Frontend sends sliding window of last N turns (max_history_turns * 2 messages)
 	// Allow a bit more (15 messages = ~7 turns) to account for edge cases
@@ -301,102 +1230,517 @@ func (req *ChatRequest) Validate() error {
 }
 
 type ChatResponse struct {
-	Response string `json:"response"`
-	Context  string `json:"context"`
+	Response       string   `json:"response"`
+	Sources        []string `json:"sources"`
+	Context        string   `json:"context"`         // Deprecated: always the question being answered; use ContextChunks for what the answer was built from
+	PokemonNumbers []string `json:"pokemon_numbers"` // National numbers of retrieved Pokemon, best match first
+
+	ContextChunks []ContextChunk `json:"context_chunks"` // Retrieved chunks given to the model, in prompt order
+
+	GenerationFailed bool     `json:"generation_failed,omitempty"` // The model produced no text; Response holds the fallback message
+	UngroundedStats  []string `json:"ungrounded_stats,omitempty"`  // Stat claims whose numbers aren't in the retrieved context (rag.verify_stats)
+	LowConfidence    bool     `json:"low_confidence,omitempty"`    // The best chunk scored below rag.low_confidence_score; Response is hedged
+	Degraded         bool     `json:"degraded,omitempty"`          // The question couldn't be embedded, so context came from keyword search (rag.keyword_fallback)
+
+	Structured       *StructuredAnswer `json:"structured,omitempty"`        // Set for format "json"; Response holds its summary
+	StructuredFailed bool              `json:"structured_failed,omitempty"` // format "json" was requested but the model's output didn't validate; Response holds it as prose
+
+	SourceDetails []SourceDetail `json:"source_details"` // Same Pokemon as Sources, with type styling for the UI
+}
+
+// ContextChunk references one retrieved chunk in the prompt. The first is
+// [1] in the prompt and in rag.inline_citations footers.
+type ContextChunk struct {
+	ID      string  `json:"id"`
+	Pokemon string  `json:"pokemon,omitempty"`
+	Chunk   string  `json:"chunk,omitempty"` // Position within the Pokemon's document, e.g. "2/4"
+	Score   float32 `json:"score"`
+}
+
+// SourceDetail describes a cited Pokemon and its primary type's badge style
+type SourceDetail struct {
+	Pokemon     string `json:"pokemon"`
+	Number      string `json:"number,omitempty"`
+	PrimaryType string `json:"primary_type,omitempty"`
+	types.Style
 }
 
 func (s *RAGService) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	persona, err := s.resolvePersona(req.Persona)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateEmbeddingModel(req.EmbeddingModel); err != nil {
+		return nil, err
+	}
+	if err := s.validateWordLength(req); err != nil {
+		return nil, err
+	}
+
+	// Answers from an empty knowledge base count as chats too
+	chatStart := s.now()
+	defer func() { s.stats.recordChat(s.now().Sub(chatStart)) }()
+
+	if empty, err := s.collection.isEmpty(ctx); err != nil {
+		log.Printf("Warning: failed to count collection points: %v", err)
+	} else if empty {
+		return &ChatResponse{
+			Response:       emptyKnowledgeBaseResponse,
+			Sources:        []string{},
+			Context:        req.Message,
+			PokemonNumbers: []string{},
+			ContextChunks:  []ContextChunk{},
+			SourceDetails:  []SourceDetail{},
+		}, nil
+	}
+
+	timings := chatTimings{start: s.now()}
+	defer func() { s.logChatTimings(ctx, timings) }()
+
 	// Generate embedding for user query
-	embeddings, err := s.generateEmbeddings([]string{req.Message})
+	stageStart := s.now()
+	embeddings, err := s.embedQueries(ctx, req.EmbeddingModel, []string{s.augmentShortQuery(req.Message)})
+	timings.embed = s.now().Sub(stageStart)
+	degraded := false
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+		if !s.canFallBackToKeywords(ctx, err) {
+			return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+		}
+		log.Printf("[request_id=%s] Query embedding failed, falling back to keyword search: %v", RequestIDFromContext(ctx), err)
+		degraded = true
+	}
+
+	// Follow-ups depend on history, so only standalone questions are cacheable
+	// Cached answers were written by the default persona and the configured seed
+	cacheable := !degraded && s.answerCache != nil && len(req.ConversationHistory) == 0 && req.TopK == 0 && req.Persona == "" && req.Source == "" && req.Format == "" && req.Audience == "" && req.EmbeddingModel == "" && req.Seed == nil
+	if cacheable && !req.NoCache {
+		cached, ok := s.answerCache.get(req.Message, embeddings[0])
+		s.stats.recordCacheLookup(ok)
+		if ok {
+			log.Printf("Answer cache hit for %q", req.Message)
+			timings.cached = true
+			cached.Context = req.Message
+			return &cached, nil
+		}
 	}
 
-	// Add timeout
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	// Search for relevant documents. Embedding and generation have their own
+	// timeouts (cfg.Ollama.EmbedTimeout / GenerateTimeout).
+	searchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	// Search for relevant documents
-	searchResults, err := s.vectorRepo.Search(ctx, embeddings[0], s.config.RAG.TopK)
+	searchOpts := repository.SearchOptions{
+		ScoreThreshold: s.config.RAG.ScoreThreshold,
+	}
+	if req.Source != "" {
+		searchOpts.Match = map[string]string{"source": req.Source}
+	}
+	stageStart = s.now()
+	topK := s.resolveTopK(req.TopK)
+	var searchResults []model.SearchResult
+	if degraded {
+		searchResults, err = s.vectorRepo.KeywordSearch(searchCtx, queryKeywords(req.Message), topK, searchOpts)
+	} else {
+		searchResults, err = s.searchWithExpansion(searchCtx, req.Message, req.EmbeddingModel, embeddings[0], s.recencyCandidates(topK), searchOpts)
+	}
+	timings.search = s.now().Sub(stageStart)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search documents: %w", err)
 	}
+	if !degraded {
+		searchResults = s.boostByRecency(searchResults, topK)
+	}
+
+	// A comparison needs both sides' stats, so those chunks lead the context
+	// and are never truncated
+	pinned := 0
+	if compared := s.comparedPokemon(req.Message); compared != nil {
+		searchResults, pinned = s.pinStatChunks(searchCtx, searchResults, compared)
+	}
 
 	// Build RAG context from search results
 	ragContext := s.buildRAGContext(searchResults)
+	pinnedContext := ""
+	if pinned > 0 {
+		pinnedContext = s.buildRAGContext(searchResults[:pinned])
+	}
 
 	// Build prompt with conversation history
-	prompt := s.buildPromptWithHistory(ragContext, req.Message, req.ConversationHistory)
+	style := answerStyle{
+		structured:   req.Format == chatFormatJSON,
+		readingLevel: s.resolveReadingLevel(req.Audience),
+	}
+	prompt := s.buildPromptWithHistory(persona, style, ragContext, pinnedContext, req.Message, s.trimHistory(req.Message, req.ConversationHistory))
+	s.logPrompt(ctx, prompt)
 
 	// Generate response from LLM
-	resp, err := s.generateResponse(prompt)
+	stageStart = s.now()
+	var format any
+	if style.structured {
+		format = s.ollamaFormat()
+	}
+	images := s.contextImages(ctx, searchResults)
+	resp, err := s.generateResponse(ctx, prompt, images, persona.temperature, s.resolveSeed(req.Seed), format)
+	if err == nil && strings.TrimSpace(resp) == "" {
+		log.Printf("[request_id=%s] Model returned an empty response, retrying once", RequestIDFromContext(ctx))
+		resp, err = s.generateResponse(ctx, prompt, images, persona.temperature, s.resolveSeed(req.Seed), format)
+	}
+	timings.generate = s.now().Sub(stageStart)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate response: %w", err)
 	}
 
-	return &ChatResponse{
-		Response: resp,
-		Context:  req.Message, // Store for follow-up questions
-	}, nil
+	var (
+		ungrounded       []string
+		lowConfidence    bool
+		structuredAnswer *StructuredAnswer
+		structuredFailed bool
+	)
+	generationFailed := strings.TrimSpace(resp) == ""
+	if generationFailed {
+		log.Printf("[request_id=%s] Model returned an empty response twice, using fallback", RequestIDFromContext(ctx))
+		resp = s.emptyResponseFallback()
+	} else {
+		if style.structured {
+			structuredAnswer, err = parseStructuredAnswer(resp)
+			if err != nil {
+				log.Printf("[request_id=%s] Structured answer failed validation, returning prose: %v", RequestIDFromContext(ctx), err)
+				structuredFailed = true
+			} else {
+				resp = structuredAnswer.Summary
+			}
+		}
+		resp = s.formatResponse(resp)
+		if mode := s.verifyMode(); mode != verifyOff {
+			ungrounded = ungroundedStats(resp, searchResults)
+			if len(ungrounded) > 0 {
+				log.Printf("[request_id=%s] Answer cites stats not found in context: %s", RequestIDFromContext(ctx), strings.Join(ungrounded, ", "))
+				if mode == verifyCaveat {
+					resp += statCaveat(ungrounded)
+				}
+			}
+		}
+		if lowConfidence = s.isLowConfidence(searchResults); lowConfidence {
+			resp = lowConfidenceHedge + resp
+		}
+		if s.config.RAG.InlineCitations {
+			resp += citationFooter(searchResults)
+		}
+	}
+
+	sources, sourceDetails := s.collectSources(searchResults)
+	chatResp := &ChatResponse{
+		Response:         resp,
+		Sources:          sources,
+		Context:          req.Message,
+		PokemonNumbers:   collectPokemonNumbers(searchResults),
+		ContextChunks:    collectContextChunks(searchResults),
+		Degraded:         degraded,
+		GenerationFailed: generationFailed,
+		UngroundedStats:  ungrounded,
+		LowConfidence:    lowConfidence,
+		Structured:       structuredAnswer,
+		StructuredFailed: structuredFailed,
+		SourceDetails:    sourceDetails,
+	}
+
+	// A bypassed lookup only replaces the cached answer when refresh_on_bypass is set
+	if cacheable && !generationFailed && (!req.NoCache || s.config.AnswerCache.RefreshOnBypass) {
+		s.answerCache.put(req.Message, embeddings[0], *chatResp)
+	}
+
+	return chatResp, nil
+}
+
+// lowConfidenceHedge is prepended to answers built from weakly matching context
+const lowConfidenceHedge = "I'm not certain, but here's what I found:\n\n"
+
+// isLowConfidence reports whether the best search result scored below
+// cfg.RAG.LowConfidenceScore. An empty result set counts as low confidence.
+func (s *RAGService) isLowConfidence(searchResults []model.SearchResult) bool {
+	threshold := s.config.RAG.LowConfidenceScore
+	if threshold <= 0 {
+		return false
+	}
+
+	var best float32
+	for _, result := range searchResults {
+		best = max(best, result.Score)
+	}
+	return best < threshold
+}
+
+// emptyResponseFallback returns the message shown when the model produces no text
+func (s *RAGService) emptyResponseFallback() string {
+	if fallback := strings.TrimSpace(s.config.RAG.EmptyResponseFallback); fallback != "" {
+		return fallback
+	}
+	return "Sorry, I couldn't come up with an answer to that. Please try rephrasing your question." // Default fallback
+}
+
+// chatTimings records how long each Chat stage took. Stages that didn't run stay zero.
+type chatTimings struct {
+	start    time.Time
+	embed    time.Duration
+	search   time.Duration
+	generate time.Duration
+	cached   bool
+}
+
+// logChatTimings logs the per-stage latency breakdown of a chat request
+func (s *RAGService) logChatTimings(ctx context.Context, timings chatTimings) {
+	log.Printf("[request_id=%s] Chat timings: embed_ms=%d search_ms=%d generate_ms=%d total_ms=%d cached=%t",
+		RequestIDFromContext(ctx),
+		timings.embed.Milliseconds(),
+		timings.search.Milliseconds(),
+		timings.generate.Milliseconds(),
+		s.now().Sub(timings.start).Milliseconds(),
+		timings.cached,
+	)
+}
+
+// trimHistory keeps the last cfg.RAG.MaxHistoryTurns turns (two messages each),
+// whatever window the client sent, after collapsing double-submitted messages
+// when cfg.RAG.DedupHistory is on. If question refers back to a Pokemon only
+// named in a dropped message, that message is kept too, ahead of the window.
+// Token-budget truncation in buildPromptWithHistory still applies on top.
+func (s *RAGService) trimHistory(question string, history []ConversationMessage) []ConversationMessage {
+	if s.config.RAG.DedupHistory {
+		history = dedupHistory(history)
+	}
+
+	maxHistoryTurns := s.config.RAG.MaxHistoryTurns
+	if maxHistoryTurns <= 0 {
+		maxHistoryTurns = 5 // Default fallback
+	}
+
+	maxMessages := maxHistoryTurns * 2
+	if len(history) <= maxMessages {
+		return history
+	}
+
+	log.Printf("Trimmed conversation history from %d to %d messages", len(history), maxMessages)
+	kept := history[len(history)-maxMessages:]
+
+	if referent := s.referentIndex(question, history); referent >= 0 && referent < len(history)-maxMessages {
+		log.Printf("Keeping message %d, which names the Pokemon the question refers to", referent)
+		kept = append([]ConversationMessage{s.referentMessage(history[referent])}, kept...)
+	}
+
+	return kept
+}
+
+// dedupHistory collapses runs of consecutive messages with the same type and
+// exactly the same content, as left by a client submitting twice. Anything
+// short of an exact match is kept.
+func dedupHistory(history []ConversationMessage) []ConversationMessage {
+	deduped := make([]ConversationMessage, 0, len(history))
+	for _, msg := range history {
+		if n := len(deduped); n > 0 && deduped[n-1] == msg {
+			continue
+		}
+		deduped = append(deduped, msg)
+	}
+
+	if dropped := len(history) - len(deduped); dropped > 0 {
+		log.Printf("Dropped %d repeated conversation history messages", dropped)
+	}
+	return deduped
+}
+
+// resolveSeed returns the request's seed, else cfg.Ollama.Seed, else nil so
+// Ollama samples randomly
+func (s *RAGService) resolveSeed(requested *int) *int {
+	if requested != nil {
+		return requested
+	}
+	return s.config.Ollama.Seed
+}
+
+// resolveTopK applies a per-request top_k override, bounded by cfg.RAG.MaxTopK
+func (s *RAGService) resolveTopK(requested int) int {
+	if requested <= 0 {
+		return s.config.RAG.TopK
+	}
+
+	maxTopK := s.config.RAG.MaxTopK
+	if maxTopK <= 0 {
+		maxTopK = 20 // Default fallback
+	}
+
+	if requested > maxTopK {
+		log.Printf("Clamped requested top_k from %d to %d", requested, maxTopK)
+		return maxTopK
+	}
+
+	return requested
+}
+
+// collectPokemonNumbers returns the distinct national numbers of the results.
+// Results arrive sorted by score, so the best match comes first.
+func collectPokemonNumbers(searchResults []model.SearchResult) []string {
+	numbers := []string{}
+	seen := make(map[string]bool)
+
+	for _, result := range searchResults {
+		number := result.Metadata["number"]
+		if number == "" || seen[number] {
+			continue
+		}
+		seen[number] = true
+		numbers = append(numbers, number)
+	}
+
+	return numbers
+}
+
+// collectContextChunks references every result, in the order
+// buildRAGContext numbers them
+func collectContextChunks(searchResults []model.SearchResult) []ContextChunk {
+	chunks := make([]ContextChunk, 0, len(searchResults))
+	for _, result := range searchResults {
+		chunks = append(chunks, ContextChunk{
+			ID:      result.ID,
+			Pokemon: result.Metadata["pokemon"],
+			Chunk:   result.Metadata["chunk"],
+			Score:   result.Score,
+		})
+	}
+	return chunks
 }
 
 func (s *RAGService) buildRAGContext(searchResults []model.SearchResult) string {
 	var contextBuilder strings.Builder
-	var sources []string
-	seenSources := make(map[string]bool)
 
 	contextBuilder.WriteString("Context Information:\n\n")
 	for i, result := range searchResults {
 		contextBuilder.WriteString(fmt.Sprintf("[%d] %s\n\n", i+1, result.Content))
+	}
 
-		// Collect unique sources
-		if pokemon, ok := result.Metadata["pokemon"]; ok && pokemon != "" {
-			sourceStr := fmt.Sprintf("Pokemon: %s", pokemon)
-			if !seenSources[sourceStr] {
-				sources = append(sources, sourceStr)
-				seenSources[sourceStr] = true
-			}
+	return contextBuilder.String()
+}
+
+// citationFooter maps the numbered context markers written by buildRAGContext
+// to their Pokemon, e.g. "\n\nSources: [1] Charizard, [2] Blastoise"
+func citationFooter(searchResults []model.SearchResult) string {
+	var citations []string
+	for i, result := range searchResults {
+		if pokemon := result.Metadata["pokemon"]; pokemon != "" {
+			citations = append(citations, fmt.Sprintf("[%d] %s", i+1, pokemon))
 		}
 	}
 
-	return contextBuilder.String()
+	if len(citations) == 0 {
+		return ""
+	}
+	return "\n\nSources: " + strings.Join(citations, ", ")
 }
 
+// collectSources returns the unique Pokemon cited as sources, by their best
+// chunk's score, highest first. A Pokemon is only cited if that chunk scored
+// at least cfg.RAG.CitationThreshold, so weakly related chunks aren't
+// presented as support for the answer, and only the top
+// cfg.RAG.MaxCitedSources are kept when set.
+func (s *RAGService) collectSources(searchResults []model.SearchResult) ([]string, []SourceDetail) {
+	best := make(map[string]model.SearchResult)
+	var order []string
+	for _, result := range searchResults {
+		key := pokename.Key(result.Metadata["pokemon"])
+		if key == "" {
+			continue
+		}
+		current, seen := best[key]
+		if !seen {
+			order = append(order, key)
+		}
+		if !seen || result.Score > current.Score {
+			best[key] = result
+		}
+	}
 
-// buildPromptWithHistory builds the prompt with smart truncation to fit within context window
-// Priority: Instructions > Current Question > Recent History > RAG Context
-func (s *RAGService) buildPromptWithHistory(ragContext, question string, conversationHistory []ConversationMessage) string {
-	// Get max context tokens from config
-	maxContextTokens := s.config.RAG.MaxContextTokens
-	if maxContextTokens == 0 {
-		maxContextTokens = 4000 // Default fallback
+	// Stable, so equal scores keep retrieval order
+	sort.SliceStable(order, func(i, j int) bool {
+		return best[order[i]].Score > best[order[j]].Score
+	})
+
+	sources := []string{}
+	details := []SourceDetail{}
+	for _, key := range order {
+		result := best[key]
+		if result.Score < s.config.RAG.CitationThreshold {
+			continue
+		}
+		if limit := s.config.RAG.MaxCitedSources; limit > 0 && len(sources) == limit {
+			break
+		}
+		sources = append(sources, fmt.Sprintf("Pokemon: %s", result.Metadata["pokemon"]))
+		details = append(details, sourceDetail(result))
 	}
 
+	return sources, details
+}
+
+// sourceDetail builds the UI metadata for a cited result
+func sourceDetail(result model.SearchResult) SourceDetail {
+	detail := SourceDetail{
+		Pokemon: result.Metadata["pokemon"],
+		Number:  result.Metadata["number"],
+	}
+
+	primaryType, _, _ := strings.Cut(result.Metadata["types"], ",")
+	if style, ok := types.StyleFor(primaryType); ok {
+		detail.PrimaryType = strings.TrimSpace(primaryType)
+		detail.Style = style
+	}
+
+	return detail
+}
+
+// buildPromptWithHistory builds the prompt with smart truncation to fit within context window
+// Priority: Instructions > Current Question > Pinned RAG Context > Recent History > RAG Context
+// pinnedContext is a prefix of ragContext that is never truncated ("" for none).
+func (s *RAGService) buildPromptWithHistory(persona persona, style answerStyle, ragContext, pinnedContext, question string, conversationHistory []ConversationMessage) string {
+	maxContextTokens := s.effectiveContextTokens()
+
 	// Define fixed components (highest priority)
-	systemPrompt := "You are a helpful Pokemon expert assistant. Answer questions based on the provided context about Pokemon.\n\n"
-	instructions := "\nInstructions:\n" +
-		"- Answer based on the context above and conversation history\n" +
-		"- Use conversation context to understand references (it, that Pokemon, etc.)\n" +
-		"- Be specific and accurate about Pokemon stats, types, and abilities\n" +
-		"- If comparing Pokemon, use specific numbers when available\n" +
-		"- If the context doesn't contain the information, say so clearly\n" +
-		"- Keep your answer concise but informative\n\n" +
-		"Answer:"
+	systemPrompt := persona.systemPrompt + "\n\n"
+	instructions := s.buildInstructions(persona, style)
 
 	// Count tokens for fixed components (always included)
 	questionWithLabel := fmt.Sprintf("Current Question: %s\n", question)
 	tokensUsed := countTokens(systemPrompt + questionWithLabel + instructions)
 
+	// Compared Pokemon's stats are reserved before anything else can be cut
+	pinnedTokens := countTokens(pinnedContext)
+	tokensUsed += pinnedTokens
+
+	// A follow-up saying "it" needs the message naming the Pokemon, so budget
+	// for that one first (within the rag.referent_tokens allowance)
+	referent := s.referentIndex(question, conversationHistory)
+	var referentMsg ConversationMessage
+	if referent >= 0 {
+		referentMsg = s.referentMessage(conversationHistory[referent])
+		tokensUsed += countTokens(historyLine(referentMsg))
+	}
+
 	// Fit as much recent history as possible (second priority)
 	recentHistory := []ConversationMessage{}
 	historyTruncated := false
+	oldestKept := len(conversationHistory)
 	for i := len(conversationHistory) - 1; i >= 0; i-- {
-		role := "Human"
-		if conversationHistory[i].Type == "assistant" {
-			role = "Assistant"
+		if i == referent {
+			// Within the budget it is kept whole, like any other message
+			reserved := countTokens(historyLine(referentMsg))
+			if whole := countTokens(historyLine(conversationHistory[i])); tokensUsed-reserved+whole <= maxContextTokens {
+				referentMsg = conversationHistory[i]
+				tokensUsed += whole - reserved
+			}
+			recentHistory = append([]ConversationMessage{referentMsg}, recentHistory...)
+			oldestKept = i
+			continue
 		}
-		msgText := fmt.Sprintf("%s: %s\n", role, conversationHistory[i].Content)
-		msgTokens := countTokens(msgText)
+
+		msgTokens := countTokens(historyLine(conversationHistory[i]))
 
 		if tokensUsed+msgTokens > maxContextTokens {
 			historyTruncated = true
@@ -405,6 +1749,11 @@ func (s *RAGService) buildPromptWithHistory(ragContext, question string, convers
 
 		recentHistory = append([]ConversationMessage{conversationHistory[i]}, recentHistory...)
 		tokensUsed += msgTokens
+		oldestKept = i
+	}
+	if referent >= 0 && referent < oldestKept {
+		log.Printf("Keeping message %d despite the token budget, it names the Pokemon the question refers to", referent)
+		recentHistory = append([]ConversationMessage{referentMsg}, recentHistory...)
 	}
 
 	// Calculate remaining tokens for RAG context
@@ -414,7 +1763,12 @@ func (s *RAGService) buildPromptWithHistory(ragContext, question string, convers
 	}
 
 	// Truncate RAG context if needed (lowest priority)
-	truncatedRagContext, ragTruncated := s.truncateToTokens(ragContext, remainingTokens)
+	unpinnedContext := strings.TrimPrefix(ragContext, pinnedContext)
+	truncatedRagContext, ragTruncated := unpinnedContext, false
+	if unpinnedContext != "" {
+		truncatedRagContext, ragTruncated = s.truncateToTokens(unpinnedContext, remainingTokens)
+	}
+	truncatedRagContext = pinnedContext + truncatedRagContext
 
 	// Log truncation for monitoring
 	if historyTruncated {
@@ -423,7 +1777,7 @@ func (s *RAGService) buildPromptWithHistory(ragContext, question string, convers
 	}
 	if ragTruncated {
 		originalTokens := countTokens(ragContext)
-		log.Printf("Truncated RAG context from %d to %d tokens", originalTokens, remainingTokens)
+		log.Printf("Truncated RAG context from %d to %d tokens", originalTokens, pinnedTokens+remainingTokens)
 	}
 
 	// Build final prompt
@@ -449,11 +1803,7 @@ func (s *RAGService) buildPromptWithHistory(ragContext, question string, convers
 			promptBuilder.WriteString("=== Recent Conversation ===\n")
 		}
 		for _, msg := range recentHistory {
-			role := "Human"
-			if msg.Type == "assistant" {
-				role = "Assistant"
-			}
-			promptBuilder.WriteString(fmt.Sprintf("%s: %s\n", role, msg.Content))
+			promptBuilder.WriteString(historyLine(msg))
 		}
 		promptBuilder.WriteString("\n")
 	}
@@ -465,6 +1815,96 @@ func (s *RAGService) buildPromptWithHistory(ragContext, question string, convers
 	return promptBuilder.String()
 }
 
+// historyLine renders a conversation message as a prompt line
+func historyLine(msg ConversationMessage) string {
+	role := "Human"
+	if msg.Type == "assistant" {
+		role = "Assistant"
+	}
+	return fmt.Sprintf("%s: %s\n", role, msg.Content)
+}
+
+// effectiveContextTokens returns cfg.RAG.MaxContextTokens minus the safety
+// margin reserved for miscounted tokens. Our counts come from tiktoken (or a
+// character approximation), not the model's tokenizer, and Ollama silently
+// truncates prompts that overflow.
+func (s *RAGService) effectiveContextTokens() int {
+	maxContextTokens := s.config.RAG.MaxContextTokens
+	if maxContextTokens == 0 {
+		maxContextTokens = 4000 // Default fallback
+	}
+
+	margin := s.config.RAG.TokenSafetyMargin
+	if margin <= 0 && GetTokenizerStatus().Degraded {
+		margin = 0.15 // The character approximation can badly underestimate
+	}
+	margin = min(max(margin, 0), 0.9)
+
+	return int(math.Round(float64(maxContextTokens) * (1 - margin)))
+}
+
+// logPrompt logs the final prompt when cfg.RAG.LogPrompts is on. Prompts carry
+// user messages, so nothing beyond the size is logged otherwise.
+func (s *RAGService) logPrompt(ctx context.Context, prompt string) {
+	requestID := RequestIDFromContext(ctx)
+
+	if !s.config.RAG.LogPrompts {
+		log.Printf("[request_id=%s] Prompt built: %d tokens (content redacted)", requestID, countTokens(prompt))
+		return
+	}
+
+	logged := prompt
+	if maxLength := s.config.RAG.LogPromptMaxLength; maxLength > 0 && len(logged) > maxLength {
+		logged = logged[:maxLength] + "... (truncated)"
+	}
+
+	log.Printf("[request_id=%s] Prompt (%d tokens):\n%s", requestID, countTokens(prompt), logged)
+}
+
+// buildInstructions returns the instruction block, including the persona's
+// instruction and the configured response language and reading level
+func (s *RAGService) buildInstructions(persona persona, style answerStyle) string {
+	var sb strings.Builder
+	sb.WriteString("\nInstructions:\n")
+	sb.WriteString("- Answer based on the context above and conversation history\n")
+	sb.WriteString("- Use conversation context to understand references (it, that Pokemon, etc.)\n")
+	sb.WriteString("- Be specific and accurate about Pokemon stats, types, and abilities\n")
+	sb.WriteString("- If comparing Pokemon, use specific numbers when available\n")
+	sb.WriteString("- If the context doesn't contain the information, say so clearly\n")
+	sb.WriteString("- Keep your answer concise but informative\n")
+	sb.WriteString(s.lengthInstruction())
+
+	if persona.instruction != "" {
+		sb.WriteString(fmt.Sprintf("- %s\n", persona.instruction))
+	}
+
+	language := strings.TrimSpace(s.config.RAG.ResponseLanguage)
+	if language != "" && !strings.EqualFold(language, "English") {
+		sb.WriteString(fmt.Sprintf("- Always answer in %s, even if the question or context is in another language\n", language))
+	}
+
+	if style.structured {
+		sb.WriteString(structuredInstruction)
+	} else if s.config.RAG.ResponseFormat == responseFormatPlain {
+		sb.WriteString("- Write plain sentences without markdown (no bullet lists, headings or bold text)\n")
+	} else {
+		sb.WriteString("- Use markdown: bullet lists for multiple facts and **bold** for Pokemon names\n")
+	}
+
+	switch style.readingLevel {
+	case readingLevelKidFriendly:
+		sb.WriteString("- Use simple words and short sentences that a young child can understand\n")
+		sb.WriteString("- Keep the answer to a few sentences and explain numbers with everyday comparisons (e.g. \"as fast as a race car\")\n")
+	case readingLevelExpert:
+		sb.WriteString("- Assume the reader is an experienced player; use competitive terminology freely\n")
+		sb.WriteString("- Give exact numbers and skip explanations of basic mechanics\n")
+	}
+
+	sb.WriteString("\nAnswer:")
+
+	return sb.String()
+}
+
 // truncateToTokens truncates text to fit within a token budget
 // Returns the truncated text and whether truncation occurred
 func (s *RAGService) truncateToTokens(text string, maxTokens int) (string, bool) {
@@ -523,28 +1963,54 @@ type OllamaChatRequest struct {
 	Prompt  string                 `json:"prompt"`
 	Stream  bool                   `json:"stream"`
 	Options map[string]interface{} `json:"options,omitempty"`
+	Format  any                    `json:"format,omitempty"` // "json" or a JSON schema to constrain the output
+	Images  []string               `json:"images,omitempty"` // Base64-encoded images for vision models
 }
 
 type OllamaChatResponse struct {
 	Response string `json:"response"`
 }
 
-func (s *RAGService) generateResponse(prompt string) (string, error) {
+// generateResponse makes one /api/generate call, bounded by cfg.Ollama.GenerateTimeout
+func (s *RAGService) generateResponse(ctx context.Context, prompt string, images []string, temperature float64, seed *int, format any) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ollamaTimeout(s.config.Ollama.GenerateTimeout, 120*time.Second))
+	defer cancel()
+
 	reqBody := OllamaChatRequest{
 		Model:  s.config.Ollama.ChatModel,
 		Prompt: prompt,
 		Stream: false,
+		Format: format,
+		Images: images,
 		Options: map[string]interface{}{
-			"temperature": 0.3, // Lower temperature for factual responses
+			"temperature": temperature,
 			"top_p":       0.9,
 		},
 	}
 
+	if len(s.config.Ollama.StopSequences) > 0 {
+		reqBody.Options["stop"] = s.config.Ollama.StopSequences
+	}
+
+	if seed != nil {
+		reqBody.Options["seed"] = *seed
+	}
+
+	// Cutting structured output short would leave invalid JSON
+	if n := s.numPredict(); n > 0 && format == nil {
+		reqBody.Options["num_predict"] = n
+	}
+
 	var result OllamaChatResponse
+	if err := s.ollamaBreaker.allow(); err != nil {
+		return "", err
+	}
 	resp, err := s.restClient.R().
+		SetContext(ctx).
 		SetBody(reqBody).
 		SetResult(&result).
 		Post(s.config.Ollama.BaseURL + "/api/generate")
+	s.recordOllamaCall(resp, err)
 
 	if err != nil {
 		return "", err
@@ -554,7 +2020,45 @@ func (s *RAGService) generateResponse(prompt string) (string, error) {
 		return "", fmt.Errorf("chat API returned status %d: %s", resp.StatusCode(), resp.String())
 	}
 
-	return result.Response, nil
+	return trimAtStopSequences(result.Response, s.config.Ollama.StopSequences), nil
+}
+
+// recordOllamaCall reports an Ollama call to the circuit breaker. Transport
+// errors, timeouts and 5xx responses count as failures; a caller that went
+// away says nothing about Ollama's health, so it isn't recorded.
+func (s *RAGService) recordOllamaCall(resp *resty.Response, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	s.ollamaBreaker.record(err != nil || resp.StatusCode() >= http.StatusInternalServerError)
+}
+
+// OllamaRetryAfter returns how long until the circuit breaker next lets a
+// call through to Ollama, or 0 if it is closed
+func (s *RAGService) OllamaRetryAfter() time.Duration {
+	return s.ollamaBreaker.retryAfter()
+}
+
+// ollamaTimeout converts a configured timeout in seconds, falling back to def when unset
+func ollamaTimeout(seconds int, def time.Duration) time.Duration {
+	if seconds <= 0 {
+		return def // Default fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// trimAtStopSequences cuts text at the first stop sequence, in case the model
+// backend did not honor the stop option
+func trimAtStopSequences(text string, stopSequences []string) string {
+	for _, stop := range stopSequences {
+		if stop == "" {
+			continue
+		}
+		if i := strings.Index(text, stop); i >= 0 {
+			text = text[:i]
+		}
+	}
+	return strings.TrimSpace(text)
 }
 
 // Helper function to remove duplicate strings
@@ -0,0 +1,1532 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/katatrina/poke-bot/internal/config"
+	"github.com/katatrina/poke-bot/internal/crawler"
+	"github.com/katatrina/poke-bot/internal/model"
+	"github.com/katatrina/poke-bot/internal/ollamatest"
+	"github.com/katatrina/poke-bot/internal/types"
+	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/protobuf/proto"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// servePokemonDB sends the crawler's pokemondb.net requests to an httptest
+// server serving the crawler's fixture pages, until the test ends
+func servePokemonDB(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	fixtures := httptest.NewServer(http.StripPrefix("/pokedex/", http.FileServer(http.Dir("../crawler/testdata"))))
+	t.Cleanup(fixtures.Close)
+	target, _ := url.Parse(fixtures.URL)
+
+	original := http.DefaultTransport
+	http.DefaultTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Hostname() == "pokemondb.net" {
+			req = req.Clone(req.Context())
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path += ".html"
+		}
+		return original.RoundTrip(req)
+	})
+	t.Cleanup(func() { http.DefaultTransport = original })
+
+	return fixtures
+}
+
+func TestIngestProvidedURLs(t *testing.T) {
+	servePokemonDB(t)
+	env := newTestEnv(t, nil)
+	env.service.sources[pokemonDBSource] = crawler.NewPokemonDBCrawler(env.service.config.Crawler)
+
+	req := &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   []string{"https://pokemondb.net/pokedex/pikachu", "https://pokemondb.net/pokedex/bulbasaur"},
+	}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.service.IngestPokemonData(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored []string
+	for _, point := range env.qdrant.Points("pokemons") {
+		if name := point.Payload["pokemon"].GetStringValue(); !slices.Contains(stored, name) {
+			stored = append(stored, name)
+		}
+	}
+	slices.Sort(stored)
+	if !slices.Equal(stored, []string{"Bulbasaur", "Pikachu"}) {
+		t.Fatalf("stored Pokemon = %v, want Bulbasaur and Pikachu", stored)
+	}
+
+	entry, ok := env.service.knowledgeIndex.Lookup("Pikachu")
+	if !ok || entry.Number != "0025" || !slices.Equal(entry.Types, []string{"Electric"}) {
+		t.Errorf("Pikachu entry = %+v, %v; want number 0025, type Electric", entry, ok)
+	}
+}
+
+func TestIngestRequestRejectsForeignURLs(t *testing.T) {
+	tests := []struct {
+		name string
+		req  IngestRequest
+	}{
+		{"other domain", IngestRequest{Source: pokemonDBSource, URLs: []string{"https://example.com/pokedex/pikachu"}}},
+		{"non-http scheme", IngestRequest{Source: pokemonDBSource, URLs: []string{"file:///etc/passwd"}}},
+		{"pokeapi source", IngestRequest{Source: pokeAPISource, URLs: []string{"https://pokemondb.net/pokedex/pikachu"}}},
+		{"too many", IngestRequest{Source: pokemonDBSource, URLs: slices.Repeat([]string{"https://pokemondb.net/pokedex/pikachu"}, 152)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Validate(); err == nil {
+				t.Error("Validate accepted the request")
+			}
+		})
+	}
+}
+
+func TestIngestProvidedURLsSkipsListCrawl(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(bulbasaur, charmander, squirtle)
+
+	env.ingest(t, "Squirtle")
+
+	if crawled := env.source.crawledURLs(); !slices.Equal(crawled, env.source.urls("Squirtle")) {
+		t.Errorf("crawled %v, want only the provided URL", crawled)
+	}
+	for _, point := range env.qdrant.Points("pokemons") {
+		if name := point.Payload["pokemon"].GetStringValue(); name != "Squirtle" {
+			t.Errorf("stored %s, which wasn't requested", name)
+		}
+	}
+}
+
+func TestTokenizerUnavailableIsReported(t *testing.T) {
+	original := tokenizer
+	tokenizer = nil
+	t.Cleanup(func() { tokenizer = original })
+
+	status := GetTokenizerStatus()
+	if !status.Degraded || status.Mode != "char_approximation" {
+		t.Errorf("status = %+v, want degraded char_approximation", status)
+	}
+	if got := countTokens("sixteen chars ok"); got != 4 {
+		t.Errorf("countTokens fell back to %d tokens, want chars/4 = 4", got)
+	}
+}
+
+func TestTokenizerAvailableIsReported(t *testing.T) {
+	if tokenizer == nil {
+		t.Skip("tiktoken encoding could not be loaded (offline)")
+	}
+
+	if status := GetTokenizerStatus(); status.Degraded || status.Mode != "tiktoken" {
+		t.Errorf("status = %+v, want tiktoken, not degraded", status)
+	}
+}
+
+func TestChatTopKIsClampedAndReachesSearch(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested int
+		wantLimit uint64
+	}{
+		{"default", 0, 5},
+		{"within bound", 3, 3},
+		{"clamped", 100, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.RAG.MaxTopK = 8
+			})
+			env.source.add(pikachu)
+			env.ingest(t, "Pikachu")
+
+			req := &ChatRequest{Message: "What type is Pikachu?", TopK: tt.requested}
+			if err := req.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := env.service.Chat(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+
+			queries := env.qdrant.Queries()
+			if len(queries) == 0 {
+				t.Fatal("no search was made")
+			}
+			if got := queries[0].GetLimit(); got != tt.wantLimit {
+				t.Errorf("search limit = %d, want %d", got, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestChatRequestRejectsNegativeTopK(t *testing.T) {
+	req := &ChatRequest{Message: "What type is Pikachu?", TopK: -1}
+	if err := req.Validate(); err == nil {
+		t.Error("Validate accepted a negative top_k")
+	}
+}
+
+func TestShutdownStopsIngestAtPokemonBoundary(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(bulbasaur, charmander, squirtle, pikachu)
+
+	// Shut down while the third Pokemon is being crawled
+	shutdownErr := make(chan error, 1)
+	env.source.detail = func(ctx context.Context, url string) error {
+		if url == pokemonURL("Squirtle") {
+			go func() { shutdownErr <- env.service.Shutdown(context.Background()) }()
+			<-ctx.Done()
+		}
+		return nil
+	}
+
+	_, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   env.source.urls("Bulbasaur", "Charmander", "Squirtle", "Pikachu"),
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ingest error = %v, want context.Canceled", err)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+
+	if crawled := env.source.crawledURLs(); slices.Contains(crawled, pokemonURL("Pikachu")) {
+		t.Errorf("crawling continued past the shutdown: %v", crawled)
+	}
+
+	// Only the Pokemon finished before the shutdown are stored, each with every chunk
+	chunks := make(map[string]int)
+	totals := make(map[string]string)
+	for _, point := range env.qdrant.Points("pokemons") {
+		name := point.Payload["pokemon"].GetStringValue()
+		chunks[name]++
+		_, total, _ := strings.Cut(point.Payload["chunk"].GetStringValue(), "/")
+		totals[name] = total
+	}
+	if len(chunks) != 2 || chunks["Bulbasaur"] == 0 || chunks["Charmander"] == 0 {
+		t.Fatalf("stored Pokemon = %v, want Bulbasaur and Charmander", chunks)
+	}
+	for name, count := range chunks {
+		if strconv.Itoa(count) != totals[name] {
+			t.Errorf("%s has %d of %s chunks stored", name, count, totals[name])
+		}
+	}
+}
+
+func TestIngestStoresSameTypeNeighbors(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Ingest.RelatedPokemonLimit = 2
+	})
+	env.source.add(
+		bulbasaur,
+		testPokemon("Oddish", "0043", "Grass", "Poison"),
+		testPokemon("Bellsprout", "0069", "Grass", "Poison"),
+		testPokemon("Tangela", "0114", "Grass"),
+		charmander,
+	)
+	env.ingest(t, "Bulbasaur", "Oddish", "Bellsprout", "Tangela", "Charmander")
+
+	want := map[string]string{
+		"Bulbasaur":  "Bellsprout,Oddish",
+		"Oddish":     "Bellsprout,Bulbasaur",
+		"Bellsprout": "Bulbasaur,Oddish",
+		"Tangela":    "Bellsprout,Bulbasaur",
+		"Charmander": "", // No other Fire type was ingested
+	}
+	for _, point := range env.qdrant.Points("pokemons") {
+		name := point.Payload["pokemon"].GetStringValue()
+		if got := point.Payload["same_type_neighbors"].GetStringValue(); got != want[name] {
+			t.Errorf("%s same_type_neighbors = %q, want %q", name, got, want[name])
+		}
+	}
+
+	// Search results carry the neighbors for the UI
+	results, err := env.service.vectorRepo.Search(context.Background(), ollamatest.Embedding("Tangela Grass", testDimension), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 {
+		t.Fatal("search returned nothing")
+	}
+	for _, result := range results {
+		name := result.Metadata["pokemon"]
+		if got := result.Metadata["same_type_neighbors"]; got != want[name] {
+			t.Errorf("%s search result same_type_neighbors = %q, want %q", name, got, want[name])
+		}
+	}
+}
+
+func TestCollectPokemonNumbers(t *testing.T) {
+	results := []model.SearchResult{
+		{Score: 0.9, Metadata: map[string]string{"pokemon": "Pikachu", "number": "0025"}},
+		{Score: 0.8, Metadata: map[string]string{"pokemon": "Raichu", "number": "0026"}},
+		{Score: 0.7, Metadata: map[string]string{"pokemon": "Pikachu", "number": "0025"}},
+		{Score: 0.6, Metadata: map[string]string{"pokemon": "Unknown"}},
+		{Score: 0.5, Metadata: map[string]string{"pokemon": "Pichu", "number": "0172"}},
+	}
+
+	if got, want := collectPokemonNumbers(results), []string{"0025", "0026", "0172"}; !slices.Equal(got, want) {
+		t.Errorf("collectPokemonNumbers = %v, want %v", got, want)
+	}
+	if got := collectPokemonNumbers(nil); got == nil || len(got) != 0 {
+		t.Errorf("collectPokemonNumbers(nil) = %#v, want an empty non-nil slice", got)
+	}
+}
+
+func TestChatReturnsPokemonNumbers(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu, bulbasaur)
+	env.ingest(t, "Pikachu", "Bulbasaur")
+
+	resp := env.chat(t, "Tell me about Pikachu")
+
+	// One number per retrieved Pokemon, in the order their chunks ranked
+	numbers := map[string]string{"Pikachu": "0025", "Bulbasaur": "0001"}
+	var want []string
+	for _, chunk := range resp.ContextChunks {
+		if number := numbers[chunk.Pokemon]; !slices.Contains(want, number) {
+			want = append(want, number)
+		}
+	}
+	if len(want) == 0 {
+		t.Fatal("no chunks were retrieved")
+	}
+	if !slices.Equal(resp.PokemonNumbers, want) {
+		t.Errorf("PokemonNumbers = %v, want %v", resp.PokemonNumbers, want)
+	}
+}
+
+// captureLog redirects the standard logger into a buffer until the test ends
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	original := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(original) })
+
+	return &buf
+}
+
+func TestPromptLoggedOnlyWhenEnabled(t *testing.T) {
+	const question = "Is Pikachu faster than my secret Pokemon Zorbulax?"
+
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("log_prompts=%v", enabled), func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.RAG.LogPrompts = enabled
+			})
+			env.source.add(pikachu)
+			env.ingest(t, "Pikachu")
+
+			logs := captureLog(t)
+			ctx := WithRequestID(context.Background(), "req-42")
+			if _, err := env.service.Chat(ctx, &ChatRequest{Message: question}); err != nil {
+				t.Fatal(err)
+			}
+
+			output := logs.String()
+			if !strings.Contains(output, "[request_id=req-42] Prompt") {
+				t.Errorf("no prompt log line tagged with the request ID:\n%s", output)
+			}
+			if logged := strings.Contains(output, "Zorbulax"); logged != enabled {
+				t.Errorf("prompt content logged = %v, want %v:\n%s", logged, enabled, output)
+			}
+			if !enabled && !strings.Contains(output, "content redacted") {
+				t.Errorf("redacted prompt log line missing:\n%s", output)
+			}
+		})
+	}
+}
+
+func TestLoggedPromptIsTruncated(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.LogPrompts = true
+		cfg.RAG.LogPromptMaxLength = 20
+	})
+
+	logs := captureLog(t)
+	prompt := strings.Repeat("Pikachu ", 10) + "Zorbulax"
+	env.service.logPrompt(context.Background(), prompt)
+
+	output := logs.String()
+	if !strings.Contains(output, prompt[:20]+"... (truncated)") || strings.Contains(output, "Zorbulax") {
+		t.Errorf("prompt not truncated to 20 characters:\n%s", output)
+	}
+}
+
+func TestIngestStartFromBoundaries(t *testing.T) {
+	tests := []struct {
+		name        string
+		startFrom   int
+		wantCrawled []string
+		wantErr     error
+	}{
+		{"from the start", 0, []string{"Bulbasaur", "Charmander", "Squirtle", "Pikachu"}, nil},
+		{"last listed", 3, []string{"Pikachu"}, nil},
+		{"equal to the list length", 4, nil, ErrNothingToIngest},
+		{"past the list end", 10, nil, ErrNothingToIngest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, nil)
+			env.source.add(bulbasaur, charmander, squirtle, pikachu)
+
+			req := &IngestRequest{Source: pokemonDBSource, CrawlLimit: 4, StartFrom: tt.startFrom}
+			if err := req.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			_, err := env.service.IngestPokemonData(context.Background(), req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ingest error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got, want := env.source.crawledURLs(), env.source.urls(tt.wantCrawled...); !slices.Equal(got, want) {
+				t.Errorf("crawled %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestIngestRequestRejectsNegativeStartFrom(t *testing.T) {
+	req := &IngestRequest{Source: pokemonDBSource, StartFrom: -1}
+	if err := req.Validate(); err == nil {
+		t.Error("Validate accepted a negative start_from")
+	}
+}
+
+func TestIngestRefreshListDropsCachedList(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(bulbasaur)
+
+	for _, refresh := range []bool{false, true} {
+		req := &IngestRequest{Source: pokemonDBSource, CrawlLimit: 1, RefreshList: refresh}
+		if _, err := env.service.IngestPokemonData(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if env.source.refreshes != 1 {
+		t.Errorf("list refreshes = %d, want 1 for the refresh_list ingest only", env.source.refreshes)
+	}
+}
+
+func TestStripSectionHeadersOnlyFromEmbeddedText(t *testing.T) {
+	for _, strip := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strip_section_headers=%v", strip), func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.Ingest.StripSectionHeaders = strip
+			})
+			env.source.add(pikachu)
+			env.ingest(t, "Pikachu")
+
+			var embedded []string
+			for _, req := range env.ollama.EmbedRequests() {
+				embedded = append(embedded, req.Input...)
+			}
+
+			points := env.qdrant.Points("pokemons")
+			if len(points) == 0 {
+				t.Fatal("nothing was stored")
+			}
+			headers := 0
+			for _, point := range points {
+				stored := point.Payload["content"].GetStringValue()
+				if strings.Contains(stored, "=== ") {
+					headers++
+				}
+
+				want := stored
+				if strip {
+					want = strings.TrimSpace(sectionHeaderPattern.ReplaceAllString(stored, ""))
+				}
+				if !slices.ContainsFunc(embedded, func(text string) bool { return strings.HasSuffix(text, want) }) {
+					t.Errorf("stored chunk was not embedded as %q", want)
+				}
+			}
+			if headers == 0 {
+				t.Error("stored content lost its section headers")
+			}
+
+			strippedInputs := !slices.ContainsFunc(embedded, func(text string) bool { return strings.Contains(text, "=== ") })
+			if strippedInputs != strip {
+				t.Errorf("embedded text free of section headers = %v, want %v", strippedInputs, strip)
+			}
+		})
+	}
+}
+
+func TestIngestJobTimeoutStopsStalledCrawl(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.KB.Crawler.JobTimeout = 1
+	})
+	env.source.add(bulbasaur, charmander, squirtle, pikachu)
+
+	// Squirtle's page stalls until the job's deadline cuts it off
+	env.source.detail = func(ctx context.Context, url string) error {
+		if url == pokemonURL("Squirtle") {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	start := time.Now()
+	_, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   env.source.urls("Bulbasaur", "Charmander", "Squirtle", "Pikachu"),
+	})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ingest took %s despite a 1s job timeout", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ingest error = %v, want context.DeadlineExceeded", err)
+	}
+	if !strings.Contains(err.Error(), "job timeout of 1s exceeded") || !strings.Contains(err.Error(), "2 success") {
+		t.Errorf("error %q doesn't report the reason and partial results", err)
+	}
+
+	if crawled := env.source.crawledURLs(); slices.Contains(crawled, pokemonURL("Pikachu")) {
+		t.Errorf("crawling continued past the timeout: %v", crawled)
+	}
+	stored := make(map[string]bool)
+	for _, point := range env.qdrant.Points("pokemons") {
+		stored[point.Payload["pokemon"].GetStringValue()] = true
+	}
+	if len(stored) != 2 || !stored["Bulbasaur"] || !stored["Charmander"] {
+		t.Errorf("stored %v, want the Pokemon finished before the timeout", stored)
+	}
+}
+
+func TestWrongTypeMatchupsOnlyWarn(t *testing.T) {
+	env := newTestEnv(t, nil)
+	wrong := *charmander
+	wrong.WeakAgainst = []string{"Grass"} // Fire is weak to Ground, Rock and Water
+	env.source.add(&wrong)
+
+	logs := captureLog(t)
+	env.ingest(t, "Charmander")
+
+	if !strings.Contains(logs.String(), "Warning: Charmander type effectiveness differs from type chart") {
+		t.Errorf("no discrepancy warning logged:\n%s", logs.String())
+	}
+	if len(env.qdrant.Points("pokemons")) == 0 {
+		t.Error("Charmander was not stored despite the discrepancy being only a warning")
+	}
+}
+
+func TestFailedPokemonRecoversOnRetryPass(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Ingest.RetryDelay = 1
+	})
+	env.source.add(bulbasaur, charmander, squirtle)
+
+	// Charmander's page fails once, as if the site hiccupped
+	var attempts int
+	env.source.detail = func(_ context.Context, url string) error {
+		if url == pokemonURL("Charmander") {
+			attempts++
+			if attempts == 1 {
+				return errors.New("connection reset")
+			}
+		}
+		return nil
+	}
+
+	var events []ProgressEvent
+	logs := captureLog(t)
+	_, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source:   pokemonDBSource,
+		URLs:     env.source.urls("Bulbasaur", "Charmander", "Squirtle"),
+		Progress: func(event ProgressEvent) { events = append(events, event) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 2 {
+		t.Errorf("Charmander was attempted %d times, want 2", attempts)
+	}
+	stored := make(map[string]bool)
+	for _, point := range env.qdrant.Points("pokemons") {
+		stored[point.Payload["pokemon"].GetStringValue()] = true
+	}
+	if len(stored) != 3 {
+		t.Errorf("stored %v, want all three Pokemon", stored)
+	}
+
+	last := events[len(events)-1]
+	if !last.Retry || last.Status != ProgressIngested || last.Pokemon != "Charmander" {
+		t.Errorf("last progress event = %+v, want Charmander ingested on retry", last)
+	}
+	if !strings.Contains(logs.String(), "Recovered on retry: Charmander") {
+		t.Errorf("Pokemon recovered on retry not reported:\n%s", logs.String())
+	}
+}
+
+func TestStopSequencesAreSentAndHonored(t *testing.T) {
+	const raw = "Pikachu is an Electric type.\n\nHuman: And Raichu?\nAssistant: Also Electric."
+	stops := []string{"Human:", "\n\nCurrent Question:"}
+
+	tests := []struct {
+		name   string
+		honors bool // Whether the fake model stops itself
+	}{
+		{"model honors stop", true},
+		{"model ignores stop", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.Ollama.StopSequences = stops
+			})
+			env.source.add(pikachu)
+			env.ingest(t, "Pikachu")
+			env.ollama.SetGenerate(func(req ollamatest.GenerateRequest) string {
+				if !tt.honors {
+					return raw
+				}
+				answer := raw
+				stop, _ := req.Options["stop"].([]any)
+				for _, s := range stop {
+					if i := strings.Index(answer, s.(string)); i >= 0 {
+						answer = answer[:i]
+					}
+				}
+				return answer
+			})
+
+			resp := env.chat(t, "What type is Pikachu?")
+
+			requests := env.ollama.GenerateRequests()
+			sent, _ := requests[len(requests)-1].Options["stop"].([]any)
+			if len(sent) != len(stops) || sent[0] != stops[0] || sent[1] != stops[1] {
+				t.Errorf("stop option = %#v, want %q", requests[len(requests)-1].Options["stop"], stops)
+			}
+			if resp.Response != "Pikachu is an Electric type." {
+				t.Errorf("response = %q, want it cut before the invented turn", resp.Response)
+			}
+		})
+	}
+}
+
+func TestOnlyHighScoringPokemonAreCited(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.CitationThreshold = 0.6
+		cfg.RAG.MaxCitedSources = 0
+	})
+
+	results := []model.SearchResult{
+		{Score: 0.9, Metadata: map[string]string{"pokemon": "Pikachu", "number": "0025"}},
+		{Score: 0.55, Metadata: map[string]string{"pokemon": "Raichu", "number": "0026"}},
+		{Score: 0.4, Metadata: map[string]string{"pokemon": "Pichu", "number": "0172"}},
+		{Score: 0.7, Metadata: map[string]string{"pokemon": "Pichu", "number": "0172"}}, // Pichu's best chunk clears the bar
+		{Score: 0.3, Metadata: map[string]string{"pokemon": "Onix", "number": "0095"}},
+	}
+
+	sources, details := env.service.collectSources(results)
+	if want := []string{"Pokemon: Pikachu", "Pokemon: Pichu"}; !slices.Equal(sources, want) {
+		t.Errorf("sources = %v, want %v", sources, want)
+	}
+	if len(details) != 2 || details[1].Pokemon != "Pichu" || details[1].Number != "0172" {
+		t.Errorf("source details = %+v, want Pikachu and Pichu", details)
+	}
+}
+
+func TestCitedSourcesAreCappedInScoreOrder(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.MaxCitedSources = 3
+	})
+
+	// Fused or boosted results needn't arrive in score order
+	names := []string{"Pikachu", "Raichu", "Pichu", "Onix", "Geodude", "Mew", "Eevee", "Snorlax"}
+	scores := []float32{0.62, 0.81, 0.55, 0.74, 0.3, 0.68, 0.45, 0.5}
+	var results []model.SearchResult
+	for i, name := range names {
+		results = append(results, model.SearchResult{Score: scores[i], Metadata: map[string]string{"pokemon": name}})
+	}
+	// A second, better chunk moves Pichu to the top
+	results = append(results, model.SearchResult{Score: 0.9, Metadata: map[string]string{"pokemon": "Pichu"}})
+
+	sources, details := env.service.collectSources(results)
+	if want := []string{"Pokemon: Pichu", "Pokemon: Raichu", "Pokemon: Onix"}; !slices.Equal(sources, want) {
+		t.Errorf("sources = %v, want %v", sources, want)
+	}
+	if len(details) != len(sources) || details[0].Pokemon != "Pichu" {
+		t.Errorf("details = %+v, want one per source in the same order", details)
+	}
+}
+
+func TestChatSourceDetailsCarryPrimaryTypeStyle(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(bulbasaur)
+	env.ingest(t, "Bulbasaur")
+
+	resp := env.chat(t, "Tell me about Bulbasaur")
+	if len(resp.SourceDetails) != 1 {
+		t.Fatalf("source details = %+v, want Bulbasaur only", resp.SourceDetails)
+	}
+
+	// Bulbasaur is Grass/Poison, so the badge uses Grass
+	want := SourceDetail{
+		Pokemon:     "Bulbasaur",
+		Number:      "0001",
+		PrimaryType: "Grass",
+		Style:       types.Style{Color: "#7AC74C", Emoji: "🌿"},
+	}
+	if resp.SourceDetails[0] != want {
+		t.Errorf("source detail = %+v, want %+v", resp.SourceDetails[0], want)
+	}
+}
+
+func TestSourceDetailWithoutKnownTypeHasNoStyle(t *testing.T) {
+	detail := sourceDetail(model.SearchResult{Metadata: map[string]string{"pokemon": "MissingNo", "types": "Bird"}})
+
+	if detail.PrimaryType != "" || detail.Style != (types.Style{}) {
+		t.Errorf("source detail = %+v, want no type styling", detail)
+	}
+}
+
+// truncateEmbeddings makes the fake Ollama return a truncated vector for text
+// the first failures times it is embedded
+func truncateEmbeddings(env *testEnv, text string, failures int) {
+	var mu sync.Mutex
+	env.ollama.SetEmbed(func(input string) []float32 {
+		embedding := ollamatest.Embedding(input, testDimension)
+		if input != text {
+			return embedding
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			return embedding[:testDimension/2]
+		}
+		return embedding
+	})
+}
+
+func TestShortEmbeddingBatchIsReRequestedIndividually(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.ollama.SetEmbedLimit(2)
+
+	texts := []string{"alpha", "beta", "gamma"}
+	embeddings, err := env.service.generateEmbeddings(context.Background(), texts, embedRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every vector is paired with its own input rather than shifted by the gap
+	for i, text := range texts {
+		if want := ollamatest.Embedding(text, testDimension); !slices.Equal(embeddings[i], want) {
+			t.Errorf("embedding %d does not belong to %q", i, text)
+		}
+	}
+
+	requests := env.ollama.EmbedRequests()
+	if len(requests) != 1+len(texts) {
+		t.Fatalf("embed requests = %d, want the batch plus %d single re-requests", len(requests), len(texts))
+	}
+	for i, req := range requests[1:] {
+		if !slices.Equal(req.Input, texts[i:i+1]) {
+			t.Errorf("re-request %d input = %v, want [%s]", i, req.Input, texts[i])
+		}
+	}
+}
+
+func TestMalformedEmbeddingIsRetried(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Ollama.EmbeddingRetries = 2
+	})
+	truncateEmbeddings(env, "beta", 2)
+
+	texts := []string{"alpha", "beta", "gamma"}
+	embeddings, err := env.service.generateEmbeddings(context.Background(), texts, embedRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, embedding := range embeddings {
+		if len(embedding) != testDimension {
+			t.Errorf("embedding %d has %d dimensions, want %d", i, len(embedding), testDimension)
+		}
+	}
+
+	// One batch, then a single-input request per retry of the bad chunk only
+	requests := env.ollama.EmbedRequests()
+	if len(requests) != 3 {
+		t.Fatalf("got %d embed requests, want 3", len(requests))
+	}
+	for _, req := range requests[1:] {
+		if len(req.Input) != 1 || req.Input[0] != "beta" {
+			t.Errorf("retry embedded %q, want only the malformed chunk", req.Input)
+		}
+	}
+}
+
+func TestPersistentlyMalformedEmbeddingNamesChunk(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Ollama.EmbeddingRetries = 1
+	})
+	truncateEmbeddings(env, "beta", 2)
+
+	_, err := env.service.generateEmbeddings(context.Background(), []string{"alpha", "beta", "gamma"}, embedRaw)
+	if err == nil {
+		t.Fatal("expected an error for an embedding that stays malformed")
+	}
+	for _, want := range []string{"chunk 1", `"beta"`, "got 8 dimensions, want 16"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+// fakeClock is a clock for RAGService.now that only moves when advanced
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestChatResponseContextContract(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	// An empty knowledge base still returns an empty list, not null
+	resp := env.chat(t, "What type is Pikachu?")
+	if resp.Context != "What type is Pikachu?" || resp.ContextChunks == nil || len(resp.ContextChunks) != 0 {
+		t.Errorf("empty knowledge base: context = %q, chunks = %v", resp.Context, resp.ContextChunks)
+	}
+
+	env.source.add(pikachu, bulbasaur)
+	env.ingest(t, "Pikachu", "Bulbasaur")
+	resp = env.chat(t, "What type is Pikachu?")
+
+	// Context stays the question; the chunks reference stored points, best first
+	if resp.Context != "What type is Pikachu?" {
+		t.Errorf("context = %q, want the question", resp.Context)
+	}
+	stored := make(map[string]string)
+	for _, point := range env.qdrant.Points("pokemons") {
+		stored[point.GetId().GetUuid()] = point.Payload["pokemon"].GetStringValue()
+	}
+	if len(resp.ContextChunks) == 0 {
+		t.Fatal("no context chunks reported")
+	}
+	for i, chunk := range resp.ContextChunks {
+		if pokemon, ok := stored[chunk.ID]; !ok || pokemon != chunk.Pokemon {
+			t.Errorf("chunk %d = %+v, want a stored point of that Pokemon", i, chunk)
+		}
+		if chunk.Chunk != "1/1" {
+			t.Errorf("chunk %d position = %q, want 1/1", i, chunk.Chunk)
+		}
+		if i > 0 && chunk.Score > resp.ContextChunks[i-1].Score {
+			t.Errorf("chunk %d scores above the one before it", i)
+		}
+	}
+	if resp.ContextChunks[0].Pokemon != "Pikachu" {
+		t.Errorf("best chunk is %s, want Pikachu", resp.ContextChunks[0].Pokemon)
+	}
+}
+
+func TestGenerateRequestsAreNotStreamed(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+	env.chat(t, "What type is Pikachu?")
+
+	// Answers are decoded as one JSON object, which a streamed reply would break
+	for _, req := range env.ollama.GenerateRequests() {
+		if req.Stream == nil || *req.Stream {
+			t.Errorf("generate request streams (stream = %v), want stream: false", req.Stream)
+		}
+	}
+}
+
+func TestChatLogsStageTimings(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	// Each fake backend call moves the clock, so the stages take known times
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	env.service.now = clock.Now
+	env.ollama.SetEmbed(func(text string) []float32 {
+		clock.advance(40 * time.Millisecond)
+		return ollamatest.Embedding(text, testDimension)
+	})
+	var searched time.Duration
+	env.qdrant.SetScore(func(_ map[string]*qdrant.Value, score float32) float32 {
+		clock.advance(7 * time.Millisecond)
+		searched += 7 * time.Millisecond
+		return score
+	})
+	env.ollama.SetGenerate(func(ollamatest.GenerateRequest) string {
+		clock.advance(1200 * time.Millisecond)
+		return ollamatest.DefaultAnswer
+	})
+
+	logs := captureLog(t)
+	ctx := WithRequestID(context.Background(), "req-timings")
+	if _, err := env.service.Chat(ctx, &ChatRequest{Message: "What type is Pikachu?"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if searched == 0 {
+		t.Fatal("search never scored a point")
+	}
+	want := fmt.Sprintf("[request_id=req-timings] Chat timings: embed_ms=40 search_ms=%d generate_ms=1200 total_ms=%d cached=false",
+		searched.Milliseconds(), (40*time.Millisecond + searched + 1200*time.Millisecond).Milliseconds())
+	if !strings.Contains(logs.String(), want) {
+		t.Errorf("log is missing %q:\n%s", want, logs)
+	}
+}
+
+func TestSeedIsForwardedToOllama(t *testing.T) {
+	configSeed, requestSeed := 7, 42
+	tests := []struct {
+		name       string
+		configSeed *int
+		seed       *int
+		want       any // Decoded from JSON, so numbers are float64
+	}{
+		{"unset", nil, nil, nil},
+		{"config", &configSeed, nil, float64(7)},
+		{"request overrides config", &configSeed, &requestSeed, float64(42)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.Ollama.Seed = tt.configSeed
+			})
+			env.source.add(pikachu)
+			env.ingest(t, "Pikachu")
+
+			if _, err := env.service.Chat(context.Background(), &ChatRequest{Message: "What type is Pikachu?", Seed: tt.seed}); err != nil {
+				t.Fatal(err)
+			}
+			requests := env.ollama.GenerateRequests()
+			if got := requests[len(requests)-1].Options["seed"]; got != tt.want {
+				t.Errorf("seed option = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameSeedGivesSameAnswer(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu, charmander)
+	env.ingest(t, "Pikachu", "Charmander")
+
+	// A deterministic model: the answer depends only on the seed and the prompt
+	env.ollama.SetGenerate(func(req ollamatest.GenerateRequest) string {
+		return fmt.Sprintf("seed %v, prompt of %d bytes", req.Options["seed"], len(req.Prompt))
+	})
+
+	seed := 1234
+	chat := func() *ChatResponse {
+		resp, err := env.service.Chat(context.Background(), &ChatRequest{Message: "Is Pikachu faster than Charmander?", Seed: &seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	first, second := chat(), chat()
+
+	if first.Response != second.Response {
+		t.Errorf("responses differ: %q vs %q", first.Response, second.Response)
+	}
+	if !slices.Equal(first.Sources, second.Sources) {
+		t.Errorf("sources differ: %v vs %v", first.Sources, second.Sources)
+	}
+	requests := env.ollama.GenerateRequests()
+	if a, b := requests[len(requests)-2].Prompt, requests[len(requests)-1].Prompt; a != b {
+		t.Errorf("prompts differ for identical requests:\n%s\n---\n%s", a, b)
+	}
+}
+
+func TestTokenSafetyMarginReducesBudget(t *testing.T) {
+	defaultMargin := 0
+	if GetTokenizerStatus().Degraded {
+		defaultMargin = 600 // The character approximation reserves 15% on its own
+	}
+
+	tests := []struct {
+		margin float64
+		want   int
+	}{
+		{0, 4000 - defaultMargin},
+		{0.15, 3400},
+		{0.5, 2000},
+		{2, 400}, // Capped so some budget is always left
+	}
+
+	for _, tt := range tests {
+		env := newTestEnv(t, func(cfg *config.Config) {
+			cfg.RAG.MaxContextTokens = 4000
+			cfg.RAG.TokenSafetyMargin = tt.margin
+		})
+		if got := env.service.effectiveContextTokens(); got != tt.want {
+			t.Errorf("margin %v: effective budget = %d, want %d", tt.margin, got, tt.want)
+		}
+	}
+}
+
+func TestTokenSafetyMarginShrinksPrompt(t *testing.T) {
+	ragContext := strings.Repeat("Pikachu stores electricity in its cheeks. ", 200)
+
+	promptTokens := func(margin float64) int {
+		env := newTestEnv(t, func(cfg *config.Config) {
+			cfg.RAG.MaxContextTokens = 1000
+			cfg.RAG.TokenSafetyMargin = margin
+		})
+		persona, err := env.service.resolvePersona("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return countTokens(env.service.buildPromptWithHistory(persona, answerStyle{}, ragContext, "", "What type is Pikachu?", nil))
+	}
+
+	// Truncation is by whole sections, so allow a little slack over the budget
+	loose, reserved := promptTokens(0), promptTokens(0.5)
+	if reserved > 525 {
+		t.Errorf("prompt with a 50%% margin has %d tokens, want about 500", reserved)
+	}
+	if reserved*3 > loose*2 {
+		t.Errorf("the margin barely shrank the prompt: %d tokens vs %d", reserved, loose)
+	}
+}
+
+func TestEmbedPrefixesDependOnCallType(t *testing.T) {
+	const (
+		queryPrefix    = "query: "
+		documentPrefix = "passage: "
+	)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.QueryEmbedPrefix = queryPrefix
+		cfg.RAG.DocumentEmbedPrefix = documentPrefix
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	ingested := env.ollama.EmbedRequests()
+	if len(ingested) == 0 {
+		t.Fatal("ingest sent no embed requests")
+	}
+	for _, req := range ingested {
+		for _, input := range req.Input {
+			if !strings.HasPrefix(input, documentPrefix) || strings.HasPrefix(input, documentPrefix+queryPrefix) {
+				t.Errorf("ingested chunk embedded as %q, want only the document prefix", previewText(input, 40))
+			}
+		}
+	}
+	// The prefix is only for the embedding model, not the stored text
+	for _, point := range env.qdrant.Points("pokemons") {
+		if content := point.GetPayload()["content"].GetStringValue(); strings.HasPrefix(content, documentPrefix) {
+			t.Errorf("stored content carries the prefix: %q", previewText(content, 40))
+		}
+	}
+
+	env.chat(t, "What type is Pikachu?")
+	queries := env.ollama.EmbedRequests()[len(ingested):]
+	if len(queries) == 0 {
+		t.Fatal("chat sent no embed requests")
+	}
+	for _, req := range queries {
+		for _, input := range req.Input {
+			if !strings.HasPrefix(input, queryPrefix) {
+				t.Errorf("query embedded as %q, want the query prefix", input)
+			}
+		}
+	}
+
+	// The /embed endpoint matches ingest unless told the texts are queries
+	for _, tt := range []struct {
+		purpose string
+		want    string
+	}{
+		{"", documentPrefix + "Pikachu"},
+		{"document", documentPrefix + "Pikachu"},
+		{"query", queryPrefix + "Pikachu"},
+	} {
+		req := &EmbedRequest{Texts: []string{"Pikachu"}, Purpose: tt.purpose}
+		if err := req.Validate(); err != nil {
+			t.Fatalf("purpose %q: %v", tt.purpose, err)
+		}
+		if _, err := env.service.Embed(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		requests := env.ollama.EmbedRequests()
+		if got := requests[len(requests)-1].Input; !slices.Equal(got, []string{tt.want}) {
+			t.Errorf("purpose %q embedded %q, want %q", tt.purpose, got, tt.want)
+		}
+	}
+	if err := (&EmbedRequest{Texts: []string{"Pikachu"}, Purpose: "passage"}).Validate(); err == nil {
+		t.Error("an unknown purpose was accepted")
+	}
+}
+
+func TestReembedRecomputesStoredVectors(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu, charmander)
+	env.ingest(t, "Pikachu", "Charmander")
+
+	before := env.qdrant.Points("pokemons")
+	crawled := len(env.source.crawledURLs())
+
+	// Switch to a "new model" that embeds the same text differently
+	newModel := func(text string) []float32 {
+		return ollamatest.Embedding("new model "+text, testDimension)
+	}
+	env.ollama.SetEmbed(newModel)
+
+	result, err := env.service.ReembedCollection(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Documents != len(before) {
+		t.Errorf("re-embedded %d documents, want %d", result.Documents, len(before))
+	}
+	if got := len(env.source.crawledURLs()); got != crawled {
+		t.Errorf("re-embedding crawled %d more pages, want none", got-crawled)
+	}
+	if env.qdrant.Calls("DeleteCollection") == 0 {
+		t.Error("the collection was not recreated")
+	}
+
+	after := env.qdrant.Points("pokemons")
+	if len(after) != len(before) {
+		t.Fatalf("got %d points after re-embedding, want %d", len(after), len(before))
+	}
+	for i, point := range after {
+		if point.GetId().GetUuid() != before[i].GetId().GetUuid() {
+			t.Errorf("point %d changed ID", i)
+		}
+		if !proto.Equal(&qdrant.Struct{Fields: point.GetPayload()}, &qdrant.Struct{Fields: before[i].GetPayload()}) {
+			t.Errorf("point %d payload changed", i)
+		}
+
+		content := point.GetPayload()["content"].GetStringValue()
+		got := point.GetVectors().GetVector().GetDense().GetData()
+		if !slices.Equal(got, newModel(content)) {
+			t.Errorf("point %d vector was not recomputed from its content", i)
+		}
+	}
+}
+
+func TestEmptyGenerationIsRetriedThenFallsBack(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.EmptyResponseFallback = "No answer this time, please ask again."
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	env.ollama.SetGenerate(func(ollamatest.GenerateRequest) string { return " \n\t" })
+
+	resp := env.chat(t, "What type is Pikachu?")
+	if resp.Response != "No answer this time, please ask again." || !resp.GenerationFailed {
+		t.Errorf("response = %q, generation_failed = %t, want the fallback flagged as failed", resp.Response, resp.GenerationFailed)
+	}
+	if got := len(env.ollama.GenerateRequests()); got != 2 {
+		t.Errorf("sent %d generate requests, want 2 (one retry)", got)
+	}
+}
+
+func TestEmptyGenerationRecoversOnRetry(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	calls := 0
+	env.ollama.SetGenerate(func(ollamatest.GenerateRequest) string {
+		calls++
+		if calls == 1 {
+			return ""
+		}
+		return ollamatest.DefaultAnswer
+	})
+
+	resp := env.chat(t, "What type is Pikachu?")
+	if resp.Response != ollamatest.DefaultAnswer || resp.GenerationFailed {
+		t.Errorf("response = %q, generation_failed = %t, want the retried answer", resp.Response, resp.GenerationFailed)
+	}
+}
+
+func TestEmptyGenerationDefaultFallback(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	env.ollama.SetGenerate(func(ollamatest.GenerateRequest) string { return "" })
+
+	if resp := env.chat(t, "What type is Pikachu?"); resp.Response != env.service.emptyResponseFallback() || resp.Response == "" {
+		t.Errorf("response = %q, want the built-in fallback", resp.Response)
+	}
+}
+
+func TestIngestStoresNumericMeasurements(t *testing.T) {
+	env := newTestEnv(t, nil)
+	snorlax := testPokemon("Snorlax", "0143", "Normal")
+	snorlax.Height, snorlax.HeightM = "2.1 m (6′11″)", 2.1
+	snorlax.Weight, snorlax.WeightKg = "460.0 kg (1014.1 lbs)", 460
+	env.source.add(snorlax)
+	env.ingest(t, "Snorlax")
+
+	for _, point := range env.qdrant.Points("pokemons") {
+		payload := point.GetPayload()
+		if got := payload["height_m"].GetDoubleValue(); got != 2.1 {
+			t.Errorf("height_m = %v, want 2.1", payload["height_m"])
+		}
+		if got := payload["weight_kg"].GetDoubleValue(); got != 460 {
+			t.Errorf("weight_kg = %v, want 460", payload["weight_kg"])
+		}
+	}
+}
+
+func TestInlineCitationsMatchContextNumbering(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.InlineCitations = true
+	})
+	env.source.add(charmander, squirtle)
+	env.ingest(t, "Charmander", "Squirtle")
+
+	resp := env.chat(t, "Is Charmander or Squirtle better against Fire types?")
+	prompt := env.lastPrompt(t)
+
+	footer, ok := strings.CutPrefix(resp.Response, ollamatest.DefaultAnswer+"\n\nSources: ")
+	if !ok {
+		t.Fatalf("response lacks a sources footer: %q", resp.Response)
+	}
+
+	citations := strings.Split(footer, ", ")
+	if len(citations) != len(resp.ContextChunks) {
+		t.Errorf("got %d citations for %d context entries: %q", len(citations), len(resp.ContextChunks), footer)
+	}
+	for i, citation := range citations {
+		want := fmt.Sprintf("[%d] %s", i+1, resp.ContextChunks[i].Pokemon)
+		if citation != want {
+			t.Errorf("citation %d = %q, want %q", i+1, citation, want)
+		}
+
+		// The numbered context entry the citation points at is about that Pokemon
+		marker := fmt.Sprintf("[%d] ", i+1)
+		start := strings.Index(prompt, marker)
+		if start < 0 {
+			t.Errorf("prompt has no context entry %s", marker)
+			continue
+		}
+		entry := prompt[start+len(marker):]
+		if end := strings.Index(entry, fmt.Sprintf("\n[%d] ", i+2)); end >= 0 {
+			entry = entry[:end]
+		}
+		if !strings.Contains(entry, resp.ContextChunks[i].Pokemon) {
+			t.Errorf("context entry %s does not mention %s", marker, resp.ContextChunks[i].Pokemon)
+		}
+	}
+}
+
+func TestInlineCitationsOffByDefault(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(charmander)
+	env.ingest(t, "Charmander")
+
+	if resp := env.chat(t, "What type is Charmander?"); strings.Contains(resp.Response, "Sources:") {
+		t.Errorf("response has a sources footer without inline_citations: %q", resp.Response)
+	}
+}
+
+func TestOllamaStartupCheck(t *testing.T) {
+	// A closed server leaves a port nothing listens on
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name      string
+		reachable bool
+		models    []string
+		require   bool
+		wantErr   bool
+		wantWarn  string
+	}{
+		{"healthy", true, []string{"test-chat:latest", "test-embed"}, true, false, ""},
+		{"unreachable warns", false, nil, false, false, "failed to reach"},
+		{"unreachable is fatal when required", false, nil, true, true, ""},
+		{"missing model warns", true, []string{"test-chat"}, false, false, "models not pulled: test-embed"},
+		{"missing model is fatal when required", true, []string{"test-chat"}, true, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.Ollama.RequireOnStartup = tt.require
+			})
+			env.ollama.SetModels(tt.models...)
+			if !tt.reachable {
+				env.service.config.Ollama.BaseURL = unreachable.URL
+			}
+
+			logs := captureLog(t)
+			err := env.service.CheckOllamaOnStartup(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %t", err, tt.wantErr)
+			}
+
+			warned := strings.Contains(logs.String(), "Warning: Ollama is unavailable")
+			if warned != (tt.wantWarn != "") || !strings.Contains(logs.String(), tt.wantWarn) {
+				t.Errorf("log = %q, want warning %q", logs, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestChunkSections(t *testing.T) {
+	chunks := []string{
+		"Pokemon: Pikachu\n\n=== Basic Information ===\nType: Electric\n\n=== Base Stats ===\nHP: 35",
+		"Attack: 55\nSpeed: 90\n\n=== Type Effectiveness ===\nWeak to: Ground",
+		"=== Quick Facts ===\n- Pikachu is an Electric type Pokemon",
+		"- Highest stat: Speed (90)",
+	}
+
+	want := [][]string{
+		{"Basic Information", "Base Stats"},
+		{"Base Stats", "Type Effectiveness"}, // Continues the previous chunk's section
+		{"Quick Facts"},                      // Starts on a header, so nothing carries over
+		{"Quick Facts"},
+	}
+	got := chunkSections(chunks)
+	for i := range want {
+		if !slices.Equal(got[i], want[i]) {
+			t.Errorf("chunk %d sections = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestIngestRendersConfiguredContentTemplate(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Ingest.ContentTemplate = `{{.Name}} is a {{join .Types "/"}} type Pokemon.`
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	points := env.qdrant.Points("pokemons")
+	if len(points) != 1 {
+		t.Fatalf("stored %d points, want 1", len(points))
+	}
+	if got := points[0].Payload["content"].GetStringValue(); !strings.HasSuffix(got, "Pikachu is a Electric type Pokemon.") {
+		t.Errorf("content = %q, want the custom template's text", got)
+	}
+}
+
+func TestNewRAGServiceRejectsInvalidContentTemplate(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Ingest.ContentTemplate = "{{.Nickname}}"
+
+	if _, err := NewRAGService(cfg, nil, nil); err == nil || !strings.Contains(err.Error(), "content_template") {
+		t.Errorf("err = %v, want the invalid content_template reported", err)
+	}
+}
+
+func TestIngestStoresChunkSections(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	var multiSection bool
+	for _, point := range env.qdrant.Points("pokemons") {
+		sections := point.GetPayload()["sections"].GetStringValue()
+		if sections == "" {
+			t.Errorf("chunk %s has no sections", point.GetPayload()["chunk"].GetStringValue())
+		}
+		if strings.Contains(sections, ",") {
+			multiSection = true
+		}
+	}
+	if !multiSection {
+		t.Error("no chunk lists more than one section")
+	}
+}
+
+func TestOllamaCallsUseTheirOwnTimeouts(t *testing.T) {
+	const delay = 1500 * time.Millisecond // Longer than a 1s timeout, well within 5s
+
+	tests := []struct {
+		name                          string
+		embedTimeout, generateTimeout int
+		wantEmbedErr, wantGenerateErr bool
+	}{
+		{"slow embedding times out", 1, 5, true, false},
+		{"slow generation times out", 5, 1, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.Ollama.EmbedTimeout = tt.embedTimeout
+				cfg.Ollama.GenerateTimeout = tt.generateTimeout
+			})
+			env.ollama.SetEmbed(func(text string) []float32 {
+				time.Sleep(delay)
+				return ollamatest.Embedding(text, testDimension)
+			})
+			env.ollama.SetGenerate(func(ollamatest.GenerateRequest) string {
+				time.Sleep(delay)
+				return ollamatest.DefaultAnswer
+			})
+
+			start := time.Now()
+			_, err := env.service.generateEmbeddings(context.Background(), []string{"Pikachu"}, embedRaw)
+			if (err != nil) != tt.wantEmbedErr {
+				t.Errorf("embedding error = %v, want error %t", err, tt.wantEmbedErr)
+			}
+			if tt.wantEmbedErr && time.Since(start) >= delay {
+				t.Errorf("embedding gave up after %s, want about %ds", time.Since(start), tt.embedTimeout)
+			}
+
+			start = time.Now()
+			_, err = env.service.generateResponse(context.Background(), "What type is Pikachu?", nil, 0.3, nil, nil)
+			if (err != nil) != tt.wantGenerateErr {
+				t.Errorf("generation error = %v, want error %t", err, tt.wantGenerateErr)
+			}
+			if tt.wantGenerateErr && time.Since(start) >= delay {
+				t.Errorf("generation gave up after %s, want about %ds", time.Since(start), tt.generateTimeout)
+			}
+		})
+	}
+}
+
+func TestIngestReplacesInvalidUTF8(t *testing.T) {
+	env := newTestEnv(t, nil)
+	garbled := testPokemon("Flabebe", "0669", "Fairy")
+	garbled.Description = "Flabebe \xe9\xff rides on a flower."
+	env.source.add(garbled)
+	env.ingest(t, "Flabebe")
+
+	points := env.qdrant.Points("pokemons")
+	if len(points) == 0 {
+		t.Fatal("nothing was stored")
+	}
+	found := false
+	for _, p := range points {
+		content := p.GetPayload()["content"].GetStringValue()
+		if !utf8.ValidString(content) {
+			t.Errorf("stored content %q is not valid UTF-8", content)
+		}
+		found = found || strings.Contains(content, "Flabebe � rides on a flower.")
+	}
+	if !found {
+		t.Error("no chunk holds the description with the invalid bytes replaced")
+	}
+	for _, req := range env.ollama.EmbedRequests() {
+		for _, input := range req.Input {
+			if !utf8.ValidString(input) {
+				t.Errorf("embedded invalid UTF-8 %q", input)
+			}
+		}
+	}
+}
+
+func TestLowScoringAnswersAreHedged(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold float32
+		score     float32
+		wantLow   bool
+	}{
+		{"below threshold", 0.5, 0.3, true},
+		{"above threshold", 0.5, 0.9, false},
+		{"disabled", 0, 0.3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.RAG.LowConfidenceScore = tt.threshold
+			})
+			env.source.add(pikachu)
+			env.ingest(t, "Pikachu")
+			env.qdrant.SetScore(func(map[string]*qdrant.Value, float32) float32 { return tt.score })
+
+			resp := env.chat(t, "What type is Pikachu?")
+			if resp.LowConfidence != tt.wantLow {
+				t.Errorf("low_confidence = %v, want %v", resp.LowConfidence, tt.wantLow)
+			}
+			if hedged := strings.HasPrefix(resp.Response, lowConfidenceHedge); hedged != tt.wantLow {
+				t.Errorf("response = %q, hedged = %v, want %v", resp.Response, hedged, tt.wantLow)
+			}
+			if !strings.Contains(resp.Response, ollamatest.DefaultAnswer) {
+				t.Errorf("response = %q, want the model's answer kept", resp.Response)
+			}
+		})
+	}
+}
+
+func TestIngestReportsEmptyListSeparatelyFromFailures(t *testing.T) {
+	t.Run("empty list", func(t *testing.T) {
+		env := newTestEnv(t, nil)
+
+		_, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{Source: pokemonDBSource, CrawlLimit: 10})
+		if !errors.Is(err, ErrNoPokemonListed) || errors.Is(err, ErrAllPokemonFailed) {
+			t.Errorf("ingest error = %v, want %v", err, ErrNoPokemonListed)
+		}
+	})
+
+	t.Run("all failed", func(t *testing.T) {
+		env := newTestEnv(t, func(cfg *config.Config) {
+			cfg.Ingest.RetryDelay = 1
+		})
+		env.source.add(bulbasaur, charmander)
+		env.source.detail = func(context.Context, string) error {
+			return errors.New("unexpected page layout")
+		}
+
+		_, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{Source: pokemonDBSource, CrawlLimit: 10})
+		if !errors.Is(err, ErrAllPokemonFailed) || errors.Is(err, ErrNoPokemonListed) {
+			t.Errorf("ingest error = %v, want %v", err, ErrAllPokemonFailed)
+		}
+		if err != nil && !strings.Contains(err.Error(), "2 of 2 failed") {
+			t.Errorf("ingest error = %v, want the failure count", err)
+		}
+	})
+}
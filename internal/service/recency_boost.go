@@ -0,0 +1,109 @@
+package service
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/katatrina/poke-bot/internal/model"
+	"github.com/katatrina/poke-bot/internal/repository"
+)
+
+const (
+	recencyBoostNone       = "none"
+	recencyBoostNewerFirst = "newer_first"
+	recencyBoostOlderFirst = "older_first"
+)
+
+// generationLastNumbers holds the last National number of each generation
+var generationLastNumbers = []int64{151, 251, 386, 493, 649, 721, 809, 905, 1025}
+
+// generationForNumber returns the generation that introduced National number n,
+// or 0 if n is out of range
+func generationForNumber(n int64) int {
+	if n <= 0 {
+		return 0
+	}
+	for i, last := range generationLastNumbers {
+		if n <= last {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// resultGeneration reads a search result's generation from its payload,
+// deriving it from the National number for points stored without one
+func resultGeneration(result model.SearchResult) int {
+	if generation, ok := result.Fields["generation"].(int64); ok && generation > 0 {
+		return int(generation)
+	}
+	if n, ok := result.Fields["number_int"].(int64); ok {
+		return generationForNumber(n)
+	}
+	n, _ := repository.ParseNationalNumber(result.Metadata["number"])
+	return generationForNumber(n)
+}
+
+// recencyBoostPolicy returns cfg.RAG.RecencyBoost, defaulting to none
+func (s *RAGService) recencyBoostPolicy() string {
+	switch policy := strings.ToLower(strings.TrimSpace(s.config.RAG.RecencyBoost)); policy {
+	case recencyBoostNewerFirst, recencyBoostOlderFirst:
+		return policy
+	default:
+		return recencyBoostNone // Default fallback
+	}
+}
+
+// recencyCandidates returns how many results to fetch so that boosting has
+// results beyond topK to promote
+func (s *RAGService) recencyCandidates(topK int) int {
+	if s.recencyBoostPolicy() == recencyBoostNone {
+		return topK
+	}
+	return topK * 2
+}
+
+// boostByRecency reorders results by similarity plus a bonus of up to
+// cfg.RAG.RecencyBoostWeight for the newest (or oldest) generation, then keeps
+// the topK best. Reported scores are unchanged, so thresholds still apply to
+// similarity alone. Results of unknown generation get no bonus.
+func (s *RAGService) boostByRecency(results []model.SearchResult, topK int) []model.SearchResult {
+	policy := s.recencyBoostPolicy()
+	if policy == recencyBoostNone {
+		return results
+	}
+
+	weight := s.config.RAG.RecencyBoostWeight
+	if weight <= 0 {
+		weight = 0.05 // Default fallback
+	}
+
+	latest := len(generationLastNumbers)
+	boosted := make([]float32, len(results))
+	for i, result := range results {
+		boosted[i] = result.Score
+
+		generation := resultGeneration(result)
+		if generation == 0 {
+			continue
+		}
+		steps := generation - 1 // Generations after the first
+		if policy == recencyBoostOlderFirst {
+			steps = latest - generation
+		}
+		boosted[i] += weight * float32(steps) / float32(latest-1)
+	}
+
+	order := make([]int, len(results))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return boosted[order[i]] > boosted[order[j]] })
+
+	reordered := make([]model.SearchResult, 0, min(len(results), topK))
+	for _, i := range order[:min(len(order), topK)] {
+		reordered = append(reordered, results[i])
+	}
+
+	return reordered
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+	"github.com/katatrina/poke-bot/internal/model"
+)
+
+func TestBoostByRecencyReordersPerPolicy(t *testing.T) {
+	// Generation comes from the stored field, number_int, or the number string
+	results := []model.SearchResult{
+		{Score: 0.80, Metadata: map[string]string{"pokemon": "Bulbasaur"}, Fields: map[string]any{"generation": int64(1)}},
+		{Score: 0.79, Metadata: map[string]string{"pokemon": "Heatran"}, Fields: map[string]any{"number_int": int64(485)}},
+		{Score: 0.78, Metadata: map[string]string{"pokemon": "Sprigatito", "number": "0906"}},
+		{Score: 0.775, Metadata: map[string]string{"pokemon": "Pikachu", "number": "0025"}},
+	}
+
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{"none", []string{"Bulbasaur", "Heatran", "Sprigatito", "Pikachu"}}, // Untouched, not truncated
+		{"", []string{"Bulbasaur", "Heatran", "Sprigatito", "Pikachu"}},
+		{"newer_first", []string{"Sprigatito", "Heatran", "Bulbasaur"}},
+		{"older_first", []string{"Bulbasaur", "Pikachu", "Heatran"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.RAG.RecencyBoost = tt.policy
+				cfg.RAG.RecencyBoostWeight = 0.05
+			})
+
+			var got []string
+			for _, result := range env.service.boostByRecency(results, 3) {
+				got = append(got, result.Metadata["pokemon"])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBoostByRecencyKeepsScores(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.RecencyBoost = recencyBoostNewerFirst
+	})
+
+	results := env.service.boostByRecency([]model.SearchResult{
+		{Score: 0.5, Metadata: map[string]string{"number": "0001"}},
+		{Score: 0.49, Metadata: map[string]string{"number": "1000"}},
+	}, 2)
+	if results[0].Score != 0.49 || results[1].Score != 0.5 {
+		t.Errorf("scores = %v, %v, want the similarity scores unchanged", results[0].Score, results[1].Score)
+	}
+}
+
+func TestRecencyCandidates(t *testing.T) {
+	for policy, want := range map[string]int{recencyBoostNone: 5, recencyBoostNewerFirst: 10, recencyBoostOlderFirst: 10} {
+		env := newTestEnv(t, func(cfg *config.Config) {
+			cfg.RAG.RecencyBoost = policy
+		})
+		if got := env.service.recencyCandidates(5); got != want {
+			t.Errorf("%s: candidates = %d, want %d", policy, got, want)
+		}
+	}
+}
+
+func TestGenerationForNumber(t *testing.T) {
+	tests := []struct {
+		number int64
+		want   int
+	}{
+		{0, 0},
+		{1, 1},
+		{151, 1},
+		{152, 2},
+		{493, 4},
+		{906, 9},
+		{1025, 9},
+		{1026, 0},
+	}
+
+	for _, tt := range tests {
+		if got := generationForNumber(tt.number); got != tt.want {
+			t.Errorf("generationForNumber(%d) = %d, want %d", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestIngestStoresGeneration(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	for _, point := range env.qdrant.Points("pokemons") {
+		if got := point.Payload["generation"].GetIntegerValue(); got != 1 {
+			t.Errorf("generation = %d, want 1 derived from #0025", got)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/katatrina/poke-bot/internal/pokename"
+	"github.com/katatrina/poke-bot/internal/repository"
+)
+
+// ErrUnknownRole is returned when a recommendation names a role that isn't configured
+var ErrUnknownRole = errors.New("unknown role")
+
+// statFields maps base stat names, as crawled, to their numeric payload fields
+var statFields = map[string]string{
+	"HP":        "stat_hp",
+	"Attack":    "stat_attack",
+	"Defense":   "stat_defense",
+	"SpAttack":  "stat_sp_attack",
+	"SpDefense": "stat_sp_defense",
+	"Speed":     "stat_speed",
+}
+
+// defaultRoles are used when cfg.Roles is empty
+var defaultRoles = map[string][]string{
+	"tank":    {"HP", "Defense", "SpDefense"},
+	"sweeper": {"Attack|SpAttack", "Speed"},
+}
+
+// roleFormula scores a Pokemon as the sum of its terms, each term being the
+// highest of one or more base stats ("Attack|SpAttack" suits either kind of
+// attacker)
+type roleFormula [][]string
+
+// parseRoles validates role definitions, accepting stat names in any case
+// and with or without separators ("sp_defense", "SpDefense")
+func parseRoles(roles map[string][]string) (map[string]roleFormula, error) {
+	if len(roles) == 0 {
+		roles = defaultRoles
+	}
+
+	byKey := make(map[string]string, len(statFields))
+	for stat := range statFields {
+		byKey[statKey(stat)] = stat
+	}
+
+	formulas := make(map[string]roleFormula, len(roles))
+	for name, terms := range roles {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || len(terms) == 0 {
+			return nil, fmt.Errorf("role %q must list at least one stat", name)
+		}
+
+		formula := make(roleFormula, 0, len(terms))
+		for _, term := range terms {
+			var stats []string
+			for _, stat := range strings.Split(term, "|") {
+				canonical, ok := byKey[statKey(stat)]
+				if !ok {
+					return nil, fmt.Errorf("role %q: unknown stat %q", name, strings.TrimSpace(stat))
+				}
+				stats = append(stats, canonical)
+			}
+			formula = append(formula, stats)
+		}
+		formulas[name] = formula
+	}
+
+	return formulas, nil
+}
+
+// statKey normalizes a stat name for matching, e.g. "Sp. Def" -> "spdef"
+func statKey(stat string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return -1
+	}, stat)
+}
+
+// score sums the terms over stats, reporting false if a stat is missing
+func (f roleFormula) score(stats map[string]int) (int, bool) {
+	total := 0
+	for _, term := range f {
+		best, found := 0, false
+		for _, stat := range term {
+			if value, ok := stats[stat]; ok {
+				best, found = max(best, value), true
+			}
+		}
+		if !found {
+			return 0, false
+		}
+		total += best
+	}
+	return total, true
+}
+
+// Recommendation is a Pokemon ranked for a role
+type Recommendation struct {
+	Name   string         `json:"name"`
+	Number string         `json:"number,omitempty"`
+	Types  []string       `json:"types,omitempty"`
+	Score  int            `json:"score"`
+	Stats  map[string]int `json:"stats"`
+}
+
+// Roles returns the configured role names, sorted
+func (s *RAGService) Roles() []string {
+	names := make([]string, 0, len(s.roles))
+	for name := range s.roles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Recommend ranks every stored Pokemon by the role's formula over its base
+// stats and returns the best limit. Pokemon ingested before base stats were
+// stored as numbers are left out until re-ingested.
+func (s *RAGService) Recommend(ctx context.Context, role string, limit int) ([]Recommendation, error) {
+	formula, ok := s.roles[strings.ToLower(strings.TrimSpace(role))]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRole, role)
+	}
+
+	fields := []string{"pokemon", "number", "types"}
+	for _, field := range statFields {
+		fields = append(fields, field)
+	}
+	metadata, err := s.vectorRepo.ScrollMetadata(ctx, fields...)
+	if err != nil {
+		return nil, err
+	}
+
+	return rankForRole(metadata, formula, limit), nil
+}
+
+// rankForRole scores each Pokemon in metadata once, highest first, breaking
+// ties by National number
+func rankForRole(metadata []map[string]string, formula roleFormula, limit int) []Recommendation {
+	seen := make(map[string]struct{})
+	var ranked []Recommendation
+	for _, md := range metadata {
+		name := pokename.Display(md["pokemon"])
+		key := pokename.Key(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		stats := make(map[string]int, len(statFields))
+		for stat, field := range statFields {
+			if value, err := strconv.Atoi(md[field]); err == nil {
+				stats[stat] = value
+			}
+		}
+		score, ok := formula.score(stats)
+		if !ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		var types []string
+		if md["types"] != "" {
+			types = strings.Split(md["types"], ",")
+		}
+		ranked = append(ranked, Recommendation{
+			Name:   name,
+			Number: md["number"],
+			Types:  types,
+			Score:  score,
+			Stats:  stats,
+		})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		a, _ := repository.ParseNationalNumber(ranked[i].Number)
+		b, _ := repository.ParseNationalNumber(ranked[j].Number)
+		return a < b
+	})
+
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
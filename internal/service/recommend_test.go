@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+	"github.com/katatrina/poke-bot/internal/crawler"
+)
+
+// statPokemon returns a test Pokemon with the given HP, Attack, Defense,
+// SpAttack, SpDefense and Speed
+func statPokemon(name, number string, stats ...int) *crawler.PokemonData {
+	p := testPokemon(name, number, "Normal")
+	p.Stats = make(map[string]int, len(stats))
+	for i, stat := range []string{"HP", "Attack", "Defense", "SpAttack", "SpDefense", "Speed"} {
+		p.Stats[stat] = stats[i]
+	}
+	return p
+}
+
+func TestRecommendRanksByRole(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Roles = map[string][]string{
+			"tank":    {"HP", "Defense", "SpDefense"},
+			"sweeper": {"Attack|SpAttack", "Speed"},
+			"wall":    {"defense", "sp_defense"},
+		}
+	})
+	env.source.add(
+		statPokemon("Snorlax", "0143", 160, 110, 65, 65, 110, 30), // tank 335, sweeper 140, wall 175
+		statPokemon("Shuckle", "0213", 20, 10, 230, 10, 230, 5),   // tank 480, sweeper 15, wall 460
+		statPokemon("Alakazam", "0065", 55, 50, 45, 135, 95, 120), // tank 195, sweeper 255, wall 140
+		statPokemon("Jolteon", "0135", 65, 65, 60, 110, 95, 130),  // tank 220, sweeper 240, wall 155
+		statPokemon("Cloyster", "0091", 50, 95, 180, 85, 45, 70),  // tank 275, sweeper 165, wall 225
+		pikachu, // tank 159, sweeper 110, wall 114
+	)
+	env.ingest(t, "Snorlax", "Shuckle", "Alakazam", "Jolteon", "Cloyster", "Pikachu")
+
+	tests := []struct {
+		role  string
+		limit int
+		want  []string
+	}{
+		{"tank", 3, []string{"Shuckle", "Snorlax", "Cloyster"}},
+		{"Sweeper", 2, []string{"Alakazam", "Jolteon"}},
+		{"wall", 0, []string{"Shuckle", "Cloyster", "Snorlax", "Jolteon", "Alakazam", "Pikachu"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			ranked, err := env.service.Recommend(context.Background(), tt.role, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, r := range ranked {
+				got = append(got, r.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ranking = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	ranked, err := env.service.Recommend(context.Background(), "tank", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ranked[0].Score != 480 || ranked[0].Stats["Defense"] != 230 {
+		t.Errorf("top tank = %+v, want Shuckle scoring 480", ranked[0])
+	}
+
+	if _, err := env.service.Recommend(context.Background(), "support", 5); !errors.Is(err, ErrUnknownRole) {
+		t.Errorf("err = %v, want ErrUnknownRole", err)
+	}
+}
+
+func TestRankForRoleBreaksTiesByNumber(t *testing.T) {
+	metadata := []map[string]string{
+		{"pokemon": "Raichu", "number": "0026", "stat_speed": "110"},
+		{"pokemon": "Alakazam", "number": "0065", "stat_speed": "120"},
+		{"pokemon": "Pikachu", "number": "0025", "stat_speed": "110"},
+		{"pokemon": "Pikachu", "number": "0025", "stat_speed": "110"}, // Second chunk of the same Pokemon
+	}
+
+	var got []string
+	for _, r := range rankForRole(metadata, roleFormula{{"Speed"}}, 0) {
+		got = append(got, r.Name)
+	}
+	if want := []string{"Alakazam", "Pikachu", "Raichu"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ranking = %v, want %v", got, want)
+	}
+}
+
+func TestParseRoles(t *testing.T) {
+	roles, err := parseRoles(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := roles["tank"]; !ok {
+		t.Errorf("default roles = %v, want tank and sweeper", roles)
+	}
+
+	roles, err = parseRoles(map[string][]string{"Bulky": {"hp", "Sp. Defense"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (roleFormula{{"HP"}, {"SpDefense"}}); !reflect.DeepEqual(roles["bulky"], want) {
+		t.Errorf("bulky = %v, want %v", roles["bulky"], want)
+	}
+
+	for _, invalid := range []map[string][]string{
+		{"tank": {"Luck"}},
+		{"tank": {}},
+		{"sweeper": {"Attack|Charm"}},
+	} {
+		if _, err := parseRoles(invalid); err == nil {
+			t.Errorf("roles %v were accepted", invalid)
+		}
+	}
+}
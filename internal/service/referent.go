@@ -0,0 +1,68 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/katatrina/poke-bot/internal/pokename"
+)
+
+// referencePattern matches words a follow-up uses to point back at a Pokemon
+// named earlier ("what does it evolve into?", "is that one faster?")
+var referencePattern = regexp.MustCompile(`(?i)\b(it|its|it's|itself|they|them|their|that one|this one|that pokemon|this pokemon)\b`)
+
+// referentIndex returns the index of the latest message in history naming a
+// Pokemon, when question refers back with a pronoun and names none itself.
+// It returns -1 when there is nothing to preserve or rag.referent_tokens is 0.
+func (s *RAGService) referentIndex(question string, history []ConversationMessage) int {
+	if s.config.RAG.ReferentTokens <= 0 || !referencePattern.MatchString(question) || s.namesPokemon(question) {
+		return -1
+	}
+
+	for i := len(history) - 1; i >= 0; i-- {
+		if s.namesPokemon(history[i].Content) {
+			return i
+		}
+	}
+	return -1
+}
+
+// namesPokemon reports whether text mentions an ingested Pokemon
+func (s *RAGService) namesPokemon(text string) bool {
+	return len(s.pokemonNames(text)) > 0
+}
+
+// pokemonNames returns the ingested Pokemon text mentions, in order of first
+// mention, checking word pairs before single words so names like "Mr. Mime"
+// match too
+func (s *RAGService) pokemonNames(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ' ' || r == '\n' || r == '\t' || r == ',' || r == '?' || r == '!' || r == ';' || r == '(' || r == ')'
+	})
+
+	var names []string
+	seen := make(map[string]bool)
+	for i := 0; i < len(words); i++ {
+		entry, ok := PokemonEntry{}, false
+		if i+1 < len(words) {
+			if entry, ok = s.knowledgeIndex.Lookup(words[i] + " " + words[i+1]); ok {
+				i++
+			}
+		}
+		if !ok {
+			entry, ok = s.knowledgeIndex.Lookup(words[i])
+		}
+		if ok && !seen[pokename.Key(entry.Name)] {
+			seen[pokename.Key(entry.Name)] = true
+			names = append(names, entry.Name)
+		}
+	}
+	return names
+}
+
+// referentMessage returns msg cut to the rag.referent_tokens allowance,
+// so keeping it can't crowd out the rest of the prompt
+func (s *RAGService) referentMessage(msg ConversationMessage) ConversationMessage {
+	msg.Content, _ = s.truncateToTokens(msg.Content, s.config.RAG.ReferentTokens)
+	return msg
+}
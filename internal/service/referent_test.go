@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+// referentHistory names Pikachu only in its first turn, followed by filler
+func referentHistory(filler int, fillerText string) []ConversationMessage {
+	history := []ConversationMessage{
+		{Type: "user", Content: "Tell me about Pikachu"},
+		{Type: "assistant", Content: "Pikachu is an Electric type Pokemon."},
+	}
+	for range filler {
+		history = append(history,
+			ConversationMessage{Type: "user", Content: fillerText},
+			ConversationMessage{Type: "assistant", Content: "Glad to help."},
+		)
+	}
+	return history
+}
+
+func TestPronounFollowUpKeepsReferentTurn(t *testing.T) {
+	tests := []struct {
+		name           string
+		referentTokens int
+		question       string
+		wantKept       bool
+	}{
+		{"pronoun follow-up", 50, "What does it evolve into?", true},
+		{"allowance disabled", 0, "What does it evolve into?", false},
+		{"question names a Pokemon", 50, "Is it faster than Bulbasaur?", false},
+		{"no pronoun", 50, "Which types are strong against Water?", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.RAG.MaxHistoryTurns = 1
+				cfg.RAG.ReferentTokens = tt.referentTokens
+			})
+			env.source.add(pikachu, bulbasaur)
+			env.ingest(t, "Pikachu", "Bulbasaur")
+
+			req := &ChatRequest{Message: tt.question, ConversationHistory: referentHistory(2, "Thanks, that helps.")}
+			if err := req.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := env.service.Chat(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			prompt := env.lastPrompt(t)
+
+			if kept := strings.Contains(prompt, "Assistant: Pikachu is an Electric type Pokemon."); kept != tt.wantKept {
+				t.Errorf("referent turn kept = %t, want %t", kept, tt.wantKept)
+			}
+			if strings.Contains(prompt, "Human: Tell me about Pikachu") {
+				t.Error("kept the older message as well, want only the latest naming one")
+			}
+		})
+	}
+}
+
+func TestReferentTurnSurvivesTokenBudget(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.MaxHistoryTurns = 50
+		cfg.RAG.MaxContextTokens = 600
+		cfg.RAG.ReferentTokens = 50
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	persona, err := env.service.resolvePersona("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The filler alone overflows the budget, which would otherwise drop the oldest turns first
+	history := referentHistory(20, strings.Repeat("Tell me more about that. ", 10))
+	prompt := env.service.buildPromptWithHistory(persona, answerStyle{}, "", "", "What does it evolve into?", history)
+
+	if !strings.Contains(prompt, "Assistant: Pikachu is an Electric type Pokemon.") {
+		t.Errorf("prompt lost the referent turn under budget pressure:\n%s", prompt)
+	}
+	if strings.Count(prompt, "Tell me more about that.") >= 20*10 {
+		t.Error("the budget didn't trim any filler, so the test proves nothing")
+	}
+}
@@ -0,0 +1,20 @@
+package service
+
+import (
+	"context"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID attaches the request ID to ctx so service logs can be correlated with access logs
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID attached by WithRequestID, or "-" if none
+func RequestIDFromContext(ctx context.Context) string {
+	if requestID, ok := ctx.Value(requestIDKey{}).(string); ok && requestID != "" {
+		return requestID
+	}
+	return "-"
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Post-processing applied to the model's answer before it is returned
+
+const (
+	responseFormatMarkdown = "markdown"
+	responseFormatPlain    = "plain"
+)
+
+var (
+	markdownEmphasisPattern = regexp.MustCompile(`(\*\*|__)(.+?)(\*\*|__)`)
+	markdownCodePattern     = regexp.MustCompile("`([^`]*)`")
+	markdownHeadingPattern  = regexp.MustCompile(`(?m)^[ \t]*#{1,6}[ \t]+`)
+	markdownBulletPattern   = regexp.MustCompile(`(?m)^[ \t]*(?:[-*+]|\d+\.)[ \t]+`)
+)
+
+// stripMarkdown removes common markdown artifacts (bold, inline code,
+// headings, list markers) while keeping the text
+func stripMarkdown(text string) string {
+	text = markdownEmphasisPattern.ReplaceAllString(text, "$2")
+	text = markdownCodePattern.ReplaceAllString(text, "$1")
+	text = markdownHeadingPattern.ReplaceAllString(text, "")
+	text = markdownBulletPattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(text)
+}
+
+// formatResponse applies cfg.RAG.ResponseFormat to the generated answer
+func (s *RAGService) formatResponse(response string) string {
+	if s.config.RAG.ResponseFormat == responseFormatPlain {
+		return stripMarkdown(response)
+	}
+	return response
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+	"github.com/katatrina/poke-bot/internal/ollamatest"
+)
+
+const markdownAnswer = `## Pikachu
+**Pikachu** is an ` + "`Electric`" + `-type Pokemon.
+- Base Speed: 90
+* Ability: __Static__
+1. Evolves into Raichu`
+
+func TestStripMarkdown(t *testing.T) {
+	want := "Pikachu\nPikachu is an Electric-type Pokemon.\nBase Speed: 90\nAbility: Static\nEvolves into Raichu"
+	if got := stripMarkdown(markdownAnswer); got != want {
+		t.Errorf("stripMarkdown:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestResponseFormatAppliesToChat(t *testing.T) {
+	tests := []struct {
+		format      string
+		want        string
+		instruction string
+	}{
+		{responseFormatMarkdown, markdownAnswer, "Use markdown"},
+		{responseFormatPlain, stripMarkdown(markdownAnswer), "Write plain sentences"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.RAG.ResponseFormat = tt.format
+			})
+			env.source.add(pikachu)
+			env.ingest(t, "Pikachu")
+			env.ollama.SetGenerate(func(ollamatest.GenerateRequest) string { return markdownAnswer })
+
+			resp := env.chat(t, "Tell me about Pikachu")
+			if resp.Response != tt.want {
+				t.Errorf("response:\n%s\nwant:\n%s", resp.Response, tt.want)
+			}
+			if prompt := env.lastPrompt(t); !strings.Contains(prompt, tt.instruction) {
+				t.Errorf("prompt lacks the %q instruction:\n%s", tt.instruction, prompt)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"maps"
+	"sort"
+	"strings"
+
+	"github.com/katatrina/poke-bot/internal/model"
+	"github.com/katatrina/poke-bot/internal/repository"
+)
+
+// searchWithRelaxation runs the search with opts and, while fewer than
+// cfg.RAG.MinResults come back, retries with the score threshold dropped and
+// then with the filters dropped too. A source filter is never dropped, since
+// the user asked for answers from that source only. Steps that would repeat
+// the previous query are skipped.
+func (s *RAGService) searchWithRelaxation(ctx context.Context, embedding []float32, topK int, opts repository.SearchOptions) ([]model.SearchResult, error) {
+	steps := []struct {
+		name string
+		opts repository.SearchOptions
+	}{
+		{"strict", opts},
+		{"no_threshold", repository.SearchOptions{Match: opts.Match, Numbers: opts.Numbers}},
+		{"no_filters", repository.SearchOptions{Match: pinnedMatch(opts.Match)}},
+	}
+
+	minResults := s.config.RAG.MinResults
+	var results []model.SearchResult
+
+	for i, step := range steps {
+		if i > 0 && sameSearch(step.opts, steps[i-1].opts) {
+			continue
+		}
+
+		var err error
+		results, err = s.vectorRepo.SearchWithOptions(ctx, embedding, topK, step.opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(results) >= minResults {
+			if i > 0 {
+				log.Printf("Search relaxed to step %q: %d results (min %d)", step.name, len(results), minResults)
+			}
+			return results, nil
+		}
+	}
+
+	log.Printf("Search returned %d results after all relaxation steps (min %d)", len(results), minResults)
+	return results, nil
+}
+
+// pinnedMatch returns the filters that relaxation must keep
+func pinnedMatch(match map[string]string) map[string]string {
+	source, ok := match["source"]
+	if !ok {
+		return nil
+	}
+	return map[string]string{"source": source}
+}
+
+// sameSearch reports whether a and b would run the same query
+func sameSearch(a, b repository.SearchOptions) bool {
+	if a.ScoreThreshold != b.ScoreThreshold || !maps.Equal(a.Match, b.Match) {
+		return false
+	}
+	if a.Numbers == nil || b.Numbers == nil {
+		return a.Numbers == b.Numbers
+	}
+	return *a.Numbers == *b.Numbers
+}
+
+// rrfK dampens the weight of top ranks in reciprocal rank fusion (the usual 60)
+const rrfK = 60
+
+// searchWithExpansion searches with the query embedding and, with
+// cfg.RAG.QueryExpansion, also with templated rewrites of the question, then
+// fuses the result lists by reciprocal rank. Expansion failures fall back to
+// the plain query's results.
+func (s *RAGService) searchWithExpansion(ctx context.Context, query, embeddingModel string, embedding []float32, topK int, opts repository.SearchOptions) ([]model.SearchResult, error) {
+	results, err := s.searchWithRelaxation(ctx, embedding, topK, opts)
+	if err != nil || !s.config.RAG.QueryExpansion {
+		return results, err
+	}
+
+	maxVariants := s.config.RAG.QueryVariants
+	if maxVariants <= 0 {
+		maxVariants = 2 // Default fallback
+	}
+	variants := queryVariants(query, min(maxVariants, 4))
+	if len(variants) == 0 {
+		return results, nil
+	}
+
+	variantEmbeddings, err := s.embedQueries(ctx, embeddingModel, variants)
+	if err != nil {
+		log.Printf("Query expansion skipped, failed to embed variants: %v", err)
+		return results, nil
+	}
+
+	resultLists := [][]model.SearchResult{results}
+	for i, variantEmbedding := range variantEmbeddings {
+		variantResults, err := s.vectorRepo.SearchWithOptions(ctx, variantEmbedding, topK, opts)
+		if err != nil {
+			log.Printf("Query expansion search for %q failed: %v", variants[i], err)
+			continue
+		}
+		resultLists = append(resultLists, variantResults)
+	}
+
+	fused := fuseResults(resultLists, topK)
+	log.Printf("Query expansion: %d variants, %d results fused into %d", len(variants), countResults(resultLists), len(fused))
+
+	return fused, nil
+}
+
+// canFallBackToKeywords reports whether a failed query embedding should be
+// answered from a keyword search instead, per cfg.RAG.KeywordFallback. A
+// request that was cancelled or timed out has nothing left to fall back for.
+func (s *RAGService) canFallBackToKeywords(ctx context.Context, err error) bool {
+	return s.config.RAG.KeywordFallback && ctx.Err() == nil && !errors.Is(err, context.Canceled)
+}
+
+// augmentShortQuery expands a question of fewer than cfg.RAG.MinQueryWords
+// words into a sentence before embedding, since a bare "Mew" or "speed"
+// embeds into a noisy vector. The question shown to the model is unchanged.
+func (s *RAGService) augmentShortQuery(question string) string {
+	question = strings.TrimSpace(question)
+	words := strings.Fields(question)
+	if len(words) == 0 || len(words) >= s.config.RAG.MinQueryWords {
+		return question
+	}
+
+	subject := strings.TrimRight(question, "?!.")
+	if s.namesPokemon(subject) {
+		return "Tell me about the Pokemon " + subject
+	}
+	return "Tell me about " + subject + " in Pokemon"
+}
+
+// queryStopwords are dropped to build the keyword-only query variant and
+// keyword fallback searches
+var queryStopwords = map[string]bool{
+	"what": true, "which": true, "who": true, "how": true, "is": true, "are": true, "the": true,
+	"a": true, "an": true, "of": true, "does": true, "do": true, "can": true, "tell": true,
+	"me": true, "about": true, "please": true, "its": true, "it": true,
+}
+
+// queryKeywords returns the lowercased words of query, minus stopwords
+func queryKeywords(query string) []string {
+	var keywords []string
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		word = strings.Trim(word, "?!.,'\"")
+		if word != "" && !queryStopwords[word] {
+			keywords = append(keywords, word)
+		}
+	}
+	return keywords
+}
+
+// queryVariants returns up to limit templated rewrites of query, each
+// different from the query and from one another
+func queryVariants(query string, limit int) []string {
+	keywordQuery := strings.Join(queryKeywords(query), " ")
+	if keywordQuery == "" {
+		return nil
+	}
+
+	candidates := []string{
+		keywordQuery,
+		"Pokemon information about " + keywordQuery,
+		"Pokedex entry: " + query,
+		"Facts and stats: " + keywordQuery,
+	}
+
+	seen := map[string]bool{strings.ToLower(query): true}
+	var variants []string
+	for _, candidate := range candidates {
+		candidate = strings.TrimSpace(candidate)
+		if len(variants) >= limit || seen[strings.ToLower(candidate)] {
+			continue
+		}
+		seen[strings.ToLower(candidate)] = true
+		variants = append(variants, candidate)
+	}
+
+	return variants
+}
+
+// fuseResults merges ranked result lists by reciprocal rank fusion and keeps
+// the topK best. Each result keeps its best similarity score, so score-based
+// thresholds downstream still mean the same thing.
+func fuseResults(resultLists [][]model.SearchResult, topK int) []model.SearchResult {
+	type fusedResult struct {
+		result model.SearchResult
+		score  float64
+	}
+
+	fused := make(map[string]*fusedResult)
+	var order []string
+	for _, results := range resultLists {
+		for rank, result := range results {
+			key := result.Metadata["pokemon"] + "\x00" + result.Content
+
+			entry, ok := fused[key]
+			if !ok {
+				entry = &fusedResult{result: result}
+				fused[key] = entry
+				order = append(order, key)
+			}
+			entry.score += 1 / float64(rrfK+rank+1)
+			entry.result.Score = max(entry.result.Score, result.Score)
+		}
+	}
+
+	// Stable sort so ties keep first-seen order, i.e. the original query's ranking
+	sort.SliceStable(order, func(i, j int) bool { return fused[order[i]].score > fused[order[j]].score })
+
+	merged := make([]model.SearchResult, 0, min(len(order), topK))
+	for _, key := range order[:min(len(order), topK)] {
+		merged = append(merged, fused[key].result)
+	}
+
+	return merged
+}
+
+func countResults(resultLists [][]model.SearchResult) int {
+	total := 0
+	for _, results := range resultLists {
+		total += len(results)
+	}
+	return total
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+	"github.com/katatrina/poke-bot/internal/model"
+	"github.com/katatrina/poke-bot/internal/ollamatest"
+	"github.com/katatrina/poke-bot/internal/repository"
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// queryFilterFields returns the payload keys each recorded query filtered on
+func queryFilterFields(queries []*qdrant.QueryPoints) [][]string {
+	fields := make([][]string, len(queries))
+	for i, query := range queries {
+		for _, condition := range query.GetFilter().GetMust() {
+			if field := condition.GetField(); field != nil {
+				fields[i] = append(fields[i], field.GetKey())
+			}
+		}
+	}
+	return fields
+}
+
+func TestRelaxationRecoversFromStrictSearch(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.MinResults = 1
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	embedding := ollamatest.Embedding("Which Pokemon is the fastest?", testDimension)
+	opts := repository.SearchOptions{
+		ScoreThreshold: 0.999, // Nothing scores this high
+		Match:          map[string]string{"source": pokemonDBSource, "pokemon_key": "mew"},
+		Numbers:        &repository.NumberRange{Min: 150, Max: 151},
+	}
+	results, err := env.service.searchWithRelaxation(context.Background(), embedding, 5, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 {
+		t.Fatal("relaxation recovered no results")
+	}
+
+	queries := env.qdrant.Queries()
+	if len(queries) != 3 {
+		t.Fatalf("got %d queries, want strict, no_threshold and no_filters", len(queries))
+	}
+	if queries[0].GetScoreThreshold() == 0 || queries[1].GetScoreThreshold() != 0 {
+		t.Errorf("score thresholds = %v, %v; want the threshold dropped after the strict query", queries[0].GetScoreThreshold(), queries[1].GetScoreThreshold())
+	}
+
+	fields := queryFilterFields(queries)
+	if len(fields[1]) != 3 {
+		t.Errorf("no_threshold filtered on %v, want every filter kept", fields[1])
+	}
+	if len(fields[2]) != 1 || fields[2][0] != "source" {
+		t.Errorf("no_filters filtered on %v, want only the pinned source", fields[2])
+	}
+}
+
+func TestRelaxationSkipsRepeatedQueries(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.MinResults = 5
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	// Only the pinned source filter, so dropping filters changes nothing
+	opts := repository.SearchOptions{
+		ScoreThreshold: 0.999,
+		Match:          map[string]string{"source": pokemonDBSource},
+	}
+	embedding := ollamatest.Embedding("Pikachu", testDimension)
+	if _, err := env.service.searchWithRelaxation(context.Background(), embedding, 5, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(env.qdrant.Queries()); got != 2 {
+		t.Errorf("got %d queries, want 2 (no_filters repeats no_threshold)", got)
+	}
+}
+
+func TestChatSourceFilterReachesEverySearch(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.MinResults = 1 // Force every relaxation step
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	req := &ChatRequest{Message: "What type is Pikachu?", Source: pokeAPISource}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := env.service.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queries := env.qdrant.Queries()
+	if len(queries) == 0 {
+		t.Fatal("no search was run")
+	}
+	for i, query := range queries {
+		var source string
+		for _, condition := range query.GetFilter().GetMust() {
+			if field := condition.GetField(); field.GetKey() == "source" {
+				source = field.GetMatch().GetKeyword()
+			}
+		}
+		if source != pokeAPISource {
+			t.Errorf("query %d filtered source = %q, want %q", i, source, pokeAPISource)
+		}
+	}
+	// Only pokemondb documents exist, so nothing may leak into the context
+	if len(resp.ContextChunks) != 0 {
+		t.Errorf("got %d context chunks from another source, want 0", len(resp.ContextChunks))
+	}
+}
+
+func TestChatWithoutSourceSearchesAllSources(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	env.chat(t, "What type is Pikachu?")
+	for i, fields := range queryFilterFields(env.qdrant.Queries()) {
+		if slices.Contains(fields, "source") {
+			t.Errorf("query %d filters on source without a source in the request", i)
+		}
+	}
+}
+
+func TestChatRequestRejectsUnknownSource(t *testing.T) {
+	req := &ChatRequest{Message: "What type is Pikachu?", Source: "bulbapedia"}
+	if err := req.Validate(); err == nil {
+		t.Error("expected an unknown source to be rejected")
+	}
+}
+
+func TestQueryExpansionSearchesEachVariant(t *testing.T) {
+	const question = "What type is Pikachu?"
+
+	searches := make(map[bool]int)
+	for _, expansion := range []bool{false, true} {
+		env := newTestEnv(t, func(cfg *config.Config) {
+			cfg.RAG.QueryExpansion = expansion
+			cfg.RAG.QueryVariants = 2
+		})
+		env.source.add(pikachu, bulbasaur)
+		env.ingest(t, "Pikachu", "Bulbasaur")
+
+		resp := env.chat(t, question)
+		if len(resp.ContextChunks) == 0 {
+			t.Fatalf("query_expansion=%v retrieved nothing", expansion)
+		}
+		searches[expansion] = len(env.qdrant.Queries())
+
+		if !expansion {
+			continue
+		}
+		var embedded []string
+		for _, req := range env.ollama.EmbedRequests() {
+			embedded = append(embedded, req.Input...)
+		}
+		for _, variant := range queryVariants(question, 2) {
+			if !slices.ContainsFunc(embedded, func(input string) bool { return strings.HasSuffix(input, variant) }) {
+				t.Errorf("variant %q was never embedded", variant)
+			}
+		}
+	}
+
+	if searches[true] != searches[false]+2 {
+		t.Errorf("searches with expansion = %d, want %d plus one per variant", searches[true], searches[false])
+	}
+}
+
+func TestQueryVariants(t *testing.T) {
+	variants := queryVariants("What type is Pikachu?", 4)
+	want := []string{
+		"type pikachu",
+		"Pokemon information about type pikachu",
+		"Pokedex entry: What type is Pikachu?",
+		"Facts and stats: type pikachu",
+	}
+	if !slices.Equal(variants, want) {
+		t.Errorf("variants = %q, want %q", variants, want)
+	}
+
+	if got := queryVariants("What type is Pikachu?", 2); !slices.Equal(got, want[:2]) {
+		t.Errorf("limited variants = %q, want %q", got, want[:2])
+	}
+
+	// A keyword-only question has no keyword rewrite distinct from itself
+	if got := queryVariants("pikachu", 4); slices.Contains(got, "pikachu") {
+		t.Errorf("variants %q repeat the question", got)
+	}
+	if got := queryVariants("What is it?", 4); got != nil {
+		t.Errorf("stopword-only question gave variants %q, want none", got)
+	}
+}
+
+func TestFuseResultsRanksAgreementFirst(t *testing.T) {
+	result := func(pokemon string, score float32) model.SearchResult {
+		return model.SearchResult{Content: pokemon + " facts", Score: score, Metadata: map[string]string{"pokemon": pokemon}}
+	}
+
+	fused := fuseResults([][]model.SearchResult{
+		{result("Pikachu", 0.9), result("Raichu", 0.8), result("Pichu", 0.7)},
+		{result("Raichu", 0.95), result("Onix", 0.6)},
+	}, 3)
+
+	var got []string
+	for _, r := range fused {
+		got = append(got, r.Metadata["pokemon"])
+	}
+	// Raichu is found by both searches, and Onix, second in its list, beats
+	// Pichu, third in the first
+	if want := []string{"Raichu", "Pikachu", "Onix"}; !slices.Equal(got, want) {
+		t.Fatalf("fused = %v, want %v", got, want)
+	}
+	if fused[0].Score != 0.95 {
+		t.Errorf("Raichu score = %v, want its best similarity 0.95", fused[0].Score)
+	}
+}
+
+func TestShortQueriesAreAugmentedBeforeEmbedding(t *testing.T) {
+	tests := []struct {
+		question  string
+		wantEmbed string
+	}{
+		{"Pikachu", "Tell me about the Pokemon Pikachu"},
+		{"speed?", "Tell me about speed in Pokemon"},
+		{"Pikachu speed", "Tell me about the Pokemon Pikachu speed"},
+		{"What type is Pikachu?", "What type is Pikachu?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.question, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.RAG.MinQueryWords = 3
+			})
+			env.source.add(pikachu)
+			env.ingest(t, "Pikachu")
+			ingestRequests := len(env.ollama.EmbedRequests())
+
+			env.chat(t, tt.question)
+
+			embedded := env.ollama.EmbedRequests()[ingestRequests].Input
+			if !slices.Equal(embedded, []string{tt.wantEmbed}) {
+				t.Errorf("embedded %q, want %q", embedded, tt.wantEmbed)
+			}
+			if want := "Current Question: " + tt.question + "\n"; !strings.Contains(env.lastPrompt(t), want) {
+				t.Errorf("prompt lost the original question %q:\n%s", tt.question, env.lastPrompt(t))
+			}
+		})
+	}
+}
+
+func TestShortQueryAugmentationDisabledByDefault(t *testing.T) {
+	env := newTestEnv(t, nil)
+	if got := env.service.augmentShortQuery("Mew"); got != "Mew" {
+		t.Errorf("augmented %q with min_query_words unset", got)
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrRetryBudgetExhausted is returned when a Pokemon has used up
+// ingest.retry_budget or ingest.retry_budget_time; it is abandoned rather
+// than retried again
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// retryBudget caps the retries spent on one Pokemon across the ingest
+// pipeline, so embedding re-requests and the retry pass can't compound into a
+// stall. The time limit runs from the Pokemon's first attempt and stops new
+// retries from starting; calls already in flight finish. A nil budget allows
+// every retry. Embedding may run concurrently, so spend is safe for that.
+type retryBudget struct {
+	maxRetries int       // 0 = no limit
+	deadline   time.Time // Zero = no limit
+	now        func() time.Time
+
+	mu      sync.Mutex
+	retries int
+}
+
+// newRetryBudget starts a budget for one Pokemon, or returns nil when neither
+// limit is configured
+func (s *RAGService) newRetryBudget() *retryBudget {
+	maxRetries := s.config.Ingest.RetryBudget
+	seconds := s.config.Ingest.RetryBudgetTime
+	if maxRetries <= 0 && seconds <= 0 {
+		return nil
+	}
+
+	budget := &retryBudget{maxRetries: max(maxRetries, 0), now: s.now}
+	if seconds > 0 {
+		budget.deadline = s.now().Add(time.Duration(seconds) * time.Second)
+	}
+	return budget
+}
+
+// spend takes one retry for stage, or returns ErrRetryBudgetExhausted
+func (b *retryBudget) spend(stage string) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.maxRetries > 0 && b.retries >= b.maxRetries {
+		return fmt.Errorf("%w: %s retry would exceed %d retries", ErrRetryBudgetExhausted, stage, b.maxRetries)
+	}
+	if !b.deadline.IsZero() && !b.now().Before(b.deadline) {
+		return fmt.Errorf("%w: %s retry after the time budget ran out", ErrRetryBudgetExhausted, stage)
+	}
+
+	b.retries++
+	return nil
+}
+
+type retryBudgetKey struct{}
+
+// withRetryBudget makes budget available to the pipeline stages called with ctx
+func withRetryBudget(ctx context.Context, budget *retryBudget) context.Context {
+	if budget == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, retryBudgetKey{}, budget)
+}
+
+// retryBudgetFrom returns the budget in ctx, or nil outside an ingest
+func retryBudgetFrom(ctx context.Context) *retryBudget {
+	budget, _ := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	return budget
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestRetryBudgetSpend(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	newBudget := func(retries, seconds int) *retryBudget {
+		env := newTestEnv(t, func(cfg *config.Config) {
+			cfg.Ingest.RetryBudget = retries
+			cfg.Ingest.RetryBudgetTime = seconds
+		})
+		env.service.now = clock.Now
+		return env.service.newRetryBudget()
+	}
+
+	if budget := newBudget(0, 0); budget != nil {
+		t.Fatal("a budget was created without limits")
+	}
+	var unlimited *retryBudget
+	for range 100 {
+		if err := unlimited.spend("embedding"); err != nil {
+			t.Fatalf("nil budget refused a retry: %v", err)
+		}
+	}
+
+	counted := newBudget(2, 0)
+	for range 2 {
+		if err := counted.spend("embedding"); err != nil {
+			t.Fatalf("retry within the budget refused: %v", err)
+		}
+	}
+	if err := counted.spend("ingest"); !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Errorf("err = %v, want ErrRetryBudgetExhausted on the third retry", err)
+	}
+
+	timed := newBudget(0, 10)
+	clock.advance(9 * time.Second)
+	if err := timed.spend("embedding"); err != nil {
+		t.Fatalf("retry before the deadline refused: %v", err)
+	}
+	clock.advance(time.Second)
+	if err := timed.spend("embedding"); !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Errorf("err = %v, want ErrRetryBudgetExhausted at the deadline", err)
+	}
+}
+
+func TestRetryBudgetBoundsEmbeddingRetries(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Ollama.EmbeddingRetries = 5
+		cfg.Ingest.RetryBudget = 2
+		cfg.Ingest.RetryDelay = 5
+	})
+	env.source.add(pikachu)
+	// Every embedding comes back malformed, so only the budget stops the retries
+	env.ollama.SetEmbed(func(string) []float32 { return make([]float32, testDimension/2) })
+
+	var events []ProgressEvent
+	start := time.Now()
+	env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source:   pokemonDBSource,
+		URLs:     env.source.urls("Pikachu"),
+		Progress: func(event ProgressEvent) { events = append(events, event) },
+	})
+
+	// The batch request plus the two budgeted retries, then no retry pass
+	if n := len(env.ollama.EmbedRequests()); n != 3 {
+		t.Errorf("sent %d embed requests, want 3", n)
+	}
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Errorf("ingest took %s, want it to skip the retry pass delay", elapsed)
+	}
+	if len(events) != 1 || events[0].Status != ProgressAbandoned {
+		t.Errorf("events = %+v, want Pikachu abandoned", events)
+	}
+}
+
+func TestRetryBudgetTimeStopsRetryPass(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Ingest.RetryBudgetTime = 10
+		cfg.Ingest.RetryDelay = 1
+	})
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	env.service.now = clock.Now
+	env.source.add(pikachu)
+
+	// The first attempt fails slowly, using up the time budget
+	attempts := 0
+	env.source.detail = func(context.Context, string) error {
+		attempts++
+		clock.advance(15 * time.Second)
+		return errors.New("connection reset")
+	}
+
+	var events []ProgressEvent
+	env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source:   pokemonDBSource,
+		URLs:     env.source.urls("Pikachu"),
+		Progress: func(event ProgressEvent) { events = append(events, event) },
+	})
+
+	if attempts != 1 {
+		t.Errorf("crawled %d times, want no retry once the time budget ran out", attempts)
+	}
+	if len(events) != 2 || events[0].Status != ProgressFailed || events[1].Status != ProgressAbandoned || !events[1].Retry {
+		t.Errorf("events = %+v, want a failure then abandoned in the retry pass", events)
+	}
+}
@@ -5,10 +5,13 @@ import (
 	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Sanitize input to prevent injection attacks and ensure data safety
-// Uses html.EscapeString for XSS prevention and includes prompt injection detection
+// Input is kept as plain text for the LLM and search (so "Speed > 100" survives);
+// HTML escaping belongs to the rendering side. gin's JSON encoder already escapes
+// <, > and & in responses, and the frontend renders messages as text.
 
 var (
 	// Common prompt injection patterns
@@ -27,16 +30,17 @@ var (
 	controlCharPattern = regexp.MustCompile(`[\x00-\x08\x0B\x0C\x0E-\x1F\x7F]`)
 )
 
-// SanitizeInput performs input sanitization using html.EscapeString
+// SanitizeInput normalizes user text before it reaches the LLM and search.
+// It does not HTML-escape, so comparison operators like "<" and ">" are preserved.
 func SanitizeInput(input string) string {
 	// 1. Trim whitespace
 	cleaned := strings.TrimSpace(input)
 
-	// 2. Remove control characters (except newlines and tabs)
-	cleaned = controlCharPattern.ReplaceAllString(cleaned, "")
+	// 2. Decode entities so pre-escaped input ("&gt;") reads the same as raw input
+	cleaned = html.UnescapeString(cleaned)
 
-	// 3. Escape HTML entities to prevent XSS
-	cleaned = html.EscapeString(cleaned)
+	// 3. Remove control characters (except newlines and tabs), including any decoded above
+	cleaned = controlCharPattern.ReplaceAllString(cleaned, "")
 
 	// 4. Normalize excessive whitespace
 	cleaned = normalizeWhitespace(cleaned)
@@ -124,12 +128,24 @@ func ValidateMessageLength(message string, maxLength int) error {
 	return nil
 }
 
+// ValidateWordLength rejects input containing a word longer than maxLength
+// characters, e.g. a pasted blob without spaces
+func ValidateWordLength(input string, maxLength int) error {
+	for _, word := range strings.Fields(input) {
+		if utf8.RuneCountInString(word) > maxLength {
+			return ErrWordTooLong
+		}
+	}
+	return nil
+}
+
 // Custom errors
 var (
 	ErrEmptyMessage       = newValidationError("message cannot be empty")
 	ErrMessageTooLong     = newValidationError("message exceeds maximum length")
 	ErrPromptInjection    = newValidationError("message contains suspicious patterns")
 	ErrInvalidCharacters  = newValidationError("message contains invalid characters")
+	ErrWordTooLong        = newValidationError("message contains a word exceeding the maximum length")
 )
 
 type validationError struct {
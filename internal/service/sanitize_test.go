@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestSanitizeInputKeepsComparisonOperators(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Pokemon with Speed > 100", "Pokemon with Speed > 100"},
+		{"Attack < 50 && Defense >= 80", "Attack < 50 && Defense >= 80"},
+		{"Speed &gt; 100", "Speed > 100"}, // Pre-escaped input reads the same as raw
+		{"  HP   <= 45\x00 ", "HP <= 45"},
+	}
+
+	for _, tt := range tests {
+		if got := SanitizeInput(tt.input); got != tt.want {
+			t.Errorf("SanitizeInput(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestComparisonOperatorsReachSearchAndPrompt(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	req := &ChatRequest{Message: "Which Pokemon have Speed > 80 and Attack < 60?"}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.service.Chat(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	const question = "Speed > 80 and Attack < 60"
+	embedded := false
+	for _, embed := range env.ollama.EmbedRequests() {
+		for _, input := range embed.Input {
+			if strings.Contains(input, "&gt;") || strings.Contains(input, "&lt;") {
+				t.Errorf("search input was HTML-escaped: %q", input)
+			}
+			embedded = embedded || strings.Contains(input, question)
+		}
+	}
+	if !embedded {
+		t.Errorf("no search embedding contained %q", question)
+	}
+	if prompt := env.lastPrompt(t); !strings.Contains(prompt, question) {
+		t.Errorf("prompt lost the comparison operators:\n%s", prompt)
+	}
+}
+
+// unbrokenWord returns n characters without whitespace or long repeated runs
+func unbrokenWord(n int) string {
+	const alphabet = "pikachuelectricmouse0123456789"
+	var sb strings.Builder
+	for i := range n {
+		sb.WriteByte(alphabet[(i*7)%len(alphabet)])
+	}
+	return sb.String()
+}
+
+func TestValidateWordLength(t *testing.T) {
+	if err := ValidateWordLength("What is "+unbrokenWord(100)+"?", 101); err != nil {
+		t.Errorf("word at the limit rejected: %v", err)
+	}
+	if err := ValidateWordLength(unbrokenWord(900), 100); !errors.Is(err, ErrWordTooLong) {
+		t.Errorf("900-character word: error = %v, want ErrWordTooLong", err)
+	}
+	// Many short words add up to more than the limit without any being too long
+	if err := ValidateWordLength(strings.Repeat("Pikachu ", 50), 10); err != nil {
+		t.Errorf("long message of short words rejected: %v", err)
+	}
+}
+
+func TestChatRejectsLongUnbrokenWords(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RAG.MaxWordLength = 30
+	})
+	env.source.add(pikachu)
+	env.ingest(t, "Pikachu")
+
+	long := unbrokenWord(31)
+	for name, req := range map[string]*ChatRequest{
+		"message": {Message: "What is " + long},
+		"history": {
+			Message:             "And its type?",
+			ConversationHistory: []ConversationMessage{{Type: "user", Content: long}},
+		},
+	} {
+		if err := req.Validate(); err != nil {
+			t.Fatalf("%s: Validate: %v", name, err)
+		}
+		if _, err := env.service.Chat(context.Background(), req); !errors.Is(err, ErrWordTooLong) {
+			t.Errorf("%s: error = %v, want ErrWordTooLong", name, err)
+		}
+	}
+	if got := len(env.ollama.GenerateRequests()); got != 0 {
+		t.Errorf("sent %d generate requests, want 0", got)
+	}
+
+	env.chat(t, "What is "+unbrokenWord(30))
+}
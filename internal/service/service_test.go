@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+	"github.com/katatrina/poke-bot/internal/crawler"
+	"github.com/katatrina/poke-bot/internal/ollamatest"
+	"github.com/katatrina/poke-bot/internal/qdranttest"
+	"github.com/katatrina/poke-bot/internal/repository"
+	"resty.dev/v3"
+)
+
+const testDimension = 16
+
+// testEnv is a RAGService wired to fake Qdrant and Ollama servers, with a
+// fakeSource standing in for pokemondb
+type testEnv struct {
+	service *RAGService
+	qdrant  *qdranttest.Server
+	ollama  *ollamatest.Server
+	source  *fakeSource
+}
+
+// newTestConfig loads a minimal config through config.LoadConfig so the
+// usual defaults apply
+func newTestConfig(t testing.TB) *config.Config {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := []byte("qdrant:\n  collection: pokemons\nollama:\n  chat_model: test-chat\n  embedding_model: test-embed\n  embedding_dimension: 16\n")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// newTestEnv builds a testEnv. configure, if non-nil, adjusts the config
+// before the repository and service are created.
+func newTestEnv(t testing.TB, configure func(cfg *config.Config)) *testEnv {
+	t.Helper()
+
+	env := &testEnv{
+		qdrant: qdranttest.NewServer(t),
+		ollama: ollamatest.NewServer(t, testDimension),
+		source: newFakeSource(),
+	}
+
+	cfg := newTestConfig(t)
+	cfg.Ollama.BaseURL = env.ollama.URL
+	if configure != nil {
+		configure(cfg)
+	}
+
+	repo, err := repository.NewVectorRepository(cfg, env.qdrant.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restClient := resty.New()
+	t.Cleanup(func() { restClient.Close() })
+
+	env.service, err = NewRAGService(cfg, repo, restClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.service.sources[pokemonDBSource] = env.source
+
+	return env
+}
+
+// ingest runs a pokemondb ingest of the named Pokemon, which must have been
+// added to the fake source
+func (env *testEnv) ingest(t *testing.T, names ...string) {
+	t.Helper()
+
+	if _, err := env.service.IngestPokemonData(context.Background(), &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   env.source.urls(names...),
+	}); err != nil {
+		t.Fatalf("ingest failed: %v", err)
+	}
+}
+
+// chat sends a single question and fails the test on error
+func (env *testEnv) chat(t *testing.T, question string) *ChatResponse {
+	t.Helper()
+
+	resp, err := env.service.Chat(context.Background(), &ChatRequest{Message: question})
+	if err != nil {
+		t.Fatalf("chat failed: %v", err)
+	}
+	return resp
+}
+
+// fakeSource is an in-memory PokemonSource. Detail URLs are
+// https://pokemondb.net/pokedex/<key>, listed in the order Pokemon were added.
+type fakeSource struct {
+	mu        sync.Mutex
+	order     []string
+	pokemon   map[string]*crawler.PokemonData // Keyed by URL
+	crawled   []string
+	refreshes int
+
+	// detail, if set, runs before each detail crawl; a non-nil error fails it
+	detail func(ctx context.Context, url string) error
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{pokemon: make(map[string]*crawler.PokemonData)}
+}
+
+// add registers Pokemon, returning the source for chaining
+func (fs *fakeSource) add(pokemon ...*crawler.PokemonData) *fakeSource {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for _, p := range pokemon {
+		url := pokemonURL(p.Name)
+		if _, ok := fs.pokemon[url]; !ok {
+			fs.order = append(fs.order, url)
+		}
+		fs.pokemon[url] = p
+	}
+	return fs
+}
+
+// urls returns the detail URLs of the named Pokemon
+func (fs *fakeSource) urls(names ...string) []string {
+	urls := make([]string, len(names))
+	for i, name := range names {
+		urls[i] = pokemonURL(name)
+	}
+	return urls
+}
+
+// crawledURLs returns the detail URLs crawled so far, in order
+func (fs *fakeSource) crawledURLs() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return append([]string(nil), fs.crawled...)
+}
+
+func (fs *fakeSource) CrawlPokemonList(_ context.Context, limit int) ([]string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return append([]string(nil), fs.order[:min(limit, len(fs.order))]...), nil
+}
+
+func (fs *fakeSource) RefreshPokemonList() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.refreshes++
+}
+
+func (fs *fakeSource) CrawlPokemonDetails(ctx context.Context, url string) (*crawler.PokemonData, error) {
+	if fs.detail != nil {
+		if err := fs.detail(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.crawled = append(fs.crawled, url)
+	p, ok := fs.pokemon[url]
+	if !ok {
+		return nil, fmt.Errorf("no Pokemon at %s", url)
+	}
+	copied := *p
+	return &copied, nil
+}
+
+func pokemonURL(name string) string {
+	return "https://pokemondb.net/pokedex/" + strings.ToLower(name)
+}
+
+// testPokemon returns crawled data for a Pokemon with plausible stats
+func testPokemon(name, number string, types ...string) *crawler.PokemonData {
+	return &crawler.PokemonData{
+		Name:        name,
+		Number:      number,
+		Types:       types,
+		Stats:       map[string]int{"HP": 45, "Attack": 49, "Defense": 49, "SpAttack": 65, "SpDefense": 65, "Speed": 45},
+		Abilities:   []string{"Overgrow"},
+		Description: name + " is a " + strings.Join(types, "/") + " type Pokemon.",
+		Category:    "Seed Pokemon",
+		Generation:  1,
+	}
+}
+
+// Starter Pokemon shared by tests
+var (
+	bulbasaur  = testPokemon("Bulbasaur", "0001", "Grass", "Poison")
+	charmander = testPokemon("Charmander", "0004", "Fire")
+	squirtle   = testPokemon("Squirtle", "0007", "Water")
+	pikachu    = testPokemon("Pikachu", "0025", "Electric")
+)
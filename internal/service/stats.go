@@ -0,0 +1,86 @@
+package service
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// serviceStats counts chats and ingests since startup. All fields are
+// updated atomically so handlers can record from any goroutine.
+type serviceStats struct {
+	startedAt time.Time
+
+	chats          atomic.Int64
+	chatLatencyNs  atomic.Int64 // Summed over all chats, for the average
+	cacheHits      atomic.Int64
+	cacheMisses    atomic.Int64
+	ingests        atomic.Int64
+	ingestFailures atomic.Int64
+}
+
+func newServiceStats(now time.Time) *serviceStats {
+	return &serviceStats{startedAt: now}
+}
+
+// recordChat counts one answered chat and how long it took
+func (st *serviceStats) recordChat(latency time.Duration) {
+	st.chats.Add(1)
+	st.chatLatencyNs.Add(int64(latency))
+}
+
+// recordCacheLookup counts an answer cache lookup as a hit or a miss
+func (st *serviceStats) recordCacheLookup(hit bool) {
+	if hit {
+		st.cacheHits.Add(1)
+	} else {
+		st.cacheMisses.Add(1)
+	}
+}
+
+// recordIngest counts a finished ingest job
+func (st *serviceStats) recordIngest(err error) {
+	st.ingests.Add(1)
+	if err != nil {
+		st.ingestFailures.Add(1)
+	}
+}
+
+// StatsSnapshot is a point-in-time view of the service counters
+type StatsSnapshot struct {
+	StartedAt        time.Time `json:"started_at"`
+	UptimeSeconds    int64     `json:"uptime_seconds"`
+	Chats            int64     `json:"chats"`
+	AvgChatLatencyMs float64   `json:"avg_chat_latency_ms"`
+	CacheHits        int64     `json:"cache_hits"`
+	CacheMisses      int64     `json:"cache_misses"`
+	CacheHitRate     float64   `json:"cache_hit_rate"` // Hits over cacheable lookups (0 before the first lookup)
+	Ingests          int64     `json:"ingests"`
+	IngestFailures   int64     `json:"ingest_failures"`
+}
+
+func (st *serviceStats) snapshot(now time.Time) StatsSnapshot {
+	snap := StatsSnapshot{
+		StartedAt:      st.startedAt,
+		UptimeSeconds:  int64(now.Sub(st.startedAt).Seconds()),
+		Chats:          st.chats.Load(),
+		CacheHits:      st.cacheHits.Load(),
+		CacheMisses:    st.cacheMisses.Load(),
+		Ingests:        st.ingests.Load(),
+		IngestFailures: st.ingestFailures.Load(),
+	}
+
+	if snap.Chats > 0 {
+		avg := time.Duration(st.chatLatencyNs.Load() / snap.Chats)
+		snap.AvgChatLatencyMs = float64(avg.Microseconds()) / 1000
+	}
+	if lookups := snap.CacheHits + snap.CacheMisses; lookups > 0 {
+		snap.CacheHitRate = float64(snap.CacheHits) / float64(lookups)
+	}
+
+	return snap
+}
+
+// Stats returns the chat, cache and ingest counters since startup
+func (s *RAGService) Stats() StatsSnapshot {
+	return s.stats.snapshot(s.now())
+}
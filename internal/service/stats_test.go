@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/katatrina/poke-bot/internal/config"
+)
+
+func TestStatsSnapshotAveragesAndRates(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stats := newServiceStats(start)
+
+	if snap := stats.snapshot(start); snap.AvgChatLatencyMs != 0 || snap.CacheHitRate != 0 {
+		t.Errorf("empty snapshot = %+v, want zero average and hit rate", snap)
+	}
+
+	stats.recordChat(10 * time.Millisecond)
+	stats.recordChat(30 * time.Millisecond)
+	stats.recordCacheLookup(true)
+	stats.recordCacheLookup(false)
+	stats.recordCacheLookup(false)
+	stats.recordCacheLookup(true)
+	stats.recordIngest(nil)
+	stats.recordIngest(context.Canceled)
+
+	want := StatsSnapshot{
+		StartedAt:        start,
+		UptimeSeconds:    90,
+		Chats:            2,
+		AvgChatLatencyMs: 20,
+		CacheHits:        2,
+		CacheMisses:      2,
+		CacheHitRate:     0.5,
+		Ingests:          2,
+		IngestFailures:   1,
+	}
+	if snap := stats.snapshot(start.Add(90 * time.Second)); snap != want {
+		t.Errorf("snapshot = %+v, want %+v", snap, want)
+	}
+}
+
+func TestStatsCountChatsCacheLookupsAndIngests(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.AnswerCache.Enabled = true
+	})
+	env.source.add(pikachu)
+
+	if _, _, err := env.service.RunIngestJob(context.Background(), "", &IngestRequest{
+		Source: pokemonDBSource,
+		URLs:   env.source.urls("Pikachu"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := env.service.RunIngestJob(context.Background(), "", &IngestRequest{
+		Source:     pokemonDBSource,
+		CrawlLimit: 1,
+		StartFrom:  10, // Past the end of the list
+	}); !errors.Is(err, ErrNothingToIngest) {
+		t.Fatalf("ingest error = %v, want %v", err, ErrNothingToIngest)
+	}
+
+	// The repeated question is answered from the cache
+	env.chat(t, "What type is Pikachu?")
+	env.chat(t, "What type is Pikachu?")
+	if _, err := env.service.Chat(context.Background(), &ChatRequest{Message: "What type is Pikachu?", TopK: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	snap := env.service.Stats()
+	if snap.Chats != 3 {
+		t.Errorf("chats = %d, want 3", snap.Chats)
+	}
+	// The top_k chat isn't cacheable, so it counts as neither a hit nor a miss
+	if snap.CacheHits != 1 || snap.CacheMisses != 1 || snap.CacheHitRate != 0.5 {
+		t.Errorf("cache hits = %d, misses = %d, rate = %v, want 1, 1 and 0.5", snap.CacheHits, snap.CacheMisses, snap.CacheHitRate)
+	}
+	if snap.Ingests != 2 || snap.IngestFailures != 1 {
+		t.Errorf("ingests = %d, failures = %d, want 2 and 1", snap.Ingests, snap.IngestFailures)
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/katatrina/poke-bot/internal/types"
+)
+
+const (
+	chatFormatJSON = "json"
+
+	structuredFormatSchema = "schema"
+	structuredFormatJSON   = "json"
+)
+
+// StructuredAnswer is the answer to a chat sent with format "json"
+type StructuredAnswer struct {
+	Pokemon  string         `json:"pokemon"`   // Main Pokemon the answer is about, empty for general questions
+	Types    []string       `json:"types"`     // That Pokemon's types
+	KeyStats map[string]int `json:"key_stats"` // Stats relevant to the question, e.g. {"Speed": 100}
+	Summary  string         `json:"summary"`   // The answer in prose
+}
+
+// structuredAnswerSchema is sent to Ollama as the format of a structured answer
+var structuredAnswerSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"pokemon":   map[string]any{"type": "string"},
+		"types":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		"key_stats": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "integer"}},
+		"summary":   map[string]any{"type": "string"},
+	},
+	"required": []string{"pokemon", "types", "key_stats", "summary"},
+}
+
+// structuredInstruction replaces the markdown/plain style instruction when a
+// structured answer is requested
+const structuredInstruction = `- Respond with only a JSON object of the form {"pokemon": string, "types": [string], "key_stats": {stat name: integer}, "summary": string}. Use "pokemon": "" and empty types/key_stats when the question isn't about one Pokemon. Put the full answer in "summary" as plain sentences.
+`
+
+// ollamaFormat returns the value of Ollama's "format" field for a structured
+// answer: the JSON schema (Ollama 0.5+), or plain JSON mode when
+// cfg.RAG.StructuredFormat is "json"
+func (s *RAGService) ollamaFormat() any {
+	if strings.EqualFold(strings.TrimSpace(s.config.RAG.StructuredFormat), structuredFormatJSON) {
+		return structuredFormatJSON
+	}
+	return structuredAnswerSchema // Default fallback
+}
+
+// parseStructuredAnswer decodes and validates a structured answer. Unknown
+// keys are ignored, but a missing summary, an unknown type or a negative
+// stat is an error.
+func parseStructuredAnswer(text string) (*StructuredAnswer, error) {
+	text = strings.TrimSpace(text)
+
+	// Some models wrap JSON in a markdown code fence despite the format option
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimPrefix(text, "```")
+	text = strings.TrimSuffix(text, "```")
+
+	var answer StructuredAnswer
+	if err := json.Unmarshal([]byte(text), &answer); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	answer.Pokemon = strings.TrimSpace(answer.Pokemon)
+	answer.Summary = strings.TrimSpace(answer.Summary)
+	if answer.Summary == "" {
+		return nil, errors.New("summary is empty")
+	}
+
+	for _, t := range answer.Types {
+		if _, ok := types.StyleFor(t); !ok {
+			return nil, fmt.Errorf("unknown type %q", t)
+		}
+	}
+	for stat, value := range answer.KeyStats {
+		if value < 0 {
+			return nil, fmt.Errorf("negative value %d for stat %q", value, stat)
+		}
+	}
+
+	if answer.Types == nil {
+		answer.Types = []string{}
+	}
+	if answer.KeyStats == nil {
+		answer.KeyStats = map[string]int{}
+	}
+
+	return &answer, nil
+}
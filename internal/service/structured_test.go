@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+	"github.com/katatrina/poke-bot/internal/ollamatest"
+)
+
+func TestParseStructuredAnswer(t *testing.T) {
+	valid := `{"pokemon": "Pikachu", "types": ["Electric"], "key_stats": {"Speed": 90}, "summary": "Pikachu is an Electric type.", "extra": true}`
+
+	tests := []struct {
+		name    string
+		text    string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"fenced", "```json\n" + valid + "\n```", false},
+		{"not json", "Pikachu is an Electric type.", true},
+		{"empty summary", `{"pokemon": "Pikachu", "types": [], "key_stats": {}, "summary": " "}`, true},
+		{"unknown type", `{"pokemon": "Pikachu", "types": ["Lightning"], "key_stats": {}, "summary": "ok"}`, true},
+		{"negative stat", `{"pokemon": "Pikachu", "types": [], "key_stats": {"Speed": -1}, "summary": "ok"}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, err := parseStructuredAnswer(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want := &StructuredAnswer{
+				Pokemon:  "Pikachu",
+				Types:    []string{"Electric"},
+				KeyStats: map[string]int{"Speed": 90},
+				Summary:  "Pikachu is an Electric type.",
+			}
+			if !reflect.DeepEqual(answer, want) {
+				t.Errorf("answer = %+v, want %+v", answer, want)
+			}
+		})
+	}
+}
+
+func TestChatFormatJSON(t *testing.T) {
+	const valid = `{"pokemon": "Pikachu", "types": ["Electric"], "key_stats": {}, "summary": "Pikachu is an Electric type."}`
+
+	tests := []struct {
+		name           string
+		output         string
+		wantStructured bool
+		wantResponse   string
+	}{
+		{"valid output", valid, true, "Pikachu is an Electric type."},
+		{"invalid output falls back to prose", "Pikachu is Electric, I think.", false, "Pikachu is Electric, I think."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.RAG.ResponseFormat = responseFormatPlain
+			})
+			env.ollama.SetGenerate(func(ollamatest.GenerateRequest) string { return tt.output })
+			env.source.add(pikachu)
+			env.ingest(t, "Pikachu")
+
+			req := &ChatRequest{Message: "What type is Pikachu?", Format: chatFormatJSON}
+			if err := req.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := env.service.Chat(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (resp.Structured != nil) != tt.wantStructured || resp.StructuredFailed == tt.wantStructured {
+				t.Errorf("structured = %+v, structured_failed = %v, want structured %v", resp.Structured, resp.StructuredFailed, tt.wantStructured)
+			}
+			if resp.Response != tt.wantResponse {
+				t.Errorf("response = %q, want %q", resp.Response, tt.wantResponse)
+			}
+
+			// The model is constrained to the schema and told to answer in JSON
+			generates := env.ollama.GenerateRequests()
+			last := generates[len(generates)-1]
+			if _, ok := last.Format.(map[string]any); !ok {
+				t.Errorf("format = %v, want the answer schema", last.Format)
+			}
+			if !strings.Contains(last.Prompt, strings.TrimSpace(structuredInstruction)) {
+				t.Error("prompt lacks the structured answer instruction")
+			}
+		})
+	}
+}
+
+func TestChatRequestRejectsUnknownFormat(t *testing.T) {
+	req := &ChatRequest{Message: "What type is Pikachu?", Format: "xml"}
+	if err := req.Validate(); err == nil {
+		t.Error("expected an unknown format to be rejected")
+	}
+}
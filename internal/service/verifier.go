@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/katatrina/poke-bot/internal/model"
+)
+
+const (
+	verifyOff    = "off"
+	verifyFlag   = "flag"
+	verifyCaveat = "caveat"
+)
+
+// statNames matches the base stat labels the model is likely to cite. A bare
+// "total" is left out since "a total of 3 evolutions" isn't a stat claim.
+const statNames = `(?:base stat total|stat total|bst|special attack|special defen[cs]e|sp\.?\s?atk|sp\.?\s?def|hp|attack|defen[cs]e|speed)`
+
+var (
+	// "Attack: 130", "**Speed** is 100", "HP of 78"
+	statThenValuePattern = regexp.MustCompile(`(?i)\b(` + statNames + `)\b[\s*:=\-]*(?:(?:is|of|at|stat|base)\s+)*\**\s*(\d{1,3})\b`)
+	// "130 Attack", "100 base Speed"
+	valueThenStatPattern = regexp.MustCompile(`(?i)\b(\d{1,3})\s+(?:base\s+)?(` + statNames + `)\b`)
+
+	numberPattern = regexp.MustCompile(`\d+`)
+)
+
+// statClaim is a stat value the answer asserts, e.g. Attack 130
+type statClaim struct {
+	stat  string
+	value string
+}
+
+func (c statClaim) String() string {
+	return c.stat + " " + c.value
+}
+
+// extractStatClaims finds numbers stated right next to a base stat name.
+// Numbers anywhere else (generations, counts, levels) are ignored.
+func extractStatClaims(answer string) []statClaim {
+	var claims []statClaim
+	seen := make(map[statClaim]bool)
+
+	add := func(stat, value string) {
+		claim := statClaim{stat: strings.TrimSpace(stat), value: value}
+		if !seen[claim] {
+			seen[claim] = true
+			claims = append(claims, claim)
+		}
+	}
+
+	for _, m := range statThenValuePattern.FindAllStringSubmatch(answer, -1) {
+		add(m[1], m[2])
+	}
+	for _, m := range valueThenStatPattern.FindAllStringSubmatch(answer, -1) {
+		add(m[2], m[1])
+	}
+
+	return claims
+}
+
+// ungroundedStats returns the stat claims in answer whose value appears
+// nowhere in the retrieved context. Only the number is checked, not which
+// stat it belongs to, which keeps false positives low at the cost of missing
+// a value quoted under the wrong stat.
+func ungroundedStats(answer string, searchResults []model.SearchResult) []string {
+	claims := extractStatClaims(answer)
+	if len(claims) == 0 {
+		return nil
+	}
+
+	grounded := make(map[string]bool)
+	for _, result := range searchResults {
+		for _, n := range numberPattern.FindAllString(result.Content, -1) {
+			grounded[strings.TrimLeft(n, "0")] = true
+		}
+	}
+
+	var ungrounded []string
+	for _, claim := range claims {
+		if !grounded[strings.TrimLeft(claim.value, "0")] {
+			ungrounded = append(ungrounded, claim.String())
+		}
+	}
+
+	return ungrounded
+}
+
+// verifyMode returns cfg.RAG.VerifyStats, defaulting to off
+func (s *RAGService) verifyMode() string {
+	switch mode := strings.ToLower(strings.TrimSpace(s.config.RAG.VerifyStats)); mode {
+	case verifyFlag, verifyCaveat:
+		return mode
+	default:
+		return verifyOff // Default fallback
+	}
+}
+
+// statCaveat is appended to answers citing stats missing from the context
+func statCaveat(ungrounded []string) string {
+	return fmt.Sprintf("\n\nNote: some numbers in this answer (%s) couldn't be verified against the Pokedex data and may be inaccurate.", strings.Join(ungrounded, ", "))
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/katatrina/poke-bot/internal/config"
+	"github.com/katatrina/poke-bot/internal/model"
+	"github.com/katatrina/poke-bot/internal/ollamatest"
+)
+
+func TestExtractStatClaims(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   []string
+	}{
+		{"Charizard has Attack: 84 and **Speed** is 100.", []string{"Attack 84", "Speed 100"}},
+		{"It boasts 130 base Sp. Atk and an HP of 78.", []string{"HP 78", "Sp. Atk 130"}},
+		// Incidental numbers aren't stat claims
+		{"Introduced in Generation 1, it evolves at level 36 and has a total of 3 forms.", nil},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, claim := range extractStatClaims(tt.answer) {
+			got = append(got, claim.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("extractStatClaims(%q) = %q, want %q", tt.answer, got, tt.want)
+		}
+	}
+}
+
+func TestUngroundedStats(t *testing.T) {
+	results := []model.SearchResult{
+		{Content: "Base stats: HP 078, Attack 84, Speed 100"},
+	}
+
+	got := ungroundedStats("HP 78, Attack 84 and Speed 120", results)
+	if want := []string{"Speed 120"}; !slices.Equal(got, want) {
+		t.Errorf("ungrounded = %q, want %q", got, want)
+	}
+
+	if got := ungroundedStats("It has no stat claims at all.", results); got != nil {
+		t.Errorf("ungrounded = %q, want none", got)
+	}
+}
+
+func TestChatFlagsUngroundedStats(t *testing.T) {
+	const answer = "Bulbasaur has an Attack of 49 and Speed: 130."
+
+	tests := []struct {
+		mode        string
+		wantFlagged []string
+		wantCaveat  bool
+	}{
+		{"", nil, false},
+		{verifyFlag, []string{"Speed 130"}, false},
+		{verifyCaveat, []string{"Speed 130"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run("verify_stats="+tt.mode, func(t *testing.T) {
+			env := newTestEnv(t, func(cfg *config.Config) {
+				cfg.RAG.VerifyStats = tt.mode
+			})
+			env.ollama.SetGenerate(func(ollamatest.GenerateRequest) string { return answer })
+			env.source.add(bulbasaur)
+			env.ingest(t, "Bulbasaur")
+
+			resp := env.chat(t, "What are Bulbasaur's Attack and Speed?")
+
+			// Attack 49 is in Bulbasaur's stats; Speed 130 is invented
+			if !slices.Equal(resp.UngroundedStats, tt.wantFlagged) {
+				t.Errorf("ungrounded stats = %q, want %q", resp.UngroundedStats, tt.wantFlagged)
+			}
+			if hasCaveat := strings.Contains(resp.Response, "couldn't be verified"); hasCaveat != tt.wantCaveat {
+				t.Errorf("response = %q, caveat appended = %v, want %v", resp.Response, hasCaveat, tt.wantCaveat)
+			}
+			if !strings.HasPrefix(resp.Response, answer) {
+				t.Errorf("response = %q, want the answer kept", resp.Response)
+			}
+		})
+	}
+}
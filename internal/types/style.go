@@ -0,0 +1,36 @@
+package types
+
+import "strings"
+
+// Style is how the UI themes a Pokemon type badge
+type Style struct {
+	Color string `json:"color"` // Hex, e.g. "#EE8130"
+	Emoji string `json:"emoji"`
+}
+
+var styles = map[string]Style{
+	"normal":   {Color: "#A8A77A", Emoji: "⚪"},
+	"fire":     {Color: "#EE8130", Emoji: "🔥"},
+	"water":    {Color: "#6390F0", Emoji: "💧"},
+	"electric": {Color: "#F7D02C", Emoji: "⚡"},
+	"grass":    {Color: "#7AC74C", Emoji: "🌿"},
+	"ice":      {Color: "#96D9D6", Emoji: "❄️"},
+	"fighting": {Color: "#C22E28", Emoji: "🥊"},
+	"poison":   {Color: "#A33EA1", Emoji: "☠️"},
+	"ground":   {Color: "#E2BF65", Emoji: "⛰️"},
+	"flying":   {Color: "#A98FF3", Emoji: "🕊️"},
+	"psychic":  {Color: "#F95587", Emoji: "🔮"},
+	"bug":      {Color: "#A6B91A", Emoji: "🐛"},
+	"rock":     {Color: "#B6A136", Emoji: "🪨"},
+	"ghost":    {Color: "#735797", Emoji: "👻"},
+	"dragon":   {Color: "#6F35FC", Emoji: "🐉"},
+	"dark":     {Color: "#705746", Emoji: "🌑"},
+	"steel":    {Color: "#B7B7CE", Emoji: "⚙️"},
+	"fairy":    {Color: "#D685AD", Emoji: "✨"},
+}
+
+// StyleFor returns the canonical style of a type (case-insensitive)
+func StyleFor(pokemonType string) (Style, bool) {
+	style, ok := styles[strings.ToLower(strings.TrimSpace(pokemonType))]
+	return style, ok
+}
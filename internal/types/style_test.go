@@ -0,0 +1,35 @@
+package types
+
+import "testing"
+
+func TestStyleFor(t *testing.T) {
+	tests := []struct {
+		pokemonType string
+		want        Style
+		wantOK      bool
+	}{
+		{"Fire", Style{Color: "#EE8130", Emoji: "🔥"}, true},
+		{" grass ", Style{Color: "#7AC74C", Emoji: "🌿"}, true},
+		{"ELECTRIC", Style{Color: "#F7D02C", Emoji: "⚡"}, true},
+		{"Stellar", Style{}, false},
+		{"", Style{}, false},
+	}
+
+	for _, tt := range tests {
+		style, ok := StyleFor(tt.pokemonType)
+		if style != tt.want || ok != tt.wantOK {
+			t.Errorf("StyleFor(%q) = %+v, %v, want %+v, %v", tt.pokemonType, style, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestEveryTypeHasAStyle(t *testing.T) {
+	if len(styles) != 18 {
+		t.Errorf("styles cover %d types, want all 18", len(styles))
+	}
+	for pokemonType, style := range styles {
+		if len(style.Color) != 7 || style.Color[0] != '#' || style.Emoji == "" {
+			t.Errorf("style for %s = %+v, want a hex color and an emoji", pokemonType, style)
+		}
+	}
+}
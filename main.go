@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/katatrina/poke-bot/internal/config"
 	"github.com/katatrina/poke-bot/internal/handler"
@@ -34,14 +38,55 @@ func main() {
 	restyClient := resty.New()
 	defer restyClient.Close()
 
-	ragService := service.NewRAGService(cfg, vectorRepo, restyClient)
+	ragService, err := service.NewRAGService(cfg, vectorRepo, restyClient)
+	if err != nil {
+		log.Fatalf("failed to create RAG service: %v", err)
+	}
+
+	checkCtx, cancelCheck := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := ragService.CheckOllamaOnStartup(checkCtx); err != nil {
+		log.Fatal(err)
+	}
+	cancelCheck()
 
 	hdl := handler.NewHTTPHandler(ragService)
 
 	srv := server.NewServer(cfg, hdl)
 	srv.SetupRoutes()
 
-	if err = srv.Start(); err != nil {
-		log.Fatalf("failed to start HTTP server: %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.Start()
+	}()
+
+	select {
+	case err = <-serverErr:
+		if err != nil {
+			log.Fatalf("failed to start HTTP server: %v", err)
+		}
+		return
+	case <-ctx.Done():
+	}
+
+	gracePeriod := time.Duration(cfg.Server.ShutdownGracePeriod) * time.Second
+	if gracePeriod <= 0 {
+		gracePeriod = 30 * time.Second
+	}
+
+	log.Printf("Shutting down, waiting up to %s for in-flight work", gracePeriod)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	// Stop ingestion first so its handlers can return before the server drains
+	if err = ragService.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to stop ingestion cleanly: %v", err)
+	}
+
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to shut down HTTP server cleanly: %v", err)
 	}
 }
@@ -27,12 +27,13 @@ class ApiService {
         }
     }
 
-    async ingestPokemon(source: string = 'pokemondb', crawlLimit: number = 10): Promise<void> {
+    async ingestPokemon(adminApiKey: string, source: string = 'pokemondb', crawlLimit: number = 10): Promise<void> {
         try {
             const response = await fetch(`${API_BASE_URL}/ingest`, {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
+                    'X-API-Key': adminApiKey,
                 },
                 body: JSON.stringify({
                     source,